@@ -9,6 +9,7 @@ import (
 
 	"sagiri-guard/agent/internal/config"
 	"sagiri-guard/agent/internal/db"
+	"sagiri-guard/agent/internal/identity"
 	"sagiri-guard/agent/internal/logger"
 	"sagiri-guard/agent/internal/osquery"
 	"sagiri-guard/agent/internal/protocolclient"
@@ -19,19 +20,25 @@ import (
 )
 
 type Credentials struct {
-	Username  string `json:"username"`
-	Password  string `json:"password"`
+	Username  string `json:"username,omitempty"`
+	Password  string `json:"password,omitempty"`
 	DeviceID  string `json:"device_id"`
 	Name      string `json:"name,omitempty"`
 	OSName    string `json:"os_name,omitempty"`
 	OSVersion string `json:"os_version,omitempty"`
 	Hostname  string `json:"hostname,omitempty"`
 	Arch      string `json:"arch,omitempty"`
+	// Credential của device gắn vào lần enroll này (xem package identity)
+	PublicKey   string `json:"public_key,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Mã enrollment do admin cấp, thay cho username/password (action enroll)
+	EnrollToken string `json:"enroll_token,omitempty"`
 }
 
 type TokenResponse struct {
-	AccessToken string `json:"token"`
-	DeviceID    string `json:"device_id"`
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	DeviceID     string `json:"device_id"`
 }
 
 func deviceIDFilePath() string {
@@ -64,7 +71,31 @@ func saveDeviceID(id string) {
 
 // Login performs protocol login to backend and stores token to file.
 func Login(host string, port int, username, password string) (string, string, error) {
-	creds := Credentials{Username: username, Password: password}
+	creds, err := deviceCredentials()
+	if err != nil {
+		return "", "", err
+	}
+	creds.Username, creds.Password = username, password
+	return exchange(host, port, "login", creds)
+}
+
+// Enroll đổi enrollment token do admin cấp lấy token device (cài đặt không
+// cần người dùng nhập tài khoản), sau đó lưu token như Login.
+func Enroll(host string, port int, enrollToken string) (string, string, error) {
+	if enrollToken == "" {
+		return "", "", errors.New("missing enrollment token")
+	}
+	creds, err := deviceCredentials()
+	if err != nil {
+		return "", "", err
+	}
+	creds.EnrollToken = enrollToken
+	return exchange(host, port, "enroll", creds)
+}
+
+// deviceCredentials thu thập thông tin máy và credential của device gửi kèm login/enroll.
+func deviceCredentials() (Credentials, error) {
+	var creds Credentials
 	// collect device info via osquery
 	cachedID := loadDeviceIDFromDisk()
 	if si, osv, err := osquery.Collect(); err == nil {
@@ -91,16 +122,30 @@ func Login(host string, port int, username, password string) (string, string, er
 		}
 	}
 
-	msg, err := protocolclient.SendAction(host, port, creds.DeviceID, "", "login", creds)
+	pub, err := identity.PublicKey()
+	if err != nil {
+		return creds, err
+	}
+	fp, err := identity.Fingerprint()
+	if err != nil {
+		return creds, err
+	}
+	creds.PublicKey, creds.Fingerprint = pub, fp
+	return creds, nil
+}
+
+// exchange gửi action (login/enroll) và lưu token backend trả về.
+func exchange(host string, port int, action string, creds Credentials) (string, string, error) {
+	msg, err := protocolclient.SendAction(host, port, creds.DeviceID, "", action, creds)
 	if err != nil {
 		return "", "", err
 	}
 	if msg.Type != network.MsgAck || msg.StatusCode != 200 {
-		return "", "", fmt.Errorf("login failed: code=%d msg=%s", msg.StatusCode, msg.StatusMsg)
+		return "", "", fmt.Errorf("%s failed: code=%d msg=%s", action, msg.StatusCode, msg.StatusMsg)
 	}
 	var tr TokenResponse
 	if err := json.Unmarshal([]byte(msg.StatusMsg), &tr); err != nil || tr.AccessToken == "" {
-		return "", "", errors.New("invalid login response")
+		return "", "", fmt.Errorf("invalid %s response", action)
 	}
 	// persist token to SQLite
 	if adb := db.Get(); adb != nil {
@@ -109,6 +154,9 @@ func Login(host string, port int, username, password string) (string, string, er
 	if err := saveToken(tr.AccessToken); err != nil {
 		return "", "", err
 	}
+	if err := saveRefreshToken(tr.RefreshToken); err != nil {
+		return "", "", err
+	}
 	SetCurrentToken(tr.AccessToken)
 	saveDeviceID(creds.DeviceID)
 	if tr.DeviceID != "" {
@@ -118,7 +166,11 @@ func Login(host string, port int, username, password string) (string, string, er
 	} else {
 		state.SetDeviceID(creds.DeviceID)
 	}
-	logger.Info("Đăng nhập thành công, token đã được lưu")
+	if action == "enroll" {
+		logger.Info("Enroll thành công, token đã được lưu")
+	} else {
+		logger.Info("Đăng nhập thành công, token đã được lưu")
+	}
 	return tr.AccessToken, tr.DeviceID, nil
 }
 
@@ -139,10 +191,12 @@ func LoadToken() (string, error) {
 	return string(b), nil
 }
 
+// ClearToken xóa access token và refresh token đã lưu.
 func ClearToken() error {
-	path := config.TokenFilePath()
-	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
-		return err
+	for _, path := range []string{config.TokenFilePath(), refreshFilePath()} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
 	}
 	return nil
 }
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"sagiri-guard/agent/internal/config"
+	"sagiri-guard/agent/internal/db"
+	"sagiri-guard/agent/internal/logger"
+	"sagiri-guard/agent/internal/protocolclient"
+	"sagiri-guard/agent/internal/state"
+	"sagiri-guard/network"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoRefreshToken  = errors.New("no refresh token stored")
+	ErrRefreshRejected = errors.New("refresh token rejected, login required")
+)
+
+// refreshMu tuần tự hóa các lần refresh: backend thu hồi refresh token sau mỗi
+// lần dùng, gửi cùng một token hai lần bị coi là token bị đánh cắp.
+var refreshMu sync.Mutex
+
+func refreshFilePath() string {
+	dir := filepath.Dir(config.TokenFilePath())
+	return filepath.Join(dir, "refresh.token")
+}
+
+func saveRefreshToken(token string) error {
+	if token == "" {
+		// backend cũ không cấp refresh token
+		return nil
+	}
+	path := refreshFilePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("mkdir token dir: %w", err)
+	}
+	return os.WriteFile(path, []byte(token), 0o600)
+}
+
+func loadRefreshToken() string {
+	b, err := os.ReadFile(refreshFilePath())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// Refresh đổi refresh token đã lưu lấy cặp token mới và cập nhật token đang
+// dùng. Refresh token bị từ chối (hết hạn, bị thu hồi) thì bị xóa và trả về
+// ErrRefreshRejected: agent phải login/enroll lại.
+func Refresh(host string, port int, deviceID string) (string, error) {
+	refreshMu.Lock()
+	defer refreshMu.Unlock()
+	refresh := loadRefreshToken()
+	if refresh == "" {
+		return "", ErrNoRefreshToken
+	}
+	if deviceID == "" {
+		deviceID = loadDeviceIDFromDisk()
+	}
+	msg, err := protocolclient.SendAction(host, port, deviceID, "", "refresh", map[string]string{
+		"refresh_token": refresh,
+		"device_id":     deviceID,
+	})
+	if err != nil {
+		return "", err
+	}
+	if msg.Type != network.MsgAck || msg.StatusCode != 200 {
+		if msg.StatusCode == 401 {
+			_ = os.Remove(refreshFilePath())
+			return "", fmt.Errorf("%w: %s", ErrRefreshRejected, msg.StatusMsg)
+		}
+		return "", fmt.Errorf("refresh failed: code=%d msg=%s", msg.StatusCode, msg.StatusMsg)
+	}
+	var tr TokenResponse
+	if err := json.Unmarshal([]byte(msg.StatusMsg), &tr); err != nil || tr.AccessToken == "" {
+		return "", errors.New("invalid refresh response")
+	}
+	if adb := db.Get(); adb != nil {
+		_ = adb.Create(&db.Token{Value: tr.AccessToken}).Error
+	}
+	if err := saveToken(tr.AccessToken); err != nil {
+		return "", err
+	}
+	if err := saveRefreshToken(tr.RefreshToken); err != nil {
+		return "", err
+	}
+	SetCurrentToken(tr.AccessToken)
+	state.SetToken(tr.AccessToken)
+	logger.Info("Access token đã được refresh")
+	return tr.AccessToken, nil
+}
+
+// Logout thu hồi access token và refresh token trên backend rồi xóa token local.
+func Logout(host string, port int) error {
+	token, _ := LoadToken()
+	token = strings.TrimSpace(token)
+	deviceID := loadDeviceIDFromDisk()
+	var serverErr error
+	if token != "" && deviceID != "" {
+		msg, err := protocolclient.SendAction(host, port, deviceID, token, "logout", map[string]string{
+			"refresh_token": loadRefreshToken(),
+		})
+		switch {
+		case err != nil:
+			serverErr = err
+		case msg.StatusCode != 200 && msg.StatusCode != 401:
+			// 401: token đã hết hạn/bị thu hồi, không còn gì để thu hồi
+			serverErr = fmt.Errorf("logout failed: code=%d msg=%s", msg.StatusCode, msg.StatusMsg)
+		}
+	}
+	SetCurrentToken("")
+	state.SetToken("")
+	if err := ClearToken(); err != nil {
+		return err
+	}
+	return serverErr
+}
+
+// TokenExpiry đọc hạn dùng của JWT (không kiểm tra chữ ký); zero nếu không đọc được.
+func TokenExpiry(token string) time.Time {
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil || claims.ExpiresAt == nil {
+		return time.Time{}
+	}
+	return claims.ExpiresAt.Time
+}
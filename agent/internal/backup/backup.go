@@ -1,7 +1,10 @@
 package backup
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -24,6 +27,10 @@ type Session struct {
 	TCPPort   int    `json:"tcp_port"`
 	Direction string `json:"direction"`
 	Status    string `json:"status"`
+	DestPath  string `json:"dest_path,omitempty"` // download theo grant: đường dẫn đích admin đã duyệt
+
+	// AuthToken là access token dùng để login kết nối transfer (không gửi lên backend trong JSON).
+	AuthToken string `json:"-"`
 }
 
 type UploadInitRequest struct {
@@ -36,6 +43,7 @@ type UploadInitRequest struct {
 
 type DownloadInitRequest struct {
 	FileName string `json:"file_name"`
+	GrantID  uint   `json:"grant_id,omitempty"` // restore chéo máy do admin cấp quyền
 }
 
 func InitUpload(host string, port int, token string, filePath string, fileID string) (*Session, error) {
@@ -60,11 +68,12 @@ func InitUpload(host string, port int, token string, filePath string, fileID str
 	if err := json.Unmarshal([]byte(msg.StatusMsg), &session); err != nil {
 		return nil, fmt.Errorf("parse upload session response: %w | raw=%s", err, msg.StatusMsg)
 	}
+	session.AuthToken = token
 	return &session, nil
 }
 
-func InitDownload(host string, port int, token string, fileName string) (*Session, error) {
-	req := DownloadInitRequest{FileName: fileName}
+func InitDownload(host string, port int, token string, fileName string, grantID uint) (*Session, error) {
+	req := DownloadInitRequest{FileName: fileName, GrantID: grantID}
 	msg, err := protocolclient.SendAction(host, port, state.GetDeviceID(), token, "backup_init_download", req)
 	if err != nil {
 		return nil, err
@@ -76,6 +85,7 @@ func InitDownload(host string, port int, token string, fileName string) (*Sessio
 	if err := json.Unmarshal([]byte(msg.StatusMsg), &session); err != nil {
 		return nil, fmt.Errorf("parse download session response: %w | raw=%s", err, msg.StatusMsg)
 	}
+	session.AuthToken = token
 	return &session, nil
 }
 
@@ -92,13 +102,9 @@ func UploadFile(session *Session, filePath string) error {
 	}
 	defer client.Close()
 
-	// Set login on this transfer socket so backend knows device_id (registry + logging)
-	if devID := state.GetDeviceID(); devID != "" && session.Token != "" {
-		if err := client.SendLogin(devID, session.Token); err != nil {
-			global.Logger.Warn().Err(err).Msg("backup upload: send login failed (continue without device_id)")
-		} else {
-			global.Logger.Debug().Str("device", devID).Msg("backup upload: login sent on transfer socket")
-		}
+	// Backend chỉ nhận chunk trên kết nối đã login bằng access token và chứng minh danh tính
+	if err := protocolclient.Login(client, state.GetDeviceID(), session.AuthToken); err != nil {
+		return fmt.Errorf("login transfer connection: %w", err)
 	}
 
 	// send file meta
@@ -110,47 +116,80 @@ func UploadFile(session *Session, filePath string) error {
 	if err := client.SendFileMeta(session.FileName, uint64(session.FileSize)); err != nil {
 		return fmt.Errorf("send file meta: %w", err)
 	}
-	bufSize := int(session.ChunkSize)
+	offset, err := sendChunks(client, session.SessionID, session.Token, file, session.ChunkSize)
+	if err != nil {
+		return err
+	}
+	global.Logger.Info().
+		Str("session", session.SessionID).
+		Int64("bytes_sent", offset).
+		Msg("backup upload: sending file done")
+	if err := client.SendFileDoneWithSession(session.SessionID, session.Token); err != nil {
+		return fmt.Errorf("send file done: %w", err)
+	}
+	// Chỉ coi là đã backup khi backend xác nhận đã lưu version
+	if err := waitAck(client); err != nil {
+		return fmt.Errorf("finalize upload: %w", err)
+	}
+	global.Logger.Info().Msgf("Uploaded %s (%d bytes)", session.FileName, offset)
+	return nil
+}
+
+// waitAck chờ ACK kế tiếp trên kết nối transfer, bỏ qua các frame khác.
+func waitAck(client *network.TCPClient) error {
+	for {
+		msg, err := client.RecvProtocolMessage()
+		if err != nil {
+			return err
+		}
+		if msg.Type != network.MsgAck {
+			continue
+		}
+		if msg.StatusCode != 200 {
+			return fmt.Errorf("code=%d msg=%s", msg.StatusCode, msg.StatusMsg)
+		}
+		return nil
+	}
+}
+
+// errReadFile phân biệt lỗi đọc file nguồn với lỗi kết nối khi gửi chunk.
+var errReadFile = errors.New("read file")
+
+// sendChunks đọc r và gửi từng chunk với session/token; trả về tổng số byte đã gửi.
+func sendChunks(client *network.TCPClient, sessionID, token string, r io.Reader, chunkSize int64) (int64, error) {
+	bufSize := int(chunkSize)
 	if bufSize <= 0 {
 		bufSize = 512 * 1024
 	}
 	dataBuf := make([]byte, bufSize)
 
-	var offset uint32 = 0
+	// Offset trên wire chỉ có 32 bit; backend dựng lại offset đầy đủ từ số byte đã nhận
+	var offset int64 = 0
 	for {
-		n, err := file.Read(dataBuf)
+		n, err := r.Read(dataBuf)
 		if n > 0 {
+			uploadThrottle.wait(n)
 			global.Logger.Debug().
-				Str("session", session.SessionID).
-				Int64("file_size", session.FileSize).
-				Uint32("offset", offset).
+				Str("session", sessionID).
+				Int64("offset", offset).
 				Int("size", n).
 				Msg("backup upload: sending chunk")
-			if err := client.SendFileChunkWithSession(session.SessionID, session.Token, offset, dataBuf[:n]); err != nil {
+			if err := client.SendFileChunkWithSession(sessionID, token, uint32(offset), dataBuf[:n]); err != nil {
 				// retry once for transient errors
-				global.Logger.Warn().Err(err).Uint32("offset", offset).Int("size", n).Msg("backup upload: chunk send failed, retrying once")
-				if err := client.SendFileChunkWithSession(session.SessionID, session.Token, offset, dataBuf[:n]); err != nil {
-					return fmt.Errorf("send chunk offset=%d size=%d: %w", offset, n, err)
+				global.Logger.Warn().Err(err).Int64("offset", offset).Int("size", n).Msg("backup upload: chunk send failed, retrying once")
+				if err := client.SendFileChunkWithSession(sessionID, token, uint32(offset), dataBuf[:n]); err != nil {
+					return offset, fmt.Errorf("send chunk offset=%d size=%d: %w", offset, n, err)
 				}
 			}
-			offset += uint32(n)
+			offset += int64(n)
 		}
 		if err == io.EOF {
-			break
+			return offset, nil
 		}
 		if err != nil {
-			return fmt.Errorf("read file: %w", err)
+			return offset, fmt.Errorf("%w: %v", errReadFile, err)
 		}
 	}
-	global.Logger.Info().
-		Str("session", session.SessionID).
-		Uint32("bytes_sent", offset).
-		Msg("backup upload: sending file done")
-	if err := client.SendFileDoneWithSession(session.SessionID, session.Token); err != nil {
-		return fmt.Errorf("send file done: %w", err)
-	}
-	global.Logger.Info().Msgf("Uploaded %s (%d bytes)", session.FileName, offset)
-	return nil
 }
 
 // looksLikeJWT performs a light check to avoid sending non-JWT tokens via MsgLogin.
@@ -164,32 +203,74 @@ func looksLikeJWT(tok string) bool {
 	return dot >= 2
 }
 
+// DownloadFile tải file về destPath qua file tạm cùng thư mục rồi rename atomic,
+// nên bản cũ (nếu có) được giữ nguyên cho tới khi tải xong toàn bộ.
 func DownloadFile(session *Session, destPath string) error {
-	if dir := filepath.Dir(destPath); dir != "" && dir != "." {
+	tmpPath, _, err := downloadToTemp(session, filepath.Dir(destPath), filepath.Base(destPath))
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("rename into place: %w", err)
+	}
+	return nil
+}
+
+// downloadToTemp tải session vào một file tạm trong dir và trả về đường dẫn
+// file tạm cùng SHA-256 của nội dung đã nhận.
+func downloadToTemp(session *Session, dir, baseName string) (string, string, error) {
+	if dir != "" && dir != "." {
 		if err := os.MkdirAll(dir, 0o755); err != nil {
-			return fmt.Errorf("mkdir dest: %w", err)
+			return "", "", fmt.Errorf("mkdir dest: %w", err)
 		}
 	}
-	file, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY, 0o600)
+	file, err := os.CreateTemp(dir, restoreTempPrefix+baseName+".*")
 	if err != nil {
-		return fmt.Errorf("open dest: %w", err)
+		return "", "", fmt.Errorf("create temp file: %w", err)
 	}
-	defer file.Close()
+	tmpPath := file.Name()
+	hasher := sha256.New()
+	if err := receiveDownload(session, io.MultiWriter(file, hasher)); err != nil {
+		_ = file.Close()
+		_ = os.Remove(tmpPath)
+		return "", "", err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		_ = os.Remove(tmpPath)
+		return "", "", fmt.Errorf("sync temp file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", "", fmt.Errorf("close temp file: %w", err)
+	}
+	return tmpPath, hex.EncodeToString(hasher.Sum(nil)), nil
+}
 
+// receiveDownload mở kết nối transfer, gửi backup_download_start và ghi
+// toàn bộ chunk nhận được vào w.
+func receiveDownload(session *Session, w io.Writer) error {
 	client, err := network.DialTCP(session.TCPHost, session.TCPPort)
 	if err != nil {
 		return fmt.Errorf("dial backup server: %w", err)
 	}
 	defer client.Close()
 
-	// Start download by sending action backup_download_start with session_id/token
-	payload := map[string]interface{}{
-		"action":     "backup_download_start",
-		"session_id": session.SessionID,
-		"token":      session.Token,
-		"offset":     session.Offset,
+	if err := protocolclient.Login(client, state.GetDeviceID(), session.AuthToken); err != nil {
+		return fmt.Errorf("login transfer connection: %w", err)
+	}
+	body, err := json.Marshal(map[string]any{
+		"action": "backup_download_start",
+		"data": map[string]any{
+			"session_id": session.SessionID,
+			"token":      session.Token,
+			"offset":     session.Offset,
+		},
+	})
+	if err != nil {
+		return err
 	}
-	body, _ := json.Marshal(payload)
 	if err := client.SendCommand(body); err != nil {
 		return fmt.Errorf("send download start: %w", err)
 	}
@@ -202,18 +283,18 @@ func DownloadFile(session *Session, destPath string) error {
 		}
 		switch msg.Type {
 		case network.MsgFileMeta:
-			// seek to start
-			if _, err := file.Seek(0, io.SeekStart); err != nil {
-				return err
-			}
 			session.FileName = msg.FileName
 			session.FileSize = int64(msg.FileSize)
 		case network.MsgFileChunk:
-			if _, err := file.Write(msg.ChunkData); err != nil {
+			if _, err := w.Write(msg.ChunkData); err != nil {
 				return err
 			}
 			session.Offset += int64(len(msg.ChunkData))
 		case network.MsgFileDone:
+			// Không để file thiếu dữ liệu bị rename đè lên bản đang có
+			if session.Offset != session.FileSize {
+				return fmt.Errorf("incomplete download: got %d of %d bytes", session.Offset, session.FileSize)
+			}
 			global.Logger.Info().Msgf("Downloaded %s (%d bytes)", session.FileName, session.Offset)
 			return nil
 		case network.MsgAck, network.MsgError:
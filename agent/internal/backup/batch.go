@@ -0,0 +1,186 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sagiri-guard/agent/internal/protocolclient"
+	"sagiri-guard/agent/internal/state"
+	"sagiri-guard/backend/global"
+	"sagiri-guard/network"
+)
+
+// BatchFile là một file trong batch upload.
+type BatchFile struct {
+	Path   string
+	FileID string
+}
+
+type BatchInitRequest struct {
+	Files []UploadInitRequest `json:"files"`
+}
+
+// BatchSession: file thứ i dùng session "<BatchID>.<i>" với chung Token.
+type BatchSession struct {
+	BatchID   string `json:"batch_id"`
+	Token     string `json:"token"`
+	Count     int    `json:"count"`
+	ChunkSize int64  `json:"chunk_size"`
+	TCPHost   string `json:"tcp_host"`
+	TCPPort   int    `json:"tcp_port"`
+}
+
+// BatchResult là kết quả finalize; Incomplete/Failed là index theo manifest.
+type BatchResult struct {
+	BatchID    string `json:"batch_id"`
+	Stored     int    `json:"stored"`
+	Incomplete []int  `json:"incomplete,omitempty"`
+	Failed     []int  `json:"failed,omitempty"`
+}
+
+// UploadBatch upload nhiều file với một init, một kết nối transfer và một finalize.
+// Trả về các path đã được backend lưu thành version.
+func UploadBatch(host string, port int, token string, files []BatchFile) ([]string, error) {
+	// Bỏ các file không còn tồn tại trước khi gửi manifest để index khớp với backend
+	var (
+		accepted []BatchFile
+		req      BatchInitRequest
+	)
+	for _, f := range files {
+		info, err := os.Stat(f.Path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		accepted = append(accepted, f)
+		req.Files = append(req.Files, UploadInitRequest{
+			FileName:    filepath.Base(f.Path),
+			FileSize:    info.Size(),
+			LogicalPath: f.Path,
+			FileID:      f.FileID,
+		})
+	}
+	if len(accepted) == 0 {
+		return nil, nil
+	}
+
+	msg, err := protocolclient.SendAction(host, port, state.GetDeviceID(), token, "backup_batch_init", req)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != network.MsgAck || msg.StatusCode != 200 {
+		return nil, fmt.Errorf("init batch upload failed: code=%d msg=%s", msg.StatusCode, msg.StatusMsg)
+	}
+	var session BatchSession
+	if err := json.Unmarshal([]byte(msg.StatusMsg), &session); err != nil {
+		return nil, fmt.Errorf("parse batch session response: %w | raw=%s", err, msg.StatusMsg)
+	}
+	if session.Count != len(accepted) {
+		return nil, fmt.Errorf("batch size mismatch: sent %d, backend accepted %d", len(accepted), session.Count)
+	}
+
+	client, err := network.DialTCP(session.TCPHost, session.TCPPort)
+	if err != nil {
+		return nil, fmt.Errorf("dial backup server: %w", err)
+	}
+	defer client.Close()
+	if err := protocolclient.Login(client, state.GetDeviceID(), token); err != nil {
+		return nil, fmt.Errorf("login transfer connection: %w", err)
+	}
+
+	for i, f := range accepted {
+		if err := sendBatchFile(client, &session, i, f.Path, req.Files[i].FileSize); err != nil {
+			if errors.Is(err, errReadFile) || errors.Is(err, os.ErrNotExist) {
+				// File đổi/mất giữa chừng: không gửi done frame, backend sẽ báo incomplete
+				global.Logger.Warn().Err(err).Str("file", f.Path).Msg("backup batch: skip file")
+				continue
+			}
+			return nil, err
+		}
+	}
+
+	res, err := finalizeBatch(client, &session)
+	if err != nil {
+		return nil, err
+	}
+	skipped := make(map[int]struct{}, len(res.Incomplete)+len(res.Failed))
+	for _, i := range res.Incomplete {
+		skipped[i] = struct{}{}
+	}
+	for _, i := range res.Failed {
+		skipped[i] = struct{}{}
+	}
+	stored := make([]string, 0, res.Stored)
+	for i, f := range accepted {
+		if _, ok := skipped[i]; !ok {
+			stored = append(stored, f.Path)
+		}
+	}
+	global.Logger.Info().
+		Str("batch", res.BatchID).
+		Int("stored", res.Stored).
+		Int("incomplete", len(res.Incomplete)).
+		Int("failed", len(res.Failed)).
+		Msg("backup batch uploaded")
+	return stored, nil
+}
+
+func sendBatchFile(client *network.TCPClient, session *BatchSession, idx int, path string, size int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sessionID := fmt.Sprintf("%s.%d", session.BatchID, idx)
+	if err := client.SendFileMeta(filepath.Base(path), uint64(size)); err != nil {
+		return fmt.Errorf("send file meta: %w", err)
+	}
+	sent, err := sendChunks(client, sessionID, session.Token, file, session.ChunkSize)
+	if err != nil {
+		return err
+	}
+	if sent != size {
+		return fmt.Errorf("%w: %s changed size during upload", errReadFile, path)
+	}
+	if err := client.SendFileDoneWithSession(sessionID, session.Token); err != nil {
+		return fmt.Errorf("send file done: %w", err)
+	}
+	return nil
+}
+
+// finalizeBatch gửi backup_batch_finalize trên cùng kết nối transfer và chờ ACK.
+func finalizeBatch(client *network.TCPClient, session *BatchSession) (*BatchResult, error) {
+	body, err := json.Marshal(map[string]any{
+		"action": "backup_batch_finalize",
+		"data": map[string]string{
+			"batch_id": session.BatchID,
+			"token":    session.Token,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SendCommand(body); err != nil {
+		return nil, fmt.Errorf("send batch finalize: %w", err)
+	}
+	for {
+		msg, err := client.RecvProtocolMessage()
+		if err != nil {
+			return nil, err
+		}
+		if msg.Type != network.MsgAck {
+			continue
+		}
+		if msg.StatusCode != 200 {
+			return nil, fmt.Errorf("finalize batch failed: code=%d msg=%s", msg.StatusCode, msg.StatusMsg)
+		}
+		var res BatchResult
+		if err := json.Unmarshal([]byte(msg.StatusMsg), &res); err != nil {
+			return nil, fmt.Errorf("parse batch finalize response: %w | raw=%s", err, msg.StatusMsg)
+		}
+		return &res, nil
+	}
+}
@@ -0,0 +1,200 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RestoreMode quyết định cách xử lý khi file đích đã tồn tại.
+type RestoreMode string
+
+const (
+	RestoreOverwrite      RestoreMode = "overwrite"
+	RestoreKeepBoth       RestoreMode = "keep_both"
+	RestoreSkipIfSameHash RestoreMode = "skip_if_same_hash"
+	RestoreToStagingDir   RestoreMode = "restore_to_staging_dir"
+)
+
+// restoreTempPrefix đánh dấu file tạm khi restore để watcher bỏ qua.
+const restoreTempPrefix = ".sagiri-restore-"
+
+// ParseRestoreMode chuẩn hóa mode từ command; rỗng = overwrite.
+func ParseRestoreMode(raw string) (RestoreMode, error) {
+	switch m := RestoreMode(strings.ToLower(strings.TrimSpace(raw))); m {
+	case "":
+		return RestoreOverwrite, nil
+	case RestoreOverwrite, RestoreKeepBoth, RestoreSkipIfSameHash, RestoreToStagingDir:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown restore mode: %s", raw)
+	}
+}
+
+// IsRestoreTempFile cho biết path có phải file tạm do Restore tạo ra không.
+func IsRestoreTempFile(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), restoreTempPrefix)
+}
+
+// RestoreOptions cấu hình một lần restore.
+type RestoreOptions struct {
+	Mode          RestoreMode
+	StagingDir    string // thư mục đích cho mode restore_to_staging_dir
+	PreRestoreDir string // nơi giữ bản sao file bị ghi đè; rỗng = không giữ
+}
+
+// RestoreResult mô tả kết quả restore.
+type RestoreResult struct {
+	Path           string // đường dẫn file sau restore (hoặc file giữ nguyên nếu Skipped)
+	PreRestorePath string // bản sao của file bị thay thế, nếu có
+	Checksum       string // SHA-256 của nội dung đã tải
+	Skipped        bool
+}
+
+// Restore tải session về file tạm cạnh đích rồi áp dụng mode:
+// file hiện có chỉ bị thay thế bằng rename atomic sau khi tải xong,
+// và được sao lưu sang PreRestoreDir trước đó.
+func Restore(session *Session, destPath string, opts RestoreOptions) (*RestoreResult, error) {
+	if destPath == "" {
+		return nil, errors.New("missing dest path")
+	}
+	if opts.Mode == "" {
+		opts.Mode = RestoreOverwrite
+	}
+
+	target := destPath
+	if opts.Mode == RestoreToStagingDir {
+		if opts.StagingDir == "" {
+			return nil, errors.New("staging dir not configured")
+		}
+		target = filepath.Join(opts.StagingDir, filepath.Base(destPath))
+	}
+
+	tmpPath, sum, err := downloadToTemp(session, filepath.Dir(target), filepath.Base(target))
+	if err != nil {
+		return nil, err
+	}
+	res := &RestoreResult{Checksum: sum}
+
+	exists := false
+	var existing os.FileInfo
+	if info, err := os.Stat(target); err == nil {
+		if info.IsDir() {
+			_ = os.Remove(tmpPath)
+			return nil, fmt.Errorf("dest %s is a directory", target)
+		}
+		exists = true
+		existing = info
+	} else if !errors.Is(err, os.ErrNotExist) {
+		_ = os.Remove(tmpPath)
+		return nil, fmt.Errorf("stat dest: %w", err)
+	}
+
+	if exists {
+		switch opts.Mode {
+		case RestoreSkipIfSameHash:
+			cur, err := fileSHA256(target)
+			if err != nil {
+				_ = os.Remove(tmpPath)
+				return nil, fmt.Errorf("hash dest: %w", err)
+			}
+			if cur == sum {
+				_ = os.Remove(tmpPath)
+				res.Path = target
+				res.Skipped = true
+				return res, nil
+			}
+		case RestoreKeepBoth, RestoreToStagingDir:
+			target = nextFreeName(target)
+			exists = false
+		}
+	}
+
+	if exists && opts.PreRestoreDir != "" {
+		saved, err := savePreRestoreCopy(target, opts.PreRestoreDir)
+		if err != nil {
+			_ = os.Remove(tmpPath)
+			return nil, fmt.Errorf("pre-restore backup: %w", err)
+		}
+		res.PreRestorePath = saved
+	}
+
+	// CreateTemp tạo file 0600: file thay thế giữ mode/owner của file cũ,
+	// file mới nhận mode mặc định như file tạo thông thường.
+	if exists {
+		if err := matchFileAttrs(tmpPath, existing); err != nil {
+			_ = os.Remove(tmpPath)
+			return nil, fmt.Errorf("copy dest attributes: %w", err)
+		}
+	} else if err := os.Chmod(tmpPath, 0o644); err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, fmt.Errorf("chmod restored file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, target); err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, fmt.Errorf("rename into place: %w", err)
+	}
+	res.Path = target
+	return res, nil
+}
+
+// nextFreeName trả về "name (restored N).ext" đầu tiên chưa tồn tại.
+func nextFreeName(path string) string {
+	dir := filepath.Dir(path)
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(filepath.Base(path), ext)
+	for i := 1; ; i++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s (restored %d)%s", stem, i, ext))
+		if _, err := os.Stat(candidate); errors.Is(err, os.ErrNotExist) {
+			return candidate
+		}
+	}
+}
+
+// savePreRestoreCopy sao chép file sắp bị ghi đè vào dir với hậu tố timestamp.
+func savePreRestoreCopy(path, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dstPath := filepath.Join(dir, fmt.Sprintf("%s.%d", filepath.Base(path), time.Now().UnixNano()))
+	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(dstPath)
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(dstPath)
+		return "", err
+	}
+	return dstPath, nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
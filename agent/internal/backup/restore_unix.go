@@ -0,0 +1,20 @@
+//go:build !windows
+
+package backup
+
+import (
+	"os"
+	"syscall"
+)
+
+// matchFileAttrs đặt owner và mode của path giống file info sắp bị thay thế.
+// Agent không chạy root thì không đổi được owner, file giữ owner của agent.
+func matchFileAttrs(path string, info os.FileInfo) error {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		if err := os.Chown(path, int(st.Uid), int(st.Gid)); err != nil && !os.IsPermission(err) {
+			return err
+		}
+	}
+	// chmod sau chown vì chown xóa bit setuid/setgid
+	return os.Chmod(path, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package backup
+
+import "os"
+
+// matchFileAttrs trên Windows chỉ giữ cờ read-only; ACL kế thừa từ thư mục cha.
+func matchFileAttrs(path string, info os.FileInfo) error {
+	return os.Chmod(path, info.Mode().Perm())
+}
@@ -0,0 +1,161 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Window là khoảng giờ trong ngày dạng "HH:MM-HH:MM"; cho phép qua nửa đêm (19:00-07:00).
+type Window struct {
+	Start int // phút tính từ 00:00
+	End   int
+}
+
+// ParseWindow đọc "HH:MM-HH:MM". Start == End nghĩa là cả ngày.
+func ParseWindow(s string) (Window, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return Window{}, fmt.Errorf("invalid backup window %q (want HH:MM-HH:MM)", s)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid backup window %q: %w", s, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid backup window %q: %w", s, err)
+	}
+	return Window{Start: start, End: end}, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w Window) Contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	switch {
+	case w.Start == w.End:
+		return true
+	case w.Start < w.End:
+		return m >= w.Start && m < w.End
+	default:
+		return m >= w.Start || m < w.End
+	}
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.Start/60, w.Start%60, w.End/60, w.End%60)
+}
+
+// ThrottlePolicy: trong Windows upload full tốc độ; ngoài Windows giới hạn
+// RateLimitBps, hoặc hoãn hẳn nếu DeferOutsideWindow.
+type ThrottlePolicy struct {
+	RateLimitBps       int64 // 0 = không giới hạn
+	Windows            []Window
+	DeferOutsideWindow bool
+}
+
+// ParseThrottlePolicy dựng policy từ config (rate tính bằng KB/s).
+func ParseThrottlePolicy(rateKBps int, windows []string, deferOutside bool) (ThrottlePolicy, error) {
+	p := ThrottlePolicy{RateLimitBps: int64(rateKBps) * 1024, DeferOutsideWindow: deferOutside}
+	for _, s := range windows {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		w, err := ParseWindow(s)
+		if err != nil {
+			return ThrottlePolicy{}, err
+		}
+		p.Windows = append(p.Windows, w)
+	}
+	return p, nil
+}
+
+// InWindow: không cấu hình window nghĩa là luôn trong window.
+func (p ThrottlePolicy) InWindow(t time.Time) bool {
+	if len(p.Windows) == 0 {
+		return true
+	}
+	for _, w := range p.Windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ShouldDefer cho biết backup tại thời điểm t phải xếp hàng chờ window.
+func (p ThrottlePolicy) ShouldDefer(t time.Time) bool {
+	return p.DeferOutsideWindow && !p.InWindow(t)
+}
+
+// RateAt trả về giới hạn byte/s tại t; 0 = không giới hạn.
+func (p ThrottlePolicy) RateAt(t time.Time) int64 {
+	if p.InWindow(t) && len(p.Windows) > 0 {
+		return 0
+	}
+	return p.RateLimitBps
+}
+
+// throttle là token bucket dùng chung cho mọi upload của agent.
+type throttle struct {
+	mu     sync.Mutex
+	policy ThrottlePolicy
+	tokens float64
+	last   time.Time
+}
+
+var uploadThrottle = &throttle{}
+
+// SetThrottlePolicy thay policy đang áp dụng cho mọi upload.
+func SetThrottlePolicy(p ThrottlePolicy) {
+	uploadThrottle.mu.Lock()
+	defer uploadThrottle.mu.Unlock()
+	uploadThrottle.policy = p
+	uploadThrottle.tokens = 0
+	uploadThrottle.last = time.Time{}
+}
+
+// CurrentThrottlePolicy trả về policy hiện tại.
+func CurrentThrottlePolicy() ThrottlePolicy {
+	uploadThrottle.mu.Lock()
+	defer uploadThrottle.mu.Unlock()
+	return uploadThrottle.policy
+}
+
+// wait trừ n byte khỏi bucket và ngủ nếu bucket bị âm. Chunk lớn hơn burst
+// vẫn được gửi, chỉ là upload kế tiếp phải chờ bù phần thiếu.
+func (t *throttle) wait(n int) {
+	t.mu.Lock()
+	now := time.Now()
+	rate := t.policy.RateAt(now)
+	if rate <= 0 {
+		t.last = now
+		t.mu.Unlock()
+		return
+	}
+	burst := float64(rate) // tối đa 1 giây dữ liệu
+	if !t.last.IsZero() {
+		t.tokens += now.Sub(t.last).Seconds() * float64(rate)
+		if t.tokens > burst {
+			t.tokens = burst
+		}
+	}
+	t.last = now
+	t.tokens -= float64(n)
+	var sleep time.Duration
+	if t.tokens < 0 {
+		sleep = time.Duration(-t.tokens / float64(rate) * float64(time.Second))
+	}
+	t.mu.Unlock()
+	if sleep > 0 {
+		time.Sleep(sleep)
+	}
+}
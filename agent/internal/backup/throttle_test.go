@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Window
+		wantErr bool
+	}{
+		{in: "09:00-17:30", want: Window{Start: 9 * 60, End: 17*60 + 30}},
+		{in: " 19:00 - 07:00 ", want: Window{Start: 19 * 60, End: 7 * 60}},
+		{in: "00:00-00:00", want: Window{}},
+		{in: "09:00", wantErr: true},
+		{in: "9am-5pm", wantErr: true},
+		{in: "25:00-01:00", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseWindow(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWindow(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseWindow(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2024, 1, 1, h, m, 0, 0, time.UTC) }
+	tests := []struct {
+		name string
+		w    Window
+		t    time.Time
+		want bool
+	}{
+		{"inside day window", Window{Start: 9 * 60, End: 17 * 60}, at(12, 0), true},
+		{"end is exclusive", Window{Start: 9 * 60, End: 17 * 60}, at(17, 0), false},
+		{"before day window", Window{Start: 9 * 60, End: 17 * 60}, at(8, 59), false},
+		{"overnight late", Window{Start: 19 * 60, End: 7 * 60}, at(23, 0), true},
+		{"overnight early", Window{Start: 19 * 60, End: 7 * 60}, at(6, 59), true},
+		{"overnight gap", Window{Start: 19 * 60, End: 7 * 60}, at(12, 0), false},
+		{"whole day", Window{Start: 5 * 60, End: 5 * 60}, at(3, 0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.w.Contains(tt.t); got != tt.want {
+				t.Errorf("%s.Contains(%s) = %t, want %t", tt.w, tt.t.Format("15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseThrottlePolicy(t *testing.T) {
+	at := func(h int) time.Time { return time.Date(2024, 1, 1, h, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name        string
+		rate        int
+		windows     []string
+		deferOut    bool
+		wantErr     bool
+		wantWindows int
+		checkAt     time.Time
+		wantRate    int64
+		wantDefer   bool
+	}{
+		{name: "no windows always full limit", rate: 100, checkAt: at(12), wantRate: 100 * 1024},
+		{name: "blank windows ignored", rate: 10, windows: []string{"", "  "}, checkAt: at(12), wantRate: 10 * 1024},
+		{name: "inside window unlimited", rate: 100, windows: []string{"19:00-07:00"}, wantWindows: 1, checkAt: at(22), wantRate: 0},
+		{name: "outside window limited", rate: 100, windows: []string{"19:00-07:00"}, wantWindows: 1, checkAt: at(12), wantRate: 100 * 1024},
+		{name: "outside window deferred", windows: []string{"19:00-07:00", "12:00-13:00"}, deferOut: true, wantWindows: 2, checkAt: at(9), wantDefer: true},
+		{name: "second window matches", windows: []string{"19:00-07:00", "12:00-13:00"}, deferOut: true, wantWindows: 2, checkAt: at(12)},
+		{name: "invalid window", windows: []string{"19:00"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseThrottlePolicy(tt.rate, tt.windows, tt.deferOut)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseThrottlePolicy error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(p.Windows) != tt.wantWindows {
+				t.Errorf("windows = %d, want %d", len(p.Windows), tt.wantWindows)
+			}
+			if got := p.RateAt(tt.checkAt); got != tt.wantRate {
+				t.Errorf("RateAt = %d, want %d", got, tt.wantRate)
+			}
+			if got := p.ShouldDefer(tt.checkAt); got != tt.wantDefer {
+				t.Errorf("ShouldDefer = %t, want %t", got, tt.wantDefer)
+			}
+		})
+	}
+}
@@ -1,18 +1,26 @@
 package command
 
 import (
+	"encoding/json"
 	"fmt"
+	"sagiri-guard/agent/internal/db"
 	"sagiri-guard/agent/internal/logger"
 	"sync"
+	"time"
 )
 
 // Manager keeps running stream commands
 type Manager struct {
 	mu     sync.Mutex
-	active map[string]func() error // name->stop
+	active map[string]activeStream // name->running stream
 }
 
-func NewManager() *Manager { return &Manager{active: map[string]func() error{}} }
+type activeStream struct {
+	stop func() error
+	out  *streamOutput
+}
+
+func NewManager() *Manager { return &Manager{active: map[string]activeStream{}} }
 
 // Format renders a human-friendly string of the command envelope
 func Format(env Envelope) string {
@@ -29,60 +37,142 @@ func resolveKind(env Envelope) Kind {
 	return KindOnce
 }
 
-// Dispatch executes or starts the given command and logs outcome
+// Dispatch executes or starts the given command and logs outcome.
+// Commands carrying a backend ID run at most once: the ID is recorded in the
+// local DB before execution and replays only re-report the recorded result.
 func (m *Manager) Dispatch(env Envelope) {
 	h, ok := Get(env.Name)
 	if !ok {
 		logger.Errorf("Unknown command: %s", env.Name)
+		reportResult(Result{ID: env.ID, Command: env.Name, Status: StatusFailed, Error: "unknown command"})
 		return
 	}
 	k := resolveKind(env)
+	if k == KindCancel {
+		m.Stop(env.Name)
+		finish(env, StatusDone, nil)
+		return
+	}
+	if env.ID != 0 {
+		claimed, prev, err := db.ClaimCommand(env.ID, env.Name)
+		if err != nil {
+			// không chặn command chỉ vì DB cục bộ lỗi
+			logger.Errorf("Cannot record command id=%d: %v", env.ID, err)
+		} else if !claimed {
+			logger.Infof("Command %s id=%d already received (status=%s), skipping replay", env.Name, env.ID, prev.Status)
+			reportResult(Result{ID: env.ID, Command: env.Name, Status: prev.Status, Error: prev.Error, Duplicate: true})
+			return
+		}
+	}
+	if env.ExpiresAt > 0 && time.Now().Unix() >= env.ExpiresAt {
+		logger.Warnf("Dropping expired command=%s (expired at %s)", env.Name, time.Unix(env.ExpiresAt, 0).Format(time.RFC3339))
+		finish(env, StatusExpired, nil)
+		return
+	}
 	var arg any
 	if len(env.Argument) > 0 {
 		var err error
 		arg, err = h.DecodeArg(env.Argument)
 		if err != nil {
 			logger.Errorf("Decode arg failed for %s: %v", env.Name, err)
+			finish(env, StatusFailed, err)
 			return
 		}
 	}
-	logger.Infof("Received command=%s kind=%s device=%s", env.Name, k, env.DeviceID)
+	logger.Infof("Received command=%s kind=%s device=%s id=%d", env.Name, k, env.DeviceID, env.ID)
 	switch k {
 	case KindOnce:
-		if err := h.HandleOnce(arg); err != nil {
-			logger.Errorf("Command %s failed: %v", env.Name, err)
-		} else {
-			logger.Infof("Command %s completed", env.Name)
+		if ah, ok := h.(AsyncHandler); ok && ah.Async() {
+			// Command chạy lâu (vd. osquery_run) không được chặn vòng nhận command
+			go func() {
+				asyncSlots <- struct{}{}
+				defer func() { <-asyncSlots }()
+				runOnce(env, h, arg)
+			}()
+			return
 		}
+		runOnce(env, h, arg)
 	case KindStream:
-		m.mu.Lock()
-		if stop, exists := m.active[env.Name]; exists {
-			_ = stop()
-			delete(m.active, env.Name)
-		}
-		m.mu.Unlock()
-		stop, err := h.Start(arg)
+		m.Stop(env.Name)
+		out := newStreamOutput(env)
+		stop, err := h.Start(arg, out)
 		if err != nil {
 			logger.Errorf("Start %s failed: %v", env.Name, err)
+			out.Close(err)
+			finish(env, StatusFailed, err)
 			return
 		}
 		m.mu.Lock()
-		m.active[env.Name] = stop
+		m.active[env.Name] = activeStream{stop: stop, out: out}
 		m.mu.Unlock()
 		logger.Infof("Command %s started", env.Name)
+		finish(env, StatusStarted, nil)
+	}
+}
+
+// asyncSlots giới hạn số command async chạy đồng thời; phần còn lại xếp hàng.
+var asyncSlots = make(chan struct{}, 2)
+
+// runOnce thực thi command once và báo kết quả.
+func runOnce(env Envelope, h Handler, arg any) {
+	var (
+		output any
+		err    error
+	)
+	if rh, ok := h.(ResultHandler); ok {
+		output, err = rh.HandleOnceResult(arg)
+	} else {
+		err = h.HandleOnce(arg)
+	}
+	if err != nil {
+		logger.Errorf("Command %s failed: %v", env.Name, err)
+		finishWithOutput(env, StatusFailed, err, output)
+	} else {
+		logger.Infof("Command %s completed", env.Name)
+		finishWithOutput(env, StatusDone, nil, output)
+	}
+}
+
+// finish lưu kết quả của command đã claim và báo về backend.
+func finish(env Envelope, status string, err error) {
+	finishWithOutput(env, status, err, nil)
+}
+
+// finishWithOutput như finish, kèm dữ liệu handler trả về (không lưu cục bộ).
+func finishWithOutput(env Envelope, status string, err error, output any) {
+	res := Result{ID: env.ID, Command: env.Name, Status: status}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	if output != nil {
+		if b, e := json.Marshal(output); e != nil {
+			logger.Errorf("Cannot encode output of command %s: %v", env.Name, e)
+		} else {
+			res.Output = b
+		}
 	}
+	if env.ID != 0 {
+		if e := db.FinishCommand(env.ID, status, res.Error); e != nil {
+			logger.Errorf("Cannot record result of command id=%d: %v", env.ID, e)
+		}
+	}
+	reportResult(res)
 }
 
-// Stop stops a running stream command by name (if exists)
+// Stop stops a running stream command by name (if exists) and closes its output
 func (m *Manager) Stop(name string) {
 	m.mu.Lock()
-	stop, exists := m.active[name]
+	s, exists := m.active[name]
 	if exists {
 		delete(m.active, name)
 	}
 	m.mu.Unlock()
 	if exists {
-		_ = stop()
+		var err error
+		if s.stop != nil {
+			err = s.stop()
+		}
+		s.out.Close(err)
 		logger.Infof("Command %s stopped", name)
 	}
 }
@@ -3,6 +3,7 @@ package command
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -11,11 +12,13 @@ import (
 	"sagiri-guard/agent/internal/db"
 	"sagiri-guard/agent/internal/firewall"
 	"sagiri-guard/agent/internal/logger"
+	"sagiri-guard/agent/internal/osquery"
 	"sagiri-guard/agent/internal/protocolclient"
 	"sagiri-guard/agent/internal/service"
 	"sagiri-guard/agent/internal/state"
 	"sagiri-guard/network"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -40,13 +43,7 @@ func (h getLogsHandler) DecodeArg(raw json.RawMessage) (any, error) {
 	return a, nil
 }
 func (h getLogsHandler) HandleOnce(arg any) error {
-	cfg := config.Get()
-	// read log file if configured; fallback to default alongside token path
-	logPath := cfg.LogPath
-	if logPath == "" {
-		logPath = filepath.Join(filepath.Dir(config.TokenFilePath()), "agent.log")
-	}
-	data, err := os.ReadFile(logPath)
+	data, err := os.ReadFile(agentLogPath())
 	if err != nil {
 		logger.Errorf("read log failed: %v", err)
 		data = []byte("<no log available>")
@@ -71,7 +68,15 @@ func (h getLogsHandler) HandleOnce(arg any) error {
 	logger.Infof("Posted logs success, status=%d", msg.StatusCode)
 	return nil
 }
-func (h getLogsHandler) Start(arg any) (func() error, error) { return nil, nil }
+func (h getLogsHandler) Start(arg any, out Output) (func() error, error) { return nil, nil }
+
+// agentLogPath trả về file log đã cấu hình; mặc định nằm cạnh token.
+func agentLogPath() string {
+	if p := config.Get().LogPath; p != "" {
+		return p
+	}
+	return filepath.Join(filepath.Dir(config.TokenFilePath()), "agent.log")
+}
 
 // remaining handlers ...
 
@@ -104,7 +109,7 @@ func (h backupAutoHandler) HandleOnce(arg any) error {
 	}
 	return nil
 }
-func (h backupAutoHandler) Start(arg any) (func() error, error) {
+func (h backupAutoHandler) Start(arg any, out Output) (func() error, error) {
 	a, ok := arg.(backupAutoArg)
 	if !ok {
 		return nil, fmt.Errorf("invalid argument type")
@@ -125,11 +130,69 @@ func (h backupAutoHandler) Start(arg any) (func() error, error) {
 	return stop, nil
 }
 
+type backupThrottleArg struct {
+	RateLimitKBps      *int     `json:"rate_limit_kbps,omitempty"`      // nil = không đổi, 0 = bỏ giới hạn
+	Windows            []string `json:"windows,omitempty"`              // nil = không đổi
+	ClearWindows       bool     `json:"clear_windows,omitempty"`        // xóa mọi window (luôn full tốc độ)
+	DeferOutsideWindow *bool    `json:"defer_outside_window,omitempty"` // nil = không đổi
+}
+
+type backupThrottleHandler struct{}
+
+func (h backupThrottleHandler) Kind() Kind { return KindOnce }
+func (h backupThrottleHandler) DecodeArg(raw json.RawMessage) (any, error) {
+	var a backupThrottleArg
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return nil, err
+		}
+	}
+	if a.RateLimitKBps != nil && *a.RateLimitKBps < 0 {
+		return nil, fmt.Errorf("rate_limit_kbps must be >= 0")
+	}
+	for _, w := range a.Windows {
+		if _, err := backup.ParseWindow(w); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+func (h backupThrottleHandler) HandleOnce(arg any) error {
+	a, ok := arg.(backupThrottleArg)
+	if !ok {
+		return fmt.Errorf("invalid argument type")
+	}
+	p := backup.CurrentThrottlePolicy()
+	if a.RateLimitKBps != nil {
+		p.RateLimitBps = int64(*a.RateLimitKBps) * 1024
+	}
+	if a.ClearWindows {
+		p.Windows = nil
+	}
+	if a.Windows != nil {
+		p.Windows = p.Windows[:0:0]
+		for _, s := range a.Windows {
+			w, _ := backup.ParseWindow(s) // đã validate trong DecodeArg
+			p.Windows = append(p.Windows, w)
+		}
+	}
+	if a.DeferOutsideWindow != nil {
+		p.DeferOutsideWindow = *a.DeferOutsideWindow
+	}
+	backup.SetThrottlePolicy(p)
+	service.SaveThrottlePolicy(p)
+	logger.Infof("Backup throttle updated: rate=%d B/s windows=%v defer=%t", p.RateLimitBps, p.Windows, p.DeferOutsideWindow)
+	return nil
+}
+func (h backupThrottleHandler) Start(arg any, out Output) (func() error, error) { return nil, nil }
+
 type restoreArg struct {
 	FileID    string `json:"file_id"`    // file ID (required, được enrich từ backend)
 	VersionID uint   `json:"version_id"` // BackupFileVersion ID (required, được enrich từ backend)
 	FileName  string `json:"file_name"`  // stored_name từ backup version (được enrich từ backend)
 	DestPath  string `json:"dest_path"`  // đường dẫn đích (được enrich từ backend)
+	Mode      string `json:"mode"`       // overwrite (mặc định) | keep_both | skip_if_same_hash | restore_to_staging_dir
+	GrantID   uint   `json:"grant_id"`   // restore chéo máy: bản backup thuộc device khác
 }
 
 type restoreHandler struct{}
@@ -149,6 +212,9 @@ func (h restoreHandler) DecodeArg(raw json.RawMessage) (any, error) {
 	if a.DestPath == "" {
 		return nil, fmt.Errorf("missing dest_path (should be enriched by backend)")
 	}
+	if _, err := backup.ParseRestoreMode(a.Mode); err != nil {
+		return nil, err
+	}
 	return a, nil
 }
 func (h restoreHandler) HandleOnce(arg any) error {
@@ -169,24 +235,40 @@ func (h restoreHandler) HandleOnce(arg any) error {
 		logger.Warnf("Backend did not provide dest_path, using temp: %s", destPath)
 	}
 
-	// Đảm bảo thư mục đích tồn tại
-	if dir := filepath.Dir(destPath); dir != "" && dir != "." {
-		if err := os.MkdirAll(dir, 0o755); err != nil {
-			return fmt.Errorf("create dest directory: %w", err)
-		}
+	mode, err := backup.ParseRestoreMode(a.Mode)
+	if err != nil {
+		return err
 	}
 
 	// Download file từ server
 	host, port := config.BackendHostPort()
-	session, err := backup.InitDownload(host, port, token, a.FileName)
+	session, err := backup.InitDownload(host, port, token, a.FileName, a.GrantID)
 	if err != nil {
 		return fmt.Errorf("init download: %w", err)
 	}
+	// Restore chéo máy chỉ được ghi vào đúng đích đã remap lưu trong grant
+	if a.GrantID != 0 && (session.DestPath == "" || filepath.Clean(session.DestPath) != filepath.Clean(destPath)) {
+		return fmt.Errorf("dest_path %q does not match restore grant %d", destPath, a.GrantID)
+	}
 
-	// Download và ghi đè file hiện tại (nếu có)
-	if err := backup.DownloadFile(session, destPath); err != nil {
-		return fmt.Errorf("download file: %w", err)
+	// Tải vào file tạm rồi rename atomic theo mode; file cũ được sao lưu trước khi bị thay thế
+	cfg := config.Get()
+	res, err := backup.Restore(session, destPath, backup.RestoreOptions{
+		Mode:          mode,
+		StagingDir:    cfg.RestoreStagingDir,
+		PreRestoreDir: cfg.PreRestoreDir,
+	})
+	if err != nil {
+		return fmt.Errorf("restore file: %w", err)
+	}
+	if res.Skipped {
+		logger.Infof("Restore skipped for %s: content already matches (sha256=%s)", res.Path, res.Checksum)
+		return nil
+	}
+	if res.PreRestorePath != "" {
+		logger.Infof("Saved pre-restore copy of %s to %s", res.Path, res.PreRestorePath)
 	}
+	destPath = res.Path
 
 	// Cập nhật MonitoredFile trong local DB để đánh dấu file đã được restore
 	if adb := db.Get(); adb != nil {
@@ -218,7 +300,7 @@ func (h restoreHandler) HandleOnce(arg any) error {
 		}
 	}
 
-	logger.Infof("Restored file_id=%s version_id=%d file_name=%s to %s", a.FileID, a.VersionID, a.FileName, destPath)
+	logger.Infof("Restored file_id=%s version_id=%d file_name=%s mode=%s to %s", a.FileID, a.VersionID, a.FileName, mode, destPath)
 	return nil
 }
 
@@ -268,7 +350,7 @@ func findPathFromFileID(fileID string) string {
 	// Có thể cần thêm vào MonitoredFile hoặc query từ backend
 	return ""
 }
-func (h restoreHandler) Start(arg any) (func() error, error) { return nil, nil }
+func (h restoreHandler) Start(arg any, out Output) (func() error, error) { return nil, nil }
 
 type blockWebsiteArg struct {
 	Action string              `json:"action"` // "apply", "remove", "sync"
@@ -326,6 +408,7 @@ func (h blockWebsiteHandler) HandleOnce(arg any) error {
 				logger.Errorf("Failed to disable website blocking: %v", err)
 				return fmt.Errorf("disable blocking: %w", err)
 			}
+			service.SaveWebsiteBlockState(service.WebsiteBlockState{Enabled: false})
 			logger.Info("Website blocking disabled")
 			return nil
 		}
@@ -365,6 +448,7 @@ func (h blockWebsiteHandler) HandleOnce(arg any) error {
 			return fmt.Errorf("enable blocking: %w", err)
 		}
 
+		service.SaveWebsiteBlockState(service.WebsiteBlockState{Enabled: true, Domains: domainList})
 		logger.Infof("Website blocking enabled with %d domains", len(domainList))
 
 	case "remove":
@@ -373,6 +457,7 @@ func (h blockWebsiteHandler) HandleOnce(arg any) error {
 			logger.Errorf("Failed to disable website blocking: %v", err)
 			return fmt.Errorf("disable blocking: %w", err)
 		}
+		service.SaveWebsiteBlockState(service.WebsiteBlockState{Enabled: false})
 		logger.Info("Website blocking removed")
 
 	default:
@@ -382,11 +467,252 @@ func (h blockWebsiteHandler) HandleOnce(arg any) error {
 	return nil
 }
 
-func (h blockWebsiteHandler) Start(arg any) (func() error, error) { return nil, nil }
+func (h blockWebsiteHandler) Start(arg any, out Output) (func() error, error) { return nil, nil }
+
+type monitorPathsArg struct {
+	Paths []string `json:"paths"`
+}
+
+type monitorPathsHandler struct{}
+
+func (h monitorPathsHandler) Kind() Kind { return KindOnce }
+func (h monitorPathsHandler) DecodeArg(raw json.RawMessage) (any, error) {
+	var a monitorPathsArg
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return nil, err
+		}
+	}
+	paths := make([]string, 0, len(a.Paths))
+	for _, p := range a.Paths {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	a.Paths = paths
+	return a, nil
+}
+func (h monitorPathsHandler) HandleOnce(arg any) error {
+	a, ok := arg.(monitorPathsArg)
+	if !ok {
+		return fmt.Errorf("invalid argument type")
+	}
+	service.SetMonitorPaths(a.Paths)
+	return nil
+}
+func (h monitorPathsHandler) Start(arg any, out Output) (func() error, error) { return nil, nil }
+
+type tailLogArg struct {
+	Lines int `json:"lines,omitempty"` // số dòng cuối gửi ngay khi bắt đầu (mặc định 20)
+}
+
+// tailLogHandler stream các dòng log mới của agent cho tới khi bị hủy.
+type tailLogHandler struct{}
+
+const tailLogInterval = time.Second
+
+func (h tailLogHandler) Kind() Kind { return KindStream }
+func (h tailLogHandler) DecodeArg(raw json.RawMessage) (any, error) {
+	a := tailLogArg{Lines: 20}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return nil, err
+		}
+	}
+	if a.Lines < 0 {
+		a.Lines = 0
+	}
+	return a, nil
+}
+func (h tailLogHandler) HandleOnce(arg any) error {
+	return fmt.Errorf("tail_log only runs as a stream command")
+}
+func (h tailLogHandler) Start(arg any, out Output) (func() error, error) {
+	a, ok := arg.(tailLogArg)
+	if !ok {
+		a = tailLogArg{Lines: 20}
+	}
+	path := agentLogPath()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read log: %w", err)
+	}
+	offset := int64(len(data))
+	if tail := lastLines(string(data), a.Lines); tail != "" {
+		_, _ = out.Write([]byte(tail))
+	}
+
+	stopCh := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(tailLogInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+			next, err := readLogFrom(path, offset, out)
+			if err != nil {
+				logger.Warnf("tail_log: %v", err)
+				continue
+			}
+			offset = next
+		}
+	}()
+	var once sync.Once
+	return func() error {
+		once.Do(func() { close(stopCh) })
+		return nil
+	}, nil
+}
+
+// readLogFrom gửi phần log mới từ offset và trả về offset tiếp theo. File bị
+// cắt ngắn (rotate) thì đọc lại từ đầu.
+func readLogFrom(path string, offset int64, out Output) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return offset, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return offset, err
+	}
+	if st.Size() < offset {
+		offset = 0
+	}
+	if st.Size() == offset {
+		return offset, nil
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+	n, err := io.Copy(out, f)
+	return offset + n, err
+}
+
+// lastLines trả về n dòng cuối của s.
+func lastLines(s string, n int) string {
+	if n <= 0 || s == "" {
+		return ""
+	}
+	end := len(s)
+	if strings.HasSuffix(s, "\n") {
+		end--
+	}
+	idx := end
+	for i := 0; i < n; i++ {
+		idx = strings.LastIndexByte(s[:idx], '\n')
+		if idx < 0 {
+			return s
+		}
+	}
+	return s[idx+1:]
+}
+
+type osqueryRunArg struct {
+	Query      string `json:"query"`
+	TimeoutSec int    `json:"timeout_sec,omitempty"` // mặc định 30, tối đa 300
+	MaxRows    int    `json:"max_rows,omitempty"`    // mặc định 1000, tối đa 10000
+}
+
+const (
+	osqueryDefaultTimeout = 30 * time.Second
+	osqueryMaxTimeout     = 300 * time.Second
+	osqueryDefaultRows    = 1000
+	osqueryMaxRows        = 10000
+	osqueryMaxBytes       = 900 * 1024 // dưới giới hạn 1MB mỗi frame của protocol
+)
+
+// osqueryRunHandler chạy truy vấn osquery do admin gửi và trả mọi dòng qua command_result.
+type osqueryRunHandler struct{}
+
+func (h osqueryRunHandler) Kind() Kind { return KindOnce }
+
+// Async: truy vấn có thể chạy tới osqueryMaxTimeout, không chạy trên vòng nhận command.
+func (h osqueryRunHandler) Async() bool { return true }
+func (h osqueryRunHandler) DecodeArg(raw json.RawMessage) (any, error) {
+	var a osqueryRunArg
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return nil, err
+		}
+	}
+	a.Query = strings.TrimSpace(a.Query)
+	if a.Query == "" {
+		return nil, fmt.Errorf("missing query")
+	}
+	return a, nil
+}
+func (h osqueryRunHandler) HandleOnce(arg any) error {
+	_, err := h.HandleOnceResult(arg)
+	return err
+}
+func (h osqueryRunHandler) HandleOnceResult(arg any) (any, error) {
+	a, ok := arg.(osqueryRunArg)
+	if !ok {
+		return nil, fmt.Errorf("invalid argument type")
+	}
+	timeout := time.Duration(a.TimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = osqueryDefaultTimeout
+	}
+	if timeout > osqueryMaxTimeout {
+		timeout = osqueryMaxTimeout
+	}
+	maxRows := a.MaxRows
+	if maxRows <= 0 {
+		maxRows = osqueryDefaultRows
+	}
+	if maxRows > osqueryMaxRows {
+		maxRows = osqueryMaxRows
+	}
+	res, err := osquery.Query(a.Query, timeout, maxRows, osqueryMaxBytes)
+	if err != nil {
+		return res, err
+	}
+	logger.Infof("osquery_run returned %d rows (sent %d, truncated=%t) in %dms", res.RowCount, len(res.Rows), res.Truncated, res.DurationMs)
+	return res, nil
+}
+func (h osqueryRunHandler) Start(arg any, out Output) (func() error, error) { return nil, nil }
+
+// osqueryPacksHandler thay toàn bộ query pack backend giao cho device.
+type osqueryPacksHandler struct{}
+
+func (h osqueryPacksHandler) Kind() Kind { return KindOnce }
+func (h osqueryPacksHandler) DecodeArg(raw json.RawMessage) (any, error) {
+	var cfg service.PackConfig
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	for _, q := range cfg.Queries {
+		if q.Pack == "" || q.Name == "" || strings.TrimSpace(q.Query) == "" || q.IntervalSec <= 0 {
+			return nil, fmt.Errorf("invalid pack query %q", q.Key())
+		}
+	}
+	return cfg, nil
+}
+func (h osqueryPacksHandler) HandleOnce(arg any) error {
+	cfg, ok := arg.(service.PackConfig)
+	if !ok {
+		return fmt.Errorf("invalid argument type")
+	}
+	service.SetOsqueryPacks(cfg)
+	return nil
+}
+func (h osqueryPacksHandler) Start(arg any, out Output) (func() error, error) { return nil, nil }
 
 func init() {
 	Register("get_logs", getLogsHandler{})
 	Register("backup_auto", backupAutoHandler{})
+	Register("backup_throttle", backupThrottleHandler{})
 	Register("restore", restoreHandler{})
 	Register("block_website", blockWebsiteHandler{})
+	Register("monitor_paths", monitorPathsHandler{})
+	Register("tail_log", tailLogHandler{})
+	Register("osquery_run", osqueryRunHandler{})
+	Register("osquery_packs", osqueryPacksHandler{})
 }
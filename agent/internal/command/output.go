@@ -0,0 +1,96 @@
+package command
+
+import (
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// maxFrameData giới hạn dữ liệu của một frame; phần dài hơn được tách thành nhiều frame.
+const maxFrameData = 2048
+
+// OutputFrame là một phần output của stream command, gửi về backend qua action
+// command_output và được backend chuyển tiếp tới admin đang theo dõi thiết bị.
+type OutputFrame struct {
+	ID      uint   `json:"id"` // AgentCommand ID (0 nếu command không được theo dõi)
+	Command string `json:"command"`
+	Seq     uint64 `json:"seq"`
+	Data    string `json:"data,omitempty"`
+	Done    int64  `json:"done,omitempty"` // tiến độ (vd: byte đã truyền)
+	Total   int64  `json:"total,omitempty"`
+	EOF     bool   `json:"eof,omitempty"` // stream đã kết thúc
+	Error   string `json:"error,omitempty"`
+}
+
+// Output là sink cho output tăng dần của stream command. Write nhận text (vd:
+// dòng log), Progress báo tiến độ; sau Close mọi lần ghi đều bị bỏ qua.
+type Output interface {
+	Write(p []byte) (int, error)
+	Progress(done, total int64) error
+	Close(err error)
+}
+
+var outputSender func(OutputFrame) error
+
+// SetOutputSender đặt hàm gửi OutputFrame về backend (gọi từ main sau khi kết nối).
+func SetOutputSender(fn func(OutputFrame) error) { outputSender = fn }
+
+type streamOutput struct {
+	id     uint
+	name   string
+	seq    atomic.Uint64
+	mu     sync.Mutex
+	closed bool
+}
+
+func newStreamOutput(env Envelope) *streamOutput {
+	return &streamOutput{id: env.ID, name: env.Name}
+}
+
+func (o *streamOutput) send(f OutputFrame, final bool) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return nil
+	}
+	if final {
+		o.closed = true
+	}
+	if outputSender == nil {
+		return nil
+	}
+	f.ID = o.id
+	f.Command = o.name
+	f.Seq = o.seq.Add(1)
+	return outputSender(f)
+}
+
+func (o *streamOutput) Write(p []byte) (int, error) {
+	for rest := string(p); rest != ""; {
+		n := len(rest)
+		if n > maxFrameData {
+			n = maxFrameData
+			// không cắt giữa một ký tự UTF-8
+			for n > 0 && !utf8.RuneStart(rest[n]) {
+				n--
+			}
+		}
+		if err := o.send(OutputFrame{Data: rest[:n]}, false); err != nil {
+			return len(p) - len(rest), err
+		}
+		rest = rest[n:]
+	}
+	return len(p), nil
+}
+
+func (o *streamOutput) Progress(done, total int64) error {
+	return o.send(OutputFrame{Done: done, Total: total}, false)
+}
+
+func (o *streamOutput) Close(err error) {
+	f := OutputFrame{EOF: true}
+	if err != nil {
+		f.Error = err.Error()
+	}
+	_ = o.send(f, true)
+}
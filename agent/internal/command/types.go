@@ -7,13 +7,50 @@ type Kind string
 const (
 	KindOnce   Kind = "once"
 	KindStream Kind = "stream"
+	// KindCancel dừng stream command cùng tên đang chạy (backend gửi khi admin hủy)
+	KindCancel Kind = "cancel"
 )
 
 type Envelope struct {
+	ID       uint            `json:"id,omitempty"` // AgentCommand ID trên backend (0 = không theo dõi)
 	DeviceID string          `json:"deviceid"`
 	Name     string          `json:"command"`
 	Kind     Kind            `json:"kind,omitempty"`
 	Argument json.RawMessage `json:"argument,omitempty"`
+	// ExpiresAt (unix, 0 = không hạn): command tới muộn hơn sẽ bị bỏ qua
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+}
+
+// Trạng thái thực thi báo về backend qua Result.
+const (
+	StatusRunning = "running" // đã nhận, chưa có kết quả (agent dừng giữa chừng)
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+	StatusStarted = "started" // stream command đã khởi động
+	StatusExpired = "expired"
+)
+
+// Result là kết quả thực thi một command, gửi về backend qua action command_result.
+type Result struct {
+	ID        uint   `json:"id"`
+	Command   string `json:"command"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	Duplicate bool   `json:"duplicate,omitempty"` // command đã nhận trước đó, không chạy lại
+	// Output là dữ liệu handler trả về (vd: các dòng của osquery_run)
+	Output json.RawMessage `json:"output,omitempty"`
+}
+
+var resultReporter func(Result)
+
+// SetResultReporter đặt hàm gửi Result về backend (gọi từ main sau khi kết nối).
+func SetResultReporter(fn func(Result)) { resultReporter = fn }
+
+func reportResult(r Result) {
+	if r.ID == 0 || resultReporter == nil {
+		return
+	}
+	resultReporter(r)
 }
 
 type Handler interface {
@@ -23,8 +60,21 @@ type Handler interface {
 	DecodeArg(raw json.RawMessage) (any, error)
 	// HandleOnce executes a one-off command; only used when kind==once
 	HandleOnce(arg any) error
-	// Start starts a continuous task; only used when kind==stream
-	Start(arg any) (stop func() error, err error)
+	// Start starts a continuous task; only used when kind==stream.
+	// out streams incremental output back to the backend until the task stops.
+	Start(arg any, out Output) (stop func() error, err error)
+}
+
+// ResultHandler is implemented by once commands that produce data; the value is
+// sent back as Result.Output instead of calling HandleOnce.
+type ResultHandler interface {
+	HandleOnceResult(arg any) (any, error)
+}
+
+// AsyncHandler is implemented by once commands that may run for a long time;
+// they execute off the receive loop so other commands are not held up.
+type AsyncHandler interface {
+	Async() bool
 }
 
 // Registry maps command name to handler
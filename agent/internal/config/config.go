@@ -9,13 +9,38 @@ import (
 )
 
 type AppConfig struct {
-	BackendHost  string
-	BackendPort  int
-	TokenPath    string
-	LogPath      string
-	OsqueryPath  string
-	MonitorPaths []string
-	DBPath       string
+	BackendHost     string
+	BackendPort     int
+	TokenPath       string
+	EnrollToken     string // token do admin cấp để enroll không cần nhập tài khoản
+	LogPath         string
+	OsqueryPath     string
+	InventorySource string   // auto | native | osquery
+	MonitorPaths    []string // thư mục thực sự watch: ManagedPaths + root của BackupPolicies
+	ManagedPaths    []string // danh sách monitor_paths do config/backend quản lý
+	DBPath          string
+
+	RestoreStagingDir string
+	PreRestoreDir     string
+
+	BackupPolicies []BackupPolicy // policy theo root; root cũng được thêm vào MonitorPaths
+
+	BackupRateLimitKBps      int      // giới hạn upload ngoài backup window; 0 = không giới hạn
+	BackupWindows            []string // "HH:MM-HH:MM", trong window upload full tốc độ
+	BackupDeferOutsideWindow bool     // true: xếp hàng backup vào SQLite cho tới khi window mở
+
+	CommandPublicKey       string // public key Ed25519 (base64) của backend dùng để xác thực command
+	CommandSigningRequired bool   // true: từ chối command không có chữ ký hợp lệ; chỉ false khi bật allow_unsigned
+}
+
+// BackupPolicy cấu hình include/exclude/giới hạn cho một thư mục gốc.
+type BackupPolicy struct {
+	Root        string   `mapstructure:"root"`
+	Include     []string `mapstructure:"include"`
+	Exclude     []string `mapstructure:"exclude"`
+	MaxSizeMB   int64    `mapstructure:"max_size_mb"`
+	Extensions  []string `mapstructure:"extensions"`
+	DebounceSec int      `mapstructure:"debounce_sec"`
 }
 
 var cfg AppConfig
@@ -34,6 +59,12 @@ func Init() AppConfig {
 	v.SetDefault("agent.token_path", defaultToken)
 	v.SetDefault("agent.monitor_paths", []string{})
 	v.SetDefault("agent.db_path", filepath.Join(os.TempDir(), "sagiri-guard", "agent.db"))
+	v.SetDefault("agent.restore.staging_dir", filepath.Join(os.TempDir(), "sagiri-guard", "restore"))
+	v.SetDefault("agent.restore.pre_restore_dir", filepath.Join(os.TempDir(), "sagiri-guard", "pre-restore"))
+	v.SetDefault("agent.backup.rate_limit_kbps", 0)
+	v.SetDefault("agent.backup.windows", []string{})
+	v.SetDefault("agent.backup.defer_outside_window", false)
+	v.SetDefault("agent.inventory.source", "auto")
 	_ = v.ReadInConfig()
 
 	port := v.GetInt("agent.backend.port")
@@ -47,19 +78,65 @@ func Init() AppConfig {
 	}
 
 	cfg = AppConfig{
-		BackendHost:  v.GetString("agent.backend.host"),
-		BackendPort:  port,
-		TokenPath:    v.GetString("agent.token_path"),
-		LogPath:      v.GetString("agent.log_path"),
-		OsqueryPath:  v.GetString("agent.osquery_path"),
-		MonitorPaths: v.GetStringSlice("agent.monitor_paths"),
-		DBPath:       v.GetString("agent.db_path"),
+		BackendHost:     v.GetString("agent.backend.host"),
+		BackendPort:     port,
+		TokenPath:       v.GetString("agent.token_path"),
+		EnrollToken:     v.GetString("agent.enroll_token"),
+		LogPath:         v.GetString("agent.log_path"),
+		OsqueryPath:     v.GetString("agent.osquery_path"),
+		InventorySource: v.GetString("agent.inventory.source"),
+		MonitorPaths:    v.GetStringSlice("agent.monitor_paths"),
+		DBPath:          v.GetString("agent.db_path"),
+
+		RestoreStagingDir: v.GetString("agent.restore.staging_dir"),
+		PreRestoreDir:     v.GetString("agent.restore.pre_restore_dir"),
+
+		BackupRateLimitKBps:      v.GetInt("agent.backup.rate_limit_kbps"),
+		BackupWindows:            v.GetStringSlice("agent.backup.windows"),
+		BackupDeferOutsideWindow: v.GetBool("agent.backup.defer_outside_window"),
+
+		CommandPublicKey: v.GetString("agent.command_signing.public_key"),
+		// Mặc định luôn bắt buộc ký; nhận command không ký phải bật tường minh allow_unsigned
+		CommandSigningRequired: !v.GetBool("agent.command_signing.allow_unsigned"),
 	}
+	if err := v.UnmarshalKey("agent.backup_policies", &cfg.BackupPolicies); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid agent.backup_policies: %v\n", err)
+	}
+	cfg.ManagedPaths = append([]string(nil), cfg.MonitorPaths...)
+	cfg.MonitorPaths = withPolicyRoots(cfg.ManagedPaths, cfg.BackupPolicies)
 	return cfg
 }
 
 func Get() AppConfig { return cfg }
 
+// SetMonitorPaths thay danh sách thư mục theo dõi (áp dụng từ command monitor_paths);
+// root của backup policy vẫn được giữ trong MonitorPaths.
+func SetMonitorPaths(paths []string) {
+	cfg.ManagedPaths = append([]string(nil), paths...)
+	cfg.MonitorPaths = withPolicyRoots(cfg.ManagedPaths, cfg.BackupPolicies)
+}
+
+// withPolicyRoots thêm root của policy vào danh sách thư mục cần theo dõi.
+func withPolicyRoots(paths []string, policies []BackupPolicy) []string {
+	out := append([]string(nil), paths...)
+	for _, p := range policies {
+		if p.Root == "" {
+			continue
+		}
+		found := false
+		for _, m := range out {
+			if filepath.Clean(m) == filepath.Clean(p.Root) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, p.Root)
+		}
+	}
+	return out
+}
+
 func TokenFilePath() string {
 	if cfg.TokenPath == "" {
 		return filepath.Join(os.TempDir(), "sagiri-guard", "agent.token")
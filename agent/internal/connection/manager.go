@@ -2,21 +2,32 @@ package connection
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
+	"sagiri-guard/agent/internal/auth"
 	"sagiri-guard/agent/internal/logger"
+	"sagiri-guard/agent/internal/protocolclient"
 	"sagiri-guard/agent/internal/socket"
 	"sagiri-guard/network"
 )
 
+const (
+	// refreshBefore is how long before expiry the access token is refreshed
+	refreshBefore = 2 * time.Minute
+	// refreshRetry is the delay after a refresh attempt failed on the network
+	refreshRetry = 30 * time.Second
+)
+
 // Manager manages a single persistent TCP connection to the backend
 type Manager struct {
 	host     string
 	port     int
 	deviceID string
 	token    string
+	version  string
 
 	client *network.TCPClient
 	mu     sync.Mutex
@@ -27,12 +38,13 @@ type Manager struct {
 }
 
 // New creates a new connection manager
-func New(host string, port int, deviceID, token string) *Manager {
+func New(host string, port int, deviceID, token, version string) *Manager {
 	return &Manager{
 		host:     host,
 		port:     port,
 		deviceID: deviceID,
 		token:    token,
+		version:  version,
 		stopCh:   make(chan struct{}),
 		doneCh:   make(chan struct{}),
 	}
@@ -69,8 +81,9 @@ func (m *Manager) Connect(maxRetries int, baseDelay time.Duration) error {
 			continue
 		}
 
-		// Send login frame to authenticate
-		if err := client.SendLogin(m.deviceID, m.token); err != nil {
+		// Send login frame to authenticate, then claim the control role so the
+		// backend routes pushed commands to this connection
+		if err := m.login(client); err != nil {
 			client.Close()
 			logger.Errorf("Agent login failed: %v", err)
 
@@ -96,6 +109,61 @@ func (m *Manager) Connect(maxRetries int, baseDelay time.Duration) error {
 	}
 }
 
+// login authenticates the connection (token plus device key proof) and waits
+// for the backend to accept it as the device's control connection. Commands pushed before the hello ACK are
+// dispatched as usual.
+func (m *Manager) login(client *network.TCPClient) error {
+	token := m.currentToken()
+	if exp := auth.TokenExpiry(token); !exp.IsZero() && time.Until(exp) < refreshBefore {
+		if fresh, err := m.refresh(); err == nil {
+			token = fresh
+		} else {
+			logger.Warnf("Refresh before login failed: %v", err)
+		}
+	}
+	err := protocolclient.Login(client, m.deviceID, token)
+	var se *protocolclient.StatusError
+	if errors.As(err, &se) && se.Code == 401 {
+		// the access token expired or was revoked while offline; the rejected
+		// login leaves the connection open, so retry on it with a fresh token
+		fresh, rerr := m.refresh()
+		if rerr != nil {
+			return fmt.Errorf("%w (refresh: %v)", err, rerr)
+		}
+		err = protocolclient.Login(client, m.deviceID, fresh)
+	}
+	if err != nil {
+		return err
+	}
+	hello, err := json.Marshal(map[string]interface{}{
+		"action": "hello",
+		"data":   map[string]string{"role": "control", "agent_version": m.version},
+	})
+	if err != nil {
+		return fmt.Errorf("marshal hello: %w", err)
+	}
+	if err := client.SendCommand(hello); err != nil {
+		return fmt.Errorf("send hello: %w", err)
+	}
+	for {
+		msg, err := client.RecvProtocolMessage()
+		if err != nil {
+			return fmt.Errorf("wait hello ack: %w", err)
+		}
+		switch msg.Type {
+		case network.MsgAck:
+			if msg.StatusCode != 200 {
+				return fmt.Errorf("hello rejected: %d %s", msg.StatusCode, msg.StatusMsg)
+			}
+			return nil
+		case network.MsgCommand:
+			if len(msg.CommandJSON) > 0 {
+				socket.HandleMessage(msg.CommandJSON)
+			}
+		}
+	}
+}
+
 // Send sends a command with payload over the persistent connection (thread-safe)
 func (m *Manager) Send(action string, data interface{}) error {
 	m.mu.Lock()
@@ -126,8 +194,61 @@ func (m *Manager) Send(action string, data interface{}) error {
 }
 
 // StartReceiveLoop starts the background goroutine to receive messages
+// and keeps the access token fresh while the agent runs
 func (m *Manager) StartReceiveLoop() {
 	go m.receiveLoop()
+	go m.refreshLoop()
+}
+
+func (m *Manager) currentToken() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.token
+}
+
+// refresh exchanges the stored refresh token for a new access token; the
+// backend updates the token of the live connection as well
+func (m *Manager) refresh() (string, error) {
+	token, err := auth.Refresh(m.host, m.port, m.deviceID)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	m.token = token
+	m.mu.Unlock()
+	return token, nil
+}
+
+// refreshLoop refreshes the access token shortly before it expires. Tokens
+// without an expiry (older backends) are left alone.
+func (m *Manager) refreshLoop() {
+	for {
+		exp := auth.TokenExpiry(m.currentToken())
+		if exp.IsZero() {
+			return
+		}
+		wait := time.Until(exp) - refreshBefore
+		if wait < 0 {
+			wait = 0
+		}
+		select {
+		case <-m.stopCh:
+			return
+		case <-time.After(wait):
+		}
+		if _, err := m.refresh(); err != nil {
+			if errors.Is(err, auth.ErrRefreshRejected) || errors.Is(err, auth.ErrNoRefreshToken) {
+				logger.Errorf("Access token can no longer be refreshed, restart the agent to log in again: %v", err)
+				return
+			}
+			logger.Warnf("Token refresh failed, retrying in %v: %v", refreshRetry, err)
+			select {
+			case <-m.stopCh:
+				return
+			case <-time.After(refreshRetry):
+			}
+		}
+	}
 }
 
 // receiveLoop continuously receives messages from the backend
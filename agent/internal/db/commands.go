@@ -0,0 +1,74 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// ClaimCommand ghi nhận command ID trước khi thực thi. Trả về false kèm bản ghi
+// cũ nếu ID đã được nhận trước đó (replay); unique index đảm bảo hai lần giao
+// đồng thời chỉ một lần được claim.
+func ClaimCommand(id uint, name string) (bool, *ExecutedCommand, error) {
+	adb := Get()
+	if adb == nil {
+		return false, nil, errors.New("local db not initialized")
+	}
+	now := time.Now()
+	row := ExecutedCommand{CommandID: id, Name: name, Status: "running", ReceivedAt: now, UpdatedAt: now}
+	res := adb.Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+	if res.Error != nil {
+		return false, nil, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return true, nil, nil
+	}
+	var prev ExecutedCommand
+	if err := adb.Where("command_id = ?", id).First(&prev).Error; err != nil {
+		return false, nil, err
+	}
+	return false, &prev, nil
+}
+
+// FinishCommand cập nhật kết quả thực thi của command đã claim.
+func FinishCommand(id uint, status, errMsg string) error {
+	adb := Get()
+	if adb == nil {
+		return errors.New("local db not initialized")
+	}
+	if len(errMsg) > 512 {
+		errMsg = errMsg[:512]
+	}
+	return adb.Model(&ExecutedCommand{}).
+		Where("command_id = ?", id).
+		Updates(map[string]any{"status": status, "error": errMsg, "updated_at": time.Now()}).Error
+}
+
+// PruneExecutedCommands xóa bản ghi cũ; backend không gửi lại command đã quá hạn
+// nên không cần giữ lâu hơn thời hạn tối đa của command.
+func PruneExecutedCommands(before time.Time) (int64, error) {
+	adb := Get()
+	if adb == nil {
+		return 0, errors.New("local db not initialized")
+	}
+	res := adb.Where("received_at < ?", before).Delete(&ExecutedCommand{})
+	return res.RowsAffected, res.Error
+}
+
+// UseNonce đánh dấu nonce đã dùng; trả về false nếu nonce đã xuất hiện (replay).
+// Nonce đã hết hạn được dọn luôn vì chữ ký kèm nó không còn được chấp nhận.
+func UseNonce(nonce string, expiresAt time.Time) (bool, error) {
+	adb := Get()
+	if adb == nil {
+		return false, errors.New("local db not initialized")
+	}
+	if err := adb.Where("expires_at < ?", time.Now()).Delete(&UsedNonce{}).Error; err != nil {
+		return false, err
+	}
+	res := adb.Clauses(clause.OnConflict{DoNothing: true}).Create(&UsedNonce{Nonce: nonce, ExpiresAt: expiresAt})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
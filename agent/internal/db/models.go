@@ -20,3 +20,52 @@ type MonitoredFile struct {
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 }
+
+// PendingBackup là backup bị hoãn do ngoài backup window, chờ window mở để upload.
+type PendingBackup struct {
+	ID            uint   `gorm:"primaryKey"`
+	Path          string `gorm:"uniqueIndex"`
+	QueuedAt      time.Time
+	Attempts      int        // số lần đã đẩy lại vào pipeline
+	LastError     string     `gorm:"size:1024"`
+	NextAttemptAt *time.Time `gorm:"index"` // nil = thử ngay khi window mở
+}
+
+// AgentSetting lưu các thiết lập do command áp dụng (JSON) để khôi phục sau khi restart.
+type AgentSetting struct {
+	ID        uint   `gorm:"primaryKey"`
+	Key       string `gorm:"size:191;uniqueIndex"`
+	Value     string `gorm:"type:text"`
+	UpdatedAt time.Time
+}
+
+// ExecutedCommand ghi nhận command (theo ID backend) đã được nhận để lần gửi lại
+// không chạy lại lần nữa.
+type ExecutedCommand struct {
+	ID         uint   `gorm:"primaryKey"`
+	CommandID  uint   `gorm:"uniqueIndex"`
+	Name       string `gorm:"size:64"`
+	Status     string `gorm:"size:32"` // running, done, failed, started, expired
+	Error      string `gorm:"size:512"`
+	ReceivedAt time.Time
+	UpdatedAt  time.Time
+}
+
+// UsedNonce lưu nonce của command đã ký đã được chấp nhận, để cùng một frame
+// không thể bị phát lại trước khi chữ ký hết hạn.
+type UsedNonce struct {
+	ID        uint      `gorm:"primaryKey"`
+	Nonce     string    `gorm:"size:64;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// OsqueryPackState giữ tập kết quả lần chạy trước của một query trong pack để
+// lần sau chỉ gửi các dòng thêm/bớt (giống differential log của osqueryd).
+type OsqueryPackState struct {
+	ID        uint   `gorm:"primaryKey"`
+	QueryKey  string `gorm:"size:191;uniqueIndex"` // "pack/query"
+	QueryHash string `gorm:"size:64"`              // query đổi nội dung thì bỏ kết quả cũ
+	RowsJSON  string `gorm:"type:text"`            // JSON array các dòng; rỗng = chưa có kết quả
+	Counter   uint64 // số lần đã gửi diff
+	LastRunAt time.Time
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"errors"
+
+	"gorm.io/gorm/clause"
+)
+
+// LoadPackStates trả về trạng thái của mọi query trong pack, theo QueryKey.
+func LoadPackStates() (map[string]OsqueryPackState, error) {
+	adb := Get()
+	if adb == nil {
+		return nil, errors.New("local db not initialized")
+	}
+	var rows []OsqueryPackState
+	if err := adb.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[string]OsqueryPackState, len(rows))
+	for _, r := range rows {
+		out[r.QueryKey] = r
+	}
+	return out, nil
+}
+
+// SavePackState ghi đè trạng thái của một query (theo QueryKey).
+func SavePackState(st OsqueryPackState) error {
+	adb := Get()
+	if adb == nil {
+		return errors.New("local db not initialized")
+	}
+	st.ID = 0
+	return adb.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "query_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"query_hash", "rows_json", "counter", "last_run_at"}),
+	}).Create(&st).Error
+}
+
+// PrunePackStates xóa trạng thái của các query không còn được giao.
+func PrunePackStates(keep []string) error {
+	adb := Get()
+	if adb == nil {
+		return errors.New("local db not initialized")
+	}
+	q := adb.Where("1 = 1")
+	if len(keep) > 0 {
+		q = adb.Where("query_key NOT IN ?", keep)
+	}
+	return q.Delete(&OsqueryPackState{}).Error
+}
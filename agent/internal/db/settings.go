@@ -0,0 +1,56 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Khóa của các thiết lập trong bảng agent_settings.
+const (
+	SettingBackupEnabled  = "backup.enabled"
+	SettingBackupThrottle = "backup.throttle"
+	SettingWebsiteBlock   = "website_block"
+	SettingMonitorPaths   = "monitor.paths"
+	SettingOsqueryPacks   = "osquery.packs"
+)
+
+// SaveSetting ghi đè giá trị (JSON) của key.
+func SaveSetting(key string, value any) error {
+	adb := Get()
+	if adb == nil {
+		return errors.New("local db not initialized")
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encode setting %s: %w", key, err)
+	}
+	row := AgentSetting{Key: key, Value: string(b), UpdatedAt: time.Now()}
+	return adb.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&row).Error
+}
+
+// LoadSetting đọc key vào out; trả về false nếu key chưa từng được lưu.
+func LoadSetting(key string, out any) (bool, error) {
+	adb := Get()
+	if adb == nil {
+		return false, errors.New("local db not initialized")
+	}
+	// Find + Limit thay vì First để key chưa có không bị log như lỗi
+	var rows []AgentSetting
+	if err := adb.Where("key = ?", key).Limit(1).Find(&rows).Error; err != nil {
+		return false, err
+	}
+	if len(rows) == 0 {
+		return false, nil
+	}
+	if err := json.Unmarshal([]byte(rows[0].Value), out); err != nil {
+		return false, fmt.Errorf("decode setting %s: %w", key, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,79 @@
+// Package identity giữ credential của device: private key Ed25519 sinh lúc
+// enroll (lưu cạnh token) và fingerprint phần cứng gửi kèm mỗi lần chứng minh
+// danh tính với backend.
+package identity
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"sagiri-guard/agent/internal/config"
+	"sagiri-guard/agent/internal/inventory"
+	"sagiri-guard/cmdsign"
+	"sagiri-guard/devicekey"
+)
+
+var cache struct {
+	sync.Mutex
+	key         ed25519.PrivateKey
+	fingerprint string
+}
+
+// KeyPath là file chứa seed của private key (quyền 0600), cùng thư mục với token.
+func KeyPath() string {
+	return filepath.Join(filepath.Dir(config.TokenFilePath()), "device.key")
+}
+
+// Key đọc private key của device, sinh mới nếu chưa có.
+func Key() (ed25519.PrivateKey, error) {
+	cache.Lock()
+	defer cache.Unlock()
+	if cache.key != nil {
+		return cache.key, nil
+	}
+	key, err := cmdsign.LoadOrCreateKey(KeyPath())
+	if err != nil {
+		return nil, fmt.Errorf("load device key: %w", err)
+	}
+	cache.key = key
+	return key, nil
+}
+
+// PublicKey trả về public key base64 gửi cho backend lúc enroll.
+func PublicKey() (string, error) {
+	key, err := Key()
+	if err != nil {
+		return "", err
+	}
+	return cmdsign.EncodePublicKey(key.Public().(ed25519.PublicKey)), nil
+}
+
+// Fingerprint trả về fingerprint phần cứng của máy; tính một lần cho mỗi tiến trình.
+func Fingerprint() (string, error) {
+	cache.Lock()
+	defer cache.Unlock()
+	if cache.fingerprint != "" {
+		return cache.fingerprint, nil
+	}
+	si, err := inventory.Collect()
+	if err != nil {
+		return "", fmt.Errorf("collect inventory for fingerprint: %w", err)
+	}
+	cache.fingerprint = inventory.Fingerprint(si)
+	return cache.fingerprint, nil
+}
+
+// Prove ký challenge của backend; trả về chữ ký và fingerprint gửi kèm.
+func Prove(deviceID, nonce string) (string, string, error) {
+	key, err := Key()
+	if err != nil {
+		return "", "", err
+	}
+	fp, err := Fingerprint()
+	if err != nil {
+		return "", "", err
+	}
+	return devicekey.Sign(key, deviceID, nonce, fp), fp, nil
+}
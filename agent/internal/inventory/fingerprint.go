@@ -0,0 +1,25 @@
+package inventory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Fingerprint băm định danh ổn định của máy để backend phát hiện credential bị
+// chép sang máy khác. Chỉ dùng machine-id đọc trực tiếp: product_uuid/serial cần
+// quyền root và UUID/CPU khác nhau giữa osquery và collector native, nên cùng một
+// máy chạy với quyền hay nguồn khác sẽ ra fingerprint khác. HĐH không có
+// machine-id (agent dùng osquery) mới rơi về UUID của system_info.
+func Fingerprint(si System) string {
+	return fingerprintOf(readMachineID(), si.UUID)
+}
+
+func fingerprintOf(machineID, uuid string) string {
+	id := strings.ToLower(strings.TrimSpace(machineID))
+	if id == "" {
+		id = "uuid:" + strings.ToUpper(strings.TrimSpace(uuid))
+	}
+	sum := sha256.Sum256([]byte("v1|" + id))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,33 @@
+package inventory
+
+import "testing"
+
+func TestFingerprintOf(t *testing.T) {
+	const mid = "0123456789abcdef0123456789abcdef"
+	base := fingerprintOf(mid, "")
+	tests := []struct {
+		name      string
+		machineID string
+		uuid      string
+		same      bool
+	}{
+		{"uuid ignored when machine-id present", mid, "4C4C4544-0000-1000-8000-B0C04F000000", true},
+		{"machine-id case and spaces", " 0123456789ABCDEF0123456789ABCDEF\n", "", true},
+		{"different machine-id", "fedcba9876543210fedcba9876543210", "", false},
+		{"uuid fallback differs", "", mid, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fingerprintOf(tt.machineID, tt.uuid)
+			if (got == base) != tt.same {
+				t.Errorf("fingerprintOf(%q, %q) == base is %v, want %v", tt.machineID, tt.uuid, got == base, tt.same)
+			}
+			if len(got) != 64 {
+				t.Errorf("fingerprint length = %d, want 64", len(got))
+			}
+		})
+	}
+	if fingerprintOf("", "abc-def") != fingerprintOf("", " ABC-DEF ") {
+		t.Error("uuid fallback should be case and space insensitive")
+	}
+}
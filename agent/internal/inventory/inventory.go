@@ -0,0 +1,95 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"sagiri-guard/agent/internal/config"
+	"sagiri-guard/agent/internal/logger"
+	osq "sagiri-guard/agent/internal/osquery"
+)
+
+// Nguồn thu thập thông tin máy (agent.inventory.source).
+const (
+	SourceAuto    = "auto"    // osquery nếu có osqueryi, lỗi thì dùng collector native
+	SourceNative  = "native"  // chỉ đọc /etc, /sys, /proc (Linux)
+	SourceOsquery = "osquery" // chỉ dùng osqueryi
+)
+
+// System là thông tin định danh/phần cứng của máy dùng khi đăng ký device.
+type System struct {
+	UUID      string `json:"uuid"`
+	MachineID string `json:"machine_id,omitempty"`
+	Hostname  string `json:"hostname"`
+	Vendor    string `json:"vendor,omitempty"`
+	Hardware  string `json:"hardware_model"`
+	Serial    string `json:"serial,omitempty"`
+	CPUBrand  string `json:"cpu_brand"`
+	CPUCores  int    `json:"cpu_cores,omitempty"`
+	MemoryMB  int64  `json:"memory_mb,omitempty"`
+	OSName    string `json:"os_name"`
+	OSVersion string `json:"os_version"`
+	Kernel    string `json:"kernel,omitempty"`
+	Arch      string `json:"arch,omitempty"`
+	Source    string `json:"source"` // native | osquery
+}
+
+var ErrNativeUnsupported = errors.New("native inventory collector is not supported on this OS")
+
+// Collect thu thập thông tin máy theo nguồn được cấu hình.
+func Collect() (System, error) {
+	source := strings.ToLower(strings.TrimSpace(config.Get().InventorySource))
+	switch source {
+	case SourceNative:
+		return Native()
+	case SourceOsquery:
+		return fromOsquery()
+	case "", SourceAuto:
+		if osqueryAvailable() {
+			si, err := fromOsquery()
+			if err == nil {
+				return si, nil
+			}
+			logger.Warnf("osquery inventory failed, falling back to native collector: %v", err)
+		}
+		si, err := Native()
+		if errors.Is(err, ErrNativeUnsupported) {
+			return si, fmt.Errorf("osquery not available and %w", err)
+		}
+		return si, err
+	default:
+		return System{}, fmt.Errorf("unknown inventory source %q", source)
+	}
+}
+
+func osqueryAvailable() bool {
+	bin := config.Get().OsqueryPath
+	if bin == "" {
+		bin = "osqueryi"
+	}
+	if strings.ContainsRune(bin, os.PathSeparator) {
+		st, err := os.Stat(bin)
+		return err == nil && !st.IsDir()
+	}
+	_, err := exec.LookPath(bin)
+	return err == nil
+}
+
+func fromOsquery() (System, error) {
+	si, osv, err := osq.Collect()
+	if err != nil {
+		return System{}, err
+	}
+	return System{
+		UUID:      si.UUID,
+		Hostname:  si.Hostname,
+		Hardware:  si.Hardware,
+		CPUBrand:  si.CPUBrand,
+		OSName:    osv.Name,
+		OSVersion: osv.Version,
+		Source:    SourceOsquery,
+	}, nil
+}
@@ -0,0 +1,171 @@
+//go:build linux
+
+package inventory
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const dmiDir = "/sys/class/dmi/id/"
+
+// Native đọc thông tin máy trực tiếp từ hệ thống, không cần osquery.
+// product_uuid/product_serial chỉ đọc được bằng root; khi đó UUID lấy từ /etc/machine-id.
+func Native() (System, error) {
+	si := System{Source: SourceNative}
+	si.MachineID = readMachineID()
+	si.Vendor = readTrim(dmiDir + "sys_vendor")
+	si.Hardware = readTrim(dmiDir + "product_name")
+	si.Serial = readTrim(dmiDir + "product_serial")
+	if si.Hardware == "" {
+		// một số máy ảo/ARM không có product_name
+		si.Hardware = readTrim(dmiDir + "board_name")
+	}
+	if si.Hardware == "" {
+		si.Hardware = readTrim("/proc/device-tree/model")
+	}
+
+	if u, ok := normalizeDMIUUID(readTrim(dmiDir + "product_uuid")); ok {
+		si.UUID = u
+	} else if si.MachineID != "" {
+		si.UUID = machineIDToUUID(si.MachineID)
+	}
+
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err == nil {
+		si.Hostname = unix.ByteSliceToString(uts.Nodename[:])
+		si.Kernel = unix.ByteSliceToString(uts.Release[:])
+		si.Arch = unix.ByteSliceToString(uts.Machine[:])
+	}
+	if h, err := os.Hostname(); err == nil && h != "" {
+		si.Hostname = h
+	}
+
+	if f, err := os.Open("/etc/os-release"); err == nil {
+		si.OSName, si.OSVersion = parseOSRelease(f)
+		f.Close()
+	} else if f, err := os.Open("/usr/lib/os-release"); err == nil {
+		si.OSName, si.OSVersion = parseOSRelease(f)
+		f.Close()
+	}
+	if si.OSName == "" {
+		si.OSName = "Linux"
+	}
+	if si.OSVersion == "" {
+		si.OSVersion = si.Kernel
+	}
+
+	if f, err := os.Open("/proc/cpuinfo"); err == nil {
+		si.CPUBrand, si.CPUCores = parseCPUInfo(f)
+		f.Close()
+	}
+	if f, err := os.Open("/proc/meminfo"); err == nil {
+		si.MemoryMB = parseMemTotalMB(f)
+		f.Close()
+	}
+
+	if si.UUID == "" && si.Hostname == "" {
+		return si, errors.New("cannot determine machine identity (no product_uuid, machine-id or hostname)")
+	}
+	return si, nil
+}
+
+func readTrim(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(b), "\x00"))
+}
+
+func readMachineID() string {
+	for _, p := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if id := readTrim(p); len(id) == 32 {
+			return strings.ToLower(id)
+		}
+	}
+	return ""
+}
+
+// normalizeDMIUUID chuẩn hóa product_uuid về dạng chữ hoa như osquery system_info.uuid;
+// bỏ các giá trị placeholder của firmware (toàn 0 hoặc toàn F).
+func normalizeDMIUUID(s string) (string, bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if len(s) != 36 {
+		return "", false
+	}
+	hex := strings.ReplaceAll(s, "-", "")
+	if strings.Trim(hex, "0") == "" || strings.Trim(hex, "F") == "" {
+		return "", false
+	}
+	return s, true
+}
+
+// machineIDToUUID định dạng machine-id (32 hex) thành chuỗi kiểu UUID 8-4-4-4-12.
+func machineIDToUUID(id string) string {
+	id = strings.ToUpper(id)
+	return id[0:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:32]
+}
+
+// parseOSRelease trả về NAME và VERSION_ID (hoặc VERSION) của /etc/os-release.
+func parseOSRelease(f *os.File) (name, version string) {
+	var fallback string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		k, v, ok := strings.Cut(strings.TrimSpace(sc.Text()), "=")
+		if !ok {
+			continue
+		}
+		v = strings.Trim(v, `"'`)
+		switch k {
+		case "NAME":
+			name = v
+		case "VERSION_ID":
+			version = v
+		case "VERSION":
+			fallback = v
+		}
+	}
+	if version == "" {
+		version = fallback
+	}
+	return name, version
+}
+
+// parseCPUInfo lấy tên CPU và số logical core từ /proc/cpuinfo.
+func parseCPUInfo(f *os.File) (brand string, cores int) {
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		k, v, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		switch k {
+		case "processor":
+			cores++
+		case "model name", "Hardware", "cpu model":
+			if brand == "" {
+				brand = v
+			}
+		}
+	}
+	return brand, cores
+}
+
+func parseMemTotalMB(f *os.File) int64 {
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, _ := strconv.ParseInt(fields[1], 10, 64)
+			return kb / 1024
+		}
+	}
+	return 0
+}
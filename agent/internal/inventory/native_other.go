@@ -0,0 +1,10 @@
+//go:build !linux
+
+package inventory
+
+// Native chỉ hỗ trợ Linux; trên HĐH khác agent cần osquery.
+func Native() (System, error) {
+	return System{Source: SourceNative}, ErrNativeUnsupported
+}
+
+func readMachineID() string { return "" }
@@ -0,0 +1,100 @@
+package inventory
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report là inventory đầy đủ gửi định kỳ lên backend (action inventory_report).
+type Report struct {
+	System     System      `json:"system"`
+	Disks      []Disk      `json:"disks"`
+	Interfaces []Interface `json:"interfaces"`
+	Packages   []Package   `json:"packages"`
+	Users      []User      `json:"users"`
+	Truncated  bool        `json:"truncated,omitempty"` // danh sách package bị cắt cho vừa một frame
+	UnixTime   int64       `json:"unix_time"`
+}
+
+type Disk struct {
+	Device string `json:"device"`
+	Mount  string `json:"mount"`
+	FSType string `json:"fs_type"`
+	SizeMB int64  `json:"size_mb"`
+}
+
+type Interface struct {
+	Name  string   `json:"name"`
+	MAC   string   `json:"mac,omitempty"`
+	Addrs []string `json:"addrs,omitempty"`
+}
+
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Manager string `json:"manager"` // dpkg | rpm
+}
+
+type User struct {
+	Name  string `json:"name"`
+	UID   int    `json:"uid"`
+	Home  string `json:"home,omitempty"`
+	Shell string `json:"shell,omitempty"`
+}
+
+// maxPackages giữ report dưới giới hạn 1MB/frame của protocol.
+const maxPackages = 8000
+
+// CollectReport thu thập inventory đầy đủ; phần nào không đọc được thì để trống.
+func CollectReport() (Report, error) {
+	si, err := Collect()
+	if err != nil {
+		return Report{}, err
+	}
+	r := Report{
+		System:     si,
+		Disks:      collectDisks(),
+		Interfaces: collectInterfaces(),
+		Packages:   collectPackages(),
+		Users:      collectUsers(),
+		UnixTime:   time.Now().Unix(),
+	}
+	sort.Slice(r.Disks, func(i, j int) bool { return r.Disks[i].Mount < r.Disks[j].Mount })
+	sort.Slice(r.Packages, func(i, j int) bool {
+		if r.Packages[i].Name != r.Packages[j].Name {
+			return r.Packages[i].Name < r.Packages[j].Name
+		}
+		return r.Packages[i].Manager < r.Packages[j].Manager
+	})
+	sort.Slice(r.Users, func(i, j int) bool { return r.Users[i].Name < r.Users[j].Name })
+	if len(r.Packages) > maxPackages {
+		r.Packages, r.Truncated = r.Packages[:maxPackages], true
+	}
+	return r, nil
+}
+
+// collectInterfaces liệt kê card mạng (bỏ loopback) kèm MAC và địa chỉ IP.
+func collectInterfaces() []Interface {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	out := make([]Interface, 0, len(ifaces))
+	for _, ifc := range ifaces {
+		if ifc.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		it := Interface{Name: ifc.Name, MAC: strings.ToLower(ifc.HardwareAddr.String())}
+		if addrs, err := ifc.Addrs(); err == nil {
+			for _, a := range addrs {
+				it.Addrs = append(it.Addrs, a.String())
+			}
+			sort.Strings(it.Addrs)
+		}
+		out = append(out, it)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
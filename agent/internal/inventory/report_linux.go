@@ -0,0 +1,154 @@
+//go:build linux
+
+package inventory
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// collectDisks đọc các filesystem gắn từ thiết bị khối trong /proc/mounts.
+func collectDisks() []Disk {
+	f, err := os.Open("/proc/mounts")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	seen := map[string]bool{}
+	var out []Disk
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "/dev/") || seen[fields[1]] {
+			continue
+		}
+		seen[fields[1]] = true
+		d := Disk{Device: fields[0], Mount: unescapeMount(fields[1]), FSType: fields[2]}
+		var st unix.Statfs_t
+		if err := unix.Statfs(d.Mount, &st); err == nil {
+			d.SizeMB = int64(st.Blocks) * int64(st.Bsize) >> 20
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// unescapeMount giải mã "\040" (dấu cách) và các ký tự octal khác trong /proc/mounts.
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// collectPackages đọc database dpkg; máy dùng rpm thì hỏi qua lệnh rpm.
+func collectPackages() []Package {
+	pkgs := dpkgPackages("/var/lib/dpkg/status")
+	return append(pkgs, rpmPackages()...)
+}
+
+func dpkgPackages(path string) []Package {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var out []Package
+	var name, version, status string
+	flush := func() {
+		if name != "" && strings.HasSuffix(status, " installed") {
+			out = append(out, Package{Name: name, Version: version, Manager: "dpkg"})
+		}
+		name, version, status = "", "", ""
+	}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(line, " ") {
+			continue
+		}
+		switch k {
+		case "Package":
+			name = strings.TrimSpace(v)
+		case "Version":
+			version = strings.TrimSpace(v)
+		case "Status":
+			status = strings.TrimSpace(v)
+		}
+	}
+	flush()
+	return out
+}
+
+func rpmPackages() []Package {
+	bin, err := exec.LookPath("rpm")
+	if err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	raw, err := exec.CommandContext(ctx, bin, "-qa", "--qf", `%{NAME}\t%{VERSION}-%{RELEASE}\n`).Output()
+	if err != nil {
+		return nil
+	}
+	var out []Package
+	for _, line := range strings.Split(string(raw), "\n") {
+		name, version, ok := strings.Cut(line, "\t")
+		if !ok || name == "" || name == "gpg-pubkey" {
+			continue
+		}
+		out = append(out, Package{Name: name, Version: version, Manager: "rpm"})
+	}
+	return out
+}
+
+// collectUsers đọc tài khoản local trong /etc/passwd.
+func collectUsers() []User {
+	f, err := os.Open("/etc/passwd")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var out []User
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, ":")
+		if len(parts) < 7 {
+			continue
+		}
+		uid, err := strconv.Atoi(parts[2])
+		if err != nil {
+			continue
+		}
+		out = append(out, User{Name: parts[0], UID: uid, Home: parts[5], Shell: parts[6]})
+	}
+	return out
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package inventory
+
+// Ổ đĩa, package và user chỉ thu thập native trên Linux.
+func collectDisks() []Disk       { return nil }
+func collectPackages() []Package { return nil }
+func collectUsers() []User       { return nil }
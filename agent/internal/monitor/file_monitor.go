@@ -10,6 +10,7 @@ import (
 	"runtime"
 	dbpkg "sagiri-guard/agent/internal/db"
 	"sagiri-guard/agent/internal/logger"
+	"sagiri-guard/agent/internal/pathpolicy"
 	"sync"
 	"time"
 	"unicode/utf16"
@@ -344,6 +345,10 @@ func flushExpiredRenames(queue []pendingRename, now time.Time, out chan<- FileEv
 }
 
 func emitEvent(out chan<- FileEvent, evt FileEvent) {
+	// ReadDirectoryChangesW theo dõi cả cây nên thư mục bị exclude chỉ lọc được ở mức event
+	if pathpolicy.Active().Excluded(evt.Path) {
+		return
+	}
 	persistMonitoredFile(evt)
 	select {
 	case out <- evt:
@@ -483,6 +488,11 @@ func shouldMarkPending(action ActionType) bool {
 	}
 }
 
+// WatchCount trả về số thư mục gốc đang được theo dõi (mỗi thư mục một handle đệ quy).
+func (f *FileMonitor) WatchCount() int {
+	return len(f.targets)
+}
+
 // Close giải phóng mọi handle và yêu cầu toàn bộ goroutine dừng lại.
 func (f *FileMonitor) Close() error {
 	var closeErr error
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	dbpkg "sagiri-guard/agent/internal/db"
 	"sagiri-guard/agent/internal/logger"
+	"sagiri-guard/agent/internal/pathpolicy"
 	"sync"
 	"time"
 
@@ -151,7 +152,7 @@ func (f *FileMonitor) handleEvent(evt fsnotify.Event, out chan<- FileEvent) {
 			Path:      path,
 			Timestamp: now,
 		})
-		if f.isDir(path) {
+		if f.isDir(path) && !pathpolicy.Active().Excluded(path) {
 			if err := f.watchRecursive(path); err != nil {
 				logger.Warnf("Failed to watch new directory %s: %v", path, err)
 			}
@@ -195,6 +196,10 @@ func (f *FileMonitor) watchRecursive(root string) error {
 		if !d.IsDir() {
 			return nil
 		}
+		// Không thêm inotify watch cho cây thư mục bị exclude (node_modules, .git, ...)
+		if path != root && pathpolicy.Active().Excluded(path) {
+			return filepath.SkipDir
+		}
 		return f.addWatch(path)
 	})
 }
@@ -217,6 +222,13 @@ func (f *FileMonitor) addWatch(dir string) error {
 	return nil
 }
 
+// WatchCount trả về số thư mục đang có inotify watch.
+func (f *FileMonitor) WatchCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.watchedDir)
+}
+
 func (f *FileMonitor) removeWatch(path string) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -250,6 +262,9 @@ func (f *FileMonitor) Close() error {
 }
 
 func emitEvent(out chan<- FileEvent, evt FileEvent) {
+	if pathpolicy.Active().Excluded(evt.Path) {
+		return
+	}
 	persistMonitoredFile(evt)
 	select {
 	case out <- evt:
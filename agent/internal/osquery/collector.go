@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os/exec"
 	"sagiri-guard/agent/internal/config"
+	"strings"
 	"time"
 )
 
@@ -21,23 +23,75 @@ type OSVersion struct {
 	Version string `json:"version"`
 }
 
-func runJSON(query string, out interface{}) error {
+// QueryResult là kết quả một truy vấn osquery tùy ý (command osquery_run).
+type QueryResult struct {
+	Rows       []map[string]any `json:"rows"`
+	RowCount   int              `json:"row_count"` // tổng số dòng osquery trả về
+	Truncated  bool             `json:"truncated,omitempty"`
+	DurationMs int64            `json:"duration_ms"`
+}
+
+// runRows chạy osqueryi --json và trả về mọi dòng kết quả.
+func runRows(query string, timeout time.Duration) ([]map[string]any, error) {
 	bin := config.Get().OsqueryPath
 	if bin == "" {
 		bin = "osqueryi"
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	cmd := exec.CommandContext(ctx, bin, "--json", query)
 	raw, err := cmd.Output()
 	if ctx.Err() == context.DeadlineExceeded {
-		return errors.New("osquery timeout")
+		return nil, errors.New("osquery timeout")
 	}
 	if err != nil {
-		return err
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("osquery: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
 	}
 	var arr []map[string]any
 	if err := json.Unmarshal(raw, &arr); err != nil {
+		return nil, err
+	}
+	return arr, nil
+}
+
+// Query chạy truy vấn của admin, giữ tối đa maxRows dòng và tổng dung lượng JSON
+// của các dòng không vượt maxBytes (để vừa một frame gửi về backend).
+func Query(query string, timeout time.Duration, maxRows, maxBytes int) (QueryResult, error) {
+	start := time.Now()
+	rows, err := runRows(query, timeout)
+	res := QueryResult{DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		return res, err
+	}
+	res.RowCount = len(rows)
+	res.Rows = make([]map[string]any, 0, len(rows))
+	size := 0
+	for _, row := range rows {
+		if maxRows > 0 && len(res.Rows) >= maxRows {
+			res.Truncated = true
+			break
+		}
+		b, err := json.Marshal(row)
+		if err != nil {
+			return res, err
+		}
+		if maxBytes > 0 && size+len(b)+1 > maxBytes {
+			res.Truncated = true
+			break
+		}
+		size += len(b) + 1
+		res.Rows = append(res.Rows, row)
+	}
+	return res, nil
+}
+
+func runJSON(query string, out interface{}) error {
+	arr, err := runRows(query, 5*time.Second)
+	if err != nil {
 		return err
 	}
 	if len(arr) == 0 {
@@ -0,0 +1,226 @@
+// Package pathpolicy quyết định file nào dưới các thư mục theo dõi được watch/backup.
+package pathpolicy
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy áp dụng cho mọi file dưới Root. Pattern so với đường dẫn tương đối
+// (dùng "/"), hỗ trợ "**"; pattern không có "/" được so với từng segment
+// (ví dụ "node_modules", "*.tmp").
+type Policy struct {
+	Root       string
+	Include    []string // rỗng = mọi file
+	Exclude    []string
+	MaxSize    int64    // byte; 0 = không giới hạn
+	Extensions []string // ".docx", ".pdf"; rỗng = mọi đuôi
+	Debounce   time.Duration
+}
+
+// Normalize chuẩn hóa Root và Extensions, kiểm tra cú pháp pattern.
+func (p *Policy) Normalize() error {
+	abs, err := filepath.Abs(p.Root)
+	if err != nil {
+		return fmt.Errorf("resolve root %s: %w", p.Root, err)
+	}
+	p.Root = filepath.Clean(abs)
+	for _, pat := range append(append([]string{}, p.Include...), p.Exclude...) {
+		if _, err := path.Match(strings.ReplaceAll(pat, "**", "*"), ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pat, err)
+		}
+	}
+	exts := make([]string, 0, len(p.Extensions))
+	for _, ext := range p.Extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts = append(exts, ext)
+	}
+	p.Extensions = exts
+	return nil
+}
+
+// rel trả về đường dẫn tương đối dạng "a/b/c"; ok=false nếu p không nằm dưới Root.
+func (p *Policy) rel(abs string) (string, bool) {
+	r, err := filepath.Rel(p.Root, filepath.Clean(abs))
+	if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if r == "." {
+		return "", true
+	}
+	return filepath.ToSlash(r), true
+}
+
+// Excluded: path (file hoặc thư mục) khớp một exclude pattern, hoặc nằm trong thư mục bị exclude.
+func (p *Policy) Excluded(abs string) bool {
+	r, ok := p.rel(abs)
+	if !ok || r == "" {
+		return false
+	}
+	segs := strings.Split(r, "/")
+	for i := range segs {
+		prefix := segs[:i+1]
+		for _, pat := range p.Exclude {
+			if matchPattern(pat, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Allows kiểm tra đầy đủ policy cho một file sắp backup.
+func (p *Policy) Allows(abs string, size int64) bool {
+	r, ok := p.rel(abs)
+	if !ok || r == "" || p.Excluded(abs) {
+		return false
+	}
+	if p.MaxSize > 0 && size > p.MaxSize {
+		return false
+	}
+	if len(p.Extensions) > 0 {
+		ext := strings.ToLower(filepath.Ext(abs))
+		found := false
+		for _, e := range p.Extensions {
+			if e == ext {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(p.Include) == 0 {
+		return true
+	}
+	segs := strings.Split(r, "/")
+	for _, pat := range p.Include {
+		if matchPattern(pat, segs) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern so pattern với đường dẫn đã tách segment.
+func matchPattern(pattern string, segs []string) bool {
+	pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+	if pattern == "" {
+		return false
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, segs[len(segs)-1])
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), segs)
+}
+
+func matchSegments(pat, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			rest := pat[1:]
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(rest, segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
+// Set là tập policy theo root; path thuộc policy có Root dài nhất chứa nó.
+type Set struct {
+	policies []Policy
+}
+
+func NewSet(policies []Policy) (*Set, error) {
+	s := &Set{}
+	for _, p := range policies {
+		if err := p.Normalize(); err != nil {
+			return nil, err
+		}
+		s.policies = append(s.policies, p)
+	}
+	return s, nil
+}
+
+// For trả về policy áp dụng cho path; nil nếu path không thuộc root nào có policy.
+func (s *Set) For(abs string) *Policy {
+	if s == nil {
+		return nil
+	}
+	var best *Policy
+	for i := range s.policies {
+		p := &s.policies[i]
+		if _, ok := p.rel(abs); !ok {
+			continue
+		}
+		if best == nil || len(p.Root) > len(best.Root) {
+			best = p
+		}
+	}
+	return best
+}
+
+// Excluded: path bị exclude bởi policy của nó (không có policy = không exclude).
+func (s *Set) Excluded(abs string) bool {
+	if p := s.For(abs); p != nil {
+		return p.Excluded(abs)
+	}
+	return false
+}
+
+// Allows: không có policy nghĩa là backup mọi file (hành vi cũ của MonitorPaths).
+func (s *Set) Allows(abs string, size int64) bool {
+	if p := s.For(abs); p != nil {
+		return p.Allows(abs, size)
+	}
+	return true
+}
+
+// Debounce trả về khoảng debounce của policy, hoặc def nếu policy không đặt.
+func (s *Set) Debounce(abs string, def time.Duration) time.Duration {
+	if p := s.For(abs); p != nil && p.Debounce > 0 {
+		return p.Debounce
+	}
+	return def
+}
+
+var (
+	activeMu sync.RWMutex
+	active   *Set
+)
+
+// SetActive đặt tập policy dùng chung cho monitor và backup.
+func SetActive(s *Set) {
+	activeMu.Lock()
+	active = s
+	activeMu.Unlock()
+}
+
+// Active trả về tập policy hiện tại (có thể nil = không lọc).
+func Active() *Set {
+	activeMu.RLock()
+	defer activeMu.RUnlock()
+	return active
+}
@@ -0,0 +1,139 @@
+package pathpolicy
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.tmp", "a/b/c.tmp", true},
+		{"*.tmp", "a/b/c.txt", false},
+		{"node_modules", "web/node_modules", true},
+		{"docs/*.pdf", "docs/a.pdf", true},
+		{"docs/*.pdf", "x/docs/a.pdf", false},
+		{"**/build", "a/b/build", true},
+		{"**/build", "build", true},
+		{"src/**/*.go", "src/a/b/main.go", true},
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "lib/main.go", false},
+		{"/docs/", "docs", true},
+		{"", "a", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+"|"+tt.path, func(t *testing.T) {
+			if got := matchPattern(tt.pattern, splitRel(tt.path)); got != tt.want {
+				t.Errorf("matchPattern(%q, %q) = %t, want %t", tt.pattern, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func splitRel(p string) []string {
+	return strings.Split(p, "/")
+}
+
+func TestPolicyAllows(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "data")
+	p := Policy{
+		Root:       root,
+		Include:    []string{"docs/**", "*.xlsx"},
+		Exclude:    []string{"node_modules", "*.tmp", "docs/private/**"},
+		MaxSize:    1000,
+		Extensions: []string{"PDF", ".xlsx", ""},
+	}
+	if err := p.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	in := func(rel string) string { return filepath.Join(root, filepath.FromSlash(rel)) }
+	tests := []struct {
+		name string
+		path string
+		size int64
+		want bool
+	}{
+		{"included pdf", in("docs/a/report.pdf"), 10, true},
+		{"extension case insensitive", in("docs/REPORT.PDF"), 10, true},
+		{"include by name anywhere", in("misc/sheet.xlsx"), 10, true},
+		{"not included", in("misc/report.pdf"), 10, false},
+		{"wrong extension", in("docs/a.docx"), 10, false},
+		{"too large", in("docs/a.pdf"), 1001, false},
+		{"excluded dir", in("docs/node_modules/a.pdf"), 10, false},
+		{"excluded subtree", in("docs/private/a.pdf"), 10, false},
+		{"outside root", filepath.Join(filepath.Dir(root), "other", "docs", "a.pdf"), 10, false},
+		{"sibling prefix", root + "2/docs/a.pdf", 10, false},
+		{"root itself", root, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Allows(tt.path, tt.size); got != tt.want {
+				t.Errorf("Allows(%q, %d) = %t, want %t", tt.path, tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	p := Policy{Root: t.TempDir(), Exclude: []string{"[bad"}}
+	if err := p.Normalize(); err == nil {
+		t.Error("Normalize accepted an invalid pattern")
+	}
+	p = Policy{Root: t.TempDir(), Extensions: []string{" DOCX ", ".Pdf", ""}}
+	if err := p.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Extensions) != 2 || p.Extensions[0] != ".docx" || p.Extensions[1] != ".pdf" {
+		t.Errorf("Extensions = %v, want [.docx .pdf]", p.Extensions)
+	}
+}
+
+func TestSetFor(t *testing.T) {
+	base := t.TempDir()
+	outer := filepath.Join(base, "home")
+	inner := filepath.Join(outer, "work")
+	s, err := NewSet([]Policy{
+		{Root: outer, Exclude: []string{"*.tmp"}},
+		{Root: inner, Debounce: 5 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		path         string
+		wantRoot     string
+		wantExcluded bool
+		wantDebounce time.Duration
+	}{
+		{"outer policy", filepath.Join(outer, "a.tmp"), outer, true, time.Second},
+		{"longest root wins", filepath.Join(inner, "a.tmp"), inner, false, 5 * time.Second},
+		{"no policy", filepath.Join(base, "other", "a.tmp"), "", false, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := ""
+			if p := s.For(tt.path); p != nil {
+				root = p.Root
+			}
+			if root != tt.wantRoot {
+				t.Errorf("For(%q).Root = %q, want %q", tt.path, root, tt.wantRoot)
+			}
+			if got := s.Excluded(tt.path); got != tt.wantExcluded {
+				t.Errorf("Excluded(%q) = %t, want %t", tt.path, got, tt.wantExcluded)
+			}
+			if got := s.Debounce(tt.path, time.Second); got != tt.wantDebounce {
+				t.Errorf("Debounce(%q) = %s, want %s", tt.path, got, tt.wantDebounce)
+			}
+		})
+	}
+	var nilSet *Set
+	if !nilSet.Allows(filepath.Join(base, "x"), 1) {
+		t.Error("nil set must allow every file")
+	}
+}
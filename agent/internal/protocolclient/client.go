@@ -2,8 +2,10 @@ package protocolclient
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 
+	"sagiri-guard/agent/internal/identity"
 	"sagiri-guard/network"
 )
 
@@ -22,8 +24,13 @@ func SendAction(host string, port int, deviceID string, token string, action str
 
 	// authorize this connection if token is available
 	if token != "" && deviceID != "" {
-		if err := c.SendLogin(deviceID, token); err != nil {
-			return nil, fmt.Errorf("send login failed: %w", err)
+		if err := Login(c, deviceID, token); err != nil {
+			// Trả ACK lỗi như phản hồi của action để caller xử lý 401 giống trước
+			var se *StatusError
+			if errors.As(err, &se) {
+				return &network.ProtocolMessage{Type: network.MsgAck, StatusCode: uint16(se.Code), StatusMsg: se.Msg}, nil
+			}
+			return nil, err
 		}
 	}
 
@@ -55,3 +62,66 @@ func SendAction(host string, port int, deviceID string, token string, action str
 		return msg, nil
 	}
 }
+
+// Login gửi login frame rồi chứng minh danh tính device: xin nonce bằng
+// identity_challenge và ký nó bằng key của device. Backend chưa gắn key cho
+// device (agent enroll trước khi có identity) thì bỏ qua bước ký.
+func Login(c *network.TCPClient, deviceID, token string) error {
+	if err := c.SendLogin(deviceID, token); err != nil {
+		return fmt.Errorf("send login failed: %w", err)
+	}
+	msg, err := request(c, "identity_challenge", nil)
+	if err != nil {
+		return fmt.Errorf("identity challenge: %w", err)
+	}
+	var ch struct {
+		Nonce string `json:"nonce"`
+		Bound bool   `json:"bound"`
+	}
+	if err := json.Unmarshal([]byte(msg.StatusMsg), &ch); err != nil {
+		return fmt.Errorf("invalid identity challenge: %w", err)
+	}
+	if !ch.Bound {
+		return nil
+	}
+	sig, fp, err := identity.Prove(deviceID, ch.Nonce)
+	if err != nil {
+		return err
+	}
+	if _, err := request(c, "identity_prove", map[string]string{"signature": sig, "fingerprint": fp}); err != nil {
+		return fmt.Errorf("identity proof: %w", err)
+	}
+	return nil
+}
+
+// request gửi một action và chờ ACK; ACK khác 200 trả về lỗi có kèm mã.
+func request(c *network.TCPClient, action string, data any) (*network.ProtocolMessage, error) {
+	b, err := json.Marshal(map[string]any{"action": action, "data": data})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.SendCommand(b); err != nil {
+		return nil, err
+	}
+	for {
+		msg, err := c.RecvProtocolMessage()
+		if err != nil {
+			return nil, err
+		}
+		if msg.Type != network.MsgAck {
+			continue
+		}
+		if msg.StatusCode != 200 {
+			return msg, &StatusError{Code: int(msg.StatusCode), Msg: msg.StatusMsg}
+		}
+		return msg, nil
+	}
+}
+
+// StatusError là ACK lỗi backend trả về trong lúc login.
+type StatusError struct {
+	Code int
+	Msg  string
+}
+
+func (e *StatusError) Error() string { return fmt.Sprintf("code=%d msg=%s", e.Code, e.Msg) }
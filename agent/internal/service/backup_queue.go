@@ -0,0 +1,140 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"sagiri-guard/agent/internal/backup"
+	"sagiri-guard/agent/internal/db"
+	"sagiri-guard/agent/internal/logger"
+
+	"gorm.io/gorm/clause"
+)
+
+var backupQueueInterval = time.Minute
+
+const (
+	pendingBackupMaxAttempts = 8             // quá số lần này row bị bỏ khỏi hàng đợi
+	pendingBackupBaseDelay   = time.Minute   // backoff sau lần thử đầu tiên
+	pendingBackupMaxDelay    = 6 * time.Hour // trần backoff
+	pendingBackupErrMax      = 1024          // khớp size cột LastError
+)
+
+// deferBackups lưu các path vào PendingBackup để upload khi backup window mở.
+func deferBackups(paths []string) {
+	adb := db.Get()
+	if adb == nil || len(paths) == 0 {
+		return
+	}
+	now := time.Now()
+	rows := make([]db.PendingBackup, 0, len(paths))
+	for _, p := range paths {
+		rows = append(rows, db.PendingBackup{Path: p, QueuedAt: now})
+	}
+	if err := adb.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error; err != nil {
+		logger.Errorf("failed to queue %d deferred backups: %v", len(paths), err)
+		return
+	}
+	logger.Infof("Deferred %d backups until backup window opens", len(paths))
+}
+
+// clearPendingBackups xóa các path đã backup xong khỏi hàng đợi.
+func clearPendingBackups(paths ...string) {
+	adb := db.Get()
+	if adb == nil || len(paths) == 0 {
+		return
+	}
+	if err := adb.Where("path IN ?", paths).Delete(&db.PendingBackup{}).Error; err != nil {
+		logger.Errorf("failed to clear pending backups: %v", err)
+	}
+}
+
+// StartBackupQueueLoop định kỳ đẩy các backup đã hoãn vào pipeline khi window mở.
+// Row chỉ bị xóa sau khi upload thành công nên vẫn còn nếu agent dừng giữa chừng.
+func StartBackupQueueLoop() {
+	go func() {
+		drainPendingBackups()
+		ticker := time.NewTicker(backupQueueInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			drainPendingBackups()
+		}
+	}()
+}
+
+// pendingBackoff là thời gian chờ trước lần thử tiếp theo sau attempts lần thử.
+func pendingBackoff(attempts int) time.Duration {
+	d := pendingBackupBaseDelay
+	for i := 1; i < attempts && d < pendingBackupMaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, pendingBackupMaxDelay)
+}
+
+// recordBackupFailure ghi lỗi gần nhất cho các path còn trong hàng đợi hoãn;
+// path không nằm trong hàng đợi được bỏ qua.
+func recordBackupFailure(cause error, paths ...string) {
+	adb := db.Get()
+	if adb == nil || cause == nil || len(paths) == 0 {
+		return
+	}
+	msg := cause.Error()
+	if len(msg) > pendingBackupErrMax {
+		msg = msg[:pendingBackupErrMax]
+	}
+	if err := adb.Model(&db.PendingBackup{}).Where("path IN ?", paths).Update("last_error", msg).Error; err != nil {
+		logger.Errorf("failed to record pending backup error: %v", err)
+	}
+}
+
+// drainPendingBackups đẩy các row tới hạn vào pipeline. Row của file đã mất,
+// bị policy loại hoặc đã thử quá pendingBackupMaxAttempts lần bị xóa; row còn
+// lại được tăng Attempts và lùi NextAttemptAt, nên một file lỗi mãi không chặn đầu hàng đợi.
+func drainPendingBackups() {
+	adb := db.Get()
+	if adb == nil || !IsBackupEnabled() {
+		return
+	}
+	now := time.Now()
+	if backup.CurrentThrottlePolicy().ShouldDefer(now) {
+		return
+	}
+	var rows []db.PendingBackup
+	if err := adb.Where("next_attempt_at IS NULL OR next_attempt_at <= ?", now).
+		Order("id ASC").Limit(backupBatchMax * 5).Find(&rows).Error; err != nil {
+		logger.Errorf("failed to load pending backups: %v", err)
+		return
+	}
+	if len(rows) == 0 {
+		return
+	}
+	logger.Infof("Backup window open, resuming %d deferred backups", len(rows))
+	var drop []string
+	for _, r := range rows {
+		if _, err := os.Stat(r.Path); errors.Is(err, os.ErrNotExist) {
+			drop = append(drop, r.Path)
+			continue
+		}
+		if backup.IsRestoreTempFile(r.Path) || !backupAllowed(r.Path) {
+			logger.Infof("Dropping deferred backup of %s: rejected by backup policy", r.Path)
+			drop = append(drop, r.Path)
+			continue
+		}
+		if r.Attempts >= pendingBackupMaxAttempts {
+			logger.Warnf("Dropping deferred backup of %s after %d attempts: %s", r.Path, r.Attempts, r.LastError)
+			drop = append(drop, r.Path)
+			continue
+		}
+		next := now.Add(pendingBackoff(r.Attempts + 1))
+		if err := adb.Model(&db.PendingBackup{}).Where("id = ?", r.ID).Updates(map[string]any{
+			"attempts":        r.Attempts + 1,
+			"next_attempt_at": next,
+		}).Error; err != nil {
+			logger.Errorf("failed to update pending backup %s: %v", r.Path, err)
+			continue
+		}
+		scheduleBackup(r.Path)
+	}
+	clearPendingBackups(drop...)
+}
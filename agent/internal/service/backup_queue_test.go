@@ -0,0 +1,26 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPendingBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 0, want: time.Minute},
+		{attempts: 1, want: time.Minute},
+		{attempts: 2, want: 2 * time.Minute},
+		{attempts: 4, want: 8 * time.Minute},
+		{attempts: 9, want: 256 * time.Minute},
+		{attempts: 10, want: 6 * time.Hour},
+		{attempts: 100, want: 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := pendingBackoff(tt.attempts); got != tt.want {
+			t.Errorf("pendingBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
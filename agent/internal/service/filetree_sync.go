@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"sagiri-guard/agent/internal/config"
@@ -35,6 +36,9 @@ type ConnectionSender interface {
 	Send(action string, data interface{}) error
 }
 
+// lastTreeSync là unix time của lần sync file tree thành công gần nhất (telemetry).
+var lastTreeSync atomic.Int64
+
 // StartFileTreeSyncLoop periodically flushes local MonitoredFile rows to backend /filetree/sync.
 func StartFileTreeSyncLoop(connMgr ConnectionSender) {
 	if connMgr == nil {
@@ -46,7 +50,9 @@ func StartFileTreeSyncLoop(connMgr ConnectionSender) {
 		for range ticker.C {
 			if err := syncFileTreeOnce(connMgr); err != nil {
 				logger.Errorf("file tree sync failed: %v", err)
+				continue
 			}
+			lastTreeSync.Store(time.Now().Unix())
 		}
 	}()
 }
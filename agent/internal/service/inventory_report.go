@@ -0,0 +1,58 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"sagiri-guard/agent/internal/inventory"
+	"sagiri-guard/agent/internal/logger"
+)
+
+const (
+	inventoryCheckInterval  = time.Hour      // thu thập lại để phát hiện thay đổi
+	inventoryResendInterval = 24 * time.Hour // gửi lại dù không đổi để backend biết inventory còn mới
+)
+
+// StartInventoryReportLoop gửi inventory khi kết nối, rồi mỗi giờ kiểm tra lại và chỉ
+// gửi khi có thay đổi (hoặc đã quá 24h từ lần gửi trước).
+func StartInventoryReportLoop(connMgr ConnectionSender) {
+	if connMgr == nil {
+		return
+	}
+	go func() {
+		var lastHash string
+		var lastSent time.Time
+		report := func() {
+			r, err := inventory.CollectReport()
+			if err != nil {
+				logger.Errorf("inventory collect failed: %v", err)
+				return
+			}
+			hash := inventoryHash(r)
+			if hash == lastHash && time.Since(lastSent) < inventoryResendInterval {
+				return
+			}
+			if err := connMgr.Send("inventory_report", r); err != nil {
+				logger.Errorf("inventory report failed: %v", err)
+				return
+			}
+			lastHash, lastSent = hash, time.Now()
+		}
+		report()
+		ticker := time.NewTicker(inventoryCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			report()
+		}
+	}()
+}
+
+// inventoryHash bỏ qua thời điểm thu thập để chỉ so nội dung.
+func inventoryHash(r inventory.Report) string {
+	r.UnixTime = 0
+	b, _ := json.Marshal(r)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
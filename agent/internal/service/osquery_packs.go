@@ -0,0 +1,285 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"sagiri-guard/agent/internal/db"
+	"sagiri-guard/agent/internal/logger"
+	"sagiri-guard/agent/internal/osquery"
+)
+
+// PackQuery là một query định kỳ trong pack do backend giao.
+type PackQuery struct {
+	Pack        string `json:"pack"`
+	Name        string `json:"name"`
+	Query       string `json:"query"`
+	IntervalSec int    `json:"interval_sec"`
+}
+
+// Key định danh query trên agent và trong bảng lịch sử của backend.
+func (q PackQuery) Key() string { return q.Pack + "/" + q.Name }
+
+// PackConfig là toàn bộ pack của device; Hash do backend tính để đối chiếu.
+type PackConfig struct {
+	Hash    string      `json:"hash"`
+	Queries []PackQuery `json:"queries"`
+}
+
+// osqueryDiff là payload action osquery_diff (khớp dto.OsqueryDiff của backend).
+type osqueryDiff struct {
+	Pack     string            `json:"pack"`
+	Name     string            `json:"name"`
+	Added    []json.RawMessage `json:"added,omitempty"`
+	Removed  []json.RawMessage `json:"removed,omitempty"`
+	Counter  uint64            `json:"counter"`
+	UnixTime int64             `json:"unix_time"`
+}
+
+const (
+	packTick         = 10 * time.Second
+	packSyncInterval = 10 * time.Minute
+	packQueryTimeout = 60 * time.Second
+	packMaxRows      = 10000
+	packMaxBytes     = 4 << 20
+	packChunkBytes   = 512 << 10 // mỗi frame osquery_diff, dưới giới hạn 1MB của protocol
+)
+
+var packs = struct {
+	sync.Mutex
+	cfg PackConfig
+}{}
+
+// SetOsqueryPacks thay cấu hình pack (từ command osquery_packs) và lưu lại để
+// khôi phục sau khi restart. Trạng thái của query bị gỡ được xóa.
+func SetOsqueryPacks(cfg PackConfig) {
+	packs.Lock()
+	packs.cfg = cfg
+	packs.Unlock()
+	if err := db.SaveSetting(db.SettingOsqueryPacks, cfg); err != nil {
+		logger.Errorf("failed to persist osquery packs: %v", err)
+	}
+	keep := make([]string, 0, len(cfg.Queries))
+	for _, q := range cfg.Queries {
+		keep = append(keep, q.Key())
+	}
+	if err := db.PrunePackStates(keep); err != nil {
+		logger.Errorf("prune osquery pack state: %v", err)
+	}
+	logger.Infof("Osquery packs updated: %d queries (hash=%s)", len(cfg.Queries), cfg.Hash)
+}
+
+// restoreOsqueryPacks nạp cấu hình pack đã lưu khi agent khởi động.
+func restoreOsqueryPacks() {
+	var cfg PackConfig
+	if ok, err := db.LoadSetting(db.SettingOsqueryPacks, &cfg); err != nil {
+		logger.Errorf("load osquery packs: %v", err)
+	} else if ok {
+		packs.Lock()
+		packs.cfg = cfg
+		packs.Unlock()
+		logger.Infof("Restored %d osquery pack queries", len(cfg.Queries))
+	}
+}
+
+func currentPacks() PackConfig {
+	packs.Lock()
+	defer packs.Unlock()
+	return packs.cfg
+}
+
+// StartOsqueryPackLoop chạy các query tới hạn và gửi diff về backend; định kỳ
+// gửi hash cấu hình để backend giao lại pack nếu agent đang giữ bản cũ.
+func StartOsqueryPackLoop(connMgr ConnectionSender) {
+	if connMgr == nil {
+		return
+	}
+	go func() {
+		report := func() {
+			if err := connMgr.Send("osquery_pack_sync", map[string]string{"config_hash": currentPacks().Hash}); err != nil {
+				logger.Errorf("osquery pack sync failed: %v", err)
+			}
+		}
+		report()
+		lastSync := time.Now()
+		ticker := time.NewTicker(packTick)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			runDuePacks(connMgr, now)
+			if now.Sub(lastSync) >= packSyncInterval {
+				report()
+				lastSync = now
+			}
+		}
+	}()
+}
+
+func runDuePacks(connMgr ConnectionSender, now time.Time) {
+	cfg := currentPacks()
+	if len(cfg.Queries) == 0 {
+		return
+	}
+	states, err := db.LoadPackStates()
+	if err != nil {
+		logger.Errorf("load osquery pack state: %v", err)
+		return
+	}
+	for _, q := range cfg.Queries {
+		st, ok := states[q.Key()]
+		interval := time.Duration(q.IntervalSec) * time.Second
+		if ok && now.Sub(st.LastRunAt) < interval {
+			continue
+		}
+		runPackQuery(connMgr, q, st, now)
+	}
+}
+
+// runPackQuery chạy một query, so với kết quả đã lưu và chỉ gửi dòng thêm/bớt.
+// Sau mỗi chunk gửi thành công, kết quả đã lưu được cập nhật theo chunk đó nên
+// nếu gửi lỗi giữa chừng, lần sau chỉ gửi phần còn thiếu, không gửi trùng.
+func runPackQuery(connMgr ConnectionSender, q PackQuery, st db.OsqueryPackState, now time.Time) {
+	hash := queryHash(q.Query)
+	if st.QueryHash != hash {
+		st.RowsJSON = ""
+	}
+	st.QueryKey = q.Key()
+	st.QueryHash = hash
+	st.LastRunAt = now
+
+	res, err := osquery.Query(q.Query, packQueryTimeout, packMaxRows, packMaxBytes)
+	if err != nil {
+		logger.Warnf("osquery pack %s failed: %v", q.Key(), err)
+		if err := db.SavePackState(st); err != nil {
+			logger.Errorf("save osquery pack state: %v", err)
+		}
+		return
+	}
+	if res.Truncated {
+		logger.Warnf("osquery pack %s returned %d rows, only %d kept", q.Key(), res.RowCount, len(res.Rows))
+	}
+	cur := make([]string, 0, len(res.Rows))
+	for _, row := range res.Rows {
+		b, err := json.Marshal(row)
+		if err != nil {
+			continue
+		}
+		cur = append(cur, string(b))
+	}
+	var prev []string
+	if st.RowsJSON != "" {
+		if err := json.Unmarshal([]byte(st.RowsJSON), &prev); err != nil {
+			logger.Warnf("osquery pack %s: discarding unreadable previous result: %v", q.Key(), err)
+			prev = nil
+		}
+	}
+	added, removed := DiffRows(prev, cur)
+	if len(added) > 0 || len(removed) > 0 {
+		st.Counter++
+		sent := prev
+		for _, chunk := range chunkDiff(added, removed) {
+			chunk.Pack, chunk.Name = q.Pack, q.Name
+			chunk.Counter = st.Counter
+			chunk.UnixTime = now.Unix()
+			if err := connMgr.Send("osquery_diff", chunk); err != nil {
+				logger.Errorf("send osquery diff %s failed: %v", q.Key(), err)
+				return
+			}
+			sent = applyDiff(sent, chunk)
+			if b, err := json.Marshal(sent); err == nil {
+				st.RowsJSON = string(b)
+				if err := db.SavePackState(st); err != nil {
+					logger.Errorf("save osquery pack state: %v", err)
+				}
+			}
+		}
+		logger.Infof("osquery pack %s: +%d -%d rows", q.Key(), len(added), len(removed))
+	}
+	b, err := json.Marshal(cur)
+	if err != nil {
+		return
+	}
+	st.RowsJSON = string(b)
+	if err := db.SavePackState(st); err != nil {
+		logger.Errorf("save osquery pack state: %v", err)
+	}
+}
+
+// DiffRows so sánh hai tập dòng (đếm trùng lặp) và trả về dòng thêm mới / bị bỏ.
+func DiffRows(prev, cur []string) (added, removed []string) {
+	remaining := make(map[string]int, len(prev))
+	for _, r := range prev {
+		remaining[r]++
+	}
+	for _, r := range cur {
+		if remaining[r] > 0 {
+			remaining[r]--
+			continue
+		}
+		added = append(added, r)
+	}
+	for _, r := range prev {
+		if remaining[r] > 0 {
+			remaining[r]--
+			removed = append(removed, r)
+		}
+	}
+	return added, removed
+}
+
+// applyDiff trả về rows sau khi bỏ các dòng Removed (mỗi dòng một lần) và thêm các dòng Added.
+func applyDiff(rows []string, d osqueryDiff) []string {
+	drop := make(map[string]int, len(d.Removed))
+	for _, r := range d.Removed {
+		drop[string(r)]++
+	}
+	out := make([]string, 0, len(rows)+len(d.Added))
+	for _, r := range rows {
+		if drop[r] > 0 {
+			drop[r]--
+			continue
+		}
+		out = append(out, r)
+	}
+	for _, r := range d.Added {
+		out = append(out, string(r))
+	}
+	return out
+}
+
+// chunkDiff chia diff thành nhiều frame không vượt packChunkBytes.
+func chunkDiff(added, removed []string) []osqueryDiff {
+	var out []osqueryDiff
+	cur := osqueryDiff{}
+	size := 0
+	push := func(row string, isAdded bool) {
+		if size > 0 && size+len(row) > packChunkBytes {
+			out = append(out, cur)
+			cur = osqueryDiff{}
+			size = 0
+		}
+		if isAdded {
+			cur.Added = append(cur.Added, json.RawMessage(row))
+		} else {
+			cur.Removed = append(cur.Removed, json.RawMessage(row))
+		}
+		size += len(row) + 1
+	}
+	for _, r := range added {
+		push(r, true)
+	}
+	for _, r := range removed {
+		push(r, false)
+	}
+	if size > 0 {
+		out = append(out, cur)
+	}
+	return out
+}
+
+func queryHash(q string) string {
+	sum := sha256.Sum256([]byte(q))
+	return hex.EncodeToString(sum[:])
+}
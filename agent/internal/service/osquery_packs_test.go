@@ -0,0 +1,104 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDiffRows(t *testing.T) {
+	tests := []struct {
+		name        string
+		prev, cur   []string
+		wantAdded   []string
+		wantRemoved []string
+	}{
+		{name: "first run", cur: []string{"a", "b"}, wantAdded: []string{"a", "b"}},
+		{name: "unchanged", prev: []string{"a", "b"}, cur: []string{"b", "a"}},
+		{name: "added and removed", prev: []string{"a", "b"}, cur: []string{"b", "c"}, wantAdded: []string{"c"}, wantRemoved: []string{"a"}},
+		{name: "duplicate gained", prev: []string{"a"}, cur: []string{"a", "a"}, wantAdded: []string{"a"}},
+		{name: "duplicate lost", prev: []string{"a", "a", "b"}, cur: []string{"a", "b"}, wantRemoved: []string{"a"}},
+		{name: "all removed", prev: []string{"a", "b"}, wantRemoved: []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := DiffRows(tt.prev, tt.cur)
+			if !reflect.DeepEqual(added, tt.wantAdded) || !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("DiffRows = +%v -%v, want +%v -%v", added, removed, tt.wantAdded, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestChunkDiff(t *testing.T) {
+	big := `"` + strings.Repeat("x", packChunkBytes/2) + `"`
+	tests := []struct {
+		name       string
+		added      []string
+		removed    []string
+		wantChunks int
+	}{
+		{name: "empty", wantChunks: 0},
+		{name: "small diff fits one frame", added: []string{`{"a":1}`}, removed: []string{`{"b":2}`}, wantChunks: 1},
+		{name: "split by size", added: []string{big, big, big}, wantChunks: 3},
+		{name: "oversized row gets its own frame", added: []string{`"s"`, `"` + strings.Repeat("y", packChunkBytes) + `"`, `"t"`}, wantChunks: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := chunkDiff(tt.added, tt.removed)
+			if len(chunks) != tt.wantChunks {
+				t.Fatalf("chunkDiff produced %d chunks, want %d", len(chunks), tt.wantChunks)
+			}
+			var gotAdded, gotRemoved []string
+			for _, c := range chunks {
+				size := 0
+				for _, r := range c.Added {
+					gotAdded = append(gotAdded, string(r))
+					size += len(r) + 1
+				}
+				for _, r := range c.Removed {
+					gotRemoved = append(gotRemoved, string(r))
+					size += len(r) + 1
+				}
+				if rows := len(c.Added) + len(c.Removed); rows > 1 && size > packChunkBytes+1 {
+					t.Errorf("chunk of %d rows is %d bytes, over %d", rows, size, packChunkBytes)
+				}
+			}
+			if !reflect.DeepEqual(gotAdded, tt.added) || !reflect.DeepEqual(gotRemoved, tt.removed) {
+				t.Error("chunks do not preserve rows and order")
+			}
+		})
+	}
+}
+
+func TestApplyDiffResumesPartialSend(t *testing.T) {
+	prev := []string{"a", "b", "b"}
+	cur := []string{"b", "c", "d"}
+	added, removed := DiffRows(prev, cur)
+
+	// Chỉ chunk đầu gửi được: lần chạy sau chỉ còn phần chưa gửi
+	first := osqueryDiff{Added: []json.RawMessage{json.RawMessage(added[0])}}
+	sent := applyDiff(prev, first)
+	restAdded, restRemoved := DiffRows(sent, cur)
+	if len(restAdded)+len(restRemoved) != len(added)+len(removed)-1 {
+		t.Errorf("after partial send: +%v -%v still pending, want one row fewer than +%v -%v", restAdded, restRemoved, added, removed)
+	}
+
+	// Áp dụng toàn bộ diff phải ra đúng tập dòng hiện tại
+	all := osqueryDiff{}
+	for _, r := range added {
+		all.Added = append(all.Added, json.RawMessage(r))
+	}
+	for _, r := range removed {
+		all.Removed = append(all.Removed, json.RawMessage(r))
+	}
+	got := applyDiff(prev, all)
+	sort.Strings(got)
+	want := append([]string(nil), cur...)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("applyDiff = %v, want %v", got, want)
+	}
+}
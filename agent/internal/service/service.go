@@ -14,9 +14,10 @@ import (
 	"sagiri-guard/agent/internal/config"
 	"sagiri-guard/agent/internal/db"
 	"sagiri-guard/agent/internal/device"
+	"sagiri-guard/agent/internal/inventory"
 	"sagiri-guard/agent/internal/logger"
 	"sagiri-guard/agent/internal/monitor"
-	osq "sagiri-guard/agent/internal/osquery"
+	"sagiri-guard/agent/internal/pathpolicy"
 	"sagiri-guard/agent/internal/state"
 )
 
@@ -27,14 +28,36 @@ func Login(username, password string) (string, string, error) {
 	return auth.Login(host, port, username, password)
 }
 
+// Enroll đổi enrollment token do admin cấp lấy token của device.
+func Enroll(enrollToken string) (string, string, error) {
+	cfg := config.Get()
+	host, port := cfg.BackendHost, cfg.BackendPort
+	logger.Infof("Enroll tới backend %s:%d", host, port)
+	return auth.Enroll(host, port, enrollToken)
+}
+
+// RefreshToken lấy access token mới bằng refresh token đã lưu.
+func RefreshToken(deviceID string) (string, error) {
+	cfg := config.Get()
+	return auth.Refresh(cfg.BackendHost, cfg.BackendPort, deviceID)
+}
+
+// Logout thu hồi token của agent trên backend và xóa token local.
+func Logout() error {
+	cfg := config.Get()
+	logger.Infof("Logout khỏi backend %s:%d", cfg.BackendHost, cfg.BackendPort)
+	return auth.Logout(cfg.BackendHost, cfg.BackendPort)
+}
+
 var ErrUnauthorized = errors.New("unauthorized")
 
 func BootstrapDevice(token string, deviceID string) (string, error) {
 	cfg := config.Get()
-	si, osv, err := osq.Collect()
+	si, err := inventory.Collect()
 	if err != nil {
 		return "", err
 	}
+	logger.Infof("Inventory collected via %s (uuid=%s)", si.Source, si.UUID)
 	uuid := deviceID
 	if uuid == "" {
 		uuid = si.UUID
@@ -42,7 +65,7 @@ func BootstrapDevice(token string, deviceID string) (string, error) {
 			uuid = si.Hostname
 		}
 	}
-	dev := device.Info{UUID: uuid, Name: si.Hardware, OSName: osv.Name, OSVersion: osv.Version, Hostname: si.Hostname, Arch: si.CPUBrand}
+	dev := device.Info{UUID: uuid, Name: si.Hardware, OSName: si.OSName, OSVersion: si.OSVersion, Hostname: si.Hostname, Arch: si.CPUBrand}
 	host, port := cfg.BackendHost, cfg.BackendPort
 	if _, code, err := device.Register(host, port, token, dev); err != nil {
 		if code == http.StatusUnauthorized {
@@ -52,35 +75,77 @@ func BootstrapDevice(token string, deviceID string) (string, error) {
 	}
 
 	// monitor files
-	if len(cfg.MonitorPaths) > 0 {
-		if fm, err := monitor.NewFileMonitor(cfg.MonitorPaths); err != nil {
-			logger.Errorf("failed to create file monitor: %v", err)
-		} else {
-			ch := fm.MonitorFiles()
-			go func() {
-				for event := range ch {
-					if event.Path == "" {
-						continue
-					}
-
-					switch event.Action {
-					case monitor.ActionCreate, monitor.ActionModify:
-						logger.Infof("File %s: %s", event.Action, event.Path)
-						scheduleBackup(event.Path)
-					case monitor.ActionRename, monitor.ActionMove:
-						logger.Infof("File %s: %s -> %s", event.Action, event.OldPath, event.Path)
-						scheduleBackup(event.Path)
-					case monitor.ActionDelete, monitor.ActionMoveOut:
-						logger.Infof("File %s: %s", event.Action, event.Path)
-					default:
-						logger.Infof("File event %s: %s", event.Action, event.Path)
-					}
-				}
-			}()
+	startFileMonitor(cfg.MonitorPaths)
+
+	return dev.UUID, nil
+}
+
+var fileMonitor struct {
+	sync.Mutex
+	current *monitor.FileMonitor
+}
+
+// startFileMonitor (re)khởi động FileMonitor cho danh sách path; monitor cũ bị đóng trước.
+func startFileMonitor(paths []string) {
+	fileMonitor.Lock()
+	defer fileMonitor.Unlock()
+	if fileMonitor.current != nil {
+		if err := fileMonitor.current.Close(); err != nil {
+			logger.Errorf("failed to close file monitor: %v", err)
 		}
+		fileMonitor.current = nil
+	}
+	if len(paths) == 0 {
+		return
+	}
+	fm, err := monitor.NewFileMonitor(paths)
+	if err != nil {
+		logger.Errorf("failed to create file monitor: %v", err)
+		return
 	}
+	fileMonitor.current = fm
+	ch := fm.MonitorFiles()
+	go func() {
+		for event := range ch {
+			if event.Path == "" {
+				continue
+			}
 
-	return dev.UUID, nil
+			switch event.Action {
+			case monitor.ActionCreate, monitor.ActionModify:
+				logger.Infof("File %s: %s", event.Action, event.Path)
+				scheduleBackup(event.Path)
+			case monitor.ActionRename, monitor.ActionMove:
+				logger.Infof("File %s: %s -> %s", event.Action, event.OldPath, event.Path)
+				scheduleBackup(event.Path)
+			case monitor.ActionDelete, monitor.ActionMoveOut:
+				logger.Infof("File %s: %s", event.Action, event.Path)
+			default:
+				logger.Infof("File event %s: %s", event.Action, event.Path)
+			}
+		}
+	}()
+}
+
+// monitorWatchCount trả về số watch của FileMonitor đang chạy (0 nếu chưa chạy).
+func monitorWatchCount() int {
+	fileMonitor.Lock()
+	defer fileMonitor.Unlock()
+	if fileMonitor.current == nil {
+		return 0
+	}
+	return fileMonitor.current.WatchCount()
+}
+
+// SetMonitorPaths đổi thư mục theo dõi lúc đang chạy (command chỉ đến sau BootstrapDevice)
+// và lưu lại để giữ sau khi restart.
+func SetMonitorPaths(paths []string) {
+	config.SetMonitorPaths(paths)
+	if err := db.SaveSetting(db.SettingMonitorPaths, paths); err != nil {
+		logger.Errorf("failed to persist monitor paths: %v", err)
+	}
+	startFileMonitor(config.Get().MonitorPaths)
+	logger.Infof("Monitor paths updated: %v", paths)
 }
 
 var (
@@ -100,11 +165,14 @@ var (
 	fileSettleStablePass = 2
 )
 
-// SetBackupEnabled bật/tắt backup tự động
+// SetBackupEnabled bật/tắt backup tự động và lưu lại để giữ nguyên sau khi restart
 func SetBackupEnabled(enabled bool) {
 	backupState.Lock()
 	defer backupState.Unlock()
 	backupState.enabled = enabled
+	if err := db.SaveSetting(db.SettingBackupEnabled, enabled); err != nil {
+		logger.Errorf("failed to persist backup state: %v", err)
+	}
 	if enabled {
 		logger.Info("Automatic backup enabled")
 	} else {
@@ -119,14 +187,59 @@ func IsBackupEnabled() bool {
 	return backupState.enabled
 }
 
+// ApplyBackupPolicies dựng pathpolicy từ config và áp dụng cho monitor + backup.
+func ApplyBackupPolicies(policies []config.BackupPolicy) error {
+	list := make([]pathpolicy.Policy, 0, len(policies))
+	for _, p := range policies {
+		if strings.TrimSpace(p.Root) == "" {
+			continue
+		}
+		list = append(list, pathpolicy.Policy{
+			Root:       p.Root,
+			Include:    p.Include,
+			Exclude:    p.Exclude,
+			MaxSize:    p.MaxSizeMB * 1024 * 1024,
+			Extensions: p.Extensions,
+			Debounce:   time.Duration(p.DebounceSec) * time.Second,
+		})
+	}
+	set, err := pathpolicy.NewSet(list)
+	if err != nil {
+		return err
+	}
+	pathpolicy.SetActive(set)
+	return nil
+}
+
+// backupAllowed kiểm tra policy của root (include/exclude, đuôi file, kích thước).
+func backupAllowed(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		// file có thể chưa xuất hiện hẳn; waitForStableFile sẽ xử lý
+		return !pathpolicy.Active().Excluded(path)
+	}
+	if info.IsDir() {
+		return false
+	}
+	return pathpolicy.Active().Allows(path, info.Size())
+}
+
 func scheduleBackup(path string) {
+	// File tạm của restore sẽ được rename ngay sau khi tải xong, không cần backup
+	if backup.IsRestoreTempFile(path) {
+		return
+	}
+	if !backupAllowed(path) {
+		return
+	}
+	cooldown := pathpolicy.Active().Debounce(path, backupCooldown)
 	backupState.Lock()
 	// Kiểm tra xem backup có được bật không
 	if !backupState.enabled {
 		backupState.Unlock()
 		return
 	}
-	if last, ok := backupState.recent[path]; ok && time.Since(last) < backupCooldown {
+	if last, ok := backupState.recent[path]; ok && time.Since(last) < cooldown {
 		backupState.Unlock()
 		return
 	}
@@ -138,20 +251,86 @@ func scheduleBackup(path string) {
 	backupState.Unlock()
 
 	go func() {
-		defer func() {
-			backupState.Lock()
-			delete(backupState.inFlight, path)
-			backupState.recent[path] = time.Now()
-			backupState.Unlock()
-		}()
-
 		if err := waitForStableFile(path); err != nil {
 			logger.Errorf("skip backup for %s: %v", path, err)
+			finishBackup(path)
+			return
+		}
+		// Kích thước cuối cùng có thể vượt giới hạn của policy
+		if !backupAllowed(path) {
+			finishBackup(path)
 			return
 		}
+		enqueueBackup(path)
+	}()
+}
+
+// finishBackup gỡ path khỏi inFlight và bắt đầu cooldown.
+func finishBackup(paths ...string) {
+	backupState.Lock()
+	defer backupState.Unlock()
+	now := time.Now()
+	for _, p := range paths {
+		delete(backupState.inFlight, p)
+		backupState.recent[p] = now
+	}
+}
 
-		if err := backupFile(path); err != nil {
-			logger.Errorf("auto backup failed for %s: %v", path, err)
+var (
+	backupBatcher = struct {
+		sync.Mutex
+		pending []string
+		timer   *time.Timer
+	}{}
+	backupBatchLinger = 2 * time.Second
+	backupBatchMax    = 200
+)
+
+// enqueueBackup gom các file đã ổn định trong backupBatchLinger thành một batch,
+// tránh mở hai kết nối cho mỗi file khi có hàng nghìn file thay đổi cùng lúc.
+func enqueueBackup(path string) {
+	backupBatcher.Lock()
+	defer backupBatcher.Unlock()
+	backupBatcher.pending = append(backupBatcher.pending, path)
+	if len(backupBatcher.pending) >= backupBatchMax {
+		flushBackupsLocked()
+		return
+	}
+	if backupBatcher.timer == nil {
+		backupBatcher.timer = time.AfterFunc(backupBatchLinger, func() {
+			backupBatcher.Lock()
+			defer backupBatcher.Unlock()
+			flushBackupsLocked()
+		})
+	}
+}
+
+func flushBackupsLocked() {
+	if backupBatcher.timer != nil {
+		backupBatcher.timer.Stop()
+		backupBatcher.timer = nil
+	}
+	paths := backupBatcher.pending
+	backupBatcher.pending = nil
+	if len(paths) == 0 {
+		return
+	}
+	go func() {
+		defer finishBackup(paths...)
+		if backup.CurrentThrottlePolicy().ShouldDefer(time.Now()) {
+			deferBackups(paths)
+			return
+		}
+		if len(paths) == 1 {
+			if err := backupFile(paths[0]); err != nil {
+				logger.Errorf("auto backup failed for %s: %v", paths[0], err)
+				recordBackupFailure(err, paths[0])
+			}
+			return
+		}
+		if err := backupBatch(paths); err != nil {
+			logger.Errorf("auto batch backup failed (%d files): %v", len(paths), err)
+			recordBackupFailure(err, paths...)
 		}
 	}()
 }
@@ -212,16 +391,10 @@ func backupFile(path string) error {
 	if token == "" {
 		return nil
 	}
-	
+
 	// Lấy file_id từ MonitoredFile để gửi lên backend
-	var fileID string
-	if adb := db.Get(); adb != nil {
-		var mf db.MonitoredFile
-		if err := adb.Where("path = ?", path).First(&mf).Error; err == nil {
-			fileID = mf.ItemID // Sử dụng ItemID đã lưu trong MonitoredFile
-		}
-	}
-	
+	fileID := monitoredFileID(path)
+
 	host, port := config.BackendHostPort()
 	session, err := backup.InitUpload(host, port, token, path, fileID)
 	if err != nil {
@@ -230,17 +403,66 @@ func backupFile(path string) error {
 	if err := backup.UploadFile(session, path); err != nil {
 		return err
 	}
+	markBackedUp(path)
+	return nil
+}
 
-	// Mark file as backed up in local DB (for sync/restore semantics).
-	if adb := db.Get(); adb != nil {
-		now := time.Now()
-		if err := adb.Model(&db.MonitoredFile{}).
-			Where("path = ?", path).
-			Updates(map[string]any{
-				"last_backup_at": now,
-			}).Error; err != nil {
-			logger.Errorf("failed to update last_backup_at for %s: %v", path, err)
+// backupBatch upload nhiều file qua một batch session.
+func backupBatch(paths []string) error {
+	token := strings.TrimSpace(state.GetToken())
+	if token == "" {
+		return nil
+	}
+	files := make([]backup.BatchFile, 0, len(paths))
+	for _, p := range paths {
+		files = append(files, backup.BatchFile{Path: p, FileID: monitoredFileID(p)})
+	}
+	host, port := config.BackendHostPort()
+	stored, err := backup.UploadBatch(host, port, token, files)
+	if err != nil {
+		return err
+	}
+	markBackedUp(stored...)
+	if len(stored) < len(paths) {
+		logger.Warnf("batch backup stored %d/%d files", len(stored), len(paths))
+		done := make(map[string]struct{}, len(stored))
+		for _, p := range stored {
+			done[p] = struct{}{}
 		}
+		var missing []string
+		for _, p := range paths {
+			if _, ok := done[p]; !ok {
+				missing = append(missing, p)
+			}
+		}
+		recordBackupFailure(errors.New("not stored by backend"), missing...)
 	}
 	return nil
 }
+
+// monitoredFileID trả về ItemID đã lưu trong MonitoredFile để gửi lên backend.
+func monitoredFileID(path string) string {
+	if adb := db.Get(); adb != nil {
+		var mf db.MonitoredFile
+		if err := adb.Where("path = ?", path).First(&mf).Error; err == nil {
+			return mf.ItemID
+		}
+	}
+	return ""
+}
+
+// markBackedUp ghi last_backup_at trong DB local (cho sync/restore) và gỡ khỏi hàng đợi hoãn.
+func markBackedUp(paths ...string) {
+	adb := db.Get()
+	if adb == nil || len(paths) == 0 {
+		return
+	}
+	clearPendingBackups(paths...)
+	if err := adb.Model(&db.MonitoredFile{}).
+		Where("path IN ?", paths).
+		Updates(map[string]any{
+			"last_backup_at": time.Now(),
+		}).Error; err != nil {
+		logger.Errorf("failed to update last_backup_at for %d files: %v", len(paths), err)
+	}
+}
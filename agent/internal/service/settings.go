@@ -0,0 +1,75 @@
+package service
+
+import (
+	"sagiri-guard/agent/internal/backup"
+	"sagiri-guard/agent/internal/config"
+	"sagiri-guard/agent/internal/db"
+	"sagiri-guard/agent/internal/firewall"
+	"sagiri-guard/agent/internal/logger"
+)
+
+// WebsiteBlockState là trạng thái chặn website được áp dụng lần cuối.
+type WebsiteBlockState struct {
+	Enabled bool     `json:"enabled"`
+	Domains []string `json:"domains,omitempty"`
+}
+
+// SaveWebsiteBlockState lưu trạng thái chặn website để áp dụng lại khi khởi động.
+func SaveWebsiteBlockState(st WebsiteBlockState) {
+	if err := db.SaveSetting(db.SettingWebsiteBlock, st); err != nil {
+		logger.Errorf("failed to persist website block state: %v", err)
+	}
+}
+
+// SaveThrottlePolicy lưu policy nhận qua command; policy này được ưu tiên hơn config khi khởi động.
+func SaveThrottlePolicy(p backup.ThrottlePolicy) {
+	if err := db.SaveSetting(db.SettingBackupThrottle, p); err != nil {
+		logger.Errorf("failed to persist backup throttle: %v", err)
+	}
+}
+
+// RestoreSettings áp dụng lại các thiết lập đã lưu trong agent_settings.
+// Gọi trước khi kết nối backend để agent không chạy với giá trị mặc định trong lúc chờ command.
+func RestoreSettings() {
+	var enabled bool
+	if ok, err := db.LoadSetting(db.SettingBackupEnabled, &enabled); err != nil {
+		logger.Errorf("load backup state: %v", err)
+	} else if ok {
+		backupState.Lock()
+		backupState.enabled = enabled
+		backupState.Unlock()
+		logger.Infof("Restored automatic backup state: enabled=%t", enabled)
+	}
+
+	var paths []string
+	if ok, err := db.LoadSetting(db.SettingMonitorPaths, &paths); err != nil {
+		logger.Errorf("load monitor paths: %v", err)
+	} else if ok {
+		// Monitor chưa chạy lúc này; BootstrapDevice sẽ dùng danh sách đã khôi phục
+		config.SetMonitorPaths(paths)
+		logger.Infof("Restored monitor paths: %v", paths)
+	}
+
+	var policy backup.ThrottlePolicy
+	if ok, err := db.LoadSetting(db.SettingBackupThrottle, &policy); err != nil {
+		logger.Errorf("load backup throttle: %v", err)
+	} else if ok {
+		backup.SetThrottlePolicy(policy)
+		logger.Infof("Restored backup throttle: rate=%d B/s windows=%v defer=%t", policy.RateLimitBps, policy.Windows, policy.DeferOutsideWindow)
+	}
+
+	var block WebsiteBlockState
+	if ok, err := db.LoadSetting(db.SettingWebsiteBlock, &block); err != nil {
+		logger.Errorf("load website block state: %v", err)
+	} else if ok && block.Enabled {
+		hostsMgr := firewall.GetHostsManager()
+		if err := hostsMgr.SetDomains(block.Domains); err != nil {
+			logger.Errorf("restore blocked domains: %v", err)
+		} else if err := hostsMgr.SetEnabled(true); err != nil {
+			logger.Errorf("restore website blocking: %v", err)
+		} else {
+			logger.Infof("Restored website blocking with %d domains", len(block.Domains))
+		}
+	}
+	restoreOsqueryPacks()
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"time"
+
+	"sagiri-guard/agent/internal/backup"
+	"sagiri-guard/agent/internal/config"
+	"sagiri-guard/agent/internal/firewall"
+	"sagiri-guard/agent/internal/logger"
+)
+
+// ActualState là trạng thái thực tế gửi lên backend (khớp dto.DeviceStateDoc).
+type ActualState struct {
+	BackupEnabled  *bool     `json:"backup_enabled"`
+	BlockEnabled   *bool     `json:"block_enabled"`
+	BlockedDomains *[]string `json:"blocked_domains"`
+	MonitorPaths   *[]string `json:"monitor_paths"`
+	RateLimitKBps  *int      `json:"rate_limit_kbps"`
+	BackupWindows  *[]string `json:"backup_windows"`
+}
+
+const stateReportInterval = 60 * time.Second
+
+// CollectActualState đọc các thiết lập đang áp dụng trên agent.
+func CollectActualState() ActualState {
+	backupOn := IsBackupEnabled()
+	st := ActualState{BackupEnabled: &backupOn}
+
+	if hostsMgr := firewall.GetHostsManager(); hostsMgr != nil {
+		blockOn := hostsMgr.IsEnabled()
+		domains := hostsMgr.GetDomains()
+		if domains == nil {
+			domains = []string{}
+		}
+		st.BlockEnabled = &blockOn
+		st.BlockedDomains = &domains
+	}
+
+	// Chỉ báo danh sách được quản lý; root của backup policy là cấu hình cục bộ
+	paths := append([]string{}, config.Get().ManagedPaths...)
+	st.MonitorPaths = &paths
+
+	p := backup.CurrentThrottlePolicy()
+	rate := int(p.RateLimitBps / 1024)
+	windows := make([]string, 0, len(p.Windows))
+	for _, w := range p.Windows {
+		windows = append(windows, w.String())
+	}
+	st.RateLimitKBps = &rate
+	st.BackupWindows = &windows
+	return st
+}
+
+// StartStateReportLoop gửi trạng thái thực tế ngay khi kết nối và định kỳ sau đó;
+// backend so với desired state và tự gửi command sửa lệch.
+func StartStateReportLoop(connMgr ConnectionSender) {
+	if connMgr == nil {
+		return
+	}
+	go func() {
+		report := func() {
+			if err := connMgr.Send("state_report", CollectActualState()); err != nil {
+				logger.Errorf("state report failed: %v", err)
+			}
+		}
+		report()
+		ticker := time.NewTicker(stateReportInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			report()
+		}
+	}()
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"runtime"
+	"time"
+
+	"sagiri-guard/agent/internal/config"
+	"sagiri-guard/agent/internal/db"
+	"sagiri-guard/agent/internal/logger"
+)
+
+// Telemetry là heartbeat sức khỏe agent (action telemetry, khớp dto.Telemetry).
+type Telemetry struct {
+	AgentVersion string  `json:"agent_version"`
+	UptimeSec    int64   `json:"uptime_sec"`
+	CPUPercent   float64 `json:"cpu_percent"` // CPU của process agent từ lần gửi trước
+	MemoryMB     float64 `json:"memory_mb"`   // RSS của process agent
+	Goroutines   int     `json:"goroutines"`
+	DiskFreeMB   int64   `json:"disk_free_mb"` // dung lượng trống nơi chứa DB của agent; -1 = không rõ
+	BackupQueue  int64   `json:"backup_queue"` // số backup đang hoãn trong PendingBackup
+	MonitorPaths int     `json:"monitor_paths"`
+	WatchCount   int     `json:"watch_count"`
+	LastTreeSync int64   `json:"last_tree_sync,omitempty"` // unix; 0 = chưa sync lần nào
+	UnixTime     int64   `json:"unix_time"`
+	IntervalSec  int     `json:"interval_sec"`
+}
+
+const telemetryInterval = 60 * time.Second
+
+var agentStarted = time.Now()
+
+// StartTelemetryLoop gửi heartbeat telemetry ngay khi kết nối và mỗi phút sau đó.
+func StartTelemetryLoop(connMgr ConnectionSender, version string) {
+	if connMgr == nil {
+		return
+	}
+	go func() {
+		var prevCPU time.Duration
+		prevAt := agentStarted
+		report := func() {
+			now := time.Now()
+			cpu, rss := processStats()
+			t := collectTelemetry(version, now)
+			t.MemoryMB = float64(rss) / (1 << 20)
+			if wall := now.Sub(prevAt); wall > 0 && cpu >= prevCPU {
+				t.CPUPercent = float64(cpu-prevCPU) / float64(wall) * 100
+			}
+			prevCPU, prevAt = cpu, now
+			if err := connMgr.Send("telemetry", t); err != nil {
+				logger.Errorf("telemetry report failed: %v", err)
+			}
+		}
+		report()
+		ticker := time.NewTicker(telemetryInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			report()
+		}
+	}()
+}
+
+func collectTelemetry(version string, now time.Time) Telemetry {
+	cfg := config.Get()
+	t := Telemetry{
+		AgentVersion: version,
+		UptimeSec:    int64(now.Sub(agentStarted).Seconds()),
+		Goroutines:   runtime.NumGoroutine(),
+		DiskFreeMB:   diskFreeMB(cfg.DBPath),
+		MonitorPaths: len(cfg.MonitorPaths),
+		WatchCount:   monitorWatchCount(),
+		LastTreeSync: lastTreeSync.Load(),
+		UnixTime:     now.Unix(),
+		IntervalSec:  int(telemetryInterval / time.Second),
+	}
+	if adb := db.Get(); adb != nil {
+		if err := adb.Model(&db.PendingBackup{}).Count(&t.BackupQueue).Error; err != nil {
+			logger.Warnf("count pending backups failed: %v", err)
+		}
+	}
+	return t
+}
@@ -0,0 +1,48 @@
+//go:build linux
+
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// processStats trả về tổng CPU time (user+sys) và RSS (byte) của process agent.
+func processStats() (time.Duration, uint64) {
+	var ru unix.Rusage
+	var cpu time.Duration
+	if err := unix.Getrusage(unix.RUSAGE_SELF, &ru); err == nil {
+		cpu = time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+	}
+	var rss uint64
+	if b, err := os.ReadFile("/proc/self/statm"); err == nil {
+		if fields := strings.Fields(string(b)); len(fields) > 1 {
+			pages, _ := strconv.ParseUint(fields[1], 10, 64)
+			rss = pages * uint64(os.Getpagesize())
+		}
+	}
+	return cpu, rss
+}
+
+// diskFreeMB trả về dung lượng trống (MB) của filesystem chứa path.
+func diskFreeMB(path string) int64 {
+	dir := filepath.Dir(path)
+	if path == "" {
+		dir = os.TempDir()
+	}
+	var st unix.Statfs_t
+	for unix.Statfs(dir, &st) != nil {
+		// thư mục chưa tồn tại: đo trên thư mục cha gần nhất
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return -1
+		}
+		dir = parent
+	}
+	return int64(st.Bavail) * int64(st.Bsize) >> 20
+}
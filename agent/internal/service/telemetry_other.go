@@ -0,0 +1,17 @@
+//go:build !linux
+
+package service
+
+import (
+	"runtime"
+	"time"
+)
+
+// processStats chỉ đo được bộ nhớ Go runtime giữ từ OS; CPU time chưa hỗ trợ.
+func processStats() (time.Duration, uint64) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return 0, ms.Sys
+}
+
+func diskFreeMB(string) int64 { return -1 }
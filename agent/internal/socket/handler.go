@@ -3,15 +3,22 @@ package socket
 import (
 	"bytes"
 	"encoding/json"
+	"time"
+
 	"sagiri-guard/agent/internal/command"
 	"sagiri-guard/agent/internal/logger"
 )
 
 type Command struct {
-	DeviceID string          `json:"deviceid"`
-	Command  string          `json:"command"`
-	Kind     command.Kind    `json:"kind,omitempty"`
-	Argument json.RawMessage `json:"argument,omitempty"`
+	ID        uint            `json:"id,omitempty"`
+	DeviceID  string          `json:"deviceid"`
+	Command   string          `json:"command"`
+	Kind      command.Kind    `json:"kind,omitempty"`
+	Argument  json.RawMessage `json:"argument,omitempty"`
+	ExpiresAt int64           `json:"expires_at,omitempty"`
+	Nonce     string          `json:"nonce,omitempty"`
+	NotAfter  int64           `json:"not_after,omitempty"`
+	Sig       string          `json:"sig,omitempty"`
 }
 
 var cmdMgr = command.NewManager()
@@ -28,7 +35,11 @@ func HandleMessage(data []byte) {
 		logger.Errorf("Invalid command: %v | raw=%s", err, string(line))
 		return
 	}
-	env := command.Envelope{DeviceID: cmd.DeviceID, Name: cmd.Command, Kind: cmd.Kind, Argument: cmd.Argument}
+	if err := verifyCommand(cmd, time.Now()); err != nil {
+		logger.Errorf("Rejected command %s id=%d: %v", cmd.Command, cmd.ID, err)
+		return
+	}
+	env := command.Envelope{ID: cmd.ID, DeviceID: cmd.DeviceID, Name: cmd.Command, Kind: cmd.Kind, Argument: cmd.Argument, ExpiresAt: cmd.ExpiresAt}
 	logger.Infof("In: %s", command.Format(env))
 	cmdMgr.Dispatch(env)
 }
@@ -0,0 +1,89 @@
+package socket
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"time"
+
+	"sagiri-guard/agent/internal/db"
+	"sagiri-guard/agent/internal/state"
+	"sagiri-guard/cmdsign"
+)
+
+// maxSigLifetime giới hạn NotAfter của chữ ký tính từ lúc nhận (bù lệch đồng hồ);
+// backend ký với hạn 5 phút.
+const maxSigLifetime = 15 * time.Minute
+
+var (
+	verifyKey      ed25519.PublicKey
+	verifyRequired bool
+)
+
+// ConfigureVerifier pin public key của backend. Khi required = true, command
+// không có chữ ký hợp lệ bị từ chối, kể cả khi chưa cấu hình key. Key sai định
+// dạng luôn dẫn tới từ chối mọi command (fail closed).
+func ConfigureVerifier(publicKey string, required bool) error {
+	verifyRequired = required
+	verifyKey = nil
+	if publicKey == "" {
+		return nil
+	}
+	pub, err := cmdsign.ParsePublicKey(publicKey)
+	if err != nil {
+		verifyRequired = true
+		return err
+	}
+	verifyKey = pub
+	return nil
+}
+
+// verifyCommand kiểm tra chữ ký, thiết bị đích, hạn chữ ký và nonce của command.
+func verifyCommand(cmd Command, now time.Time) error {
+	if self := state.GetDeviceID(); self != "" && cmd.DeviceID != self {
+		return fmt.Errorf("command addressed to device %q", cmd.DeviceID)
+	}
+	if cmd.Sig == "" {
+		if verifyRequired {
+			return errors.New("unsigned command")
+		}
+		return nil
+	}
+	if verifyKey == nil {
+		if verifyRequired {
+			return errors.New("no public key configured")
+		}
+		return nil
+	}
+	err := cmdsign.Verify(verifyKey, cmdsign.Fields{
+		ID:        cmd.ID,
+		DeviceID:  cmd.DeviceID,
+		Command:   cmd.Command,
+		Kind:      string(cmd.Kind),
+		Argument:  cmd.Argument,
+		ExpiresAt: cmd.ExpiresAt,
+		Nonce:     cmd.Nonce,
+		NotAfter:  cmd.NotAfter,
+	}, cmd.Sig)
+	if err != nil {
+		return err
+	}
+	notAfter := time.Unix(cmd.NotAfter, 0)
+	if now.After(notAfter) {
+		return errors.New("signature expired")
+	}
+	if notAfter.Sub(now) > maxSigLifetime {
+		return errors.New("signature lifetime too long")
+	}
+	if cmd.Nonce == "" {
+		return errors.New("missing nonce")
+	}
+	fresh, err := db.UseNonce(cmd.Nonce, notAfter)
+	if err != nil {
+		return fmt.Errorf("record nonce: %w", err)
+	}
+	if !fresh {
+		return errors.New("replayed nonce")
+	}
+	return nil
+}
@@ -6,6 +6,8 @@ import (
 	"os"
 	"os/signal"
 	"sagiri-guard/agent/internal/auth"
+	"sagiri-guard/agent/internal/backup"
+	"sagiri-guard/agent/internal/command"
 	"sagiri-guard/agent/internal/config"
 	"sagiri-guard/agent/internal/connection"
 	"sagiri-guard/agent/internal/db"
@@ -13,6 +15,7 @@ import (
 	"sagiri-guard/agent/internal/logger"
 	"sagiri-guard/agent/internal/privilege"
 	"sagiri-guard/agent/internal/service"
+	"sagiri-guard/agent/internal/socket"
 	"sagiri-guard/agent/internal/state"
 	"sagiri-guard/network"
 	"strings"
@@ -20,19 +23,24 @@ import (
 	"time"
 )
 
+// version được ghi đè lúc build: go build -ldflags "-X main.version=1.2.3"
+var version = "dev"
+
 func main() {
 	var (
 		cfgPath    = flag.String("config", "config/config.yaml", "Path to configuration file")
 		maxRetries = flag.Int("max-retries", 10, "Maximum retry attempts for backend connection")
 		retryDelay = flag.Duration("retry-delay", 1*time.Second, "Base delay between retry attempts")
 		elevate    = flag.Bool("elevate", false, "Attempt to elevate to admin (disable by default for go run)")
+		enroll     = flag.String("enroll-token", "", "Enrollment token issued by an admin (overrides agent.enroll_token)")
+		logout     = flag.Bool("logout", false, "Revoke this agent's tokens on the backend, delete them locally and exit")
 	)
 	flag.Parse()
 
-	// osquery thường cần quyền root để đọc system_info ổn định
+	// Không có root vẫn chạy được: collector native lấy UUID từ /etc/machine-id khi
+	// không đọc được DMI product_uuid; chặn host/firewall thì vẫn cần root.
 	if os.Geteuid() != 0 {
-		fmt.Println("Agent requires root to collect stable machine UUID. Please run with sudo.")
-		return
+		fmt.Println("Warning: agent is not running as root; hardware UUID and firewall features may be unavailable.")
 	}
 
 	if err := network.Init(); err != nil {
@@ -53,10 +61,29 @@ func main() {
 		logger.Error("Cannot open SQLite:", dberr)
 		return
 	}
-	if err := adb.AutoMigrate(&db.Token{}, &db.MonitoredFile{}); err != nil {
+	if err := adb.AutoMigrate(&db.Token{}, &db.MonitoredFile{}, &db.PendingBackup{}, &db.AgentSetting{}, &db.ExecutedCommand{}, &db.UsedNonce{}, &db.OsqueryPackState{}); err != nil {
 		logger.Error("Cannot migrate SQLite:", err)
 		return
 	}
+	// Executed command IDs only need to outlive the backend's command expiry
+	if n, err := db.PruneExecutedCommands(time.Now().AddDate(0, 0, -30)); err != nil {
+		logger.Errorf("prune executed commands: %v", err)
+	} else if n > 0 {
+		logger.Infof("Pruned %d executed command records", n)
+	}
+
+	// backup throttle / windows từ config (có thể đổi lại qua command backup_throttle)
+	if policy, err := backup.ParseThrottlePolicy(cfgVals.BackupRateLimitKBps, cfgVals.BackupWindows, cfgVals.BackupDeferOutsideWindow); err != nil {
+		logger.Errorf("Invalid backup throttle config, uploads will not be throttled: %v", err)
+	} else {
+		backup.SetThrottlePolicy(policy)
+	}
+	// include/exclude theo root phải có trước khi FileMonitor thêm watch
+	if err := service.ApplyBackupPolicies(cfgVals.BackupPolicies); err != nil {
+		logger.Errorf("Invalid backup policies, backing up everything under monitor paths: %v", err)
+	}
+	// Thiết lập do command áp dụng lần trước (backup on/off, throttle, chặn website)
+	service.RestoreSettings()
 
 	// Elevate on Windows (optional)
 	if *elevate && !privilege.IsElevated() {
@@ -67,7 +94,21 @@ func main() {
 		}
 	}
 
-	token, deviceID, err := loadOrPromptToken()
+	if *logout {
+		if err := service.Logout(); err != nil {
+			logger.Error("Logout failed:", err)
+			return
+		}
+		logger.Info("Logged out, local tokens removed")
+		return
+	}
+
+	enrollToken := strings.TrimSpace(*enroll)
+	if enrollToken == "" {
+		enrollToken = strings.TrimSpace(cfgVals.EnrollToken)
+	}
+
+	token, deviceID, err := loadOrObtainToken(enrollToken)
 	if err != nil {
 		logger.Error("Missing login information:", err)
 		return
@@ -79,14 +120,25 @@ func main() {
 	}
 
 	var uuid string
+	refreshed := false
 	for {
 		uuid, err = service.BootstrapDevice(token, deviceID)
+		if err == service.ErrUnauthorized && !refreshed {
+			// the stored access token is short-lived; try the refresh token before asking for credentials
+			refreshed = true
+			fresh, rerr := service.RefreshToken(deviceID)
+			if rerr == nil {
+				token = fresh
+				continue
+			}
+			logger.Warn("Cannot refresh token:", rerr)
+		}
 		if err == service.ErrUnauthorized {
 			logger.Warn("Current token is invalid, requesting login again")
 			if clearErr := auth.ClearToken(); clearErr != nil {
 				logger.Warn("Cannot clear old token: %v", clearErr)
 			}
-			token, deviceID, err = promptLogin()
+			token, deviceID, err = obtainToken(enrollToken)
 			if err != nil {
 				logger.Error("Login failed:", err)
 				return
@@ -113,7 +165,7 @@ func main() {
 
 	// Create ConnectionManager (single persistent connection)
 	addr := cfgVals
-	connMgr := connection.New(addr.BackendHost, addr.BackendPort, uuid, token)
+	connMgr := connection.New(addr.BackendHost, addr.BackendPort, uuid, token, version)
 
 	// Connect with retry logic
 	if err := connMgr.Connect(*maxRetries, *retryDelay); err != nil {
@@ -122,17 +174,52 @@ func main() {
 	}
 	defer connMgr.Close()
 
+	// Only commands signed by the pinned backend key are executed
+	if err := socket.ConfigureVerifier(cfgVals.CommandPublicKey, cfgVals.CommandSigningRequired); err != nil {
+		logger.Errorf("Invalid agent.command_signing.public_key, all commands will be rejected: %v", err)
+	} else if cfgVals.CommandPublicKey == "" && cfgVals.CommandSigningRequired {
+		logger.Error("agent.command_signing.public_key is not set, all commands will be rejected (set allow_unsigned only while upgrading)")
+	} else if !cfgVals.CommandSigningRequired {
+		logger.Warn("agent.command_signing.allow_unsigned is enabled, unsigned commands will be executed")
+	}
+
 	// Start background receive loop
+	// Report command results so the backend can track and de-duplicate deliveries
+	command.SetResultReporter(func(r command.Result) {
+		if err := connMgr.Send("command_result", r); err != nil {
+			logger.Errorf("report result of command id=%d failed: %v", r.ID, err)
+		}
+	})
+	// Stream commands push incremental output (log tail, progress) to the backend
+	command.SetOutputSender(func(f command.OutputFrame) error {
+		return connMgr.Send("command_output", f)
+	})
 	connMgr.StartReceiveLoop()
 
 	// Start directory tree sync loop (using ConnectionManager)
 	service.StartFileTreeSyncLoop(connMgr)
 
+	// Report applied settings so the backend can detect and correct drift
+	service.StartStateReportLoop(connMgr)
+
+	// Run assigned osquery packs and ship differential results
+	service.StartOsqueryPackLoop(connMgr)
+
+	// Ship hardware/software inventory whenever it changes
+	service.StartInventoryReportLoop(connMgr)
+
+	// Heartbeat with process/queue health so the backend can flag sick agents
+	service.StartTelemetryLoop(connMgr, version)
+
+	// Resume backups deferred until the backup window opens
+	service.StartBackupQueueLoop()
+
 	// socket running; setup cleanup on shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	// Cleanup function: remove website blocking khi agent shutdown
+	// (trạng thái đã lưu trong agent_settings sẽ được áp dụng lại ở lần khởi động sau)
 	defer func() {
 		logger.Info("Agent shutting down, cleaning up website blocking...")
 		hostsMgr := firewall.GetHostsManager()
@@ -150,10 +237,18 @@ func main() {
 	logger.Info("Shutdown signal received, exiting...")
 }
 
-func loadOrPromptToken() (string, string, error) {
+func loadOrObtainToken(enrollToken string) (string, string, error) {
 	if existing, err := auth.LoadToken(); err == nil && strings.TrimSpace(existing) != "" {
 		return strings.TrimSpace(existing), state.GetDeviceID(), nil
 	}
+	return obtainToken(enrollToken)
+}
+
+// obtainToken enroll bằng enrollment token nếu có (cài đặt tự động), ngược lại hỏi tài khoản.
+func obtainToken(enrollToken string) (string, string, error) {
+	if enrollToken != "" {
+		return service.Enroll(enrollToken)
+	}
 	return promptLogin()
 }
 
@@ -4,13 +4,25 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"sagiri-guard/backend/app/dto"
 	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/services"
 	"sagiri-guard/backend/global"
+	"sagiri-guard/cmdsign"
 )
 
-func (c *ProtocolController) handleAdminSendCommand(payload json.RawMessage) (any, error) {
+// commandSigTTL là thời gian sống của chữ ký command; agent từ chối chữ ký quá hạn.
+const commandSigTTL = 5 * time.Minute
+
+// handleAdminSendCommand queues (and signs) a command for one device; only an
+// authenticated admin may do this since the agent trusts the backend signature.
+func (c *ProtocolController) handleAdminSendCommand(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, ok := c.adminName(adminDeviceID)
+	if !ok {
+		return nil, errors.New("admin role required")
+	}
 	if c.CmdRepo == nil {
 		return nil, errors.New("command repo not available")
 	}
@@ -28,38 +40,361 @@ func (c *ProtocolController) handleAdminSendCommand(payload json.RawMessage) (an
 		Payload:  string(req.Payload),
 		Status:   "pending",
 	}
-	if err := c.CmdRepo.Create(&cmd); err != nil {
-		return nil, fmt.Errorf("queue command: %w", err)
+	applyCommandPolicy(&cmd, req.CommandPolicy, time.Now())
+	sent, err := c.dispatchCommand(&cmd)
+	if err != nil {
+		return nil, err
+	}
+	c.Audit.Record(admin, "command_send", cmd.DeviceID, fmt.Sprintf("command:%d", cmd.ID), cmd.Command)
+
+	resp := dto.AdminSendCommandResponse{
+		ID:     cmd.ID,
+		Status: cmd.Status,
+		Sent:   sent,
+	}
+	if cmd.ExpiresAt != nil {
+		resp.ExpiresAt = cmd.ExpiresAt.Unix()
+	}
+	return resp, nil
+}
+
+// applyCommandPolicy copies an explicit expiry/attempt limit from an admin request.
+func applyCommandPolicy(cmd *models.AgentCommand, p dto.CommandPolicy, now time.Time) {
+	switch {
+	case p.ExpiresAt > 0:
+		t := time.Unix(p.ExpiresAt, 0)
+		cmd.ExpiresAt = &t
+	case p.TTLSec > 0:
+		t := now.Add(time.Duration(p.TTLSec) * time.Second)
+		cmd.ExpiresAt = &t
+	}
+	if p.MaxAttempts > 0 {
+		cmd.MaxAttempts = p.MaxAttempts
+	}
+}
+
+// handleAdminCancelCommand cancels one command or a whole batch. Pending rows are
+// retired; stream commands already running on an online agent are told to stop.
+func (c *ProtocolController) handleAdminCancelCommand(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, ok := c.adminName(adminDeviceID)
+	if !ok {
+		return nil, errors.New("admin role required")
+	}
+	if c.CmdRepo == nil {
+		return nil, errors.New("command repo not available")
+	}
+	var req dto.AdminCancelCommandRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
 	}
 
-	sent := false
-	if c.Hub != nil && c.Hub.IsOnline(req.DeviceID) {
-		// try to send immediately
-		wireReq := dto.CommandRequest{
-			DeviceID: req.DeviceID,
-			Command:  req.Command,
-			Kind:     req.Kind,
-			Argument: req.Payload,
+	var cmds []models.AgentCommand
+	switch {
+	case req.ID != 0:
+		cmd, err := c.CmdRepo.Get(req.ID)
+		if err != nil {
+			return nil, err
+		}
+		if cmd == nil {
+			return nil, errors.New("command not found")
+		}
+		if cmd.Status != "pending" && (!commandActive(cmd) || cmd.Kind == "once") {
+			return nil, fmt.Errorf("command %d cannot be cancelled (status=%s kind=%s)", cmd.ID, cmd.Status, cmd.Kind)
+		}
+		cmds = append(cmds, *cmd)
+	case req.BatchID != "":
+		list, err := c.CmdRepo.ListByBatch(req.BatchID)
+		if err != nil {
+			return nil, err
 		}
-		b, err := json.Marshal(wireReq)
-		if err == nil {
-			if err := c.Hub.Send(req.DeviceID, b); err == nil {
-				_ = c.CmdRepo.MarkSent(cmd.ID)
-				sent = true
-			} else {
-				global.Logger.Warn().Err(err).Str("device", req.DeviceID).Msg("admin send command failed, keeping queued")
-				_ = c.CmdRepo.UpdateStatus(cmd.ID, "pending", err.Error())
+		if len(list) == 0 {
+			return nil, errors.New("batch not found")
+		}
+		cmds = list
+	default:
+		return nil, errors.New("missing id or batch_id")
+	}
+
+	var resp dto.AdminCancelCommandResponse
+	for i := range cmds {
+		cmd := &cmds[i]
+		switch {
+		case cmd.Status == "pending":
+			if ok, err := c.CmdRepo.Cancel(cmd.ID, []string{"pending"}); err != nil {
+				return nil, err
+			} else if ok {
+				resp.Cancelled++
+				continue
+			}
+			resp.Skipped++ // delivered concurrently
+		case commandActive(cmd) && cmd.Kind != "once":
+			ok, err := c.CmdRepo.Cancel(cmd.ID, []string{"sent", "running"})
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				resp.Skipped++
+				continue
+			}
+			resp.Cancelled++
+			if c.stopStreamCommand(cmd) {
+				resp.Stopped++
 			}
+		default:
+			resp.Skipped++
 		}
 	}
+	target := fmt.Sprintf("command:%d", req.ID)
+	if req.BatchID != "" {
+		target = "batch:" + req.BatchID
+	}
+	c.Audit.Record(admin, "command_cancel", cmds[0].DeviceID, target,
+		fmt.Sprintf("cancelled=%d stopped=%d skipped=%d", resp.Cancelled, resp.Stopped, resp.Skipped))
+	return resp, nil
+}
+
+// commandActive: delivered and possibly still running on the agent.
+func commandActive(cmd *models.AgentCommand) bool {
+	return cmd.Status == "sent" || cmd.Status == "running"
+}
+
+// handleCommandResult stores the execution result reported by the agent.
+// Duplicate reports come from replayed deliveries the agent refused to re-run.
+func (c *ProtocolController) handleCommandResult(deviceID string, payload json.RawMessage) error {
+	if c.CmdRepo == nil {
+		return errors.New("command repo not available")
+	}
+	var res dto.CommandResult
+	if err := json.Unmarshal(payload, &res); err != nil {
+		return err
+	}
+	if res.ID == 0 {
+		return errors.New("missing command id")
+	}
+	var status string
+	switch res.Status {
+	case "done", "failed", "expired":
+		status = res.Status
+	case "started":
+		status = "running"
+	case "running":
+		// agent stopped mid-execution earlier; the outcome is unknown, keep it delivered
+		status = "sent"
+	default:
+		return fmt.Errorf("unknown command status %q", res.Status)
+	}
+	ok, err := c.CmdRepo.RecordResult(res.ID, deviceID, status, res.Error)
+	if err != nil {
+		return err
+	}
+	ev := global.Logger.Info()
+	if status == "failed" {
+		ev = global.Logger.Warn()
+	}
+	ev.Str("device", deviceID).
+		Uint("id", res.ID).
+		Str("command", res.Command).
+		Str("status", status).
+		Bool("duplicate", res.Duplicate).
+		Bool("updated", ok).
+		Str("error", res.Error).
+		Msg("command result")
+	if ok && res.Command == "osquery_run" && (status == "done" || status == "failed") {
+		c.storeOsqueryResult(deviceID, res)
+	}
+	return nil
+}
+
+// stopStreamCommand asks an online agent to stop a running stream command.
+func (c *ProtocolController) stopStreamCommand(cmd *models.AgentCommand) bool {
+	if c.Hub == nil || !c.Hub.IsOnline(cmd.DeviceID) {
+		return false
+	}
+	if err := c.sendCommand(dto.CommandRequest{DeviceID: cmd.DeviceID, Command: cmd.Command, Kind: "cancel"}); err != nil {
+		global.Logger.Warn().Err(err).Str("device", cmd.DeviceID).Str("command", cmd.Command).Msg("send cancel failed")
+		return false
+	}
+	return true
+}
+
+// queueCommand persists an AgentCommand and pushes it immediately when the device is online.
+func (c *ProtocolController) queueCommand(deviceID, command, kind string, payload json.RawMessage) (*models.AgentCommand, bool, error) {
+	cmd := models.AgentCommand{
+		DeviceID: deviceID,
+		Command:  command,
+		Kind:     kind,
+		Payload:  string(payload),
+		Status:   "pending",
+	}
+	sent, err := c.dispatchCommand(&cmd)
+	if err != nil {
+		return nil, false, err
+	}
+	return &cmd, sent, nil
+}
+
+// dispatchCommand stores a prepared command row and tries to deliver it right away.
+// Unset expiry/attempt limits get the defaults from services.ApplyCommandDefaults.
+func (c *ProtocolController) dispatchCommand(cmd *models.AgentCommand) (bool, error) {
+	services.ApplyCommandDefaults(cmd, time.Now())
+	if err := c.CmdRepo.Create(cmd); err != nil {
+		return false, fmt.Errorf("queue command: %w", err)
+	}
+	if c.Hub == nil || !c.Hub.IsOnline(cmd.DeviceID) {
+		return false, nil
+	}
+	// try to send immediately
+	if err := c.deliverCommand(cmd); err != nil {
+		global.Logger.Warn().Err(err).Str("device", cmd.DeviceID).Msg("admin send command failed, keeping queued")
+		return false, nil
+	}
+	return true, nil
+}
+
+// deliverCommand pushes one stored command to the device and records the attempt.
+// Failures schedule a retry with backoff until MaxAttempts is reached.
+func (c *ProtocolController) deliverCommand(cmd *models.AgentCommand) error {
+	now := time.Now()
+	if services.CommandExpired(cmd, now) {
+		_ = c.CmdRepo.UpdateStatus(cmd.ID, "expired", "expired before delivery")
+		cmd.Status = "expired"
+		return nil
+	}
+	wireReq := dto.CommandRequest{
+		ID:       cmd.ID,
+		DeviceID: cmd.DeviceID,
+		Command:  cmd.Command,
+		Kind:     cmd.Kind,
+	}
+	if cmd.Payload != "" {
+		wireReq.Argument = json.RawMessage(cmd.Payload)
+	}
+	if cmd.ExpiresAt != nil {
+		wireReq.ExpiresAt = cmd.ExpiresAt.Unix()
+	}
+	err := c.sendCommand(wireReq)
+	if err == nil {
+		_ = c.CmdRepo.MarkSent(cmd.ID)
+		cmd.Status = "sent"
+		cmd.Attempts++
+		return nil
+	}
+
+	cmd.Attempts++
+	cmd.LastError = err.Error()
+	if cmd.Attempts >= cmd.MaxAttempts {
+		cmd.Status = "failed"
+		cmd.NextAttemptAt = nil
+	} else {
+		next := now.Add(services.CommandBackoff(cmd.Attempts))
+		cmd.Status = "pending"
+		cmd.NextAttemptAt = &next
+	}
+	_ = c.CmdRepo.MarkAttemptFailed(cmd.ID, cmd.Status, cmd.LastError, cmd.NextAttemptAt)
+	return err
+}
+
+// sendCommand signs a command for its target device and writes it to the live connection.
+// Each send gets a fresh nonce and a short signature lifetime so a captured frame
+// cannot be replayed later or against another device.
+func (c *ProtocolController) sendCommand(req dto.CommandRequest) error {
+	if c.CmdKey == nil {
+		return errors.New("command signing key not configured")
+	}
+	nonce, err := cmdsign.NewNonce()
+	if err != nil {
+		return err
+	}
+	req.Nonce = nonce
+	req.NotAfter = time.Now().Add(commandSigTTL).Unix()
+	req.Sig, err = cmdsign.Sign(c.CmdKey, cmdsign.Fields{
+		ID:        req.ID,
+		DeviceID:  req.DeviceID,
+		Command:   req.Command,
+		Kind:      req.Kind,
+		Argument:  req.Argument,
+		ExpiresAt: req.ExpiresAt,
+		Nonce:     req.Nonce,
+		NotAfter:  req.NotAfter,
+	})
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return c.Hub.Send(req.DeviceID, b)
+}
+
+// handleAdminCrossDeviceRestore restores a backup taken on one device onto another.
+// Paths are remapped server-side and the target is granted read access to the
+// source blob before the restore command is queued.
+func (c *ProtocolController) handleAdminCrossDeviceRestore(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, ok := c.adminName(adminDeviceID)
+	if !ok {
+		return nil, errors.New("admin role required")
+	}
+	if c.Backup == nil || c.CmdRepo == nil {
+		return nil, errors.New("backup service not available")
+	}
+	var req dto.AdminCrossDeviceRestoreRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.SourceDeviceID == "" || req.TargetDeviceID == "" {
+		return nil, errors.New("missing source_device_id or target_device_id")
+	}
+	if c.Devices != nil {
+		if _, err := c.Devices.FindByUUID(req.TargetDeviceID); err != nil {
+			return nil, fmt.Errorf("target device: %w", err)
+		}
+	}
+	v, err := c.Backup.ResolveVersion(req.SourceDeviceID, req.VersionID, req.LogicalPath, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	destPath := req.DestPath
+	if destPath == "" {
+		destPath = services.RemapPath(v.LogicalPath, req.PathRemaps)
+	}
+	grant, err := c.Backup.GrantCrossDeviceRestore(v, req.TargetDeviceID, destPath, admin)
+	if err != nil {
+		return nil, err
+	}
+	// file_id is left empty: item IDs belong to the source device's tree.
+	arg, err := json.Marshal(map[string]any{
+		"version_id": v.ID,
+		"file_name":  v.StoredName,
+		"dest_path":  destPath,
+		"mode":       req.Mode,
+		"grant_id":   grant.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	cmd, sent, err := c.queueCommand(req.TargetDeviceID, "restore", "once", arg)
+	if err != nil {
+		return nil, err
+	}
+	global.Logger.Info().
+		Str("admin", admin).
+		Str("source", req.SourceDeviceID).
+		Str("target", req.TargetDeviceID).
+		Uint("version_id", v.ID).
+		Str("dest", destPath).
+		Msg("cross-device restore queued")
 
 	status := "pending"
 	if sent {
 		status = "sent"
 	}
-	return dto.AdminSendCommandResponse{
-		ID:     cmd.ID,
-		Status: status,
-		Sent:   sent,
+	return dto.AdminCrossDeviceRestoreResponse{
+		CommandID: cmd.ID,
+		GrantID:   grant.ID,
+		VersionID: v.ID,
+		DestPath:  destPath,
+		Status:    status,
+		Sent:      sent,
 	}, nil
 }
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/services"
+	"sagiri-guard/backend/global"
+)
+
+// handleAdminBackupHold places (legalHold=true) or releases a legal hold on one
+// version or on every backup of a device. Retention can be extended, never shortened.
+// A place request that only extends retention leaves the legal hold untouched
+// unless legal_hold is sent explicitly.
+func (c *ProtocolController) handleAdminBackupHold(adminDeviceID string, payload json.RawMessage, legalHold bool) (any, error) {
+	admin, ok := c.adminName(adminDeviceID)
+	if !ok {
+		return nil, errors.New("admin role required")
+	}
+	if c.Backup == nil {
+		return nil, errors.New("backup service not available")
+	}
+	var req dto.AdminBackupHoldRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	action := "backup_hold_release"
+	if legalHold {
+		action = "backup_hold_place"
+	}
+	hold := &legalHold
+	if legalHold {
+		switch {
+		case req.LegalHold != nil:
+			hold = req.LegalHold
+		case req.RetainUntil > 0 || req.RetainDays != nil:
+			hold = nil
+		}
+	}
+
+	if req.VersionID != 0 {
+		var until *time.Time
+		if req.RetainUntil > 0 {
+			t := time.Unix(req.RetainUntil, 0)
+			until = &t
+		}
+		v, err := c.Backup.SetVersionHold(req.VersionID, hold, until)
+		if err != nil {
+			return nil, err
+		}
+		resp := dto.AdminBackupHoldResponse{DeviceID: v.DeviceID, VersionID: v.ID, LegalHold: v.LegalHold}
+		if v.RetainUntil != nil {
+			resp.RetainUntil = v.RetainUntil.Unix()
+		}
+		c.Audit.Record(admin, action, v.DeviceID, fmt.Sprintf("version:%d", v.ID),
+			fmt.Sprintf("legal_hold=%t retain_until=%d reason=%s", v.LegalHold, resp.RetainUntil, req.Reason))
+		return resp, nil
+	}
+
+	if req.DeviceID == "" {
+		return nil, errors.New("missing device_id or version_id")
+	}
+	dh, err := c.Backup.SetDeviceHold(req.DeviceID, hold, req.RetainDays, admin)
+	if err != nil {
+		return nil, err
+	}
+	c.Audit.Record(admin, action, dh.DeviceID, "device",
+		fmt.Sprintf("legal_hold=%t retain_days=%d reason=%s", dh.LegalHold, dh.RetainDays, req.Reason))
+	return dto.AdminBackupHoldResponse{
+		DeviceID:   dh.DeviceID,
+		LegalHold:  dh.LegalHold,
+		RetainDays: dh.RetainDays,
+	}, nil
+}
+
+// handleAdminBackupDelete runs one of the deletion paths (single version,
+// retention prune, device purge). Protected versions are refused/skipped by the service.
+func (c *ProtocolController) handleAdminBackupDelete(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, ok := c.adminName(adminDeviceID)
+	if !ok {
+		return nil, errors.New("admin role required")
+	}
+	if c.Backup == nil {
+		return nil, errors.New("backup service not available")
+	}
+	var req dto.AdminBackupDeleteRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+
+	var (
+		report *services.BackupDeleteReport
+		action string
+		target string
+		err    error
+	)
+	switch {
+	case req.VersionID != 0:
+		action, target = "backup_delete", fmt.Sprintf("version:%d", req.VersionID)
+		v, derr := c.Backup.DeleteVersion(req.VersionID)
+		if derr != nil {
+			if errors.Is(derr, services.ErrBackupProtected) {
+				c.Audit.Record(admin, "backup_delete_refused", req.DeviceID, target, req.Reason)
+			}
+			return nil, derr
+		}
+		req.DeviceID = v.DeviceID
+		report = &services.BackupDeleteReport{Deleted: []uint{v.ID}}
+	case req.DeviceID != "" && req.Purge:
+		action, target = "backup_purge", "device"
+		report, err = c.Backup.PurgeDevice(req.DeviceID)
+	case req.DeviceID != "" && req.LogicalPath != "":
+		action, target = "backup_prune", req.LogicalPath
+		report, err = c.Backup.PruneVersions(req.DeviceID, req.LogicalPath, req.KeepLast)
+	default:
+		return nil, errors.New("missing version_id, or device_id with purge or logical_path")
+	}
+	if report != nil {
+		c.Audit.Record(admin, action, req.DeviceID, target,
+			fmt.Sprintf("deleted=%v protected=%v reason=%s", report.Deleted, report.Protected, req.Reason))
+	}
+	if err != nil {
+		return nil, err
+	}
+	global.Logger.Info().
+		Str("admin", admin).
+		Str("action", action).
+		Str("device", req.DeviceID).
+		Int("deleted", len(report.Deleted)).
+		Int("protected", len(report.Protected)).
+		Msg("backup deletion executed")
+	return report, nil
+}
@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/services"
+	"sagiri-guard/backend/global"
+
+	"github.com/google/uuid"
+)
+
+// adminGroupsReady checks the admin role and that the group service is wired.
+func (c *ProtocolController) adminGroupsReady(adminDeviceID string) (string, error) {
+	admin, ok := c.adminName(adminDeviceID)
+	if !ok {
+		return "", errors.New("admin role required")
+	}
+	if c.Groups == nil {
+		return "", errors.New("device group service not available")
+	}
+	return admin, nil
+}
+
+func (c *ProtocolController) handleAdminGroupSave(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, err := c.adminGroupsReady(adminDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	var req dto.AdminGroupSaveRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	g, err := c.Groups.Save(req, admin)
+	if err != nil {
+		return nil, err
+	}
+	c.Audit.Record(admin, "group_save", "", "group:"+g.Name,
+		fmt.Sprintf("os=%q hostname=%q arch=%q add=%v", g.RuleOSName, g.RuleHostname, g.RuleArch, req.Devices))
+	return c.Groups.Detail(g.Name)
+}
+
+func (c *ProtocolController) handleAdminGroupMembers(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, err := c.adminGroupsReady(adminDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	var req dto.AdminGroupMembersRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	g, err := c.Groups.UpdateMembers(req.Name, req.Add, req.Remove)
+	if err != nil {
+		return nil, err
+	}
+	c.Audit.Record(admin, "group_members", "", "group:"+g.Name, fmt.Sprintf("add=%v remove=%v", req.Add, req.Remove))
+	return c.Groups.Detail(g.Name)
+}
+
+func (c *ProtocolController) handleAdminGroupDelete(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, err := c.adminGroupsReady(adminDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	var req dto.AdminGroupRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	if err := c.Groups.Delete(req.Name); err != nil {
+		return nil, err
+	}
+	c.Audit.Record(admin, "group_delete", "", "group:"+req.Name, "")
+	return map[string]string{"deleted": req.Name}, nil
+}
+
+func (c *ProtocolController) handleAdminGetGroup(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if _, err := c.adminGroupsReady(adminDeviceID); err != nil {
+		return nil, err
+	}
+	var req dto.AdminGroupRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	return c.Groups.Detail(req.Name)
+}
+
+func (c *ProtocolController) handleAdminListGroups(adminDeviceID string) (any, error) {
+	if _, err := c.adminGroupsReady(adminDeviceID); err != nil {
+		return nil, err
+	}
+	return c.Groups.List()
+}
+
+// handleAdminGroupSendCommand fans a command out to every member of a group.
+// Each device gets its own AgentCommand row; all rows share one batch ID.
+func (c *ProtocolController) handleAdminGroupSendCommand(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, err := c.adminGroupsReady(adminDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	var req dto.AdminGroupSendCommandRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.Group == "" || req.Command == "" {
+		return nil, errors.New("missing group or command")
+	}
+	members, err := c.Groups.Resolve(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	progress, err := c.fanOut(uuid.NewString(), req.Command, members, func(deviceID string) (*models.AgentCommand, error) {
+		cmd := &models.AgentCommand{
+			DeviceID: deviceID,
+			Command:  req.Command,
+			Kind:     req.Kind,
+			Payload:  string(req.Payload),
+			Status:   "pending",
+		}
+		applyCommandPolicy(cmd, req.CommandPolicy, now)
+		return cmd, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.Audit.Record(admin, "group_send_command", "", "group:"+req.Group,
+		fmt.Sprintf("command=%s batch=%s devices=%d", req.Command, progress.BatchID, progress.Total))
+	return progress, nil
+}
+
+// handleAdminGroupBlockRule adds a website block rule to every member of a group,
+// enables blocking there and pushes a block_website sync command per device.
+func (c *ProtocolController) handleAdminGroupBlockRule(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, err := c.adminGroupsReady(adminDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if c.Blocks == nil {
+		return nil, errors.New("website block service not available")
+	}
+	var req dto.AdminGroupBlockRuleRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.Group == "" {
+		return nil, errors.New("missing group")
+	}
+	rule := dto.WebsiteBlockRuleRequest{
+		Type:     req.Type,
+		Category: req.Category,
+		Domain:   strings.ToLower(strings.TrimSpace(req.Domain)),
+		Enabled:  req.Enabled == nil || *req.Enabled,
+	}
+	members, err := c.Groups.Resolve(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	progress, err := c.fanOut(uuid.NewString(), "block_website", members, func(deviceID string) (*models.AgentCommand, error) {
+		if _, err := c.Blocks.CreateRule(deviceID, rule); err != nil {
+			return nil, err
+		}
+		if err := c.Blocks.UpdateStatus(deviceID, true); err != nil {
+			return nil, err
+		}
+		sync, err := c.Blocks.GetSyncData(deviceID)
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(sync)
+		if err != nil {
+			return nil, err
+		}
+		return &models.AgentCommand{
+			DeviceID: deviceID,
+			Command:  "block_website",
+			Kind:     "once",
+			Payload:  string(b),
+			Status:   "pending",
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.Audit.Record(admin, "group_block_rule", "", "group:"+req.Group,
+		fmt.Sprintf("type=%s category=%s domain=%s batch=%s devices=%d", rule.Type, rule.Category, rule.Domain, progress.BatchID, progress.Total))
+	return progress, nil
+}
+
+// fanOut builds and dispatches one command per device under the given batch ID.
+// A device whose command cannot be built is counted as failed; the rest still run.
+func (c *ProtocolController) fanOut(batchID, command string, deviceIDs []string, build func(deviceID string) (*models.AgentCommand, error)) (dto.BatchProgress, error) {
+	if c.CmdRepo == nil {
+		return dto.BatchProgress{}, errors.New("command repo not available")
+	}
+	if len(deviceIDs) == 0 {
+		return dto.BatchProgress{}, errors.New("group has no devices")
+	}
+	cmds := make([]models.AgentCommand, 0, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		cmd, err := build(deviceID)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidInput) {
+				return dto.BatchProgress{}, err
+			}
+			global.Logger.Warn().Err(err).Str("device", deviceID).Str("batch", batchID).Msg("prepare group command failed")
+			// keep a failed row so batch progress stays accurate later on
+			failed := models.AgentCommand{DeviceID: deviceID, BatchID: batchID, Command: command, Status: "failed", LastError: err.Error()}
+			_ = c.CmdRepo.Create(&failed)
+			cmds = append(cmds, failed)
+			continue
+		}
+		cmd.BatchID = batchID
+		if _, err := c.dispatchCommand(cmd); err != nil {
+			global.Logger.Warn().Err(err).Str("device", deviceID).Str("batch", batchID).Msg("queue group command failed")
+			cmd.Status = "failed"
+		}
+		cmds = append(cmds, *cmd)
+	}
+	return services.SummarizeBatch(batchID, cmds), nil
+}
+
+func (c *ProtocolController) handleAdminBatchStatus(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if _, ok := c.adminName(adminDeviceID); !ok {
+		return nil, errors.New("admin role required")
+	}
+	if c.CmdRepo == nil {
+		return nil, errors.New("command repo not available")
+	}
+	var req dto.AdminBatchStatusRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.BatchID == "" {
+		return nil, errors.New("missing batch_id")
+	}
+	cmds, err := c.CmdRepo.ListByBatch(req.BatchID)
+	if err != nil {
+		return nil, err
+	}
+	if len(cmds) == 0 {
+		return nil, errors.New("batch not found")
+	}
+	return services.SummarizeBatch(req.BatchID, cmds), nil
+}
@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/services"
+	"sagiri-guard/backend/global"
+
+	"github.com/google/uuid"
+)
+
+// ackListBudget is the room left for list items once the fixed fields of an ACK
+// response are accounted for (ACKs are capped at ~3800 bytes).
+const ackListBudget = 2800
+
+func (c *ProtocolController) adminOsqueryReady(adminDeviceID string) (string, error) {
+	admin, ok := c.adminName(adminDeviceID)
+	if !ok {
+		return "", errors.New("admin role required")
+	}
+	if c.Osquery == nil {
+		return "", errors.New("osquery service not available")
+	}
+	return admin, nil
+}
+
+// handleAdminOsqueryRun queues an osquery_run command on one device or every member of a group.
+func (c *ProtocolController) handleAdminOsqueryRun(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, err := c.adminOsqueryReady(adminDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	var req dto.AdminOsqueryRunRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	query := services.NormalizeQuery(req.Query)
+	if query == "" {
+		return nil, errors.New("missing query")
+	}
+	if (req.DeviceID == "") == (req.Group == "") {
+		return nil, errors.New("exactly one of device_id or group is required")
+	}
+	arg, err := json.Marshal(dto.OsqueryRunArg{Query: query, TimeoutSec: req.TimeoutSec, MaxRows: req.MaxRows})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	build := func(deviceID string) (*models.AgentCommand, error) {
+		cmd := &models.AgentCommand{
+			DeviceID: deviceID,
+			Command:  "osquery_run",
+			Kind:     "once",
+			Payload:  string(arg),
+			Status:   "pending",
+		}
+		applyCommandPolicy(cmd, req.CommandPolicy, now)
+		return cmd, nil
+	}
+
+	if req.DeviceID != "" {
+		if c.CmdRepo == nil {
+			return nil, errors.New("command repo not available")
+		}
+		cmd, _ := build(req.DeviceID)
+		sent, err := c.dispatchCommand(cmd)
+		if err != nil {
+			return nil, err
+		}
+		c.Audit.Record(admin, "osquery_run", req.DeviceID, "", truncateDetail(query))
+		resp := dto.AdminSendCommandResponse{ID: cmd.ID, Status: cmd.Status, Sent: sent}
+		if cmd.ExpiresAt != nil {
+			resp.ExpiresAt = cmd.ExpiresAt.Unix()
+		}
+		return resp, nil
+	}
+
+	if c.Groups == nil {
+		return nil, errors.New("device group service not available")
+	}
+	members, err := c.Groups.Resolve(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	progress, err := c.fanOut(uuid.NewString(), "osquery_run", members, build)
+	if err != nil {
+		return nil, err
+	}
+	c.Audit.Record(admin, "osquery_run", "", "group:"+req.Group,
+		fmt.Sprintf("batch=%s devices=%d query=%s", progress.BatchID, progress.Total, truncateDetail(query)))
+	return progress, nil
+}
+
+// storeOsqueryResult keeps the rows of a finished osquery_run command. The
+// command row must belong to the reporting device.
+func (c *ProtocolController) storeOsqueryResult(deviceID string, res dto.CommandResult) {
+	if c.Osquery == nil || c.CmdRepo == nil || res.Duplicate {
+		return
+	}
+	cmd, err := c.CmdRepo.Get(res.ID)
+	if err != nil || cmd == nil || cmd.DeviceID != deviceID || cmd.Command != "osquery_run" {
+		return
+	}
+	if err := c.Osquery.StoreResult(cmd, res.Error, res.Output); err != nil {
+		global.Logger.Warn().Err(err).Str("device", deviceID).Uint("id", res.ID).Msg("store osquery result failed")
+	}
+}
+
+func (c *ProtocolController) handleAdminOsqueryResults(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if _, err := c.adminOsqueryReady(adminDeviceID); err != nil {
+		return nil, err
+	}
+	var req dto.AdminOsqueryResultsRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.DeviceID == "" {
+		return nil, errors.New("missing device_id")
+	}
+	rows, err := c.Osquery.ListByDevice(req.DeviceID, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]dto.OsqueryResultSummary, 0, len(rows))
+	for _, r := range rows {
+		s := services.OsqueryResultToDTO(r)
+		s.Query = truncateDetail(s.Query)
+		out = append(out, s)
+	}
+	fit, truncated := fitAck(out, ackListBudget)
+	return dto.AdminOsqueryResultsResponse{Results: fit, Truncated: truncated}, nil
+}
+
+// handleAdminGetOsqueryResult returns one page of stored rows starting at offset;
+// the page is cut to whatever fits into a single ACK.
+func (c *ProtocolController) handleAdminGetOsqueryResult(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if _, err := c.adminOsqueryReady(adminDeviceID); err != nil {
+		return nil, err
+	}
+	var req dto.AdminOsqueryResultRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	res, err := c.Osquery.Get(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.Osquery.Rows(res)
+	if err != nil {
+		return nil, err
+	}
+	summary := services.OsqueryResultToDTO(*res)
+	summary.Query = truncateDetail(summary.Query)
+	page := dto.OsqueryResultPage{OsqueryResultSummary: summary, Offset: req.Offset, Rows: []json.RawMessage{}}
+	if req.Offset < 0 || req.Offset > len(rows) {
+		return nil, errors.New("offset out of range")
+	}
+	rows = rows[req.Offset:]
+	if req.Limit > 0 && req.Limit < len(rows) {
+		rows = rows[:req.Limit]
+	}
+	fit, _ := fitAck(rows, ackListBudget-len(summary.Query))
+	page.Rows = fit
+	if next := req.Offset + len(fit); next < res.StoredRows {
+		page.NextOffset = next
+	}
+	return page, nil
+}
+
+// handleAdminOsqueryCompare groups devices by the row set of their latest result for a query.
+func (c *ProtocolController) handleAdminOsqueryCompare(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if _, err := c.adminOsqueryReady(adminDeviceID); err != nil {
+		return nil, err
+	}
+	var req dto.AdminOsqueryCompareRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	devices := req.DeviceIDs
+	if req.Group != "" {
+		if c.Groups == nil {
+			return nil, errors.New("device group service not available")
+		}
+		members, err := c.Groups.Resolve(req.Group)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, members...)
+	}
+	if len(devices) == 0 {
+		return nil, errors.New("missing device_ids or group")
+	}
+	resp, err := c.Osquery.Compare(req.Query, uniqueStrings(devices))
+	if err != nil {
+		return nil, err
+	}
+	var truncated bool
+	resp.Devices, truncated = fitAck(resp.Devices, ackListBudget)
+	resp.Truncated = truncated
+	return resp, nil
+}
+
+func (c *ProtocolController) handleAdminOsqueryDiff(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if _, err := c.adminOsqueryReady(adminDeviceID); err != nil {
+		return nil, err
+	}
+	var req dto.AdminOsqueryDiffRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.LeftID == 0 || req.RightID == 0 {
+		return nil, errors.New("missing left_id or right_id")
+	}
+	resp, err := c.Osquery.Diff(req.LeftID, req.RightID)
+	if err != nil {
+		return nil, err
+	}
+	var cutLeft, cutRight bool
+	resp.OnlyLeft, cutLeft = fitAck(resp.OnlyLeft, ackListBudget/2)
+	resp.OnlyRight, cutRight = fitAck(resp.OnlyRight, ackListBudget/2)
+	resp.Truncated = cutLeft || cutRight
+	return resp, nil
+}
+
+// fitAck keeps the leading items whose JSON encoding fits into budget bytes and
+// reports whether anything was dropped.
+func fitAck[T any](items []T, budget int) ([]T, bool) {
+	used := 0
+	for i, it := range items {
+		b, err := json.Marshal(it)
+		if err != nil || used+len(b)+1 > budget {
+			return items[:i], true
+		}
+		used += len(b) + 1
+	}
+	return items, false
+}
+
+// truncateDetail shortens free text (queries) for audit details and list views.
+func truncateDetail(s string) string {
+	const max = 200
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "..."
+}
+
+func uniqueStrings(in []string) []string {
+	seen := make(map[string]bool, len(in))
+	out := make([]string, 0, len(in))
+	for _, s := range in {
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	return out
+}
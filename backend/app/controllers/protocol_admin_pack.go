@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/global"
+)
+
+func (c *ProtocolController) adminPacksReady(adminDeviceID string) (string, error) {
+	admin, ok := c.adminName(adminDeviceID)
+	if !ok {
+		return "", errors.New("admin role required")
+	}
+	if c.Packs == nil {
+		return "", errors.New("osquery pack service not available")
+	}
+	return admin, nil
+}
+
+// handleAdminPackSave creates or replaces a pack and re-pushes the config to every device running it.
+func (c *ProtocolController) handleAdminPackSave(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, err := c.adminPacksReady(adminDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	var req dto.AdminPackSaveRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	p, err := c.Packs.Save(req, admin)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := c.Packs.Devices(p)
+	if err != nil {
+		return nil, err
+	}
+	updated := c.pushOsqueryPacks(devices)
+	summary, err := c.Packs.Summary(p.Name)
+	if err != nil {
+		return nil, err
+	}
+	c.Audit.Record(admin, "pack_save", "", "pack:"+p.Name, fmt.Sprintf("queries=%d devices=%d", len(summary.Queries), updated))
+	summary.Devices, _ = fitAck(summary.Devices, ackListBudget/2)
+	summary.Groups, _ = fitAck(summary.Groups, ackListBudget/4)
+	return dto.AdminPackSaveResponse{Pack: summary, Updated: updated}, nil
+}
+
+// handleAdminPackAssign adds (or removes) device/group targets of a pack.
+func (c *ProtocolController) handleAdminPackAssign(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, err := c.adminPacksReady(adminDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	var req dto.AdminPackAssignRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	affected, err := c.Packs.Assign(req)
+	if err != nil {
+		return nil, err
+	}
+	updated := c.pushOsqueryPacks(affected)
+	action := "pack_assign"
+	if req.Remove {
+		action = "pack_unassign"
+	}
+	c.Audit.Record(admin, action, "", "pack:"+req.Pack,
+		fmt.Sprintf("devices=%s groups=%s updated=%d", strings.Join(req.DeviceIDs, ","), strings.Join(req.Groups, ","), updated))
+	return map[string]int{"updated": updated}, nil
+}
+
+func (c *ProtocolController) handleAdminPackDelete(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, err := c.adminPacksReady(adminDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	var req dto.AdminPackRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	devices, err := c.Packs.Delete(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	updated := c.pushOsqueryPacks(devices)
+	c.Audit.Record(admin, "pack_delete", "", "pack:"+req.Name, fmt.Sprintf("devices=%d", updated))
+	return map[string]int{"updated": updated}, nil
+}
+
+func (c *ProtocolController) handleAdminListPacks(adminDeviceID string) (any, error) {
+	if _, err := c.adminPacksReady(adminDeviceID); err != nil {
+		return nil, err
+	}
+	packs, err := c.Packs.List()
+	if err != nil {
+		return nil, err
+	}
+	fit, truncated := fitAck(packs, ackListBudget)
+	return map[string]any{"packs": fit, "truncated": truncated}, nil
+}
+
+// handleAdminPackHistory pages through the added/removed rows reported for a device.
+func (c *ProtocolController) handleAdminPackHistory(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if _, err := c.adminPacksReady(adminDeviceID); err != nil {
+		return nil, err
+	}
+	var req dto.AdminPackHistoryRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	entries, more, err := c.Packs.History(req)
+	if err != nil {
+		return nil, err
+	}
+	fit, truncated := fitAck(entries, ackListBudget)
+	resp := dto.AdminPackHistoryResponse{Entries: fit}
+	if truncated || more {
+		resp.NextOffset = req.Offset + len(fit)
+	}
+	return resp, nil
+}
+
+// handleOsqueryPackSync compares the pack config hash reported by the agent
+// with the expected one and queues a fresh osquery_packs command on mismatch.
+func (c *ProtocolController) handleOsqueryPackSync(deviceID string, payload json.RawMessage) (any, error) {
+	if c.Packs == nil || c.CmdRepo == nil {
+		return nil, errors.New("osquery pack service not available")
+	}
+	if deviceID == "" {
+		return nil, errors.New("missing device id")
+	}
+	var req dto.OsqueryPackSync
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	arg, err := c.Packs.ConfigFor(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if req.ConfigHash == arg.Hash {
+		return map[string]bool{"in_sync": true}, nil
+	}
+	pending, err := c.CmdRepo.HasPending(deviceID, "osquery_packs", time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !pending {
+		if err := c.queueOsqueryPacks(deviceID, arg); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]bool{"in_sync": false}, nil
+}
+
+// handleOsqueryDiff stores the added/removed rows of one scheduled pack query.
+func (c *ProtocolController) handleOsqueryDiff(deviceID string, payload json.RawMessage) (any, error) {
+	if c.Packs == nil {
+		return nil, errors.New("osquery pack service not available")
+	}
+	if deviceID == "" {
+		return nil, errors.New("missing device id")
+	}
+	var d dto.OsqueryDiff
+	if err := json.Unmarshal(payload, &d); err != nil {
+		return nil, err
+	}
+	n, err := c.Packs.RecordDiff(deviceID, d)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{"stored": n}, nil
+}
+
+// pushOsqueryPacks rebuilds and queues the pack config of each device; returns how many were queued.
+func (c *ProtocolController) pushOsqueryPacks(deviceIDs []string) int {
+	if c.CmdRepo == nil {
+		return 0
+	}
+	n := 0
+	for _, id := range deviceIDs {
+		arg, err := c.Packs.ConfigFor(id)
+		if err == nil {
+			err = c.queueOsqueryPacks(id, arg)
+		}
+		if err != nil {
+			global.Logger.Warn().Err(err).Str("device", id).Msg("push osquery packs failed")
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// queueOsqueryPacks replaces any undelivered pack config with the new one.
+func (c *ProtocolController) queueOsqueryPacks(deviceID string, arg dto.OsqueryPacksArg) error {
+	payload, err := json.Marshal(arg)
+	if err != nil {
+		return err
+	}
+	if _, err := c.CmdRepo.CancelPending(deviceID, "osquery_packs"); err != nil {
+		return err
+	}
+	_, _, err = c.queueCommand(deviceID, "osquery_packs", "once", payload)
+	return err
+}
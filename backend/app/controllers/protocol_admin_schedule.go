@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/services"
+	"sagiri-guard/backend/global"
+)
+
+func (c *ProtocolController) adminSchedulesReady(adminDeviceID string) (string, error) {
+	admin, ok := c.adminName(adminDeviceID)
+	if !ok {
+		return "", errors.New("admin role required")
+	}
+	if c.Schedules == nil {
+		return "", errors.New("schedule service not available")
+	}
+	return admin, nil
+}
+
+func (c *ProtocolController) handleAdminScheduleCreate(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, err := c.adminSchedulesReady(adminDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	var req dto.AdminScheduleCreateRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	sched, err := c.Schedules.Create(req, admin)
+	if err != nil {
+		return nil, err
+	}
+	c.Audit.Record(admin, "schedule_create", sched.DeviceID, "schedule:"+sched.Name,
+		fmt.Sprintf("cron=%q tz=%q group=%q command=%s", sched.CronExpr, sched.Timezone, sched.GroupName, sched.Command))
+	return services.ScheduleToDTO(sched), nil
+}
+
+// handleAdminSchedulePause pauses a schedule, or resumes it when paused=false.
+func (c *ProtocolController) handleAdminSchedulePause(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, err := c.adminSchedulesReady(adminDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	var req dto.AdminSchedulePauseRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	paused := req.Paused == nil || *req.Paused
+	sched, err := c.Schedules.SetPaused(req.ID, req.Name, paused)
+	if err != nil {
+		return nil, err
+	}
+	action := "schedule_pause"
+	if !paused {
+		action = "schedule_resume"
+	}
+	c.Audit.Record(admin, action, sched.DeviceID, "schedule:"+sched.Name, "")
+	return services.ScheduleToDTO(sched), nil
+}
+
+func (c *ProtocolController) handleAdminListSchedules(adminDeviceID string) (any, error) {
+	if _, err := c.adminSchedulesReady(adminDeviceID); err != nil {
+		return nil, err
+	}
+	return c.Schedules.List()
+}
+
+// StartScheduler runs due schedules every interval until the process exits.
+func (c *ProtocolController) StartScheduler(interval time.Duration) {
+	if c.Schedules == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		c.runSchedules(time.Now())
+		for now := range ticker.C {
+			c.runSchedules(now)
+		}
+	}()
+}
+
+// runSchedules claims due schedules and materializes their AgentCommand rows.
+// Each run's commands share a batch ID derived from the schedule and slot.
+func (c *ProtocolController) runSchedules(now time.Time) {
+	runs, err := c.Schedules.ClaimDue(now)
+	if err != nil {
+		global.Logger.Error().Err(err).Msg("claim due schedules failed")
+	}
+	for _, run := range runs {
+		sched := run.Schedule
+		targets, err := c.Schedules.Targets(&sched)
+		if err != nil {
+			global.Logger.Error().Err(err).Str("schedule", sched.Name).Msg("resolve schedule targets failed")
+			continue
+		}
+		policy := dto.CommandPolicy{TTLSec: sched.TTLSec, MaxAttempts: sched.MaxAttempts}
+		progress, err := c.fanOut(run.BatchID, sched.Command, targets, func(deviceID string) (*models.AgentCommand, error) {
+			cmd := &models.AgentCommand{
+				DeviceID: deviceID,
+				Command:  sched.Command,
+				Kind:     sched.Kind,
+				Payload:  sched.Payload,
+				Status:   "pending",
+			}
+			applyCommandPolicy(cmd, policy, now)
+			return cmd, nil
+		})
+		if err != nil {
+			global.Logger.Error().Err(err).Str("schedule", sched.Name).Msg("run schedule failed")
+			continue
+		}
+		global.Logger.Info().
+			Str("schedule", sched.Name).
+			Str("batch", run.BatchID).
+			Time("slot", run.Slot).
+			Int("devices", progress.Total).
+			Int("sent", progress.Sent).
+			Msg("scheduled command dispatched")
+	}
+}
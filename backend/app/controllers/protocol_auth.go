@@ -13,7 +13,7 @@ import (
 )
 
 func (c *ProtocolController) handleLogin(msgDeviceID string, payload json.RawMessage) (any, error) {
-	if c.Users == nil || c.Signer == nil {
+	if c.Users == nil || c.Tokens == nil {
 		return nil, errors.New("auth not available")
 	}
 	var req dto.ProtocolLoginRequest
@@ -32,36 +32,59 @@ func (c *ProtocolController) handleLogin(msgDeviceID string, payload json.RawMes
 	if err != nil {
 		return nil, err
 	}
-	token, err := c.Signer.Sign(user.ID, user.Username, user.Role, deviceID)
+	// Check the device key and hardware fingerprint before issuing a token. A password
+	// login only binds a key for a device registering for the first time.
+	if c.Identity != nil {
+		if err := c.Identity.Login(deviceID, req.PublicKey, req.Fingerprint, user.Username, c.deviceKnown(deviceID)); err != nil {
+			c.auditIdentityAlert(deviceID, req.Hostname, err)
+			return nil, err
+		}
+	}
+	pair, err := c.Tokens.Issue(user.ID, user.Username, user.Role, deviceID)
 	if err != nil {
 		return nil, err
 	}
 	c.mu.Lock()
-	c.deviceTokens[deviceID] = token
+	c.deviceTokens[deviceID] = pair.Token
 	if msgDeviceID != "" && msgDeviceID != deviceID {
 		// also cache under frame device id to keep connection/device map in sync
-		c.deviceTokens[msgDeviceID] = token
+		c.deviceTokens[msgDeviceID] = pair.Token
 	}
 	c.mu.Unlock()
 
 	// Ensure device exists and enrich basic info (first login on a machine may not have registered yet)
-	if c.Devices != nil && deviceID != "" {
-		info := models.Device{
-			UUID:      deviceID,
-			Name:      req.Name,
-			OSName:    req.OSName,
-			OSVersion: req.OSVersion,
-			Hostname:  req.Hostname,
-			Arch:      req.Arch,
-		}
-		if _, err := c.Devices.FindByUUID(deviceID); err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				_ = c.Devices.UpsertDevice(&info)
-			}
-		} else {
+	c.ensureDevice(models.Device{
+		UUID:      deviceID,
+		Name:      req.Name,
+		OSName:    req.OSName,
+		OSVersion: req.OSVersion,
+		Hostname:  req.Hostname,
+		Arch:      req.Arch,
+	})
+
+	return pair, nil
+}
+
+// deviceKnown reports whether deviceID is already registered; lookup errors count
+// as registered so a DB hiccup cannot turn a login into a first registration.
+func (c *ProtocolController) deviceKnown(deviceID string) bool {
+	if c.Devices == nil {
+		return false
+	}
+	_, err := c.Devices.FindByUUID(deviceID)
+	return !errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+// ensureDevice creates or refreshes the device record reported at login/enrollment.
+func (c *ProtocolController) ensureDevice(info models.Device) {
+	if c.Devices == nil || info.UUID == "" {
+		return
+	}
+	if _, err := c.Devices.FindByUUID(info.UUID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			_ = c.Devices.UpsertDevice(&info)
 		}
+	} else {
+		_ = c.Devices.UpsertDevice(&info)
 	}
-
-	return map[string]string{"token": token, "device_id": deviceID}, nil
 }
@@ -5,8 +5,10 @@ import (
 	"errors"
 	"io"
 	"os"
+	"time"
 
 	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/services"
 	"sagiri-guard/backend/global"
 	"sagiri-guard/network"
 )
@@ -36,6 +38,89 @@ func (c *ProtocolController) handleBackupInitUpload(deviceID string, payload jso
 	return resp, nil
 }
 
+// handleBackupBatchInit opens a multi-file upload: every file gets its own
+// session "<batch>.<i>" sharing one token, streamed over a single transfer connection.
+func (c *ProtocolController) handleBackupBatchInit(deviceID string, payload json.RawMessage) (any, error) {
+	if c.Backup == nil {
+		return nil, errors.New("backup disabled")
+	}
+	if deviceID == "" {
+		return nil, errors.New("missing device id")
+	}
+	var req dto.BackupBatchInitRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	resp, err := c.Backup.PrepareBatchUpload(deviceID, req)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	for i := 0; i < resp.Count; i++ {
+		id := services.BatchFileSessionID(resp.BatchID, i)
+		c.activeUpload[id] = &backupSessionCtx{id: id, token: resp.Token, batch: true}
+	}
+	c.mu.Unlock()
+	return resp, nil
+}
+
+// handleBackupBatchFinalize commits every completed file of the batch in one transaction.
+func (c *ProtocolController) handleBackupBatchFinalize(deviceID string, payload json.RawMessage) (any, error) {
+	if c.Backup == nil {
+		return nil, errors.New("backup disabled")
+	}
+	var req dto.BackupBatchFinalizeRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.BatchID == "" || req.Token == "" {
+		return nil, errors.New("missing batch id or token")
+	}
+	resp, err := c.Backup.FinalizeBatch(deviceID, req)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	for id, ctx := range c.activeUpload {
+		if ctx.token == req.Token {
+			delete(c.activeUpload, id)
+		}
+	}
+	c.mu.Unlock()
+	global.Logger.Info().
+		Str("device", deviceID).
+		Str("batch", resp.BatchID).
+		Int("stored", resp.Stored).
+		Int("incomplete", len(resp.Incomplete)).
+		Int("failed", len(resp.Failed)).
+		Msg("backup batch finalized")
+	return resp, nil
+}
+
+// StartBackupSweeper periodically drops batch uploads that were never finalized,
+// together with their temp files and transfer contexts.
+func (c *ProtocolController) StartBackupSweeper(interval time.Duration) {
+	if c.Backup == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			ids := c.Backup.ExpireBatches(now)
+			if len(ids) == 0 {
+				continue
+			}
+			c.mu.Lock()
+			for _, id := range ids {
+				delete(c.activeUpload, id)
+			}
+			c.mu.Unlock()
+			global.Logger.Info().Int("sessions", len(ids)).Msg("expired abandoned backup batches")
+		}
+	}()
+}
+
 func (c *ProtocolController) handleBackupInitDownload(deviceID string, payload json.RawMessage) (any, error) {
 	if !c.isAuthorized(deviceID) {
 		return nil, errors.New("unauthorized")
@@ -76,6 +161,9 @@ func (c *ProtocolController) handleBackupDownloadStart(client *network.TCPClient
 	if err != nil {
 		return err
 	}
+	if err := c.Backup.CheckDownloadGrant(sess); err != nil {
+		return err
+	}
 	// Send meta
 	if err := client.SendFileMeta(sess.FileName, uint64(sess.FileSize)); err != nil {
 		return err
@@ -111,11 +199,16 @@ func (c *ProtocolController) handleBackupDownloadStart(client *network.TCPClient
 	if err := client.SendFileDoneWithSession(req.SessionID, req.Token); err != nil {
 		return err
 	}
+	// The restore grant is consumed only once every byte has been sent.
+	// The done frame is already out, so a failure here is only logged.
+	if err := c.Backup.CompleteDownload(req.SessionID); err != nil {
+		global.Logger.Warn().Err(err).Str("device", deviceID).Str("session", req.SessionID).Msg("complete download failed")
+	}
 	return nil
 }
 
-func (c *ProtocolController) handleFileChunk(msg *network.ProtocolMessage) {
-	if !c.isAuthorized(msg.DeviceID) {
+func (c *ProtocolController) handleFileChunk(deviceID string, msg *network.ProtocolMessage) {
+	if !c.isAuthorized(deviceID) {
 		return
 	}
 	if c.Backup == nil {
@@ -132,7 +225,7 @@ func (c *ProtocolController) handleFileChunk(msg *network.ProtocolMessage) {
 	}
 	sess, err := c.Backup.ValidateSession(ctx.id, ctx.token, dto.DirectionUpload)
 	if err != nil {
-		global.Logger.Warn().Err(err).Str("device", msg.DeviceID).Msg("invalid upload session")
+		global.Logger.Warn().Err(err).Str("device", deviceID).Msg("invalid upload session")
 		return
 	}
 	if msg.ChunkData == nil || msg.ChunkLen == 0 {
@@ -143,7 +236,8 @@ func (c *ProtocolController) handleFileChunk(msg *network.ProtocolMessage) {
 		global.Logger.Error().Err(err).Msg("open temp file failed")
 		return
 	}
-	if _, err := f.Seek(int64(msg.ChunkOffset), io.SeekStart); err != nil {
+	done, _ := c.Backup.CurrentOffset(ctx.id)
+	if _, err := f.Seek(services.ChunkOffset(done, msg.ChunkOffset), io.SeekStart); err != nil {
 		_ = f.Close()
 		global.Logger.Error().Err(err).Msg("seek temp file failed")
 		return
@@ -159,41 +253,61 @@ func (c *ProtocolController) handleFileChunk(msg *network.ProtocolMessage) {
 	}
 }
 
-func (c *ProtocolController) handleFileDone(msg *network.ProtocolMessage) {
-	if !c.isAuthorized(msg.DeviceID) {
-		return
+// handleFileDone completes an upload session. Single-file uploads are acknowledged
+// so the agent only records a file as backed up once its version is stored; batch
+// files are acknowledged together by backup_batch_finalize.
+func (c *ProtocolController) handleFileDone(client *network.TCPClient, deviceID string, msg *network.ProtocolMessage) {
+	batch, err := c.finishUpload(deviceID, msg)
+	switch {
+	case batch && err != nil:
+		global.Logger.Warn().Err(err).Str("device", deviceID).Str("session", msg.SessionID).Msg("batch file done refused")
+	case batch:
+	case err != nil:
+		global.Logger.Error().Err(err).Str("device", deviceID).Str("session", msg.SessionID).Msg("finalize upload failed")
+		_ = client.SendAck(500, err.Error())
+	default:
+		_ = client.SendAck(200, "upload finalized")
+	}
+}
+
+func (c *ProtocolController) finishUpload(deviceID string, msg *network.ProtocolMessage) (bool, error) {
+	if !c.isAuthorized(deviceID) {
+		return false, errors.New("unauthorized")
 	}
 	if c.Backup == nil {
-		return
+		return false, errors.New("backup disabled")
 	}
 	if msg.SessionID == "" || msg.Token == "" {
-		return
+		return false, errors.New("missing session id or token")
 	}
 	c.mu.Lock()
 	ctx := c.activeUpload[msg.SessionID]
 	c.mu.Unlock()
 	if ctx == nil || ctx.token != msg.Token {
-		return
+		return false, errors.New("unknown upload session")
 	}
 	sess, err := c.Backup.ValidateSession(ctx.id, ctx.token, dto.DirectionUpload)
 	if err != nil {
-		global.Logger.Warn().Err(err).Str("device", msg.DeviceID).Msg("invalid upload session")
-		return
+		return ctx.batch, err
 	}
 	if err := c.Backup.MarkCompleted(sess.ID); err != nil {
-		global.Logger.Error().Err(err).Msg("mark upload complete failed")
-		return
+		return ctx.batch, err
+	}
+	// Batch file: version rows are created once at backup_batch_finalize
+	if ctx.batch {
+		global.Logger.Debug().Str("device", deviceID).Str("session", sess.ID).Msg("batch file received")
+		return true, nil
 	}
 	if err := c.Backup.FinalizeUpload(sess.ID); err != nil {
-		global.Logger.Error().Err(err).Str("session", sess.ID).Msg("finalize upload failed (rename .part/.path)")
-		return
+		return false, err
 	}
 	global.Logger.Info().
-		Str("device", msg.DeviceID).
+		Str("device", deviceID).
 		Str("session", sess.ID).
 		Str("file", sess.FinalPath).
 		Msg("backup upload finalized")
 	c.mu.Lock()
 	delete(c.activeUpload, msg.SessionID)
 	c.mu.Unlock()
+	return false, nil
 }
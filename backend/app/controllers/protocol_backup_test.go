@@ -0,0 +1,351 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	jwtutil "sagiri-guard/backend/app/jwt"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+	"sagiri-guard/backend/app/services"
+	"sagiri-guard/backend/app/socket"
+	"sagiri-guard/backend/config"
+	"sagiri-guard/backend/global"
+	"sagiri-guard/cmdsign"
+	"sagiri-guard/devicekey"
+	"sagiri-guard/network"
+
+	"github.com/rs/zerolog"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testFingerprint = "fp-test"
+
+// backupHarness runs a ProtocolController behind a real protocol server with a
+// device whose key is bound, the way a deployed backend sees an enrolled agent.
+type backupHarness struct {
+	ctrl     *ProtocolController
+	db       *gorm.DB
+	port     int
+	storage  string
+	signer   *jwtutil.Signer
+	deviceID string
+	key      ed25519.PrivateKey
+}
+
+func newBackupHarness(t *testing.T) *backupHarness {
+	t.Helper()
+	global.Logger = zerolog.Nop()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.BackupFileVersion{}, &models.BackupHold{}, &models.RestoreGrant{}, &models.DeviceIdentity{}); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	storage := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Backup.StoragePath = storage
+	cfg.Backup.TCP.Host = "127.0.0.1"
+	cfg.Backup.TCP.Port = port
+	backup, err := services.NewBackupService(cfg, repo.NewBackupVersionRepository(db), repo.NewRestoreGrantRepository(db), repo.NewBackupHoldRepository(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity := services.NewDeviceIdentityService(repo.NewDeviceIdentityRepository(db))
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const deviceID = "dev-backup"
+	if err := identity.Enroll(deviceID, cmdsign.EncodePublicKey(pub), testFingerprint, "test"); err != nil {
+		t.Fatal(err)
+	}
+	signer := &jwtutil.Signer{Secret: []byte("test-secret"), Issuer: "test", ExpMin: 15, RefreshExpMin: 60}
+	ctrl := NewProtocolController(socket.NewHub(""), nil, nil, nil, nil, backup, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, identity, nil, nil, signer, nil)
+
+	srv, err := network.ListenProtocol("127.0.0.1", port, ctrl.HandleMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+	return &backupHarness{ctrl: ctrl, db: db, port: port, storage: storage, signer: signer, deviceID: deviceID, key: key}
+}
+
+func (h *backupHarness) dial(t *testing.T) *network.TCPClient {
+	t.Helper()
+	var c *network.TCPClient
+	var err error
+	for i := 0; i < 50; i++ {
+		if c, err = network.DialTCP("127.0.0.1", h.port); err == nil {
+			t.Cleanup(func() { _ = c.Close() })
+			return c
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("dial protocol server: %v", err)
+	return nil
+}
+
+// login authenticates a connection like the agent's protocolclient.Login:
+// login frame with an access token, then the identity challenge/proof.
+func (h *backupHarness) login(t *testing.T, c *network.TCPClient) {
+	t.Helper()
+	tok, err := h.signer.Sign(1, "agent", "device", h.deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendLogin(h.deviceID, tok); err != nil {
+		t.Fatal(err)
+	}
+	var ch dto.IdentityChallengeResponse
+	if err := json.Unmarshal([]byte(h.request(t, c, "identity_challenge", nil, 200)), &ch); err != nil || !ch.Bound {
+		t.Fatalf("identity challenge = %+v, %v", ch, err)
+	}
+	h.request(t, c, "identity_prove", dto.IdentityProveRequest{
+		Signature:   devicekey.Sign(h.key, h.deviceID, ch.Nonce, testFingerprint),
+		Fingerprint: testFingerprint,
+	}, 200)
+}
+
+func (h *backupHarness) request(t *testing.T, c *network.TCPClient, action string, data any, want uint16) string {
+	t.Helper()
+	b, err := json.Marshal(map[string]any{"action": action, "data": data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendCommand(b); err != nil {
+		t.Fatal(err)
+	}
+	return expectAck(t, c, want)
+}
+
+func expectAck(t *testing.T, c *network.TCPClient, want uint16) string {
+	t.Helper()
+	for {
+		msg, err := c.RecvProtocolMessage()
+		if err != nil {
+			t.Fatalf("waiting for ack %d: %v", want, err)
+		}
+		if msg.Type != network.MsgAck {
+			continue
+		}
+		if msg.StatusCode != want {
+			t.Fatalf("ack = %d %q, want %d", msg.StatusCode, msg.StatusMsg, want)
+		}
+		return msg.StatusMsg
+	}
+}
+
+func (h *backupHarness) upload(t *testing.T, c *network.TCPClient, logicalPath string, data []byte) dto.BackupSessionResponse {
+	t.Helper()
+	var sess dto.BackupSessionResponse
+	raw := h.request(t, c, "backup_init_upload", dto.BackupUploadInitRequest{
+		FileName:    filepath.Base(logicalPath),
+		FileSize:    int64(len(data)),
+		LogicalPath: logicalPath,
+	}, 200)
+	if err := json.Unmarshal([]byte(raw), &sess); err != nil {
+		t.Fatal(err)
+	}
+	step := max(4, len(data)/16) // several chunks whatever the size
+	for off := 0; off < len(data); off += step {
+		end := min(off+step, len(data))
+		if err := c.SendFileChunkWithSession(sess.SessionID, sess.Token, uint32(off), data[off:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.SendFileDoneWithSession(sess.SessionID, sess.Token); err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+func TestBackupUploadOnAuthorizedConnection(t *testing.T) {
+	h := newBackupHarness(t)
+	c := h.dial(t)
+	h.login(t, c)
+
+	data := []byte("hello backup over the wire")
+	h.upload(t, c, "/home/alice/notes.txt", data)
+	if msg := expectAck(t, c, 200); msg != "upload finalized" {
+		t.Errorf("done ack = %q", msg)
+	}
+
+	var versions []models.BackupFileVersion
+	if err := h.db.Where("device_id = ?", h.deviceID).Find(&versions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].LogicalPath != "/home/alice/notes.txt" || versions[0].Size != int64(len(data)) {
+		t.Fatalf("versions = %+v, want one stored version", versions)
+	}
+	got, err := os.ReadFile(filepath.Join(h.storage, h.deviceID, versions[0].StoredName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("stored blob = %q, want %q", got, data)
+	}
+}
+
+func TestBackupUploadRefusedWithoutIdentityProof(t *testing.T) {
+	h := newBackupHarness(t)
+	setup := h.dial(t)
+	h.login(t, setup)
+	var sess dto.BackupSessionResponse
+	raw := h.request(t, setup, "backup_init_upload", dto.BackupUploadInitRequest{FileName: "a.txt", FileSize: 3}, 200)
+	if err := json.Unmarshal([]byte(raw), &sess); err != nil {
+		t.Fatal(err)
+	}
+
+	// a transfer connection with a token but no key proof must not finish the upload
+	c := h.dial(t)
+	tok, err := h.signer.Sign(1, "agent", "device", h.deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendLogin(h.deviceID, tok); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendFileChunkWithSession(sess.SessionID, sess.Token, 0, []byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendFileDoneWithSession(sess.SessionID, sess.Token); err != nil {
+		t.Fatal(err)
+	}
+	expectAck(t, c, 401)
+
+	var n int64
+	if err := h.db.Model(&models.BackupFileVersion{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("stored %d versions from an unproven connection", n)
+	}
+}
+
+// download runs the agent's restore framing on its own transfer connection:
+// login, backup_download_start, then meta/chunks until the done frame.
+func (h *backupHarness) download(t *testing.T, sess dto.BackupSessionResponse, offset uint32) []byte {
+	t.Helper()
+	c := h.dial(t)
+	h.login(t, c)
+	b, err := json.Marshal(map[string]any{
+		"action": "backup_download_start",
+		"data":   dto.BackupDownloadStartRequest{SessionID: sess.SessionID, Token: sess.Token, Offset: offset},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendCommand(b); err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	for {
+		msg, err := c.RecvProtocolMessage()
+		if err != nil {
+			t.Fatalf("receive download: %v", err)
+		}
+		switch msg.Type {
+		case network.MsgFileMeta:
+			if int64(msg.FileSize) != sess.FileSize {
+				t.Errorf("meta size = %d, want %d", msg.FileSize, sess.FileSize)
+			}
+		case network.MsgFileChunk:
+			got = append(got, msg.ChunkData...)
+		case network.MsgFileDone:
+			return got
+		case network.MsgAck, network.MsgError:
+			t.Fatalf("download failed: %d %q", msg.StatusCode, msg.StatusMsg)
+		}
+	}
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	h := newBackupHarness(t)
+	c := h.dial(t)
+	h.login(t, c)
+
+	data := bytes.Repeat([]byte("restore me end to end. "), 40000) // > one 512 KiB chunk
+	h.upload(t, c, "/home/alice/report.txt", data)
+	expectAck(t, c, 200)
+	var v models.BackupFileVersion
+	if err := h.db.Where("device_id = ?", h.deviceID).First(&v).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var sess dto.BackupSessionResponse
+	raw := h.request(t, c, "backup_init_download", dto.BackupDownloadInitRequest{FileName: v.StoredName}, 200)
+	if err := json.Unmarshal([]byte(raw), &sess); err != nil {
+		t.Fatal(err)
+	}
+	if sess.FileSize != int64(len(data)) || sess.TCPPort != h.port {
+		t.Fatalf("download session = %+v", sess)
+	}
+	if got := h.download(t, sess, 0); !bytes.Equal(got, data) {
+		t.Fatalf("restored %d bytes, want %d identical bytes", len(got), len(data))
+	}
+
+	// resume from an offset sends only the tail
+	raw = h.request(t, c, "backup_init_download", dto.BackupDownloadInitRequest{FileName: v.StoredName}, 200)
+	if err := json.Unmarshal([]byte(raw), &sess); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.download(t, sess, 1000); !bytes.Equal(got, data[1000:]) {
+		t.Fatalf("resumed download returned %d bytes, want %d", len(got), len(data)-1000)
+	}
+}
+
+func TestBackupDownloadStartRequiresAuthorizedConnection(t *testing.T) {
+	h := newBackupHarness(t)
+	c := h.dial(t)
+	h.login(t, c)
+	h.upload(t, c, "/home/alice/secret.txt", []byte("top secret"))
+	expectAck(t, c, 200)
+	var v models.BackupFileVersion
+	if err := h.db.Where("device_id = ?", h.deviceID).First(&v).Error; err != nil {
+		t.Fatal(err)
+	}
+	var sess dto.BackupSessionResponse
+	raw := h.request(t, c, "backup_init_download", dto.BackupDownloadInitRequest{FileName: v.StoredName}, 200)
+	if err := json.Unmarshal([]byte(raw), &sess); err != nil {
+		t.Fatal(err)
+	}
+
+	// session id and token alone are not enough without a logged-in device
+	anon := h.dial(t)
+	b, err := json.Marshal(map[string]any{
+		"action": "backup_download_start",
+		"data":   dto.BackupDownloadStartRequest{SessionID: sess.SessionID, Token: sess.Token},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := anon.SendCommand(b); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := anon.RecvProtocolMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != network.MsgAck || msg.StatusCode == 200 {
+		t.Fatalf("unauthenticated download start got type=%d code=%d", msg.Type, msg.StatusCode)
+	}
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/global"
+)
+
+// handleCommandOutput relays an output frame of a stream command to every admin
+// session subscribed to the sending device. The device ID is taken from the
+// connection, so an agent can only publish output for itself.
+func (c *ProtocolController) handleCommandOutput(deviceID string, payload json.RawMessage) error {
+	var frame dto.CommandOutput
+	if err := json.Unmarshal(payload, &frame); err != nil {
+		return err
+	}
+	if frame.Command == "" {
+		return errors.New("missing command")
+	}
+	frame.DeviceID = deviceID
+
+	c.mu.Lock()
+	var admins []string
+	for admin, devices := range c.outputSubs {
+		if cmdID, ok := devices[deviceID]; ok && (cmdID == 0 || cmdID == frame.ID) {
+			admins = append(admins, admin)
+		}
+	}
+	c.mu.Unlock()
+	if len(admins) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(dto.AdminEvent{Event: "command_output", Data: frame})
+	if err != nil {
+		return err
+	}
+	for _, admin := range admins {
+		if err := c.Hub.Send(admin, b); err != nil {
+			global.Logger.Warn().Err(err).Str("admin", admin).Str("device", deviceID).Msg("relay command output failed")
+			if !c.Hub.IsOnline(admin) {
+				c.dropOutputSubs(admin)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *ProtocolController) handleAdminSubscribeOutput(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if _, ok := c.adminName(adminDeviceID); !ok {
+		return nil, errors.New("admin role required")
+	}
+	var req dto.AdminOutputSubscribeRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.DeviceID == "" {
+		return nil, errors.New("missing device_id")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	devices := c.outputSubs[adminDeviceID]
+	if devices == nil {
+		devices = make(map[string]uint)
+		c.outputSubs[adminDeviceID] = devices
+	}
+	devices[req.DeviceID] = req.CommandID
+	return dto.AdminOutputSubscribeResponse{Devices: subscribedDevices(devices)}, nil
+}
+
+func (c *ProtocolController) handleAdminUnsubscribeOutput(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if _, ok := c.adminName(adminDeviceID); !ok {
+		return nil, errors.New("admin role required")
+	}
+	var req dto.AdminOutputSubscribeRequest
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	devices := c.outputSubs[adminDeviceID]
+	if req.DeviceID == "" {
+		devices = nil
+	} else {
+		delete(devices, req.DeviceID)
+	}
+	if len(devices) == 0 {
+		delete(c.outputSubs, adminDeviceID)
+	}
+	return dto.AdminOutputSubscribeResponse{Devices: subscribedDevices(devices)}, nil
+}
+
+// dropOutputSubs forgets every subscription of an admin session (on disconnect).
+func (c *ProtocolController) dropOutputSubs(adminDeviceID string) {
+	c.mu.Lock()
+	delete(c.outputSubs, adminDeviceID)
+	c.mu.Unlock()
+}
+
+func subscribedDevices(devices map[string]uint) []string {
+	out := make([]string, 0, len(devices))
+	for id := range devices {
+		out = append(out, id)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/socket"
+	"sagiri-guard/backend/global"
+	"sagiri-guard/network"
+)
+
+// handleHello promotes a logged-in connection to the device's control connection,
+// applying the hub's duplicate-login policy. Only control connections are
+// reported online and receive pushed commands.
+func (c *ProtocolController) handleHello(client *network.TCPClient, deviceID string, payload json.RawMessage) (dto.HelloResponse, error) {
+	var req dto.HelloRequest
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return dto.HelloResponse{}, err
+		}
+	}
+	if req.Role != "" && req.Role != string(socket.RoleControl) {
+		return dto.HelloResponse{}, fmt.Errorf("unsupported role %q", req.Role)
+	}
+	info, replaced, err := c.Hub.Promote(deviceID, client, req.AgentVersion)
+	if err != nil {
+		if errors.Is(err, socket.ErrDuplicateLogin) {
+			global.Logger.Warn().Str("device", deviceID).Int64("conn", info.ConnID).Str("remote", info.RemoteAddr).
+				Msg("duplicate control login rejected")
+			c.Audit.Record("system", "duplicate_login_rejected", deviceID, info.RemoteAddr, "")
+		}
+		return dto.HelloResponse{}, err
+	}
+	resp := dto.HelloResponse{ConnID: info.ConnID, Role: string(info.Role), Policy: string(c.Hub.Policy())}
+	if replaced != nil {
+		resp.ReplacedConn = replaced.ConnID
+		c.trackDisconnect(deviceID, replaced.ConnID, "replaced")
+		c.Audit.Record("system", "duplicate_login_replaced", deviceID, info.RemoteAddr,
+			fmt.Sprintf("old_conn=%d old_remote=%s", replaced.ConnID, replaced.RemoteAddr))
+		// Two live control connections holding the same device key from different
+		// hosts: the key has most likely been copied to another machine.
+		if c.Identity != nil && replaced.Verified && info.Verified && remoteHost(replaced.RemoteAddr) != remoteHost(info.RemoteAddr) {
+			c.Identity.Alert(deviceID, "concurrent verified connections from "+remoteHost(replaced.RemoteAddr)+" and "+remoteHost(info.RemoteAddr))
+			c.Audit.Record("system", "identity_clone_suspected", deviceID, info.RemoteAddr, "concurrent control connection from another host")
+		}
+	}
+	c.trackConnect(deviceID, client)
+	go c.retryPendingCommands(deviceID)
+	return resp, nil
+}
+
+// handleAdminListConnections lists every logged-in connection with its role and
+// traffic metadata.
+func (c *ProtocolController) handleAdminListConnections(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if _, ok := c.adminName(adminDeviceID); !ok {
+		return nil, errors.New("admin role required")
+	}
+	var req dto.AdminConnectionsRequest
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+	}
+	var all []dto.ConnectionEntry
+	for _, info := range c.Hub.Connections() {
+		if req.DeviceID != "" && info.DeviceID != req.DeviceID {
+			continue
+		}
+		if req.ControlOnly && info.Role != socket.RoleControl {
+			continue
+		}
+		e := dto.ConnectionEntry{
+			ConnID:       info.ConnID,
+			DeviceID:     info.DeviceID,
+			Role:         string(info.Role),
+			RemoteAddr:   info.RemoteAddr,
+			AgentVersion: info.AgentVersion,
+			ConnectedAt:  info.ConnectedAt.Unix(),
+			LastFrameAt:  info.LastFrameAt.Unix(),
+			Frames:       info.Frames,
+			Authorized:   info.Authorized,
+			Verified:     info.Verified,
+		}
+		if !info.PromotedAt.IsZero() {
+			e.PromotedAt = info.PromotedAt.Unix()
+		}
+		all = append(all, e)
+	}
+	if req.Offset < 0 || req.Offset > len(all) {
+		return nil, errors.New("offset out of range")
+	}
+	fit, _ := fitAck(all[req.Offset:], ackListBudget)
+	resp := dto.AdminConnectionsResponse{Policy: string(c.Hub.Policy()), Total: len(all), Connections: fit}
+	if resp.Connections == nil {
+		resp.Connections = []dto.ConnectionEntry{}
+	}
+	if next := req.Offset + len(fit); next < len(all) {
+		resp.NextOffset = next
+	}
+	return resp, nil
+}
+
+// remoteHost strips the port from an "ip:port" peer address.
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -1,10 +1,12 @@
 package controllers
 
 import (
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"sync"
+	"time"
 
-	"sagiri-guard/backend/app/dto"
 	jwtutil "sagiri-guard/backend/app/jwt"
 	"sagiri-guard/backend/app/repo"
 	"sagiri-guard/backend/app/services"
@@ -15,27 +17,45 @@ import (
 
 // ProtocolController handles protocol-level messages (login, command, etc.)
 type ProtocolController struct {
-	Hub     *socket.Hub
-	CmdRepo *repo.AgentCommandRepository
-	Devices *services.DeviceService
-	Tree    *services.FileTreeService
-	Logs    *services.AgentLogService
-	Backup  *services.BackupService
-	Users   *services.UserService
-	Signer  *jwtutil.Signer
+	Hub        *socket.Hub
+	CmdRepo    *repo.AgentCommandRepository
+	Devices    *services.DeviceService
+	Tree       *services.FileTreeService
+	Logs       *services.AgentLogService
+	Backup     *services.BackupService
+	Users      *services.UserService
+	Audit      *services.AuditService
+	States     *services.DeviceStateService
+	Groups     *services.DeviceGroupService
+	Blocks     *services.WebsiteBlockService
+	Schedules  *services.ScheduleService
+	Osquery    *services.OsqueryService
+	Packs      *services.OsqueryPackService
+	Inventory  *services.InventoryService
+	Telemetry  *services.TelemetryService
+	Presence   *services.PresenceService
+	Identity   *services.DeviceIdentityService
+	Enrollment *services.EnrollmentService
+	Tokens     *services.TokenService
+	Signer     *jwtutil.Signer
+	CmdKey     ed25519.PrivateKey // ký command gửi xuống agent
 
 	mu             sync.Mutex
 	activeUpload   map[string]*backupSessionCtx // sessionID -> ctx
 	deviceTokens   map[string]string            // deviceID -> token
 	activeDownload map[string]*backupSessionCtx
+	outputSubs     map[string]map[string]uint // admin deviceID -> device -> command ID (0 = all)
+	liveSessions   map[string][]liveSession   // deviceID -> open DeviceSession per connection
+	lastSeen       map[string]time.Time       // deviceID -> last LastSeenAt write
 }
 
 type backupSessionCtx struct {
 	id    string
 	token string
+	batch bool // file of a batch upload: acknowledged by backup_batch_finalize, not per file
 }
 
-func NewProtocolController(h *socket.Hub, r *repo.AgentCommandRepository, devices *services.DeviceService, tree *services.FileTreeService, logs *services.AgentLogService, backup *services.BackupService, users *services.UserService, signer *jwtutil.Signer) *ProtocolController {
+func NewProtocolController(h *socket.Hub, r *repo.AgentCommandRepository, devices *services.DeviceService, tree *services.FileTreeService, logs *services.AgentLogService, backup *services.BackupService, users *services.UserService, audit *services.AuditService, states *services.DeviceStateService, groups *services.DeviceGroupService, blocks *services.WebsiteBlockService, schedules *services.ScheduleService, osquery *services.OsqueryService, packs *services.OsqueryPackService, inventory *services.InventoryService, telemetry *services.TelemetryService, presence *services.PresenceService, identity *services.DeviceIdentityService, enrollment *services.EnrollmentService, tokens *services.TokenService, signer *jwtutil.Signer, cmdKey ed25519.PrivateKey) *ProtocolController {
 	return &ProtocolController{
 		Hub:            h,
 		CmdRepo:        r,
@@ -44,10 +64,27 @@ func NewProtocolController(h *socket.Hub, r *repo.AgentCommandRepository, device
 		Logs:           logs,
 		Backup:         backup,
 		Users:          users,
+		Audit:          audit,
+		States:         states,
+		Groups:         groups,
+		Blocks:         blocks,
+		Schedules:      schedules,
+		Osquery:        osquery,
+		Packs:          packs,
+		Inventory:      inventory,
+		Telemetry:      telemetry,
+		Presence:       presence,
+		Identity:       identity,
+		Enrollment:     enrollment,
+		Tokens:         tokens,
 		Signer:         signer,
+		CmdKey:         cmdKey,
 		activeUpload:   make(map[string]*backupSessionCtx),
 		activeDownload: make(map[string]*backupSessionCtx),
 		deviceTokens:   make(map[string]string),
+		outputSubs:     make(map[string]map[string]uint),
+		liveSessions:   make(map[string][]liveSession),
+		lastSeen:       make(map[string]time.Time),
 	}
 }
 
@@ -88,41 +125,95 @@ func (c *ProtocolController) isAuthorized(deviceID string) bool {
 	c.mu.Lock()
 	tok := c.deviceTokens[deviceID]
 	c.mu.Unlock()
-	return tok != ""
+	if tok == "" {
+		return false
+	}
+	// the cached access token may have expired or been revoked since login
+	_, err := c.validateToken(tok)
+	return err == nil
+}
+
+// validateToken parses an access token and checks it against the revocation list.
+func (c *ProtocolController) validateToken(tok string) (*jwtutil.Claims, error) {
+	if !looksLikeJWT(tok) {
+		return nil, errors.New("token is not a JWT")
+	}
+	if c.Tokens != nil {
+		return c.Tokens.Validate(tok)
+	}
+	if c.Signer == nil {
+		return nil, errors.New("auth not available")
+	}
+	return c.Signer.Parse(tok)
+}
+
+// adminName returns the username behind the JWT cached for deviceID when it carries the admin role.
+func (c *ProtocolController) adminName(deviceID string) (string, bool) {
+	if deviceID == "" {
+		return "", false
+	}
+	c.mu.Lock()
+	tok := c.deviceTokens[deviceID]
+	c.mu.Unlock()
+	claims, err := c.validateToken(tok)
+	if err != nil || claims.Role != "admin" {
+		return "", false
+	}
+	return claims.Username, true
 }
 
 // retryPendingCommands sends queued commands when a device logs in.
+// Expired commands are retired first; commands still in backoff wait for the sweeper.
 func (c *ProtocolController) retryPendingCommands(deviceID string) {
 	if c.CmdRepo == nil {
 		return
 	}
-	cmds, err := c.CmdRepo.ListByDevice(deviceID, false)
+	now := time.Now()
+	if n, err := c.CmdRepo.ExpireDue(now); err != nil {
+		global.Logger.Error().Err(err).Msg("expire pending commands failed")
+	} else if n > 0 {
+		global.Logger.Info().Int64("count", n).Msg("expired pending commands")
+	}
+	cmds, err := c.CmdRepo.ListDue(deviceID, now)
 	if err != nil {
 		global.Logger.Error().Err(err).Str("device", deviceID).Msg("list pending commands failed")
 		return
 	}
-	for _, cmd := range cmds {
-		req := dto.CommandRequest{
-			DeviceID: deviceID,
-			Command:  cmd.Command,
-			Kind:     cmd.Kind,
-		}
-		if cmd.Payload != "" {
-			req.Argument = json.RawMessage(cmd.Payload)
-		}
-		payload, err := json.Marshal(req)
-		if err != nil {
-			_ = c.CmdRepo.UpdateStatus(cmd.ID, "failed", err.Error())
-			continue
-		}
-		if err := c.Hub.Send(deviceID, payload); err != nil {
-			_ = c.CmdRepo.UpdateStatus(cmd.ID, "failed", err.Error())
+	for i := range cmds {
+		if err := c.deliverCommand(&cmds[i]); err != nil {
+			// connection is likely gone; remaining commands wait for the next login
 			break
 		}
-		_ = c.CmdRepo.MarkSent(cmd.ID)
 	}
 }
 
+// StartCommandSweeper periodically expires stale commands and retries
+// commands whose backoff elapsed for devices that are online.
+func (c *ProtocolController) StartCommandSweeper(interval time.Duration) {
+	if c.CmdRepo == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			devices, err := c.CmdRepo.DueDevices(now)
+			if err != nil {
+				global.Logger.Error().Err(err).Msg("list devices with due commands failed")
+				continue
+			}
+			for _, deviceID := range devices {
+				if c.Hub != nil && c.Hub.IsOnline(deviceID) {
+					c.retryPendingCommands(deviceID)
+				}
+			}
+			if _, err := c.CmdRepo.ExpireDue(now); err != nil {
+				global.Logger.Error().Err(err).Msg("expire pending commands failed")
+			}
+		}
+	}()
+}
+
 // HandleDisconnect is called when a client disconnects
 func (c *ProtocolController) HandleDisconnect(client *network.TCPClient, deviceID string) {
 	if deviceID == "" {
@@ -134,11 +225,20 @@ func (c *ProtocolController) HandleDisconnect(client *network.TCPClient, deviceI
 		Msg("handling client disconnect, cleaning up Hub")
 	
 	// Cleanup Hub registration
-	c.Hub.Unregister(deviceID, client)
+	info, wasControl := c.Hub.Unregister(deviceID, client)
+	if wasControl {
+		c.trackDisconnect(deviceID, info.ConnID, "disconnect")
+	}
+	if c.Hub.IsOnline(deviceID) {
+		// A transfer connection or a replaced control connection closed;
+		// the device's current control connection keeps its token and subscriptions.
+		return
+	}
 	
-	// Cleanup device tokens
+	// Cleanup device tokens and output subscriptions
 	c.mu.Lock()
 	delete(c.deviceTokens, deviceID)
+	delete(c.outputSubs, deviceID)
 	
 	// Cleanup active upload/download sessions for this device
 	// Note: We need to iterate to find sessions belonging to this device
@@ -3,6 +3,7 @@ package controllers
 import (
 	"encoding/json"
 	"errors"
+	"time"
 
 	"sagiri-guard/backend/app/dto"
 	"sagiri-guard/backend/app/models"
@@ -89,7 +90,10 @@ func (c *ProtocolController) handleAgentLog(deviceID string, payload json.RawMes
 	return nil
 }
 
-func (c *ProtocolController) handleAdminListDevices() (any, error) {
+func (c *ProtocolController) handleAdminListDevices(adminDeviceID string) (any, error) {
+	if _, ok := c.adminName(adminDeviceID); !ok {
+		return nil, errors.New("admin role required")
+	}
 	if c.Devices == nil {
 		return nil, errors.New("device service not available")
 	}
@@ -97,39 +101,66 @@ func (c *ProtocolController) handleAdminListDevices() (any, error) {
 	if err != nil {
 		return nil, err
 	}
+	var drift map[string][]string
+	if c.States != nil {
+		if drift, err = c.States.DriftByDevice(); err != nil {
+			global.Logger.Warn().Err(err).Msg("load device drift failed for admin_list_devices")
+		}
+	}
+	var health map[string]string
+	var issues map[string][]string
+	if c.Telemetry != nil {
+		if health, issues, err = c.Telemetry.HealthByDevice(time.Now()); err != nil {
+			global.Logger.Warn().Err(err).Msg("load device health failed for admin_list_devices")
+		}
+	}
 	out := make([]dto.DeviceSummary, 0, len(ds))
 	for _, d := range ds {
+		var lastSeen int64
+		if d.LastSeenAt != nil {
+			lastSeen = d.LastSeenAt.Unix()
+		}
 		out = append(out, dto.DeviceSummary{
-			UUID:   d.UUID,
-			Name:   d.Name,
-			Online: c.Hub != nil && c.Hub.IsOnline(d.UUID),
+			UUID:         d.UUID,
+			Name:         d.Name,
+			Online:       c.Hub != nil && c.Hub.IsOnline(d.UUID),
+			Drift:        drift[d.UUID],
+			Health:       health[d.UUID],
+			HealthIssues: issues[d.UUID],
+			LastSeenAt:   lastSeen,
 		})
 	}
 	return out, nil
 }
 
-func (c *ProtocolController) handleAdminListOnline(excludeDeviceID string) any {
+func (c *ProtocolController) handleAdminListOnline(adminDeviceID string) (any, error) {
+	if _, ok := c.adminName(adminDeviceID); !ok {
+		return nil, errors.New("admin role required")
+	}
 	if c.Hub == nil || c.Devices == nil {
-		return []string{}
+		return []string{}, nil
 	}
 	ds, err := c.Devices.ListAll()
 	if err != nil {
 		global.Logger.Warn().Err(err).Msg("list devices failed for admin_list_online")
-		return []string{}
+		return []string{}, nil
 	}
 	out := make([]string, 0, len(ds))
 	for _, d := range ds {
-		if d.UUID == excludeDeviceID {
+		if d.UUID == adminDeviceID {
 			continue
 		}
 		if c.Hub.IsOnline(d.UUID) {
 			out = append(out, d.UUID)
 		}
 	}
-	return out
+	return out, nil
 }
 
-func (c *ProtocolController) handleAdminListTree(payload json.RawMessage) (any, error) {
+func (c *ProtocolController) handleAdminListTree(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if _, ok := c.adminName(adminDeviceID); !ok {
+		return nil, errors.New("admin role required")
+	}
 	if c.Tree == nil {
 		return nil, errors.New("file tree service not available")
 	}
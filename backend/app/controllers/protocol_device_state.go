@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/global"
+)
+
+// handleStateReport stores the actual state reported by an agent, recomputes
+// drift against the desired state and queues corrective commands when due.
+func (c *ProtocolController) handleStateReport(deviceID string, payload json.RawMessage) (any, error) {
+	if c.States == nil {
+		return nil, errors.New("device state service not available")
+	}
+	if deviceID == "" {
+		return nil, errors.New("missing device id")
+	}
+	var actual dto.DeviceStateDoc
+	if err := json.Unmarshal(payload, &actual); err != nil {
+		return nil, err
+	}
+	st, corrections, err := c.States.ReportActual(deviceID, actual)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.States.ToResponse(st)
+	if err != nil {
+		return nil, err
+	}
+	if len(corrections) == 0 {
+		return resp, nil
+	}
+
+	for _, corr := range corrections {
+		cmd, _, err := c.queueCommand(deviceID, corr.Command, corr.Kind, corr.Payload)
+		if err != nil {
+			global.Logger.Error().Err(err).Str("device", deviceID).Str("command", corr.Command).Msg("queue drift correction failed")
+			continue
+		}
+		resp.Corrections = append(resp.Corrections, cmd.ID)
+	}
+	if err := c.States.MarkCorrected(st); err != nil {
+		global.Logger.Warn().Err(err).Str("device", deviceID).Msg("mark drift corrected failed")
+	}
+	c.Audit.Record("system", "state_correct", deviceID, strings.Join(resp.Drift, ","),
+		fmt.Sprintf("queued=%v", resp.Corrections))
+	global.Logger.Info().Str("device", deviceID).Strs("drift", resp.Drift).Int("commands", len(resp.Corrections)).Msg("drift corrections queued")
+	// Actual/desired are not echoed back to the agent to keep the ACK small.
+	return dto.DeviceStateResponse{DeviceID: deviceID, Drift: resp.Drift, Corrections: resp.Corrections}, nil
+}
+
+// handleAdminSetDesiredState replaces the desired-state document of a device.
+// Corrections are sent on the next state_report from the agent.
+func (c *ProtocolController) handleAdminSetDesiredState(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, ok := c.adminName(adminDeviceID)
+	if !ok {
+		return nil, errors.New("admin role required")
+	}
+	if c.States == nil {
+		return nil, errors.New("device state service not available")
+	}
+	var req dto.AdminSetDesiredStateRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	st, err := c.States.SetDesired(req.DeviceID, req.Desired, admin)
+	if err != nil {
+		return nil, err
+	}
+	c.Audit.Record(admin, "set_desired_state", st.DeviceID, "device", st.Desired)
+	return c.States.ToResponse(st)
+}
+
+func (c *ProtocolController) handleAdminGetDeviceState(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if _, ok := c.adminName(adminDeviceID); !ok {
+		return nil, errors.New("admin role required")
+	}
+	if c.States == nil {
+		return nil, errors.New("device state service not available")
+	}
+	var req dto.AdminGetDeviceStateRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.DeviceID == "" {
+		return nil, errors.New("missing device_id")
+	}
+	st, err := c.States.Get(req.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if st == nil {
+		return dto.DeviceStateResponse{DeviceID: req.DeviceID}, nil
+	}
+	return c.States.ToResponse(st)
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/services"
+	"sagiri-guard/backend/global"
+	"sagiri-guard/network"
+)
+
+// handleEnroll exchanges an admin-issued enrollment token for a device token,
+// binding the device key and fingerprint exactly like a password login would.
+func (c *ProtocolController) handleEnroll(client *network.TCPClient, msgDeviceID string, payload json.RawMessage) (any, error) {
+	if c.Enrollment == nil || c.Tokens == nil {
+		return nil, errors.New("enrollment not available")
+	}
+	var req dto.DeviceEnrollRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	deviceID := req.DeviceID
+	if deviceID == "" {
+		deviceID = msgDeviceID
+	}
+	if deviceID == "" {
+		return nil, errors.New("missing device id")
+	}
+	if msgDeviceID != "" && deviceID != msgDeviceID {
+		return nil, errors.New("device id does not match connection")
+	}
+	now := time.Now()
+	t, err := c.Enrollment.Check(req.EnrollToken, deviceID, now)
+	if err != nil {
+		global.Logger.Warn().Str("device", deviceID).Str("remote", client.RemoteAddr()).Msg("enrollment with invalid token refused")
+		return nil, err
+	}
+	actor := "enroll:" + t.Prefix
+	if c.Identity != nil && req.PublicKey == "" {
+		return nil, errors.New("device key required for token enrollment")
+	}
+	// Redeem first so a token used up meanwhile never binds a key; hand the use
+	// back if the device cannot be enrolled after all
+	fresh, err := c.Enrollment.Redeem(t, deviceID, req.Hostname, client.RemoteAddr(), now)
+	if err != nil {
+		return nil, err
+	}
+	release := func() {
+		if !fresh {
+			return
+		}
+		if err := c.Enrollment.Release(t, deviceID); err != nil {
+			global.Logger.Error().Err(err).Str("device", deviceID).Msg("release enrollment token use failed")
+		}
+	}
+	if c.Identity != nil {
+		if err := c.Identity.Enroll(deviceID, req.PublicKey, req.Fingerprint, actor); err != nil {
+			release()
+			c.auditIdentityAlert(deviceID, req.Hostname, err)
+			return nil, err
+		}
+	}
+	pair, err := c.Tokens.Issue(0, actor, "device", deviceID)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	c.mu.Lock()
+	c.deviceTokens[deviceID] = pair.Token
+	c.mu.Unlock()
+
+	c.ensureDevice(models.Device{
+		UUID:      deviceID,
+		Name:      req.Name,
+		OSName:    req.OSName,
+		OSVersion: req.OSVersion,
+		Hostname:  req.Hostname,
+		Arch:      req.Arch,
+	})
+	if err := c.Enrollment.AssignGroup(t, deviceID); err != nil {
+		// the device is enrolled either way; the admin can add it to the group later
+		global.Logger.Warn().Err(err).Str("device", deviceID).Str("group", t.GroupName).Msg("enrollment group assignment failed")
+	}
+	c.Audit.Record(actor, "device_enrolled", deviceID, fmt.Sprintf("enroll_token:%d", t.ID), t.GroupName)
+	return pair, nil
+}
+
+// handleAdminEnrollTokenCreate mints a time- and use-limited enrollment token.
+// The token itself is only returned in this response.
+func (c *ProtocolController) handleAdminEnrollTokenCreate(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, err := c.adminEnrollmentReady(adminDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	var req dto.AdminEnrollTokenCreateRequest
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+	}
+	plain, t, err := c.Enrollment.Mint(req, admin)
+	if err != nil {
+		return nil, err
+	}
+	c.Audit.Record(admin, "enroll_token_create", "", fmt.Sprintf("enroll_token:%d", t.ID),
+		fmt.Sprintf("prefix=%s group=%s max_uses=%d expires=%d", t.Prefix, t.GroupName, t.MaxUses, t.ExpiresAt.Unix()))
+	return dto.AdminEnrollTokenCreateResponse{Token: plain, Summary: services.EnrollTokenToSummary(*t, time.Now())}, nil
+}
+
+// handleAdminEnrollTokenRevoke stops a token from enrolling further devices.
+// Devices already enrolled with it keep their credentials.
+func (c *ProtocolController) handleAdminEnrollTokenRevoke(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, err := c.adminEnrollmentReady(adminDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	var req dto.AdminEnrollTokenRevokeRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	t, err := c.Enrollment.Revoke(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	c.Audit.Record(admin, "enroll_token_revoke", "", fmt.Sprintf("enroll_token:%d", t.ID), fmt.Sprintf("uses=%d", t.Uses))
+	return services.EnrollTokenToSummary(*t, time.Now()), nil
+}
+
+// handleAdminListEnrollTokens lists tokens, or one token with the devices it enrolled.
+func (c *ProtocolController) handleAdminListEnrollTokens(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if _, err := c.adminEnrollmentReady(adminDeviceID); err != nil {
+		return nil, err
+	}
+	var req dto.AdminListEnrollTokensRequest
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+	}
+	if req.Offset < 0 {
+		return nil, errors.New("offset out of range")
+	}
+	limit := req.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	now := time.Now()
+	var resp dto.AdminListEnrollTokensResponse
+	if req.ID != 0 {
+		t, err := c.Enrollment.Get(req.ID)
+		if err != nil {
+			return nil, err
+		}
+		resp.Tokens = []dto.EnrollTokenSummary{services.EnrollTokenToSummary(*t, now)}
+		list, err := c.Enrollment.Enrollments(t.ID, req.Offset, limit+1)
+		if err != nil {
+			return nil, err
+		}
+		more := len(list) > limit
+		if more {
+			list = list[:limit]
+		}
+		entries := make([]dto.DeviceEnrollmentEntry, 0, len(list))
+		for _, e := range list {
+			entries = append(entries, dto.DeviceEnrollmentEntry{DeviceID: e.DeviceID, Hostname: e.Hostname, RemoteAddr: e.RemoteAddr, EnrolledAt: e.EnrolledAt.Unix()})
+		}
+		fit, truncated := fitAck(entries, ackListBudget-400)
+		resp.Enrollments = fit
+		if more || truncated {
+			resp.NextOffset = req.Offset + len(fit)
+		}
+		return resp, nil
+	}
+	list, err := c.Enrollment.List(req.ActiveOnly, req.Offset, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	more := len(list) > limit
+	if more {
+		list = list[:limit]
+	}
+	summaries := make([]dto.EnrollTokenSummary, 0, len(list))
+	for _, t := range list {
+		summaries = append(summaries, services.EnrollTokenToSummary(t, now))
+	}
+	fit, truncated := fitAck(summaries, ackListBudget)
+	resp.Tokens = fit
+	if more || truncated {
+		resp.NextOffset = req.Offset + len(fit)
+	}
+	return resp, nil
+}
+
+func (c *ProtocolController) adminEnrollmentReady(adminDeviceID string) (string, error) {
+	admin, ok := c.adminName(adminDeviceID)
+	if !ok {
+		return "", errors.New("admin role required")
+	}
+	if c.Enrollment == nil {
+		return "", errors.New("enrollment service not available")
+	}
+	return admin, nil
+}
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/services"
+	"sagiri-guard/cmdsign"
+	"sagiri-guard/network"
+
+	"gorm.io/gorm"
+)
+
+// handleIdentityChallenge issues a single-use nonce the connection must sign with
+// the device key. Devices without an enrolled key are told so and skip the proof.
+func (c *ProtocolController) handleIdentityChallenge(client *network.TCPClient, deviceID string) (dto.IdentityChallengeResponse, error) {
+	if c.Identity == nil || !c.Identity.Bound(deviceID) {
+		return dto.IdentityChallengeResponse{Bound: false}, nil
+	}
+	nonce, err := cmdsign.NewNonce()
+	if err != nil {
+		return dto.IdentityChallengeResponse{}, err
+	}
+	if err := c.Hub.SetChallenge(client, nonce); err != nil {
+		return dto.IdentityChallengeResponse{}, err
+	}
+	return dto.IdentityChallengeResponse{Nonce: nonce, Bound: true}, nil
+}
+
+// handleIdentityProve checks the signed challenge and hardware fingerprint and
+// marks the connection verified. A valid signature from different hardware is
+// reported as a suspected clone.
+func (c *ProtocolController) handleIdentityProve(client *network.TCPClient, deviceID string, payload json.RawMessage) error {
+	if c.Identity == nil {
+		return errors.New("identity service not available")
+	}
+	var req dto.IdentityProveRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return err
+	}
+	nonce := c.Hub.TakeChallenge(client)
+	if nonce == "" {
+		return errors.New("no identity challenge issued on this connection")
+	}
+	if err := c.Identity.Verify(deviceID, nonce, req.Fingerprint, req.Signature); err != nil {
+		c.auditIdentityAlert(deviceID, client.RemoteAddr(), err)
+		return err
+	}
+	c.Hub.MarkVerified(client, req.Fingerprint)
+	return nil
+}
+
+// identityVerified reports whether the connection may act for deviceID: either it
+// proved the device key or the device has no key enrolled yet.
+func (c *ProtocolController) identityVerified(client *network.TCPClient, deviceID string) bool {
+	if c.Identity == nil || c.Hub.Verified(client) {
+		return true
+	}
+	return !c.Identity.Bound(deviceID)
+}
+
+// auditIdentityAlert records identity failures that point at cloning or spoofing.
+func (c *ProtocolController) auditIdentityAlert(deviceID, target string, err error) {
+	switch {
+	case errors.Is(err, services.ErrIdentityProof),
+		errors.Is(err, services.ErrFingerprintMismatch),
+		errors.Is(err, services.ErrIdentityRebind),
+		errors.Is(err, services.ErrIdentityKeyRequired):
+		c.Audit.Record("system", "identity_clone_suspected", deviceID, target, err.Error())
+	}
+}
+
+// handleAdminDeviceIdentity shows enrolled device credentials and clone alerts,
+// and lets an admin reset a device's key so it can enroll again.
+func (c *ProtocolController) handleAdminDeviceIdentity(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, ok := c.adminName(adminDeviceID)
+	if !ok {
+		return nil, errors.New("admin role required")
+	}
+	if c.Identity == nil {
+		return nil, errors.New("identity service not available")
+	}
+	var req dto.AdminDeviceIdentityRequest
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+	}
+	if req.DeviceID != "" {
+		id, err := c.Identity.Find(req.DeviceID)
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+			if !req.Reset {
+				return nil, errors.New("device identity not enrolled")
+			}
+			// device registered before identity was enabled: allow its next login to bind a key
+			id = &models.DeviceIdentity{DeviceID: req.DeviceID}
+		}
+		resp := dto.AdminDeviceIdentityResponse{Identities: []dto.DeviceIdentityEntry{identityEntry(*id)}}
+		if req.Reset {
+			if _, err := c.Identity.Reset(req.DeviceID); err != nil {
+				return nil, err
+			}
+			resp.Reset = true
+			c.Audit.Record(admin, "identity_reset", req.DeviceID, id.Fingerprint, "")
+		}
+		return resp, nil
+	}
+	if req.Reset {
+		return nil, errors.New("device_id required for reset")
+	}
+	limit := req.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if req.Offset < 0 {
+		return nil, errors.New("offset out of range")
+	}
+	list, err := c.Identity.List(req.AlertsOnly, req.Offset, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	more := len(list) > limit
+	if more {
+		list = list[:limit]
+	}
+	entries := make([]dto.DeviceIdentityEntry, 0, len(list))
+	for _, id := range list {
+		entries = append(entries, identityEntry(id))
+	}
+	fit, truncated := fitAck(entries, ackListBudget)
+	resp := dto.AdminDeviceIdentityResponse{Identities: fit}
+	if more || truncated {
+		resp.NextOffset = req.Offset + len(fit)
+	}
+	return resp, nil
+}
+
+func identityEntry(id models.DeviceIdentity) dto.DeviceIdentityEntry {
+	e := dto.DeviceIdentityEntry{
+		DeviceID:    id.DeviceID,
+		PublicKey:   id.PublicKey,
+		Fingerprint: id.Fingerprint,
+		EnrolledBy:  id.EnrolledBy,
+		EnrolledAt:  id.EnrolledAt.Unix(),
+		CloneAlerts: id.CloneAlerts,
+		LastAlert:   id.LastAlert,
+	}
+	if id.LastVerifiedAt != nil {
+		e.LastVerifiedAt = id.LastVerifiedAt.Unix()
+	}
+	if id.LastAlertAt != nil {
+		e.LastAlertAt = id.LastAlertAt.Unix()
+	}
+	return e
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/services"
+	"sagiri-guard/backend/global"
+)
+
+// handleInventoryReport stores a periodic inventory report from the agent.
+func (c *ProtocolController) handleInventoryReport(deviceID string, payload json.RawMessage) (any, error) {
+	if c.Inventory == nil {
+		return nil, errors.New("inventory service not available")
+	}
+	var rep dto.InventoryReport
+	if err := json.Unmarshal(payload, &rep); err != nil {
+		return nil, err
+	}
+	resp, err := c.Inventory.Record(deviceID, rep)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Changed {
+		global.Logger.Info().Str("device", deviceID).Uint("snapshot", resp.SnapshotID).Int("changes", resp.Changes).Msg("inventory snapshot stored")
+	}
+	return resp, nil
+}
+
+func (c *ProtocolController) adminInventoryReady(adminDeviceID string) error {
+	if _, ok := c.adminName(adminDeviceID); !ok {
+		return errors.New("admin role required")
+	}
+	if c.Inventory == nil {
+		return errors.New("inventory service not available")
+	}
+	return nil
+}
+
+// handleAdminGetInventory returns the summary of a snapshot and, when a section
+// is requested, one page of its items starting at offset.
+func (c *ProtocolController) handleAdminGetInventory(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if err := c.adminInventoryReady(adminDeviceID); err != nil {
+		return nil, err
+	}
+	var req dto.AdminInventoryRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.DeviceID == "" {
+		return nil, errors.New("missing device_id")
+	}
+	inv, rep, err := c.Inventory.Snapshot(req.DeviceID, req.SnapshotID)
+	if err != nil {
+		return nil, err
+	}
+	resp := dto.AdminInventoryResponse{InventorySummary: services.InventoryToSummary(*inv)}
+	if req.Section == "" {
+		return resp, nil
+	}
+	items, err := services.InventorySection(rep, req.Section)
+	if err != nil {
+		return nil, err
+	}
+	if req.Offset < 0 || req.Offset > len(items) {
+		return nil, errors.New("offset out of range")
+	}
+	fit, _ := fitAck(items[req.Offset:], ackListBudget-500)
+	resp.Section = req.Section
+	resp.Items = fit
+	if next := req.Offset + len(fit); next < len(items) {
+		resp.NextOffset = next
+	}
+	return resp, nil
+}
+
+// handleAdminInventoryHistory lists snapshots (category "snapshots") or the
+// recorded changes, newest first.
+func (c *ProtocolController) handleAdminInventoryHistory(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if err := c.adminInventoryReady(adminDeviceID); err != nil {
+		return nil, err
+	}
+	var req dto.AdminInventoryHistoryRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.DeviceID == "" {
+		return nil, errors.New("missing device_id")
+	}
+	limit := req.Limit
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	var resp dto.AdminInventoryHistoryResponse
+	if req.Category == "snapshots" {
+		snaps, more, err := c.Inventory.Snapshots(req.DeviceID, req.Offset, limit)
+		if err != nil {
+			return nil, err
+		}
+		fit, truncated := fitAck(snaps, ackListBudget)
+		resp.Snapshots = fit
+		if more || truncated {
+			resp.NextOffset = req.Offset + len(fit)
+		}
+		return resp, nil
+	}
+	changes, more, err := c.Inventory.Changes(req, limit)
+	if err != nil {
+		return nil, err
+	}
+	fit, truncated := fitAck(changes, ackListBudget)
+	resp.Changes = fit
+	if more || truncated {
+		resp.NextOffset = req.Offset + len(fit)
+	}
+	return resp, nil
+}
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/services"
+	"sagiri-guard/backend/global"
+	"sagiri-guard/network"
+)
+
+// seenInterval throttles LastSeenAt writes triggered by ordinary frames.
+const seenInterval = time.Minute
+
+type liveSession struct {
+	client *network.TCPClient
+	id     uint
+}
+
+// trackConnect opens a DeviceSession for a connection that just became the control connection.
+func (c *ProtocolController) trackConnect(deviceID string, client *network.TCPClient) {
+	if c.Presence == nil {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	for _, s := range c.liveSessions[deviceID] {
+		if s.client.Equal(client) {
+			c.mu.Unlock()
+			return // login repeated on the same connection
+		}
+	}
+	c.mu.Unlock()
+
+	id, err := c.Presence.Connect(deviceID, client.RemoteAddr(), now)
+	if err != nil {
+		global.Logger.Warn().Err(err).Str("device", deviceID).Msg("record device session failed")
+		return
+	}
+	if id == 0 {
+		return
+	}
+	c.mu.Lock()
+	c.liveSessions[deviceID] = append(c.liveSessions[deviceID], liveSession{client: client, id: id})
+	c.lastSeen[deviceID] = now
+	c.mu.Unlock()
+}
+
+// trackSeen refreshes LastSeenAt/LastIP at most once per seenInterval per device.
+func (c *ProtocolController) trackSeen(deviceID string, client *network.TCPClient) {
+	if c.Presence == nil || deviceID == "" {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	_, live := c.liveSessions[deviceID]
+	due := live && now.Sub(c.lastSeen[deviceID]) >= seenInterval
+	if due {
+		c.lastSeen[deviceID] = now
+	}
+	c.mu.Unlock()
+	if !due {
+		return
+	}
+	if err := c.Presence.Seen(deviceID, client.RemoteAddr(), now); err != nil {
+		global.Logger.Warn().Err(err).Str("device", deviceID).Msg("update last seen failed")
+	}
+}
+
+// trackDisconnect closes the DeviceSession that belongs to connection connID.
+func (c *ProtocolController) trackDisconnect(deviceID string, connID int64, reason string) {
+	if c.Presence == nil {
+		return
+	}
+	var id uint
+	c.mu.Lock()
+	list := c.liveSessions[deviceID]
+	for i, s := range list {
+		if s.client.ConnID() == connID {
+			id = s.id
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(c.liveSessions, deviceID)
+		delete(c.lastSeen, deviceID)
+	} else {
+		c.liveSessions[deviceID] = list
+	}
+	c.mu.Unlock()
+	if id == 0 {
+		return
+	}
+	if err := c.Presence.Disconnect(id, deviceID, reason, time.Now()); err != nil {
+		global.Logger.Warn().Err(err).Str("device", deviceID).Msg("close device session failed")
+	}
+}
+
+// handleAdminDevicePresence reports uptime percentages over a window of days,
+// either for every device or for one device together with its recent sessions.
+func (c *ProtocolController) handleAdminDevicePresence(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if _, ok := c.adminName(adminDeviceID); !ok {
+		return nil, errors.New("admin role required")
+	}
+	if c.Presence == nil {
+		return nil, errors.New("presence service not available")
+	}
+	var req dto.AdminPresenceRequest
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+	}
+	since, until := services.PresenceWindow(req.Days, time.Now())
+	resp := dto.AdminPresenceResponse{Since: since.Unix(), Until: until.Unix()}
+	limit := req.Limit
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	if req.DeviceID != "" {
+		p, sessions, more, err := c.Presence.Detail(req.DeviceID, since, until, req.Offset, limit)
+		if err != nil {
+			return nil, err
+		}
+		p.Online = c.Hub != nil && c.Hub.IsOnline(req.DeviceID)
+		resp.Devices = []dto.DevicePresence{p}
+		fit, truncated := fitAck(sessions, ackListBudget-300)
+		resp.Sessions = fit
+		if more || truncated {
+			resp.NextOffset = req.Offset + len(fit)
+		}
+		return resp, nil
+	}
+
+	var online func(string) bool
+	if c.Hub != nil {
+		online = c.Hub.IsOnline
+	}
+	all, err := c.Presence.Summaries(since, until, req.NotSeenDays, online)
+	if err != nil {
+		return nil, err
+	}
+	if req.Offset < 0 || req.Offset > len(all) {
+		return nil, errors.New("offset out of range")
+	}
+	page := all[req.Offset:]
+	if len(page) > limit {
+		page = page[:limit]
+	}
+	fit, _ := fitAck(page, ackListBudget)
+	resp.Devices = fit
+	if next := req.Offset + len(fit); next < len(all) {
+		resp.NextOffset = next
+	}
+	return resp, nil
+}
@@ -2,9 +2,11 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"strings"
 
 	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/socket"
 	"sagiri-guard/backend/global"
 	"sagiri-guard/network"
 )
@@ -21,44 +23,74 @@ func (c *ProtocolController) HandleMessage(client *network.TCPClient, msg *netwo
 			log.Warn().Msg("login missing device id")
 			return
 		}
-		// If the client sent a token, validate if JWT; otherwise accept as opaque token for auth cache.
+		// A token must be a JWT issued for this device; an empty token opens an
+		// unauthenticated connection that may only use the login, enroll and refresh actions.
+		authorized := false
 		if msg.Token != "" {
-			authorized := false
-			if c.Signer != nil && looksLikeJWT(msg.Token) {
-				if claims, err := c.Signer.Parse(msg.Token); err != nil {
-					log.Warn().Err(err).Str("token", msg.Token).Msg("protocol login token parse failed")
-				} else if claims.DeviceID != "" && claims.DeviceID != deviceID {
-					log.Warn().Str("token_device", claims.DeviceID).Str("frame_device", deviceID).Msg("protocol login device mismatch")
-				} else {
-					authorized = true
-				}
+			claims, err := c.validateToken(msg.Token)
+			if err != nil {
+				log.Warn().Err(err).Msg("protocol login token parse failed")
+			} else if claims.DeviceID != deviceID {
+				log.Warn().Str("token_device", claims.DeviceID).Str("frame_device", deviceID).Msg("protocol login device mismatch")
 			} else {
-				// No signer or non-JWT token: accept as opaque token to authorize this device.
-				log.Debug().Str("token", msg.Token).Msg("protocol login token treated as opaque")
 				authorized = true
 			}
-			if authorized {
-				c.mu.Lock()
-				c.deviceTokens[deviceID] = msg.Token
-				c.mu.Unlock()
+			if !authorized {
+				_ = client.SendAck(401, "invalid login token")
+				return
 			}
+			c.cacheDeviceToken(deviceID, msg.Token, claims)
 		}
 		log.Info().Msg("protocol connected")
-		c.Hub.Register(deviceID, client)
-		go c.retryPendingCommands(deviceID)
+		c.Hub.Register(deviceID, client, authorized)
 	case network.MsgCommand:
-		c.handleSubCommand(client, msg)
+		deviceID, ok := c.connDevice(client, msg)
+		if !ok {
+			log.Warn().Msg("command device id does not match connection")
+			_ = client.SendAck(401, "device id does not match connection")
+			return
+		}
+		c.Hub.Touch(client)
+		c.handleSubCommand(client, deviceID, msg)
 	case network.MsgFileChunk:
+		deviceID, ok := c.connDevice(client, msg)
+		if !ok || deviceID == "" || !c.Hub.Authorized(client) || !c.identityVerified(client, deviceID) {
+			log.Warn().Msg("file chunk on unauthorized connection dropped")
+			return
+		}
+		c.Hub.Touch(client)
 		log.Debug().Uint32("offset", msg.ChunkOffset).Uint32("len", msg.ChunkLen).Msg("file chunk received")
-		c.handleFileChunk(msg)
+		c.handleFileChunk(deviceID, msg)
 	case network.MsgFileDone:
+		deviceID, ok := c.connDevice(client, msg)
+		if !ok || deviceID == "" || !c.Hub.Authorized(client) || !c.identityVerified(client, deviceID) {
+			log.Warn().Msg("file done on unauthorized connection refused")
+			_ = client.SendAck(401, "unauthorized")
+			return
+		}
+		c.Hub.Touch(client)
 		log.Info().Str("session", msg.SessionID).Msg("file done received")
-		c.handleFileDone(msg)
+		c.handleFileDone(client, deviceID, msg)
 	default:
 		// ignore other frames for now
 	}
 }
 
+// connDevice returns the device the connection logged in as. The C layer stamps
+// frames with the device of the last login frame, even a refused one, so a frame
+// naming another device than the Hub registered is rejected. Connections that never
+// sent a login frame keep the frame's device id (only login, enroll and refresh pass auth).
+func (c *ProtocolController) connDevice(client *network.TCPClient, msg *network.ProtocolMessage) (string, bool) {
+	deviceID, registered := c.Hub.DeviceOf(client)
+	if !registered {
+		return msg.DeviceID, true
+	}
+	if msg.DeviceID != "" && msg.DeviceID != deviceID {
+		return "", false
+	}
+	return deviceID, true
+}
+
 func looksLikeJWT(tok string) bool {
 	if tok == "" {
 		return false
@@ -66,7 +98,7 @@ func looksLikeJWT(tok string) bool {
 	return strings.Count(tok, ".") >= 2
 }
 
-func (c *ProtocolController) handleSubCommand(client *network.TCPClient, msg *network.ProtocolMessage) {
+func (c *ProtocolController) handleSubCommand(client *network.TCPClient, deviceID string, msg *network.ProtocolMessage) {
 	if len(msg.CommandJSON) == 0 {
 		_ = client.SendAck(400, "empty command payload")
 		return
@@ -79,73 +111,172 @@ func (c *ProtocolController) handleSubCommand(client *network.TCPClient, msg *ne
 	payload := env.Data
 	// debug log incoming sub-command
 	global.Logger.Debug().
-		Str("device", msg.DeviceID).
+		Str("device", deviceID).
 		Str("action", env.Action).
 		Int("payload_len", len(payload)).
 		RawJSON("payload", payload).
 		Msg("protocol sub-command received")
-	// login and admin_* do not require device token; others require issued token
+	// login, enroll and refresh do not require device token; others (admin_* included) require issued token
 	if env.Action != "login" &&
-		env.Action != "admin_send_command" &&
-		env.Action != "admin_list_devices" &&
-		env.Action != "admin_list_online" &&
-		env.Action != "admin_list_tree" {
-		if !c.isAuthorized(msg.DeviceID) {
+		env.Action != "enroll" &&
+		env.Action != "refresh" {
+		if !c.isAuthorized(deviceID) || !c.Hub.Authorized(client) {
 			_ = client.SendAck(401, "unauthorized")
 			return
 		}
+		if env.Action != "identity_challenge" && env.Action != "identity_prove" && !c.identityVerified(client, deviceID) {
+			_ = client.SendAck(401, "device identity proof required")
+			return
+		}
+		// Only authenticated frames refresh last-seen
+		c.trackSeen(deviceID, client)
 	}
 	switch env.Action {
 	case "ping":
 		_ = client.SendAck(200, "pong")
 	case "login":
-		if data, err := c.handleLogin(msg.DeviceID, payload); err != nil {
+		if data, err := c.handleLogin(deviceID, payload); err != nil {
+			_ = client.SendAck(401, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "enroll":
+		if data, err := c.handleEnroll(client, deviceID, payload); err != nil {
+			_ = client.SendAck(401, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "refresh":
+		if data, err := c.handleRefresh(client, deviceID, payload); err != nil {
+			_ = client.SendAck(401, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "logout":
+		if err := c.handleLogout(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			_ = client.SendAck(200, "logged out")
+		}
+	case "identity_challenge":
+		if data, err := c.handleIdentityChallenge(client, deviceID); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "identity_prove":
+		if err := c.handleIdentityProve(client, deviceID, payload); err != nil {
 			_ = client.SendAck(401, err.Error())
+		} else {
+			_ = client.SendAck(200, "identity verified")
+		}
+	case "hello":
+		if data, err := c.handleHello(client, deviceID, payload); err != nil {
+			if errors.Is(err, socket.ErrDuplicateLogin) {
+				_ = client.SendAck(409, err.Error())
+				_ = client.Shutdown()
+			} else {
+				_ = client.SendAck(400, err.Error())
+			}
 		} else {
 			c.sendAckJSON(client, 200, data)
 		}
 	case "device_register":
-		if err := c.handleDeviceRegister(msg.DeviceID, payload); err != nil {
+		if err := c.handleDeviceRegister(deviceID, payload); err != nil {
 			_ = client.SendAck(500, err.Error())
 		} else {
 			_ = client.SendAck(200, "device registered")
 		}
 	case "filetree_sync":
-		if err := c.handleFileTreeSync(msg.DeviceID, payload); err != nil {
+		if err := c.handleFileTreeSync(deviceID, payload); err != nil {
 			_ = client.SendAck(500, err.Error())
 		} else {
 			_ = client.SendAck(200, "filetree synced")
 		}
 	case "agent_log":
-		if err := c.handleAgentLog(msg.DeviceID, payload); err != nil {
+		if err := c.handleAgentLog(deviceID, payload); err != nil {
 			_ = client.SendAck(500, err.Error())
 		} else {
 			_ = client.SendAck(200, "log stored")
 		}
 	case "backup_init_upload":
-		if data, err := c.handleBackupInitUpload(msg.DeviceID, payload); err != nil {
+		if data, err := c.handleBackupInitUpload(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "backup_batch_init":
+		if data, err := c.handleBackupBatchInit(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "backup_batch_finalize":
+		if data, err := c.handleBackupBatchFinalize(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "command_result":
+		if err := c.handleCommandResult(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			_ = client.SendAck(200, "result stored")
+		}
+	case "command_output":
+		if err := c.handleCommandOutput(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			_ = client.SendAck(200, "output relayed")
+		}
+	case "state_report":
+		if data, err := c.handleStateReport(deviceID, payload); err != nil {
 			_ = client.SendAck(500, err.Error())
 		} else {
 			c.sendAckJSON(client, 200, data)
 		}
+	case "osquery_pack_sync":
+		if data, err := c.handleOsqueryPackSync(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "osquery_diff":
+		if data, err := c.handleOsqueryDiff(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "inventory_report":
+		if data, err := c.handleInventoryReport(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "telemetry":
+		if err := c.handleTelemetry(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			_ = client.SendAck(200, "telemetry stored")
+		}
 	case "backup_init_download":
-		if data, err := c.handleBackupInitDownload(msg.DeviceID, payload); err != nil {
+		if data, err := c.handleBackupInitDownload(deviceID, payload); err != nil {
 			_ = client.SendAck(500, err.Error())
 		} else {
 			c.sendAckJSON(client, 200, data)
 		}
 	case "backup_download_start":
-		if err := c.handleBackupDownloadStart(client, msg.DeviceID, payload); err != nil {
+		if err := c.handleBackupDownloadStart(client, deviceID, payload); err != nil {
 			_ = client.SendAck(500, err.Error())
 		}
 	case "admin_send_command":
-		if data, err := c.handleAdminSendCommand(payload); err != nil {
+		if data, err := c.handleAdminSendCommand(deviceID, payload); err != nil {
 			_ = client.SendAck(500, err.Error())
 		} else {
 			c.sendAckJSON(client, 200, data)
 		}
 	case "admin_list_devices":
-		if data, err := c.handleAdminListDevices(); err != nil {
+		if data, err := c.handleAdminListDevices(deviceID); err != nil {
 			_ = client.SendAck(500, err.Error())
 		} else {
 			if b, er := json.Marshal(data); er == nil {
@@ -154,13 +285,262 @@ func (c *ProtocolController) handleSubCommand(client *network.TCPClient, msg *ne
 			c.sendAckJSON(client, 200, data)
 		}
 	case "admin_list_online":
-		data := c.handleAdminListOnline(msg.DeviceID)
-		if b, er := json.Marshal(data); er == nil {
-			global.Logger.Info().RawJSON("payload", b).Msg("admin_list_online response")
+		if data, err := c.handleAdminListOnline(deviceID); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			if b, er := json.Marshal(data); er == nil {
+				global.Logger.Info().RawJSON("payload", b).Msg("admin_list_online response")
+			}
+			c.sendAckJSON(client, 200, data)
 		}
-		c.sendAckJSON(client, 200, data)
 	case "admin_list_tree":
-		if data, err := c.handleAdminListTree(payload); err != nil {
+		if data, err := c.handleAdminListTree(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_restore_cross_device":
+		if data, err := c.handleAdminCrossDeviceRestore(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_backup_hold":
+		if data, err := c.handleAdminBackupHold(deviceID, payload, true); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_backup_release_hold":
+		if data, err := c.handleAdminBackupHold(deviceID, payload, false); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_backup_delete":
+		if data, err := c.handleAdminBackupDelete(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_set_desired_state":
+		if data, err := c.handleAdminSetDesiredState(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_get_device_state":
+		if data, err := c.handleAdminGetDeviceState(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_group_save":
+		if data, err := c.handleAdminGroupSave(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_group_members":
+		if data, err := c.handleAdminGroupMembers(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_group_delete":
+		if data, err := c.handleAdminGroupDelete(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_get_group":
+		if data, err := c.handleAdminGetGroup(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_list_groups":
+		if data, err := c.handleAdminListGroups(deviceID); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_group_send_command":
+		if data, err := c.handleAdminGroupSendCommand(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_group_block_rule":
+		if data, err := c.handleAdminGroupBlockRule(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_batch_status":
+		if data, err := c.handleAdminBatchStatus(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_schedule_create":
+		if data, err := c.handleAdminScheduleCreate(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_schedule_pause":
+		if data, err := c.handleAdminSchedulePause(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_list_schedules":
+		if data, err := c.handleAdminListSchedules(deviceID); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_cancel_command":
+		if data, err := c.handleAdminCancelCommand(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_subscribe_output":
+		if data, err := c.handleAdminSubscribeOutput(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_unsubscribe_output":
+		if data, err := c.handleAdminUnsubscribeOutput(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_osquery_run":
+		if data, err := c.handleAdminOsqueryRun(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_osquery_results":
+		if data, err := c.handleAdminOsqueryResults(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_get_osquery_result":
+		if data, err := c.handleAdminGetOsqueryResult(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_osquery_compare":
+		if data, err := c.handleAdminOsqueryCompare(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_osquery_diff":
+		if data, err := c.handleAdminOsqueryDiff(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_pack_save":
+		if data, err := c.handleAdminPackSave(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_pack_assign":
+		if data, err := c.handleAdminPackAssign(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_pack_delete":
+		if data, err := c.handleAdminPackDelete(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_list_packs":
+		if data, err := c.handleAdminListPacks(deviceID); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_pack_history":
+		if data, err := c.handleAdminPackHistory(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_get_inventory":
+		if data, err := c.handleAdminGetInventory(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_inventory_history":
+		if data, err := c.handleAdminInventoryHistory(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_device_telemetry":
+		if data, err := c.handleAdminDeviceTelemetry(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_device_presence":
+		if data, err := c.handleAdminDevicePresence(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_list_connections":
+		if data, err := c.handleAdminListConnections(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_device_identity":
+		if data, err := c.handleAdminDeviceIdentity(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_enroll_token_create":
+		if data, err := c.handleAdminEnrollTokenCreate(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_enroll_token_revoke":
+		if data, err := c.handleAdminEnrollTokenRevoke(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_list_enroll_tokens":
+		if data, err := c.handleAdminListEnrollTokens(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_revoke_token":
+		if data, err := c.handleAdminRevokeToken(deviceID, payload); err != nil {
+			_ = client.SendAck(500, err.Error())
+		} else {
+			c.sendAckJSON(client, 200, data)
+		}
+	case "admin_revoke_device":
+		if data, err := c.handleAdminRevokeDevice(deviceID, payload); err != nil {
 			_ = client.SendAck(500, err.Error())
 		} else {
 			c.sendAckJSON(client, 200, data)
@@ -168,7 +548,7 @@ func (c *ProtocolController) handleSubCommand(client *network.TCPClient, msg *ne
 	default:
 		// Unknown action: log payload for debug
 		global.Logger.Warn().
-			Str("device", msg.DeviceID).
+			Str("device", deviceID).
 			Str("action", env.Action).
 			Int("payload_len", len(payload)).
 			RawJSON("payload", payload).
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/services"
+)
+
+// handleTelemetry stores one health heartbeat from the agent.
+func (c *ProtocolController) handleTelemetry(deviceID string, payload json.RawMessage) error {
+	if c.Telemetry == nil {
+		return errors.New("telemetry service not available")
+	}
+	var t dto.Telemetry
+	if err := json.Unmarshal(payload, &t); err != nil {
+		return err
+	}
+	return c.Telemetry.Record(deviceID, t)
+}
+
+// handleAdminDeviceTelemetry returns the current health verdict and recent samples of a device.
+func (c *ProtocolController) handleAdminDeviceTelemetry(adminDeviceID string, payload json.RawMessage) (any, error) {
+	if _, ok := c.adminName(adminDeviceID); !ok {
+		return nil, errors.New("admin role required")
+	}
+	if c.Telemetry == nil {
+		return nil, errors.New("telemetry service not available")
+	}
+	var req dto.AdminTelemetryRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.DeviceID == "" {
+		return nil, errors.New("missing device_id")
+	}
+	rows, err := c.Telemetry.Recent(req.DeviceID, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	resp := dto.AdminTelemetryResponse{DeviceID: req.DeviceID, Samples: make([]dto.TelemetrySample, 0, len(rows))}
+	if len(rows) > 0 {
+		resp.Health, resp.Issues = services.EvaluateHealth(rows[0], time.Now())
+	}
+	for _, r := range rows {
+		resp.Samples = append(resp.Samples, services.TelemetryToDTO(r))
+	}
+	resp.Samples, _ = fitAck(resp.Samples, ackListBudget)
+	return resp, nil
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	jwtutil "sagiri-guard/backend/app/jwt"
+	"sagiri-guard/backend/app/services"
+	"sagiri-guard/backend/global"
+	"sagiri-guard/network"
+)
+
+// handleRefresh exchanges a refresh token for a new token pair. It runs on
+// unauthenticated connections too, since the access token may already have expired.
+func (c *ProtocolController) handleRefresh(client *network.TCPClient, msgDeviceID string, payload json.RawMessage) (any, error) {
+	if c.Tokens == nil {
+		return nil, errors.New("auth not available")
+	}
+	var req dto.TokenRefreshRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	deviceID := req.DeviceID
+	if deviceID == "" {
+		deviceID = msgDeviceID
+	}
+	if deviceID == "" {
+		return nil, errors.New("missing device id")
+	}
+	pair, err := c.Tokens.Refresh(req.RefreshToken, deviceID)
+	if err != nil {
+		if errors.Is(err, services.ErrRefreshReused) {
+			// the device's tokens were revoked; close whatever session is using them
+			// (the requesting connection still gets its 401)
+			c.dropDeviceToken(deviceID)
+			n := c.Hub.Disconnect(deviceID, client)
+			c.Audit.Record("system", "refresh_token_reuse", deviceID, "", fmt.Sprintf("disconnected=%d", n))
+		}
+		global.Logger.Warn().Err(err).Str("device", deviceID).Msg("token refresh refused")
+		return nil, err
+	}
+	c.mu.Lock()
+	c.deviceTokens[deviceID] = pair.Token
+	c.mu.Unlock()
+	return pair, nil
+}
+
+// handleLogout revokes the access token of the device and the refresh token it sends.
+func (c *ProtocolController) handleLogout(deviceID string, payload json.RawMessage) error {
+	if c.Tokens == nil {
+		return errors.New("auth not available")
+	}
+	var req dto.LogoutRequest
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	tok := c.deviceTokens[deviceID]
+	c.mu.Unlock()
+	claims, err := c.validateToken(tok)
+	if err != nil {
+		return err
+	}
+	if err := c.Tokens.RevokeClaims(claims, services.RevokeReasonLogout, deviceID); err != nil {
+		return err
+	}
+	if req.RefreshToken != "" {
+		if err := c.Tokens.RevokeRefresh(req.RefreshToken, deviceID, services.RevokeReasonLogout, deviceID); err != nil {
+			return err
+		}
+	}
+	c.dropDeviceToken(deviceID)
+	c.Audit.Record(claims.Username, "logout", deviceID, "", "")
+	return nil
+}
+
+// handleAdminRevokeToken revokes a single token by jti; a device whose cached
+// access token is no longer valid loses its authorization.
+func (c *ProtocolController) handleAdminRevokeToken(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, err := c.adminTokensReady(adminDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	var req dto.AdminRevokeTokenRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	var exp time.Time
+	if req.ExpiresAt > 0 {
+		exp = time.Unix(req.ExpiresAt, 0)
+	}
+	reason := req.Reason
+	if reason == "" {
+		reason = services.RevokeReasonAdmin
+	}
+	if err := c.Tokens.RevokeJTI(req.JTI, req.DeviceID, exp, reason, admin); err != nil {
+		return nil, err
+	}
+	var dropped []string
+	c.mu.Lock()
+	for deviceID, tok := range c.deviceTokens {
+		if _, err := c.Tokens.Validate(tok); errors.Is(err, services.ErrTokenRevoked) {
+			delete(c.deviceTokens, deviceID)
+			dropped = append(dropped, deviceID)
+		}
+	}
+	c.mu.Unlock()
+	c.Audit.Record(admin, "token_revoke", req.DeviceID, "jti:"+req.JTI, truncateDetail(reason))
+	return map[string]any{"jti": req.JTI, "dropped_sessions": dropped}, nil
+}
+
+// handleAdminRevokeDevice revokes every token issued to a device so far and
+// disconnects its live connections; the device has to log in or enroll again.
+func (c *ProtocolController) handleAdminRevokeDevice(adminDeviceID string, payload json.RawMessage) (any, error) {
+	admin, err := c.adminTokensReady(adminDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	var req dto.AdminRevokeDeviceRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.DeviceID == adminDeviceID {
+		return nil, errors.New("cannot revoke the console's own session")
+	}
+	reason := req.Reason
+	if reason == "" {
+		reason = services.RevokeReasonAdmin
+	}
+	cutoff, err := c.Tokens.RevokeDevice(req.DeviceID, reason, admin)
+	if err != nil {
+		return nil, err
+	}
+	c.dropDeviceToken(req.DeviceID)
+	n := c.Hub.Disconnect(req.DeviceID, nil)
+	c.Audit.Record(admin, "device_revoke", req.DeviceID, "", truncateDetail(fmt.Sprintf("disconnected=%d reason=%s", n, reason)))
+	return dto.AdminRevokeDeviceResponse{DeviceID: req.DeviceID, RevokedBefore: cutoff.Unix(), Disconnected: n}, nil
+}
+
+// cacheDeviceToken remembers tok as the device's token unless the cached one
+// stays valid longer: a one-shot connection may still log in with the access
+// token issued before the last refresh.
+func (c *ProtocolController) cacheDeviceToken(deviceID, tok string, claims *jwtutil.Claims) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cur := c.deviceTokens[deviceID]; cur != "" && cur != tok && claims.ExpiresAt != nil {
+		if old, err := c.validateToken(cur); err == nil && old.ExpiresAt != nil && old.ExpiresAt.After(claims.ExpiresAt.Time) {
+			return
+		}
+	}
+	c.deviceTokens[deviceID] = tok
+}
+
+// dropDeviceToken forgets the cached token and output subscriptions of a device.
+func (c *ProtocolController) dropDeviceToken(deviceID string) {
+	c.mu.Lock()
+	delete(c.deviceTokens, deviceID)
+	delete(c.outputSubs, deviceID)
+	c.mu.Unlock()
+}
+
+func (c *ProtocolController) adminTokensReady(adminDeviceID string) (string, error) {
+	admin, ok := c.adminName(adminDeviceID)
+	if !ok {
+		return "", errors.New("admin role required")
+	}
+	if c.Tokens == nil {
+		return "", errors.New("token service not available")
+	}
+	return admin, nil
+}
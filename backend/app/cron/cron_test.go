@@ -0,0 +1,95 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"10-5 * * * *",
+		"* * * foo *",
+		"@every5m",
+	}
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := Parse(expr); err == nil {
+				t.Errorf("Parse(%q) succeeded, want error", expr)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	// 2024-01-01 là thứ Hai
+	at := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	tests := []struct {
+		expr  string
+		after string
+		want  string
+	}{
+		{"* * * * *", "2024-01-01 10:00", "2024-01-01 10:01"},
+		{"*/15 * * * *", "2024-01-01 10:01", "2024-01-01 10:15"},
+		{"*/15 * * * *", "2024-01-01 10:59", "2024-01-01 11:00"},
+		{"5/20 * * * *", "2024-01-01 10:06", "2024-01-01 10:25"},
+		{"0,30 9 * * *", "2024-01-01 09:00", "2024-01-01 09:30"},
+		{"30 8-18 * * mon-fri", "2024-01-05 18:30", "2024-01-08 08:30"},
+		{"0 0 * * 7", "2024-01-01 00:00", "2024-01-07 00:00"},
+		{"0 0 * * sun", "2024-01-01 00:00", "2024-01-07 00:00"},
+		{"0 12 1 * *", "2024-01-01 12:00", "2024-02-01 12:00"},
+		{"0 0 31 * *", "2024-01-31 00:00", "2024-03-31 00:00"},
+		{"0 0 29 feb *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		// cả ngày trong tháng và thứ bị giới hạn: khớp một trong hai
+		{"0 0 15 * mon", "2024-01-01 00:00", "2024-01-08 00:00"},
+		{"0 0 15 * mon", "2024-01-09 00:00", "2024-01-15 00:00"},
+		{"@daily", "2024-01-01 10:00", "2024-01-02 00:00"},
+		{"@HOURLY", "2024-01-01 10:00", "2024-01-01 11:00"},
+		{"@monthly", "2024-12-15 00:00", "2025-01-01 00:00"},
+		{"0 0 30 2 *", "2024-01-01 00:00", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr+"|"+tt.after, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			got := s.Next(at(tt.after))
+			if tt.want == "" {
+				if !got.IsZero() {
+					t.Errorf("Next = %s, want zero time", got)
+				}
+				return
+			}
+			if want := at(tt.want); !got.Equal(want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.after, got.Format("2006-01-02 15:04"), tt.want)
+			}
+		})
+	}
+}
+
+func TestNextTruncatesSeconds(t *testing.T) {
+	s, err := Parse("* * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Date(2024, 1, 1, 10, 0, 59, 999, time.UTC)
+	if got, want := s.Next(after), time.Date(2024, 1, 1, 10, 1, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next = %s, want %s", got, want)
+	}
+}
@@ -7,19 +7,45 @@ type AdminSendCommandRequest struct {
 	Command  string          `json:"command"`
 	Kind     string          `json:"kind,omitempty"`
 	Payload  json.RawMessage `json:"payload,omitempty"`
+	CommandPolicy
+}
+
+// CommandPolicy điều khiển hạn và số lần gửi lại của command; giá trị 0 = mặc định.
+type CommandPolicy struct {
+	ExpiresAt   int64 `json:"expires_at,omitempty"` // unix
+	TTLSec      int   `json:"ttl_sec,omitempty"`    // dùng khi không có expires_at
+	MaxAttempts int   `json:"max_attempts,omitempty"`
 }
 
 type AdminSendCommandResponse struct {
-	ID     uint   `json:"id"`
-	Status string `json:"status"`
-	Sent   bool   `json:"sent"`
-	Error  string `json:"error,omitempty"`
+	ID        uint   `json:"id"`
+	Status    string `json:"status"`
+	Sent      bool   `json:"sent"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AdminCancelCommandRequest hủy một command (ID) hoặc mọi command của một batch.
+type AdminCancelCommandRequest struct {
+	ID      uint   `json:"id,omitempty"`
+	BatchID string `json:"batch_id,omitempty"`
+}
+
+type AdminCancelCommandResponse struct {
+	Cancelled int `json:"cancelled"`
+	Stopped   int `json:"stopped"` // stream command được yêu cầu dừng trên agent
+	Skipped   int `json:"skipped"` // đã hoàn tất/hết hạn hoặc command once đã gửi
 }
 
 type DeviceSummary struct {
-	UUID   string `json:"uuid"`
-	Name   string `json:"name"`
-	Online bool   `json:"online"`
+	UUID   string   `json:"uuid"`
+	Name   string   `json:"name"`
+	Online bool     `json:"online"`
+	Drift  []string `json:"drift,omitempty"` // field lệch so với desired state
+	// Health: healthy | unhealthy | stale; rỗng khi agent chưa gửi telemetry.
+	Health       string   `json:"health,omitempty"`
+	HealthIssues []string `json:"health_issues,omitempty"`
+	LastSeenAt   int64    `json:"last_seen_at,omitempty"`
 }
 
 type AdminListTreeRequest struct {
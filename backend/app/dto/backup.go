@@ -26,6 +26,7 @@ type BackupUploadInitRequest struct {
 
 type BackupDownloadInitRequest struct {
 	FileName string `json:"file_name"`
+	GrantID  uint   `json:"grant_id,omitempty"` // restore chéo máy: tải bản backup của device khác
 }
 
 type BackupSessionResponse struct {
@@ -39,4 +40,33 @@ type BackupSessionResponse struct {
 	TCPPort   int               `json:"tcp_port"`
 	Direction TransferDirection `json:"direction"`
 	Status    SessionStatus     `json:"status"`
+	DestPath  string            `json:"dest_path,omitempty"` // download theo grant: đích đã remap, agent phải ghi đúng đường dẫn này
+}
+
+// BackupBatchInitRequest khai báo manifest các file sẽ upload chung một kết nối.
+type BackupBatchInitRequest struct {
+	Files []BackupUploadInitRequest `json:"files"`
+}
+
+// BackupBatchSessionResponse: session của file thứ i là "<batch_id>.<i>", dùng chung Token.
+type BackupBatchSessionResponse struct {
+	BatchID   string `json:"batch_id"`
+	Token     string `json:"token"`
+	Count     int    `json:"count"`
+	ChunkSize int64  `json:"chunk_size"`
+	TCPHost   string `json:"tcp_host"`
+	TCPPort   int    `json:"tcp_port"`
+}
+
+type BackupBatchFinalizeRequest struct {
+	BatchID string `json:"batch_id"`
+	Token   string `json:"token"`
+}
+
+// BackupBatchFinalizeResponse liệt kê index (theo manifest) của các file không được lưu.
+type BackupBatchFinalizeResponse struct {
+	BatchID    string `json:"batch_id"`
+	Stored     int    `json:"stored"`
+	Incomplete []int  `json:"incomplete,omitempty"` // chưa nhận đủ dữ liệu / done frame
+	Failed     []int  `json:"failed,omitempty"`     // lỗi khi ghi file trên server hoặc checksum không khớp
 }
@@ -19,6 +19,61 @@ type BackupRestoreRequest struct {
 	LogicalPath string `json:"logical_path"`
 	Version     int    `json:"version,omitempty"`   // 0 hoặc bỏ trống = latest
 	DestPath    string `json:"dest_path,omitempty"` // nếu rỗng, agent sẽ chọn default
+	Mode        string `json:"mode,omitempty"`      // overwrite (mặc định), keep_both, skip_if_same_hash, restore_to_staging_dir
 }
 
+// PathRemap ánh xạ thư mục gốc cũ sang thư mục gốc mới khi restore chéo máy.
+type PathRemap struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// AdminCrossDeviceRestoreRequest yêu cầu restore bản backup của device nguồn xuống device đích.
+type AdminCrossDeviceRestoreRequest struct {
+	SourceDeviceID string      `json:"source_device_id"`
+	TargetDeviceID string      `json:"target_device_id"`
+	VersionID      uint        `json:"version_id,omitempty"`   // ưu tiên nếu có
+	LogicalPath    string      `json:"logical_path,omitempty"` // dùng cùng Version khi không có VersionID
+	Version        int         `json:"version,omitempty"`      // 0 = latest
+	PathRemaps     []PathRemap `json:"path_remaps,omitempty"`
+	DestPath       string      `json:"dest_path,omitempty"` // ghi đè kết quả remap nếu có
+	Mode           string      `json:"mode,omitempty"`
+}
 
+type AdminCrossDeviceRestoreResponse struct {
+	CommandID uint   `json:"command_id"`
+	GrantID   uint   `json:"grant_id"`
+	VersionID uint   `json:"version_id"`
+	DestPath  string `json:"dest_path"`
+	Status    string `json:"status"`
+	Sent      bool   `json:"sent"`
+}
+
+// AdminBackupHoldRequest đặt hoặc gỡ hold. VersionID = 0 áp dụng cho cả device.
+type AdminBackupHoldRequest struct {
+	DeviceID    string `json:"device_id"`
+	VersionID   uint   `json:"version_id,omitempty"`
+	RetainUntil int64  `json:"retain_until,omitempty"` // unix giây, chỉ cho version; chỉ được gia hạn
+	RetainDays  *int   `json:"retain_days,omitempty"`  // WORM cấp device cho các version upload sau
+	LegalHold   *bool  `json:"legal_hold,omitempty"`   // nil: đặt hold chỉ khi request không gia hạn retention
+	Reason      string `json:"reason,omitempty"`
+}
+
+type AdminBackupHoldResponse struct {
+	DeviceID    string `json:"device_id"`
+	VersionID   uint   `json:"version_id,omitempty"`
+	LegalHold   bool   `json:"legal_hold"`
+	RetainUntil int64  `json:"retain_until,omitempty"`
+	RetainDays  int    `json:"retain_days,omitempty"`
+}
+
+// AdminBackupDeleteRequest: VersionID xóa một version; LogicalPath + KeepLast áp
+// retention; Purge xóa toàn bộ backup của device. Version được bảo vệ luôn bị bỏ qua.
+type AdminBackupDeleteRequest struct {
+	DeviceID    string `json:"device_id"`
+	VersionID   uint   `json:"version_id,omitempty"`
+	LogicalPath string `json:"logical_path,omitempty"`
+	KeepLast    int    `json:"keep_last,omitempty"`
+	Purge       bool   `json:"purge,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
@@ -3,8 +3,57 @@ package dto
 import "encoding/json"
 
 type CommandRequest struct {
+	ID       uint            `json:"id,omitempty"` // AgentCommand ID; agent dùng để bỏ qua bản gửi lặp
 	DeviceID string          `json:"deviceid"`
 	Command  string          `json:"command"`
 	Kind     string          `json:"kind,omitempty"`
 	Argument json.RawMessage `json:"argument,omitempty"`
+	// ExpiresAt (unix): agent bỏ qua command nhận được sau thời điểm này
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+	// Chữ ký Ed25519 (xem package cmdsign); nonce dùng một lần, hết hạn sau NotAfter
+	Nonce    string `json:"nonce,omitempty"`
+	NotAfter int64  `json:"not_after,omitempty"`
+	Sig      string `json:"sig,omitempty"`
+}
+
+// CommandResult là kết quả thực thi agent báo về (action command_result).
+type CommandResult struct {
+	ID        uint   `json:"id"`
+	Command   string `json:"command"`
+	Status    string `json:"status"` // running, done, failed, started, expired
+	Error     string `json:"error,omitempty"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	// Output là dữ liệu command trả về (vd: các dòng của osquery_run)
+	Output json.RawMessage `json:"output,omitempty"`
+}
+
+// CommandOutput là một frame output của stream command (action command_output).
+// Backend gắn DeviceID theo kết nối gửi rồi chuyển tới admin đang theo dõi.
+type CommandOutput struct {
+	ID       uint   `json:"id"`
+	DeviceID string `json:"device_id"`
+	Command  string `json:"command"`
+	Seq      uint64 `json:"seq"`
+	Data     string `json:"data,omitempty"`
+	Done     int64  `json:"done,omitempty"`
+	Total    int64  `json:"total,omitempty"`
+	EOF      bool   `json:"eof,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// AdminEvent là frame backend chủ động đẩy tới phiên admin (không phải ACK).
+type AdminEvent struct {
+	Event string `json:"event"` // command_output
+	Data  any    `json:"data"`
+}
+
+// AdminOutputSubscribeRequest đăng ký/hủy nhận output stream của một thiết bị.
+// CommandID = 0: mọi command; unsubscribe với DeviceID rỗng hủy tất cả.
+type AdminOutputSubscribeRequest struct {
+	DeviceID  string `json:"device_id"`
+	CommandID uint   `json:"command_id,omitempty"`
+}
+
+type AdminOutputSubscribeResponse struct {
+	Devices []string `json:"devices"` // thiết bị đang được theo dõi sau thao tác
 }
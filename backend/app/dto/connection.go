@@ -0,0 +1,43 @@
+package dto
+
+// HelloRequest được client gửi ngay sau login trên kết nối persistent để xin
+// vai trò control (nhận command push). Kết nối không gửi hello là transfer.
+type HelloRequest struct {
+	Role         string `json:"role"` // hiện chỉ hỗ trợ "control"
+	AgentVersion string `json:"agent_version,omitempty"`
+}
+
+type HelloResponse struct {
+	ConnID       int64  `json:"conn_id"`
+	Role         string `json:"role"`
+	Policy       string `json:"duplicate_policy"`
+	ReplacedConn int64  `json:"replaced_conn,omitempty"` // kết nối control cũ vừa bị ngắt (kick_old)
+}
+
+// AdminConnectionsRequest: DeviceID rỗng = mọi kết nối; ControlOnly bỏ qua kết nối transfer.
+type AdminConnectionsRequest struct {
+	DeviceID    string `json:"device_id,omitempty"`
+	ControlOnly bool   `json:"control_only,omitempty"`
+	Offset      int    `json:"offset,omitempty"`
+}
+
+type ConnectionEntry struct {
+	ConnID       int64  `json:"conn_id"`
+	DeviceID     string `json:"device_id"`
+	Role         string `json:"role"`
+	RemoteAddr   string `json:"remote_addr,omitempty"`
+	AgentVersion string `json:"agent_version,omitempty"`
+	ConnectedAt  int64  `json:"connected_at"`
+	PromotedAt   int64  `json:"promoted_at,omitempty"`
+	LastFrameAt  int64  `json:"last_frame_at"`
+	Frames       int64  `json:"frames"`
+	Authorized   bool   `json:"authorized"`
+	Verified     bool   `json:"identity_verified"`
+}
+
+type AdminConnectionsResponse struct {
+	Policy      string            `json:"duplicate_policy"`
+	Total       int               `json:"total"`
+	Connections []ConnectionEntry `json:"connections"`
+	NextOffset  int               `json:"next_offset,omitempty"`
+}
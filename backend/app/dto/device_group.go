@@ -0,0 +1,76 @@
+package dto
+
+import "encoding/json"
+
+// DeviceGroupRules là rule động; field rỗng = không lọc. Giá trị là glob
+// (path.Match), so khớp không phân biệt hoa thường.
+type DeviceGroupRules struct {
+	OSName   string `json:"os_name,omitempty"`
+	Hostname string `json:"hostname_pattern,omitempty"`
+	Arch     string `json:"arch,omitempty"`
+}
+
+type AdminGroupSaveRequest struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Rules       DeviceGroupRules `json:"rules"`
+	Devices     []string         `json:"devices,omitempty"` // thành viên tĩnh cần thêm
+}
+
+type AdminGroupMembersRequest struct {
+	Name   string   `json:"name"`
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+}
+
+type AdminGroupRequest struct {
+	Name string `json:"name"`
+}
+
+type DeviceGroupSummary struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Rules       DeviceGroupRules `json:"rules"`
+	StaticCount int              `json:"static_count"`
+	MemberCount int              `json:"member_count"` // tĩnh + khớp rule
+}
+
+type DeviceGroupDetail struct {
+	DeviceGroupSummary
+	Members []string `json:"members"`
+}
+
+type AdminGroupSendCommandRequest struct {
+	Group   string          `json:"group"`
+	Command string          `json:"command"`
+	Kind    string          `json:"kind,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	CommandPolicy
+}
+
+type AdminGroupBlockRuleRequest struct {
+	Group    string `json:"group"`
+	Type     string `json:"type"` // "category" hoặc "domain"
+	Category string `json:"category,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Enabled  *bool  `json:"enabled,omitempty"` // mặc định true
+}
+
+type AdminBatchStatusRequest struct {
+	BatchID string `json:"batch_id"`
+}
+
+// BatchProgress tổng hợp trạng thái các command cùng batch fan-out.
+type BatchProgress struct {
+	BatchID   string `json:"batch_id"`
+	Command   string `json:"command"`
+	Total     int    `json:"total"`
+	Pending   int    `json:"pending"`
+	Sent      int    `json:"sent"` // đã giao, chưa có kết quả
+	Running   int    `json:"running"`
+	Done      int    `json:"done"`
+	Failed    int    `json:"failed"`
+	Expired   int    `json:"expired"`
+	Cancelled int    `json:"cancelled"`
+	Complete  bool   `json:"complete"` // không còn command pending
+}
@@ -0,0 +1,31 @@
+package dto
+
+// DeviceStateDoc mô tả các thiết lập được quản lý trên agent. Với trạng thái
+// mong muốn, field nil nghĩa là backend không quản lý field đó.
+type DeviceStateDoc struct {
+	BackupEnabled  *bool     `json:"backup_enabled,omitempty"`
+	BlockEnabled   *bool     `json:"block_enabled,omitempty"`
+	BlockedDomains *[]string `json:"blocked_domains,omitempty"`
+	MonitorPaths   *[]string `json:"monitor_paths,omitempty"`
+	RateLimitKBps  *int      `json:"rate_limit_kbps,omitempty"`
+	BackupWindows  *[]string `json:"backup_windows,omitempty"`
+}
+
+type AdminSetDesiredStateRequest struct {
+	DeviceID string         `json:"device_id"`
+	Desired  DeviceStateDoc `json:"desired"`
+}
+
+type AdminGetDeviceStateRequest struct {
+	DeviceID string `json:"device_id"`
+}
+
+type DeviceStateResponse struct {
+	DeviceID    string          `json:"device_id"`
+	Desired     *DeviceStateDoc `json:"desired,omitempty"`
+	Actual      *DeviceStateDoc `json:"actual,omitempty"`
+	Drift       []string        `json:"drift,omitempty"`
+	ReportedAt  int64           `json:"reported_at,omitempty"`
+	CorrectedAt int64           `json:"corrected_at,omitempty"`
+	Corrections []uint          `json:"corrections,omitempty"` // ID command sửa lệch vừa được queue
+}
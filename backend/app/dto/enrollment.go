@@ -0,0 +1,71 @@
+package dto
+
+// DeviceEnrollRequest được agent gửi (action enroll) để đổi mã enrollment lấy
+// token device mà không cần username/password.
+type DeviceEnrollRequest struct {
+	EnrollToken string `json:"enroll_token"`
+	DeviceID    string `json:"device_id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	OSName      string `json:"os_name,omitempty"`
+	OSVersion   string `json:"os_version,omitempty"`
+	Hostname    string `json:"hostname,omitempty"`
+	Arch        string `json:"arch,omitempty"`
+	PublicKey   string `json:"public_key"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// AdminEnrollTokenCreateRequest: MaxUses mặc định 1 (Unlimited bỏ giới hạn),
+// TTLHours mặc định 24, tối đa 720.
+type AdminEnrollTokenCreateRequest struct {
+	Name      string `json:"name,omitempty"`
+	Group     string `json:"group,omitempty"`
+	MaxUses   int    `json:"max_uses,omitempty"`
+	Unlimited bool   `json:"unlimited,omitempty"`
+	TTLHours  int    `json:"ttl_hours,omitempty"`
+}
+
+type EnrollTokenSummary struct {
+	ID         uint   `json:"id"`
+	Name       string `json:"name,omitempty"`
+	Prefix     string `json:"prefix"`
+	Group      string `json:"group,omitempty"`
+	MaxUses    int    `json:"max_uses"` // 0 = không giới hạn
+	Uses       int    `json:"uses"`
+	ExpiresAt  int64  `json:"expires_at"`
+	Revoked    bool   `json:"revoked,omitempty"`
+	Active     bool   `json:"active"`
+	CreatedBy  string `json:"created_by,omitempty"`
+	CreatedAt  int64  `json:"created_at"`
+	LastUsedAt int64  `json:"last_used_at,omitempty"`
+}
+
+// AdminEnrollTokenCreateResponse: Token là mã đầy đủ, chỉ trả về một lần lúc tạo.
+type AdminEnrollTokenCreateResponse struct {
+	Token   string             `json:"token"`
+	Summary EnrollTokenSummary `json:"summary"`
+}
+
+type AdminEnrollTokenRevokeRequest struct {
+	ID uint `json:"id"`
+}
+
+// AdminListEnrollTokensRequest: có ID thì trả token đó kèm các device đã enroll bằng nó.
+type AdminListEnrollTokensRequest struct {
+	ID         uint `json:"id,omitempty"`
+	ActiveOnly bool `json:"active_only,omitempty"`
+	Offset     int  `json:"offset,omitempty"`
+	Limit      int  `json:"limit,omitempty"`
+}
+
+type DeviceEnrollmentEntry struct {
+	DeviceID   string `json:"device_id"`
+	Hostname   string `json:"hostname,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	EnrolledAt int64  `json:"enrolled_at"`
+}
+
+type AdminListEnrollTokensResponse struct {
+	Tokens      []EnrollTokenSummary    `json:"tokens"`
+	Enrollments []DeviceEnrollmentEntry `json:"enrollments,omitempty"`
+	NextOffset  int                     `json:"next_offset,omitempty"`
+}
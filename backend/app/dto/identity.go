@@ -0,0 +1,42 @@
+package dto
+
+// IdentityChallengeResponse: Bound=false nghĩa là device chưa gắn key, kết nối
+// không cần ký challenge.
+type IdentityChallengeResponse struct {
+	Nonce string `json:"nonce,omitempty"`
+	Bound bool   `json:"bound"`
+}
+
+type IdentityProveRequest struct {
+	Signature   string `json:"signature"` // base64 Ed25519 trên devicekey.Message
+	Fingerprint string `json:"fingerprint"`
+}
+
+// AdminDeviceIdentityRequest: có DeviceID thì trả identity của device đó (Reset
+// gỡ key để device enroll lại); không thì liệt kê, AlertsOnly chỉ giữ device
+// có cảnh báo clone.
+type AdminDeviceIdentityRequest struct {
+	DeviceID   string `json:"device_id,omitempty"`
+	Reset      bool   `json:"reset,omitempty"`
+	AlertsOnly bool   `json:"alerts_only,omitempty"`
+	Offset     int    `json:"offset,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+}
+
+type DeviceIdentityEntry struct {
+	DeviceID       string `json:"device_id"`
+	PublicKey      string `json:"public_key"`
+	Fingerprint    string `json:"fingerprint"`
+	EnrolledBy     string `json:"enrolled_by,omitempty"`
+	EnrolledAt     int64  `json:"enrolled_at"`
+	LastVerifiedAt int64  `json:"last_verified_at,omitempty"`
+	CloneAlerts    int    `json:"clone_alerts"`
+	LastAlertAt    int64  `json:"last_alert_at,omitempty"`
+	LastAlert      string `json:"last_alert,omitempty"`
+}
+
+type AdminDeviceIdentityResponse struct {
+	Identities []DeviceIdentityEntry `json:"identities"`
+	Reset      bool                  `json:"reset,omitempty"`
+	NextOffset int                   `json:"next_offset,omitempty"`
+}
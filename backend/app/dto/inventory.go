@@ -0,0 +1,128 @@
+package dto
+
+import "encoding/json"
+
+// InventorySystem là thông tin máy trong inventory_report của agent.
+type InventorySystem struct {
+	UUID      string `json:"uuid"`
+	MachineID string `json:"machine_id,omitempty"`
+	Hostname  string `json:"hostname"`
+	Vendor    string `json:"vendor,omitempty"`
+	Hardware  string `json:"hardware_model"`
+	Serial    string `json:"serial,omitempty"`
+	CPUBrand  string `json:"cpu_brand"`
+	CPUCores  int    `json:"cpu_cores,omitempty"`
+	MemoryMB  int64  `json:"memory_mb,omitempty"`
+	OSName    string `json:"os_name"`
+	OSVersion string `json:"os_version"`
+	Kernel    string `json:"kernel,omitempty"`
+	Arch      string `json:"arch,omitempty"`
+	Source    string `json:"source"`
+}
+
+type InventoryDisk struct {
+	Device string `json:"device"`
+	Mount  string `json:"mount"`
+	FSType string `json:"fs_type"`
+	SizeMB int64  `json:"size_mb"`
+}
+
+type InventoryInterface struct {
+	Name  string   `json:"name"`
+	MAC   string   `json:"mac,omitempty"`
+	Addrs []string `json:"addrs,omitempty"`
+}
+
+type InventoryPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Manager string `json:"manager"`
+}
+
+type InventoryUser struct {
+	Name  string `json:"name"`
+	UID   int    `json:"uid"`
+	Home  string `json:"home,omitempty"`
+	Shell string `json:"shell,omitempty"`
+}
+
+// InventoryReport là payload của action inventory_report (agent -> backend).
+type InventoryReport struct {
+	System     InventorySystem      `json:"system"`
+	Disks      []InventoryDisk      `json:"disks"`
+	Interfaces []InventoryInterface `json:"interfaces"`
+	Packages   []InventoryPackage   `json:"packages"`
+	Users      []InventoryUser      `json:"users"`
+	Truncated  bool                 `json:"truncated,omitempty"`
+	UnixTime   int64                `json:"unix_time"`
+}
+
+// InventoryReportResponse cho agent biết report tạo snapshot mới hay trùng snapshot cũ.
+type InventoryReportResponse struct {
+	SnapshotID uint `json:"snapshot_id"`
+	Changed    bool `json:"changed"`
+	Changes    int  `json:"changes"`
+}
+
+// AdminInventoryRequest đọc một snapshot (0 = mới nhất). Section rỗng chỉ trả tóm tắt;
+// disks | interfaces | packages | users trả thêm một trang danh sách từ Offset.
+type AdminInventoryRequest struct {
+	DeviceID   string `json:"device_id"`
+	SnapshotID uint   `json:"snapshot_id,omitempty"`
+	Section    string `json:"section,omitempty"`
+	Offset     int    `json:"offset,omitempty"`
+}
+
+type InventorySummary struct {
+	SnapshotID     uint   `json:"snapshot_id"`
+	CollectedAt    int64  `json:"collected_at"`
+	LastSeenAt     int64  `json:"last_seen_at"`
+	Source         string `json:"source"`
+	Hostname       string `json:"hostname"`
+	Vendor         string `json:"vendor,omitempty"`
+	Hardware       string `json:"hardware_model,omitempty"`
+	Serial         string `json:"serial,omitempty"`
+	CPUBrand       string `json:"cpu_brand,omitempty"`
+	CPUCores       int    `json:"cpu_cores,omitempty"`
+	MemoryMB       int64  `json:"memory_mb,omitempty"`
+	OSName         string `json:"os_name,omitempty"`
+	OSVersion      string `json:"os_version,omitempty"`
+	Kernel         string `json:"kernel,omitempty"`
+	DiskCount      int    `json:"disk_count"`
+	InterfaceCount int    `json:"interface_count"`
+	PackageCount   int    `json:"package_count"`
+	UserCount      int    `json:"user_count"`
+	Truncated      bool   `json:"truncated,omitempty"`
+}
+
+type AdminInventoryResponse struct {
+	InventorySummary
+	Section    string            `json:"section,omitempty"`
+	Items      []json.RawMessage `json:"items,omitempty"`
+	NextOffset int               `json:"next_offset,omitempty"` // 0 = không còn
+}
+
+// AdminInventoryHistoryRequest liệt kê snapshot (Category = "snapshots") hoặc các thay đổi.
+type AdminInventoryHistoryRequest struct {
+	DeviceID string `json:"device_id"`
+	Category string `json:"category,omitempty"` // snapshots | system | disk | interface | package | user
+	Since    int64  `json:"since,omitempty"`
+	Offset   int    `json:"offset,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+}
+
+type InventoryChangeEntry struct {
+	SnapshotID uint   `json:"snapshot_id"`
+	DetectedAt int64  `json:"detected_at"`
+	Category   string `json:"category"`
+	Action     string `json:"action"`
+	Item       string `json:"item"`
+	Old        string `json:"old,omitempty"`
+	New        string `json:"new,omitempty"`
+}
+
+type AdminInventoryHistoryResponse struct {
+	Snapshots  []InventorySummary     `json:"snapshots,omitempty"`
+	Changes    []InventoryChangeEntry `json:"changes,omitempty"`
+	NextOffset int                    `json:"next_offset,omitempty"`
+}
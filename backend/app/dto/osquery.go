@@ -0,0 +1,107 @@
+package dto
+
+import "encoding/json"
+
+// AdminOsqueryRunRequest gửi command osquery_run tới một device hoặc một group.
+type AdminOsqueryRunRequest struct {
+	DeviceID   string `json:"device_id,omitempty"`
+	Group      string `json:"group,omitempty"`
+	Query      string `json:"query"`
+	TimeoutSec int    `json:"timeout_sec,omitempty"`
+	MaxRows    int    `json:"max_rows,omitempty"`
+	CommandPolicy
+}
+
+// OsqueryRunArg là argument của command osquery_run trên agent.
+type OsqueryRunArg struct {
+	Query      string `json:"query"`
+	TimeoutSec int    `json:"timeout_sec,omitempty"`
+	MaxRows    int    `json:"max_rows,omitempty"`
+}
+
+// OsqueryRunOutput là Output agent gửi kèm command_result của osquery_run.
+type OsqueryRunOutput struct {
+	Rows       []json.RawMessage `json:"rows"`
+	RowCount   int               `json:"row_count"`
+	Truncated  bool              `json:"truncated,omitempty"`
+	DurationMs int64             `json:"duration_ms"`
+}
+
+type AdminOsqueryResultsRequest struct {
+	DeviceID string `json:"device_id"`
+	Limit    int    `json:"limit,omitempty"`
+}
+
+type OsqueryResultSummary struct {
+	ID         uint   `json:"id"`
+	CommandID  uint   `json:"command_id"`
+	DeviceID   string `json:"device_id"`
+	Query      string `json:"query"`
+	RowCount   int    `json:"row_count"`
+	StoredRows int    `json:"stored_rows"`
+	Truncated  bool   `json:"truncated,omitempty"`
+	RowsHash   string `json:"rows_hash,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+type AdminOsqueryResultsResponse struct {
+	Results   []OsqueryResultSummary `json:"results"`
+	Truncated bool                   `json:"truncated,omitempty"` // còn kết quả cũ hơn không vừa ACK
+}
+
+// AdminOsqueryResultRequest lấy các dòng của một kết quả theo trang.
+type AdminOsqueryResultRequest struct {
+	ID     uint `json:"id"`
+	Offset int  `json:"offset,omitempty"`
+	Limit  int  `json:"limit,omitempty"`
+}
+
+type OsqueryResultPage struct {
+	OsqueryResultSummary
+	Offset     int               `json:"offset"`
+	Rows       []json.RawMessage `json:"rows"`
+	NextOffset int               `json:"next_offset,omitempty"` // 0 = đã hết dòng
+}
+
+// AdminOsqueryCompareRequest so sánh kết quả mới nhất của cùng query giữa các device.
+type AdminOsqueryCompareRequest struct {
+	Query     string   `json:"query"`
+	DeviceIDs []string `json:"device_ids,omitempty"`
+	Group     string   `json:"group,omitempty"`
+}
+
+type OsqueryCompareEntry struct {
+	DeviceID  string `json:"device_id"`
+	ResultID  uint   `json:"result_id"`
+	RowCount  int    `json:"row_count"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Error     string `json:"error,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	Variant   int    `json:"variant"` // các device cùng variant có tập dòng giống nhau
+}
+
+type OsqueryCompareResponse struct {
+	Devices   []OsqueryCompareEntry `json:"devices"`
+	Variants  int                   `json:"variants"`
+	Missing   []string              `json:"missing,omitempty"` // device chưa có kết quả cho query
+	Truncated bool                  `json:"truncated,omitempty"`
+}
+
+// AdminOsqueryDiffRequest liệt kê dòng chỉ có ở một trong hai kết quả.
+type AdminOsqueryDiffRequest struct {
+	LeftID  uint `json:"left_id"`
+	RightID uint `json:"right_id"`
+}
+
+type OsqueryDiffResponse struct {
+	LeftID         uint              `json:"left_id"`
+	RightID        uint              `json:"right_id"`
+	Common         int               `json:"common"`
+	OnlyLeftCount  int               `json:"only_left_count"`
+	OnlyRightCount int               `json:"only_right_count"`
+	OnlyLeft       []json.RawMessage `json:"only_left"`
+	OnlyRight      []json.RawMessage `json:"only_right"`
+	Truncated      bool              `json:"truncated,omitempty"`
+}
@@ -0,0 +1,97 @@
+package dto
+
+import "encoding/json"
+
+type OsqueryPackQuery struct {
+	Name        string `json:"name"`
+	Query       string `json:"query"`
+	IntervalSec int    `json:"interval_sec"`
+}
+
+// AdminPackSaveRequest tạo mới hoặc thay toàn bộ query của một pack.
+type AdminPackSaveRequest struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Queries     []OsqueryPackQuery `json:"queries"`
+}
+
+// AdminPackAssignRequest giao (hoặc gỡ khi Remove) pack cho các device và/hoặc group.
+type AdminPackAssignRequest struct {
+	Pack      string   `json:"pack"`
+	DeviceIDs []string `json:"device_ids,omitempty"`
+	Groups    []string `json:"groups,omitempty"`
+	Remove    bool     `json:"remove,omitempty"`
+}
+
+type AdminPackRequest struct {
+	Name string `json:"name"`
+}
+
+type OsqueryPackSummary struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Queries     []string `json:"queries"`
+	Devices     []string `json:"devices,omitempty"`
+	Groups      []string `json:"groups,omitempty"`
+}
+
+// AdminPackSaveResponse cho biết pack đã lưu và số device được gửi lại cấu hình.
+type AdminPackSaveResponse struct {
+	Pack    OsqueryPackSummary `json:"pack"`
+	Updated int                `json:"updated"`
+}
+
+// OsqueryPackQueryArg là một query trong argument của command osquery_packs.
+type OsqueryPackQueryArg struct {
+	Pack        string `json:"pack"`
+	Name        string `json:"name"`
+	Query       string `json:"query"`
+	IntervalSec int    `json:"interval_sec"`
+}
+
+// OsqueryPacksArg là toàn bộ pack của một device (command osquery_packs).
+type OsqueryPacksArg struct {
+	Hash    string                `json:"hash"`
+	Queries []OsqueryPackQueryArg `json:"queries"`
+}
+
+// OsqueryPackSync là hash cấu hình pack agent đang giữ (action osquery_pack_sync).
+type OsqueryPackSync struct {
+	ConfigHash string `json:"config_hash"`
+}
+
+// OsqueryDiff là các dòng thêm/bớt của một query pack (action osquery_diff).
+type OsqueryDiff struct {
+	Pack     string            `json:"pack"`
+	Name     string            `json:"name"`
+	Added    []json.RawMessage `json:"added,omitempty"`
+	Removed  []json.RawMessage `json:"removed,omitempty"`
+	Counter  uint64            `json:"counter"`
+	UnixTime int64             `json:"unix_time"`
+}
+
+// AdminPackHistoryRequest tra lịch sử thay đổi của device; Since/Until là unix.
+type AdminPackHistoryRequest struct {
+	DeviceID string `json:"device_id"`
+	Pack     string `json:"pack,omitempty"`
+	Query    string `json:"query,omitempty"`
+	Action   string `json:"action,omitempty"` // added | removed
+	Since    int64  `json:"since,omitempty"`
+	Until    int64  `json:"until,omitempty"`
+	Offset   int    `json:"offset,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+}
+
+type OsqueryDiffEntry struct {
+	ID          uint            `json:"id"`
+	Pack        string          `json:"pack"`
+	Query       string          `json:"query"`
+	Action      string          `json:"action"`
+	Row         json.RawMessage `json:"row"`
+	CollectedAt int64           `json:"collected_at"`
+}
+
+type AdminPackHistoryResponse struct {
+	Entries    []OsqueryDiffEntry `json:"entries"`
+	NextOffset int                `json:"next_offset,omitempty"` // 0 = không còn
+}
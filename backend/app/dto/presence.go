@@ -0,0 +1,39 @@
+package dto
+
+// AdminPresenceRequest: có DeviceID thì trả chi tiết một device kèm các session gần đây,
+// không thì trả bảng presence của mọi device. NotSeenDays > 0 chỉ giữ device
+// không kết nối trong ngần ấy ngày.
+type AdminPresenceRequest struct {
+	DeviceID    string `json:"device_id,omitempty"`
+	Days        int    `json:"days,omitempty"` // cửa sổ tính uptime, mặc định 7, tối đa 90
+	NotSeenDays int    `json:"not_seen_days,omitempty"`
+	Offset      int    `json:"offset,omitempty"`
+	Limit       int    `json:"limit,omitempty"`
+}
+
+type DevicePresence struct {
+	UUID          string  `json:"uuid"`
+	Name          string  `json:"name,omitempty"`
+	Online        bool    `json:"online"`
+	LastSeenAt    int64   `json:"last_seen_at,omitempty"`
+	LastIP        string  `json:"last_ip,omitempty"`
+	UptimePercent float64 `json:"uptime_percent"`
+	Sessions      int     `json:"sessions"`
+	WindowStart   int64   `json:"window_start"` // muộn hơn Since nếu device đăng ký sau đó
+}
+
+type DeviceSessionEntry struct {
+	ConnectedAt    int64  `json:"connected_at"`
+	DisconnectedAt int64  `json:"disconnected_at,omitempty"` // 0 = còn kết nối
+	DurationSec    int64  `json:"duration_sec"`
+	RemoteAddr     string `json:"remote_addr,omitempty"`
+	CloseReason    string `json:"close_reason,omitempty"`
+}
+
+type AdminPresenceResponse struct {
+	Since      int64                `json:"since"`
+	Until      int64                `json:"until"`
+	Devices    []DevicePresence     `json:"devices"`
+	Sessions   []DeviceSessionEntry `json:"sessions,omitempty"`
+	NextOffset int                  `json:"next_offset,omitempty"`
+}
@@ -18,6 +18,9 @@ type ProtocolLoginRequest struct {
 	OSVersion string `json:"os_version,omitempty"`
 	Hostname  string `json:"hostname,omitempty"`
 	Arch      string `json:"arch,omitempty"`
+	// Device credential bound at enrollment (base64 Ed25519 public key + hardware fingerprint)
+	PublicKey   string `json:"public_key,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
 }
 
 // BackupDownloadStartRequest is sent by the agent to begin a download session.
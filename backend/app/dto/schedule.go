@@ -0,0 +1,41 @@
+package dto
+
+import "encoding/json"
+
+// AdminScheduleCreateRequest tạo command định kỳ; cần đúng một trong DeviceID/Group.
+type AdminScheduleCreateRequest struct {
+	Name     string          `json:"name"`
+	Cron     string          `json:"cron"`               // 5 trường hoặc @daily, @hourly...
+	Timezone string          `json:"timezone,omitempty"` // IANA, vd. "Asia/Ho_Chi_Minh"
+	DeviceID string          `json:"device_id,omitempty"`
+	Group    string          `json:"group,omitempty"`
+	Command  string          `json:"command"`
+	Kind     string          `json:"kind,omitempty"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	Paused   bool            `json:"paused,omitempty"`
+	// Áp dụng cho mỗi command sinh ra; expires_at tuyệt đối bị bỏ qua
+	CommandPolicy
+}
+
+// AdminSchedulePauseRequest chọn schedule theo ID hoặc tên.
+type AdminSchedulePauseRequest struct {
+	ID     uint   `json:"id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Paused *bool  `json:"paused,omitempty"` // mặc định true; false = tiếp tục
+}
+
+type ScheduleSummary struct {
+	ID          uint            `json:"id"`
+	Name        string          `json:"name"`
+	Cron        string          `json:"cron"`
+	Timezone    string          `json:"timezone,omitempty"`
+	DeviceID    string          `json:"device_id,omitempty"`
+	Group       string          `json:"group,omitempty"`
+	Command     string          `json:"command"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Paused      bool            `json:"paused"`
+	NextRunAt   int64           `json:"next_run_at,omitempty"`
+	LastRunAt   int64           `json:"last_run_at,omitempty"`
+	LastBatchID string          `json:"last_batch_id,omitempty"`
+	RunCount    int             `json:"run_count"`
+}
@@ -0,0 +1,41 @@
+package dto
+
+// Telemetry là heartbeat sức khỏe agent (action telemetry).
+type Telemetry struct {
+	AgentVersion string  `json:"agent_version"`
+	UptimeSec    int64   `json:"uptime_sec"`
+	CPUPercent   float64 `json:"cpu_percent"`
+	MemoryMB     float64 `json:"memory_mb"`
+	Goroutines   int     `json:"goroutines"`
+	DiskFreeMB   int64   `json:"disk_free_mb"`
+	BackupQueue  int64   `json:"backup_queue"`
+	MonitorPaths int     `json:"monitor_paths"`
+	WatchCount   int     `json:"watch_count"`
+	LastTreeSync int64   `json:"last_tree_sync,omitempty"`
+	UnixTime     int64   `json:"unix_time"`
+	IntervalSec  int     `json:"interval_sec"`
+}
+
+type TelemetrySample struct {
+	ReportedAt   int64   `json:"reported_at"`
+	AgentVersion string  `json:"agent_version"`
+	UptimeSec    int64   `json:"uptime_sec"`
+	CPUPercent   float64 `json:"cpu_percent"`
+	MemoryMB     float64 `json:"memory_mb"`
+	DiskFreeMB   int64   `json:"disk_free_mb"`
+	BackupQueue  int64   `json:"backup_queue"`
+	WatchCount   int     `json:"watch_count"`
+	SyncAgeSec   int64   `json:"sync_age_sec"`
+}
+
+type AdminTelemetryRequest struct {
+	DeviceID string `json:"device_id"`
+	Limit    int    `json:"limit,omitempty"`
+}
+
+type AdminTelemetryResponse struct {
+	DeviceID string            `json:"device_id"`
+	Health   string            `json:"health,omitempty"`
+	Issues   []string          `json:"issues,omitempty"`
+	Samples  []TelemetrySample `json:"samples"`
+}
@@ -0,0 +1,43 @@
+package dto
+
+// TokenPair được trả về khi login/enroll/refresh. Token là access token ngắn
+// hạn; RefreshToken chỉ dùng cho action refresh.
+type TokenPair struct {
+	Token            string `json:"token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresAt        int64  `json:"expires_at"`
+	RefreshExpiresAt int64  `json:"refresh_expires_at"`
+	DeviceID         string `json:"device_id"`
+}
+
+// TokenRefreshRequest đổi refresh token lấy cặp token mới; refresh token cũ bị
+// thu hồi ngay (rotation).
+type TokenRefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	DeviceID     string `json:"device_id,omitempty"`
+}
+
+// LogoutRequest thu hồi access token của kết nối và refresh token gửi kèm (nếu có).
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// AdminRevokeTokenRequest thu hồi một token theo jti.
+type AdminRevokeTokenRequest struct {
+	JTI       string `json:"jti"`
+	DeviceID  string `json:"device_id,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"` // unix; mặc định giữ theo thời hạn refresh token
+	Reason    string `json:"reason,omitempty"`
+}
+
+// AdminRevokeDeviceRequest thu hồi mọi token của device và ngắt kết nối đang mở.
+type AdminRevokeDeviceRequest struct {
+	DeviceID string `json:"device_id"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type AdminRevokeDeviceResponse struct {
+	DeviceID      string `json:"device_id"`
+	RevokedBefore int64  `json:"revoked_before"`
+	Disconnected  int    `json:"disconnected"`
+}
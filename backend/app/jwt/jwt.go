@@ -1,37 +1,97 @@
 package jwtutil
 
 import (
+	"errors"
 	"time"
 
 	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+)
+
+// ErrWrongTokenType is returned when a refresh token is used as an access token or vice versa.
+var ErrWrongTokenType = errors.New("wrong token type")
+
 type Claims struct {
 	UserID   uint   `json:"uid"`
 	Username string `json:"uname"`
 	Role     string `json:"role"`
 	DeviceID string `json:"device_id"`
+	Type     string `json:"typ,omitempty"` // empty on tokens issued before refresh tokens existed (access)
 	jwt.RegisteredClaims
 }
 
 type Signer struct {
-	Secret []byte
-	Issuer string
-	ExpMin int
+	Secret        []byte
+	Issuer        string
+	ExpMin        int // access token lifetime
+	RefreshExpMin int // refresh token lifetime
 }
 
+// Sign issues a short-lived access token.
 func (s *Signer) Sign(userID uint, username, role, deviceID string) (string, error) {
+	tok, _, err := s.SignAccess(userID, username, role, deviceID)
+	return tok, err
+}
+
+// SignAccess issues an access token and returns it with its claims.
+func (s *Signer) SignAccess(userID uint, username, role, deviceID string) (string, *Claims, error) {
+	return s.sign(TypeAccess, time.Duration(s.ExpMin)*time.Minute, userID, username, role, deviceID)
+}
+
+// SignRefresh issues a refresh token and returns it with its claims.
+func (s *Signer) SignRefresh(userID uint, username, role, deviceID string) (string, *Claims, error) {
+	return s.sign(TypeRefresh, time.Duration(s.RefreshExpMin)*time.Minute, userID, username, role, deviceID)
+}
+
+func (s *Signer) sign(typ string, ttl time.Duration, userID uint, username, role, deviceID string) (string, *Claims, error) {
 	now := time.Now()
-	exp := now.Add(time.Duration(s.ExpMin) * time.Minute)
-	claims := Claims{
-		UserID: userID, Username: username, Role: role, DeviceID: deviceID,
-		RegisteredClaims: jwt.RegisteredClaims{Issuer: s.Issuer, IssuedAt: jwt.NewNumericDate(now), ExpiresAt: jwt.NewNumericDate(exp)},
+	claims := &Claims{
+		UserID: userID, Username: username, Role: role, DeviceID: deviceID, Type: typ,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    s.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.Secret)
+	signed, err := token.SignedString(s.Secret)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
 }
 
+// Parse validates an access token.
 func (s *Signer) Parse(tokenStr string) (*Claims, error) {
+	claims, err := s.parse(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != "" && claims.Type != TypeAccess {
+		return nil, ErrWrongTokenType
+	}
+	return claims, nil
+}
+
+// ParseRefresh validates a refresh token.
+func (s *Signer) ParseRefresh(tokenStr string) (*Claims, error) {
+	claims, err := s.parse(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != TypeRefresh {
+		return nil, ErrWrongTokenType
+	}
+	return claims, nil
+}
+
+func (s *Signer) parse(tokenStr string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (interface{}, error) { return s.Secret, nil })
 	if err != nil {
 		return nil, err
@@ -6,14 +6,21 @@ import "time"
 type AgentCommand struct {
 	ID        uint      `gorm:"primaryKey"`
 	DeviceID  string    `gorm:"size:191;index"`
+	BatchID   string    `gorm:"size:64;index"` // fan-out theo group: các command cùng batch
 	Command   string    `gorm:"size:64"`
 	Kind      string    `gorm:"size:32"`
 	Payload   string    `gorm:"type:longtext"` // JSON argument
-	Status    string    `gorm:"size:32;index"` // pending,sent,failed
+	Status    string    `gorm:"size:32;index"` // pending,sent,failed,expired,cancelled
 	LastError string    `gorm:"size:512"`
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 	SentAt    *time.Time
+
+	// Chính sách retry: hết hạn thì chuyển expired, quá MaxAttempts thì failed.
+	ExpiresAt     *time.Time `gorm:"index"`
+	MaxAttempts   int
+	Attempts      int
+	NextAttemptAt *time.Time // backoff: chưa gửi lại trước thời điểm này
 }
 
 
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// AuditLog ghi lại các thao tác quản trị nhạy cảm (ai làm gì, trên đối tượng nào).
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey"`
+	Actor     string    `gorm:"size:191;index"`
+	Action    string    `gorm:"size:64;index"`
+	DeviceID  string    `gorm:"size:191;index"`
+	Target    string    `gorm:"size:255"`
+	Detail    string    `gorm:"type:text"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// BackupHold cấu hình WORM (giữ tối thiểu RetainDays) và legal hold cho toàn bộ
+// backup của một device.
+type BackupHold struct {
+	ID         uint      `gorm:"primaryKey"`
+	DeviceID   string    `gorm:"size:191;uniqueIndex;not null"`
+	RetainDays int       // >0: mỗi version mới bị khóa xóa trong RetainDays ngày
+	LegalHold  bool      `gorm:"default:false"` // khóa xóa mọi version của device
+	UpdatedBy  string    `gorm:"size:191"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+}
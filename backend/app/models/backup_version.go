@@ -12,5 +12,8 @@ type BackupFileVersion struct {
 	StoredName  string `gorm:"size:255"`       // tên file thực trong thư mục backups
 	Version     int    `gorm:"index"`
 	Size        int64
-	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	SHA256      string     `gorm:"size:64"` // checksum nội dung lúc finalize, dùng cho scrub
+	RetainUntil *time.Time // WORM: không được xóa trước thời điểm này
+	LegalHold   bool       `gorm:"default:false"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime"`
 }
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// DeviceGroup gom device theo thành viên tĩnh (DeviceGroupMember) và/hoặc rule động
+// trên thông tin models.Device. Rule rỗng = không lọc theo field đó; group không có
+// rule nào chỉ gồm thành viên tĩnh.
+type DeviceGroup struct {
+	ID           uint      `gorm:"primaryKey"`
+	Name         string    `gorm:"size:128;uniqueIndex;not null"`
+	Description  string    `gorm:"size:512"`
+	RuleOSName   string    `gorm:"size:128"` // glob, không phân biệt hoa thường
+	RuleHostname string    `gorm:"size:255"` // glob, ví dụ "lab-*"
+	RuleArch     string    `gorm:"size:64"`  // glob
+	CreatedBy    string    `gorm:"size:191"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+}
+
+// DeviceGroupMember là thành viên tĩnh của group.
+type DeviceGroupMember struct {
+	ID        uint      `gorm:"primaryKey"`
+	GroupID   uint      `gorm:"uniqueIndex:idx_group_device;not null"`
+	DeviceID  string    `gorm:"size:191;uniqueIndex:idx_group_device;not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// HasRules cho biết group có rule động hay không.
+func (g *DeviceGroup) HasRules() bool {
+	return g.RuleOSName != "" || g.RuleHostname != "" || g.RuleArch != ""
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// DeviceIdentity là credential cấp cho device lúc enroll: public key Ed25519 và
+// fingerprint phần cứng mà mọi kết nối của device phải chứng minh lại.
+type DeviceIdentity struct {
+	ID             uint   `gorm:"primaryKey"`
+	DeviceID       string `gorm:"size:191;uniqueIndex"`
+	PublicKey      string `gorm:"size:64"`
+	Fingerprint    string `gorm:"size:64"`
+	EnrolledBy     string `gorm:"size:191"`
+	EnrolledAt     time.Time
+	LastVerifiedAt *time.Time
+	// Cảnh báo nghi clone: chữ ký đúng nhưng fingerprint khác, enroll lại với key khác...
+	CloneAlerts int
+	LastAlertAt *time.Time `gorm:"index"`
+	LastAlert   string     `gorm:"size:255"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// DeviceInventory là một snapshot inventory của device; chỉ tạo snapshot mới khi
+// nội dung khác snapshot trước, còn không thì cập nhật LastSeenAt.
+type DeviceInventory struct {
+	ID             uint   `gorm:"primaryKey"`
+	DeviceID       string `gorm:"size:191;index"`
+	Hash           string `gorm:"size:64"` // sha256 nội dung (không tính thời điểm thu thập)
+	Source         string `gorm:"size:16"` // native | osquery
+	Hostname       string `gorm:"size:255"`
+	Vendor         string `gorm:"size:255"`
+	Hardware       string `gorm:"size:255"`
+	Serial         string `gorm:"size:255"`
+	CPUBrand       string `gorm:"size:255"`
+	CPUCores       int
+	MemoryMB       int64
+	OSName         string `gorm:"size:128"`
+	OSVersion      string `gorm:"size:128"`
+	Kernel         string `gorm:"size:128"`
+	DiskCount      int
+	InterfaceCount int
+	PackageCount   int
+	UserCount      int
+	Truncated      bool
+	DataJSON       string    `gorm:"type:longtext"` // report đầy đủ (disks, interfaces, packages, users)
+	CollectedAt    time.Time // thời điểm agent thu thập snapshot này lần đầu
+	LastSeenAt     time.Time // lần cuối agent báo cùng nội dung
+	CreatedAt      time.Time
+}
+
+// InventoryChange là một thay đổi giữa hai snapshot liên tiếp (vd: RAM đổi, package mới).
+type InventoryChange struct {
+	ID         uint      `gorm:"primaryKey"`
+	DeviceID   string    `gorm:"size:191;index:idx_inventory_change_device,priority:1"`
+	DetectedAt time.Time `gorm:"index:idx_inventory_change_device,priority:2"`
+	SnapshotID uint      `gorm:"index"`
+	Category   string    `gorm:"size:32"` // system | disk | interface | package | user
+	Action     string    `gorm:"size:16"` // added | removed | changed
+	Item       string    `gorm:"size:255"`
+	Old        string    `gorm:"size:512"`
+	New        string    `gorm:"size:512"`
+}
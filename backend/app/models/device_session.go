@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// DeviceSession là một lần device kết nối protocol tới backend; DisconnectedAt
+// nil nghĩa là kết nối còn mở.
+type DeviceSession struct {
+	ID             uint      `gorm:"primaryKey"`
+	DeviceID       string    `gorm:"size:191;index:idx_device_session,priority:1"`
+	ConnectedAt    time.Time `gorm:"index:idx_device_session,priority:2"`
+	DisconnectedAt *time.Time
+	RemoteAddr     string `gorm:"size:64"`
+	CloseReason    string `gorm:"size:64"` // disconnect | replaced | server_restart
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// DeviceState giữ trạng thái mong muốn (do admin đặt) và trạng thái thực tế
+// (agent báo cáo) của một device, cùng danh sách field đang lệch.
+type DeviceState struct {
+	ID          uint   `gorm:"primaryKey"`
+	DeviceID    string `gorm:"size:191;uniqueIndex;not null"`
+	Desired     string `gorm:"type:text"` // JSON dto.DeviceStateDoc
+	Actual      string `gorm:"type:text"` // JSON dto.DeviceStateDoc do agent báo cáo
+	Drift       string `gorm:"size:512"`  // các field lệch, phân tách bằng dấu phẩy
+	DesiredBy   string `gorm:"size:191"`
+	DesiredAt   *time.Time
+	ReportedAt  *time.Time
+	CorrectedAt *time.Time // lần cuối gửi command sửa lệch
+	CreatedAt   time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime"`
+}
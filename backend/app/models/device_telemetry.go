@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// DeviceTelemetry là một mẫu heartbeat sức khỏe agent; chỉ giữ các mẫu gần đây.
+type DeviceTelemetry struct {
+	ID           uint   `gorm:"primaryKey"`
+	DeviceID     string `gorm:"size:191;index:idx_telemetry_device_time,priority:1"`
+	AgentVersion string `gorm:"size:64"`
+	UptimeSec    int64
+	CPUPercent   float64
+	MemoryMB     float64
+	Goroutines   int
+	DiskFreeMB   int64 // -1 = agent không đo được
+	BackupQueue  int64
+	MonitorPaths int
+	WatchCount   int
+	SyncAgeSec   int64     // số giây từ lần sync file tree thành công (theo đồng hồ agent); -1 = chưa sync
+	IntervalSec  int       // chu kỳ gửi của agent, dùng để xác định stale
+	ReportedAt   time.Time `gorm:"index:idx_telemetry_device_time,priority:2"` // thời điểm backend nhận
+}
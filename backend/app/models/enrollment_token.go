@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// EnrollmentToken là mã admin cấp để agent tự enroll khi cài không người trực.
+// Chỉ lưu SHA-256 của mã; Prefix giữ vài ký tự đầu để nhận diện trong danh sách.
+type EnrollmentToken struct {
+	ID         uint      `gorm:"primaryKey"`
+	Name       string    `gorm:"size:128"`
+	TokenHash  string    `gorm:"size:64;uniqueIndex;not null"`
+	Prefix     string    `gorm:"size:16"`
+	GroupName  string    `gorm:"size:128"` // group device được thêm vào sau khi enroll (rỗng = không)
+	MaxUses    int       // 0 = không giới hạn
+	Uses       int       `gorm:"not null;default:0"`
+	ExpiresAt  time.Time `gorm:"index"`
+	Revoked    bool      `gorm:"not null;default:false"`
+	CreatedBy  string    `gorm:"size:191"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	LastUsedAt *time.Time
+}
+
+// DeviceEnrollment ghi device nào đã enroll bằng token nào.
+type DeviceEnrollment struct {
+	ID         uint      `gorm:"primaryKey"`
+	TokenID    uint      `gorm:"uniqueIndex:idx_enroll_token_device,priority:1;not null"`
+	DeviceID   string    `gorm:"size:191;uniqueIndex:idx_enroll_token_device,priority:2;index;not null"`
+	Hostname   string    `gorm:"size:255"`
+	RemoteAddr string    `gorm:"size:64"`
+	EnrolledAt time.Time `gorm:"autoCreateTime"`
+}
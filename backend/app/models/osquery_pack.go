@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// OsqueryPack là nhóm query osquery chạy định kỳ trên các device được giao.
+type OsqueryPack struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"size:128;uniqueIndex;not null"`
+	Description string `gorm:"size:512"`
+	CreatedBy   string `gorm:"size:191"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// OsqueryPackQuery là một query trong pack, chạy mỗi IntervalSec giây.
+type OsqueryPackQuery struct {
+	ID          uint   `gorm:"primaryKey"`
+	PackID      uint   `gorm:"uniqueIndex:idx_pack_query_name;not null"`
+	Name        string `gorm:"size:128;uniqueIndex:idx_pack_query_name;not null"`
+	Query       string `gorm:"type:text"`
+	IntervalSec int
+}
+
+// OsqueryPackTarget giao pack cho một device hoặc một group (đúng một trong hai).
+type OsqueryPackTarget struct {
+	ID        uint   `gorm:"primaryKey"`
+	PackID    uint   `gorm:"uniqueIndex:idx_pack_target;not null"`
+	DeviceID  string `gorm:"size:191;uniqueIndex:idx_pack_target"`
+	GroupName string `gorm:"size:128;uniqueIndex:idx_pack_target"`
+	CreatedAt time.Time
+}
+
+// OsqueryDiffRow là một dòng thêm/bớt trong kết quả của query pack, lưu theo
+// thời gian để tra lịch sử thay đổi (vd: port mới mở, user mới).
+type OsqueryDiffRow struct {
+	ID          uint      `gorm:"primaryKey"`
+	DeviceID    string    `gorm:"size:191;index:idx_osquery_diff_series,priority:1"`
+	Pack        string    `gorm:"size:128;index:idx_osquery_diff_series,priority:2"`
+	QueryName   string    `gorm:"size:128;index:idx_osquery_diff_series,priority:3"`
+	CollectedAt time.Time `gorm:"index:idx_osquery_diff_series,priority:4"` // thời điểm agent chạy query
+	Action      string    `gorm:"size:16"`                                  // added | removed
+	Counter     uint64    // số thứ tự lần gửi diff của query trên agent
+	Row         string    `gorm:"type:text"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
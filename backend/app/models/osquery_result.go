@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// OsqueryResult lưu kết quả một lần chạy command osquery_run trên device.
+type OsqueryResult struct {
+	ID         uint   `gorm:"primaryKey"`
+	CommandID  uint   `gorm:"uniqueIndex"`
+	DeviceID   string `gorm:"size:191;index:idx_osquery_device_query"`
+	QueryHash  string `gorm:"size:64;index:idx_osquery_device_query"` // sha256 của query đã chuẩn hóa
+	Query      string `gorm:"type:text"`
+	RowsJSON   string `gorm:"type:longtext"` // JSON array, mỗi dòng đã sắp xếp key
+	RowCount   int    // tổng số dòng osquery trả về trên agent
+	StoredRows int    // số dòng thực sự nhận được (có thể ít hơn khi bị cắt)
+	Truncated  bool
+	RowsHash   string `gorm:"size:64"` // không phụ thuộc thứ tự dòng, dùng để so sánh giữa device
+	Error      string `gorm:"size:1024"`
+	DurationMs int64
+	CreatedAt  time.Time `gorm:"autoCreateTime;index"`
+}
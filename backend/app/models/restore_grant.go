@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// RestoreGrant cho phép một device tải bản backup thuộc về device khác
+// (restore chéo máy do admin khởi tạo).
+type RestoreGrant struct {
+	ID             uint   `gorm:"primaryKey"`
+	SourceDeviceID string `gorm:"size:191;index"` // device sở hữu bản backup
+	TargetDeviceID string `gorm:"size:191;index"` // device được phép tải về
+	VersionID      uint   `gorm:"index"`
+	StoredName     string `gorm:"size:255"`
+	DestPath       string `gorm:"size:1024"` // đường dẫn đích sau khi remap
+	GrantedBy      string `gorm:"size:191"`
+	ExpiresAt      time.Time
+	UsedAt         *time.Time
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
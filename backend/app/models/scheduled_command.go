@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// ScheduledCommand là command định kỳ theo biểu thức cron, nhắm tới một device
+// hoặc một DeviceGroup. Runner sinh các AgentCommand khi tới NextRunAt.
+type ScheduledCommand struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"size:128;uniqueIndex;not null"`
+	CronExpr    string `gorm:"size:128;not null"`
+	Timezone    string `gorm:"size:64"` // IANA, rỗng = giờ local của backend
+	DeviceID    string `gorm:"size:191"`
+	GroupName   string `gorm:"size:128"`
+	Command     string `gorm:"size:64;not null"`
+	Kind        string `gorm:"size:32"`
+	Payload     string `gorm:"type:longtext"`
+	TTLSec      int    // hạn của mỗi command sinh ra; 0 = mặc định
+	MaxAttempts int
+	Paused      bool       `gorm:"index"`
+	NextRunAt   *time.Time `gorm:"index"`
+	LastRunAt   *time.Time // slot cron đã chạy gần nhất
+	LastBatchID string     `gorm:"size:64"`
+	RunCount    int
+	CreatedBy   string    `gorm:"size:191"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+}
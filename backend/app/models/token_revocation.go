@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// RevokedToken là một JWT (access hoặc refresh) bị thu hồi trước hạn, theo jti.
+// Bản ghi chỉ cần giữ tới ExpiresAt của token; sau đó token tự hết hiệu lực.
+type RevokedToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	JTI       string    `gorm:"column:jti;size:64;uniqueIndex"`
+	DeviceID  string    `gorm:"size:191;index"`
+	Type      string    `gorm:"size:16"`  // access | refresh
+	Reason    string    `gorm:"size:64"`  // logout | rotated | admin | ...
+	RevokedBy string    `gorm:"size:191"` // username admin, device ID (logout) hoặc "system"
+	ExpiresAt time.Time `gorm:"index"`
+	RevokedAt time.Time
+}
+
+// DeviceRevocation thu hồi mọi token của device cấp trước RevokedBefore
+// (admin_revoke_device, phát hiện refresh token bị dùng lại).
+type DeviceRevocation struct {
+	ID            uint   `gorm:"primaryKey"`
+	DeviceID      string `gorm:"size:191;uniqueIndex"`
+	RevokedBefore time.Time
+	Reason        string `gorm:"size:255"`
+	RevokedBy     string `gorm:"size:191"`
+	UpdatedAt     time.Time
+}
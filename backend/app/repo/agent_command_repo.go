@@ -1,6 +1,9 @@
 package repo
 
 import (
+	"errors"
+	"time"
+
 	"sagiri-guard/backend/app/models"
 
 	"gorm.io/gorm"
@@ -33,11 +36,85 @@ func (r *AgentCommandRepository) MarkSent(id uint) error {
 	return r.db.Model(&models.AgentCommand{}).
 		Where("id = ?", id).
 		Updates(map[string]any{
-			"status":  "sent",
-			"sent_at": gorm.Expr("NOW()"),
+			"status":   "sent",
+			"sent_at":  gorm.Expr("NOW()"),
+			"attempts": gorm.Expr("attempts + 1"),
+		}).Error
+}
+
+// MarkAttemptFailed ghi nhận một lần gửi thất bại: status là pending (chờ retry
+// tới next) hoặc failed khi đã hết số lần thử.
+func (r *AgentCommandRepository) MarkAttemptFailed(id uint, status, lastError string, next *time.Time) error {
+	return r.db.Model(&models.AgentCommand{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"status":          status,
+			"last_error":      lastError,
+			"next_attempt_at": next,
+			"attempts":        gorm.Expr("attempts + 1"),
 		}).Error
 }
 
+// Get trả về command theo ID; nil nếu không tồn tại.
+func (r *AgentCommandRepository) Get(id uint) (*models.AgentCommand, error) {
+	var cmd models.AgentCommand
+	err := r.db.First(&cmd, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cmd, nil
+}
+
+// ListDue trả về command pending của device đã hết thời gian backoff và chưa hết hạn.
+func (r *AgentCommandRepository) ListDue(deviceID string, now time.Time) ([]models.AgentCommand, error) {
+	var cmds []models.AgentCommand
+	err := r.db.Where("device_id = ? AND status = ?", deviceID, "pending").
+		Where("next_attempt_at IS NULL OR next_attempt_at <= ?", now).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Order("id ASC").
+		Find(&cmds).Error
+	return cmds, err
+}
+
+// DueDevices trả về các device đang có command pending cần gửi lại.
+func (r *AgentCommandRepository) DueDevices(now time.Time) ([]string, error) {
+	var ids []string
+	err := r.db.Model(&models.AgentCommand{}).
+		Where("status = ?", "pending").
+		Where("next_attempt_at IS NULL OR next_attempt_at <= ?", now).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Distinct().
+		Pluck("device_id", &ids).Error
+	return ids, err
+}
+
+// ExpireDue chuyển các command pending đã quá hạn sang expired.
+func (r *AgentCommandRepository) ExpireDue(now time.Time) (int64, error) {
+	res := r.db.Model(&models.AgentCommand{}).
+		Where("status = ? AND expires_at IS NOT NULL AND expires_at <= ?", "pending", now).
+		Updates(map[string]any{"status": "expired", "last_error": "expired before delivery"})
+	return res.RowsAffected, res.Error
+}
+
+// RecordResult lưu kết quả agent báo về; command đã bị hủy giữ nguyên status.
+func (r *AgentCommandRepository) RecordResult(id uint, deviceID, status, lastError string) (bool, error) {
+	res := r.db.Model(&models.AgentCommand{}).
+		Where("id = ? AND device_id = ? AND status <> ?", id, deviceID, "cancelled").
+		Updates(map[string]any{"status": status, "last_error": lastError})
+	return res.RowsAffected == 1, res.Error
+}
+
+// Cancel chuyển command sang cancelled nếu đang ở một trong các status from.
+func (r *AgentCommandRepository) Cancel(id uint, from []string) (bool, error) {
+	res := r.db.Model(&models.AgentCommand{}).
+		Where("id = ? AND status IN ?", id, from).
+		Update("status", "cancelled")
+	return res.RowsAffected == 1, res.Error
+}
+
 // ListByDevice trả về queue command cho 1 device; nếu includeSent=false chỉ lấy pending/failed.
 func (r *AgentCommandRepository) ListByDevice(deviceID string, includeSent bool) ([]models.AgentCommand, error) {
 	q := r.db.Where("device_id = ?", deviceID)
@@ -51,4 +128,29 @@ func (r *AgentCommandRepository) ListByDevice(deviceID string, includeSent bool)
 	return cmds, nil
 }
 
+// ListByBatch trả về mọi command thuộc một batch fan-out.
+func (r *AgentCommandRepository) ListByBatch(batchID string) ([]models.AgentCommand, error) {
+	var cmds []models.AgentCommand
+	if err := r.db.Where("batch_id = ?", batchID).Order("id ASC").Find(&cmds).Error; err != nil {
+		return nil, err
+	}
+	return cmds, nil
+}
 
+// CancelPending hủy mọi command pending cùng loại của device (vd: cấu hình cũ bị thay thế).
+func (r *AgentCommandRepository) CancelPending(deviceID, command string) (int64, error) {
+	res := r.db.Model(&models.AgentCommand{}).
+		Where("device_id = ? AND command = ? AND status = ?", deviceID, command, "pending").
+		Update("status", "cancelled")
+	return res.RowsAffected, res.Error
+}
+
+// HasPending cho biết device còn command cùng loại đang chờ gửi hay không.
+func (r *AgentCommandRepository) HasPending(deviceID, command string, now time.Time) (bool, error) {
+	var n int64
+	err := r.db.Model(&models.AgentCommand{}).
+		Where("device_id = ? AND command = ? AND status = ?", deviceID, command, "pending").
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Count(&n).Error
+	return n > 0, err
+}
@@ -0,0 +1,27 @@
+package repo
+
+import (
+	"sagiri-guard/backend/app/models"
+
+	"gorm.io/gorm"
+)
+
+type AuditLogRepository struct{ db *gorm.DB }
+
+func NewAuditLogRepository(db *gorm.DB) *AuditLogRepository { return &AuditLogRepository{db: db} }
+
+func (r *AuditLogRepository) Create(l *models.AuditLog) error { return r.db.Create(l).Error }
+
+// LatestByDevice trả về các entry audit mới nhất của device (deviceID rỗng = tất cả).
+func (r *AuditLogRepository) LatestByDevice(deviceID string, limit int) ([]models.AuditLog, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	q := r.db.Order("id DESC").Limit(limit)
+	if deviceID != "" {
+		q = q.Where("device_id = ?", deviceID)
+	}
+	var logs []models.AuditLog
+	err := q.Find(&logs).Error
+	return logs, err
+}
@@ -0,0 +1,35 @@
+package repo
+
+import (
+	"errors"
+
+	"sagiri-guard/backend/app/models"
+
+	"gorm.io/gorm"
+)
+
+type BackupHoldRepository struct {
+	db *gorm.DB
+}
+
+func NewBackupHoldRepository(db *gorm.DB) *BackupHoldRepository {
+	return &BackupHoldRepository{db: db}
+}
+
+// Get trả về cấu hình hold của device; nil nếu device chưa có hold.
+func (r *BackupHoldRepository) Get(deviceID string) (*models.BackupHold, error) {
+	var h models.BackupHold
+	err := r.db.Where("device_id = ?", deviceID).First(&h).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Save tạo mới hoặc cập nhật hold (theo ID).
+func (r *BackupHoldRepository) Save(h *models.BackupHold) error {
+	return r.db.Save(h).Error
+}
@@ -3,6 +3,7 @@ package repo
 import (
 	"database/sql"
 	"errors"
+	"time"
 
 	"sagiri-guard/backend/app/models"
 
@@ -111,4 +112,82 @@ func (r *BackupVersionRepository) GetLatestByFileID(deviceID, fileID string) (*m
 	return &v, nil
 }
 
+// FindByStoredName trả về version ứng với blob <device>/<stored_name>; nil nếu chưa có.
+func (r *BackupVersionRepository) FindByStoredName(deviceID, storedName string) (*models.BackupFileVersion, error) {
+	var v models.BackupFileVersion
+	err := r.db.
+		Where("device_id = ? AND stored_name = ?", deviceID, storedName).
+		First(&v).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// VersionExists kiểm tra cặp (device, logical_path, version) đã được dùng chưa.
+func (r *BackupVersionRepository) VersionExists(deviceID, logicalPath string, version int) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.BackupFileVersion{}).
+		Where("device_id = ? AND logical_path = ? AND version = ?", deviceID, logicalPath, version).
+		Count(&count).Error
+	return count > 0, err
+}
 
+// EachBatch duyệt toàn bộ BackupFileVersion theo lô để không nạp hết vào bộ nhớ.
+func (r *BackupVersionRepository) EachBatch(size int, fn func([]models.BackupFileVersion) error) error {
+	var batch []models.BackupFileVersion
+	return r.db.FindInBatches(&batch, size, func(tx *gorm.DB, _ int) error {
+		return fn(batch)
+	}).Error
+}
+
+// UpdateChecksum lưu SHA-256 cho version (dùng khi scrub gặp row cũ chưa có checksum).
+func (r *BackupVersionRepository) UpdateChecksum(id uint, sum string) error {
+	return r.db.Model(&models.BackupFileVersion{}).
+		Where("id = ?", id).
+		Update("sha256", sum).Error
+}
+
+// ListByDevice trả về mọi version của device (dùng cho purge/áp hold hàng loạt).
+func (r *BackupVersionRepository) ListByDevice(deviceID string) ([]models.BackupFileVersion, error) {
+	var out []models.BackupFileVersion
+	err := r.db.
+		Where("device_id = ?", deviceID).
+		Order("id ASC").
+		Find(&out).Error
+	return out, err
+}
+
+// SetHold cập nhật legal hold và retain_until của một version.
+func (r *BackupVersionRepository) SetHold(id uint, legalHold bool, retainUntil *time.Time) error {
+	return r.db.Model(&models.BackupFileVersion{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"legal_hold": legalHold, "retain_until": retainUntil}).Error
+}
+
+// Delete xóa row version. Chỉ gọi sau khi service đã kiểm tra hold/retention.
+func (r *BackupVersionRepository) Delete(id uint) error {
+	return r.db.Delete(&models.BackupFileVersion{}, id).Error
+}
+
+// CreateBatch tạo nhiều version trong một transaction; Version được cấp tuần tự
+// theo (device, logical_path) ngay trong transaction nên các file trùng path vẫn đúng thứ tự.
+func (r *BackupVersionRepository) CreateBatch(vs []*models.BackupFileVersion) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		txRepo := &BackupVersionRepository{db: tx}
+		for _, v := range vs {
+			next, err := txRepo.NextVersion(v.DeviceID, v.LogicalPath)
+			if err != nil {
+				return err
+			}
+			v.Version = next
+			if err := tx.Create(v).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"errors"
+
+	"sagiri-guard/backend/app/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DeviceGroupRepository struct {
+	db *gorm.DB
+}
+
+func NewDeviceGroupRepository(db *gorm.DB) *DeviceGroupRepository {
+	return &DeviceGroupRepository{db: db}
+}
+
+// GetByName trả về group theo tên; nil nếu không tồn tại.
+func (r *DeviceGroupRepository) GetByName(name string) (*models.DeviceGroup, error) {
+	var g models.DeviceGroup
+	err := r.db.Where("name = ?", name).First(&g).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (r *DeviceGroupRepository) Save(g *models.DeviceGroup) error {
+	return r.db.Save(g).Error
+}
+
+func (r *DeviceGroupRepository) List() ([]models.DeviceGroup, error) {
+	var out []models.DeviceGroup
+	err := r.db.Order("name ASC").Find(&out).Error
+	return out, err
+}
+
+// Delete xóa group cùng toàn bộ thành viên tĩnh.
+func (r *DeviceGroupRepository) Delete(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", id).Delete(&models.DeviceGroupMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.DeviceGroup{}, id).Error
+	})
+}
+
+// AddMembers thêm thành viên tĩnh; device đã có trong group được bỏ qua.
+func (r *DeviceGroupRepository) AddMembers(groupID uint, deviceIDs []string) error {
+	if len(deviceIDs) == 0 {
+		return nil
+	}
+	rows := make([]models.DeviceGroupMember, 0, len(deviceIDs))
+	for _, id := range deviceIDs {
+		rows = append(rows, models.DeviceGroupMember{GroupID: groupID, DeviceID: id})
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+}
+
+func (r *DeviceGroupRepository) RemoveMembers(groupID uint, deviceIDs []string) error {
+	if len(deviceIDs) == 0 {
+		return nil
+	}
+	return r.db.Where("group_id = ? AND device_id IN ?", groupID, deviceIDs).
+		Delete(&models.DeviceGroupMember{}).Error
+}
+
+// ListMembers trả về device ID của các thành viên tĩnh.
+func (r *DeviceGroupRepository) ListMembers(groupID uint) ([]string, error) {
+	var ids []string
+	err := r.db.Model(&models.DeviceGroupMember{}).
+		Where("group_id = ?", groupID).
+		Order("device_id ASC").
+		Pluck("device_id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"errors"
+	"time"
+
+	"sagiri-guard/backend/app/models"
+
+	"gorm.io/gorm"
+)
+
+type DeviceIdentityRepository struct {
+	db *gorm.DB
+}
+
+func NewDeviceIdentityRepository(db *gorm.DB) *DeviceIdentityRepository {
+	return &DeviceIdentityRepository{db: db}
+}
+
+func (r *DeviceIdentityRepository) FindByDevice(deviceID string) (*models.DeviceIdentity, error) {
+	var out models.DeviceIdentity
+	if err := r.db.Where("device_id = ?", deviceID).First(&out).Error; err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (r *DeviceIdentityRepository) Create(id *models.DeviceIdentity) error {
+	return r.db.Create(id).Error
+}
+
+// ClearKey gỡ key và fingerprint nhưng giữ bản ghi (và lịch sử cảnh báo) của device.
+func (r *DeviceIdentityRepository) ClearKey(deviceID string) (int64, error) {
+	res := r.db.Model(&models.DeviceIdentity{}).Where("device_id = ?", deviceID).
+		Updates(map[string]any{"public_key": "", "fingerprint": "", "last_verified_at": nil})
+	return res.RowsAffected, res.Error
+}
+
+// Bind gắn key cho bản ghi đã bị ClearKey; chỉ cập nhật khi chưa có key để hai
+// kết nối đồng thời không ghi đè key của nhau.
+func (r *DeviceIdentityRepository) Bind(deviceID, publicKey, fingerprint, actor string, at time.Time) error {
+	res := r.db.Model(&models.DeviceIdentity{}).Where("device_id = ? AND public_key = ?", deviceID, "").
+		Updates(map[string]any{"public_key": publicKey, "fingerprint": fingerprint, "enrolled_by": actor, "enrolled_at": at})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("device identity was bound concurrently")
+	}
+	return nil
+}
+
+// TouchVerified ghi thời điểm device chứng minh danh tính thành công gần nhất.
+func (r *DeviceIdentityRepository) TouchVerified(deviceID string, at time.Time) error {
+	return r.db.Model(&models.DeviceIdentity{}).Where("device_id = ?", deviceID).
+		Update("last_verified_at", at).Error
+}
+
+// AddAlert tăng bộ đếm cảnh báo clone và lưu lý do mới nhất.
+func (r *DeviceIdentityRepository) AddAlert(deviceID, reason string, at time.Time) error {
+	return r.db.Model(&models.DeviceIdentity{}).Where("device_id = ?", deviceID).
+		Updates(map[string]any{
+			"clone_alerts":  gorm.Expr("clone_alerts + 1"),
+			"last_alert_at": at,
+			"last_alert":    reason,
+		}).Error
+}
+
+// List trả về identity theo DeviceID; alertsOnly chỉ giữ device có cảnh báo,
+// mới nhất trước.
+func (r *DeviceIdentityRepository) List(alertsOnly bool, offset, limit int) ([]models.DeviceIdentity, error) {
+	q := r.db.Model(&models.DeviceIdentity{})
+	if alertsOnly {
+		q = q.Where("clone_alerts > 0").Order("last_alert_at DESC")
+	} else {
+		q = q.Order("device_id ASC")
+	}
+	var out []models.DeviceIdentity
+	err := q.Offset(offset).Limit(limit).Find(&out).Error
+	return out, err
+}
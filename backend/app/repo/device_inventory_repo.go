@@ -0,0 +1,100 @@
+package repo
+
+import (
+	"errors"
+	"time"
+
+	"sagiri-guard/backend/app/models"
+
+	"gorm.io/gorm"
+)
+
+type DeviceInventoryRepository struct {
+	db *gorm.DB
+}
+
+func NewDeviceInventoryRepository(db *gorm.DB) *DeviceInventoryRepository {
+	return &DeviceInventoryRepository{db: db}
+}
+
+// Latest trả về snapshot mới nhất của device; nil nếu chưa có.
+func (r *DeviceInventoryRepository) Latest(deviceID string) (*models.DeviceInventory, error) {
+	var inv models.DeviceInventory
+	err := r.db.Where("device_id = ?", deviceID).Order("id DESC").First(&inv).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// Get trả về snapshot theo ID của device; nil nếu không tồn tại.
+func (r *DeviceInventoryRepository) Get(deviceID string, id uint) (*models.DeviceInventory, error) {
+	var inv models.DeviceInventory
+	err := r.db.Where("id = ? AND device_id = ?", id, deviceID).First(&inv).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// CreateSnapshot lưu snapshot mới cùng các thay đổi so với snapshot trước trong một transaction.
+func (r *DeviceInventoryRepository) CreateSnapshot(inv *models.DeviceInventory, changes []models.InventoryChange) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(inv).Error; err != nil {
+			return err
+		}
+		for i := range changes {
+			changes[i].SnapshotID = inv.ID
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(changes, 200).Error
+	})
+}
+
+// Touch cập nhật LastSeenAt khi agent báo lại inventory không đổi.
+func (r *DeviceInventoryRepository) Touch(id uint, at time.Time) error {
+	return r.db.Model(&models.DeviceInventory{}).Where("id = ?", id).Update("last_seen_at", at).Error
+}
+
+// ListSnapshots trả về các snapshot của device (mới nhất trước), không kèm data_json.
+func (r *DeviceInventoryRepository) ListSnapshots(deviceID string, offset, limit int) ([]models.DeviceInventory, error) {
+	var out []models.DeviceInventory
+	err := r.db.Omit("data_json").
+		Where("device_id = ?", deviceID).
+		Order("id DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&out).Error
+	return out, err
+}
+
+// InventoryChangeFilter lọc lịch sử thay đổi; trường rỗng/0 = không lọc.
+type InventoryChangeFilter struct {
+	DeviceID string
+	Category string
+	Since    time.Time
+	Offset   int
+	Limit    int
+}
+
+// Changes trả về các thay đổi của device, mới nhất trước.
+func (r *DeviceInventoryRepository) Changes(f InventoryChangeFilter) ([]models.InventoryChange, error) {
+	q := r.db.Where("device_id = ?", f.DeviceID)
+	if f.Category != "" {
+		q = q.Where("category = ?", f.Category)
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("detected_at >= ?", f.Since)
+	}
+	var out []models.InventoryChange
+	err := q.Order("detected_at DESC").Order("id DESC").Offset(f.Offset).Limit(f.Limit).Find(&out).Error
+	return out, err
+}
@@ -1,6 +1,8 @@
 package repo
 
 import (
+	"time"
+
 	"sagiri-guard/backend/app/models"
 
 	"gorm.io/gorm"
@@ -42,3 +44,12 @@ func (r *DeviceRepository) Upsert(d *models.Device) error {
 	}
 	return r.db.Create(d).Error
 }
+
+// TouchSeen cập nhật LastSeenAt (và LastIP nếu có) mà không đổi UpdatedAt.
+func (r *DeviceRepository) TouchSeen(uuid string, at time.Time, ip string) error {
+	updates := map[string]any{"last_seen_at": at}
+	if ip != "" {
+		updates["last_ip"] = ip
+	}
+	return r.db.Model(&models.Device{}).Where("uuid = ?", uuid).UpdateColumns(updates).Error
+}
@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"time"
+
+	"sagiri-guard/backend/app/models"
+
+	"gorm.io/gorm"
+)
+
+type DeviceSessionRepository struct {
+	db *gorm.DB
+}
+
+func NewDeviceSessionRepository(db *gorm.DB) *DeviceSessionRepository {
+	return &DeviceSessionRepository{db: db}
+}
+
+func (r *DeviceSessionRepository) Create(s *models.DeviceSession) error {
+	return r.db.Create(s).Error
+}
+
+// Close đóng session còn mở; session đã đóng giữ nguyên.
+func (r *DeviceSessionRepository) Close(id uint, at time.Time, reason string) error {
+	return r.db.Model(&models.DeviceSession{}).
+		Where("id = ? AND disconnected_at IS NULL", id).
+		Updates(map[string]any{"disconnected_at": at, "close_reason": reason}).Error
+}
+
+// Open trả về mọi session chưa đóng.
+func (r *DeviceSessionRepository) Open() ([]models.DeviceSession, error) {
+	var out []models.DeviceSession
+	err := r.db.Where("disconnected_at IS NULL").Find(&out).Error
+	return out, err
+}
+
+// Overlapping trả về các session giao với [from, to); deviceID rỗng = mọi device.
+func (r *DeviceSessionRepository) Overlapping(deviceID string, from, to time.Time) ([]models.DeviceSession, error) {
+	q := r.db.Where("connected_at < ?", to).
+		Where("disconnected_at IS NULL OR disconnected_at > ?", from)
+	if deviceID != "" {
+		q = q.Where("device_id = ?", deviceID)
+	}
+	var out []models.DeviceSession
+	err := q.Order("connected_at ASC").Find(&out).Error
+	return out, err
+}
+
+// Recent trả về các session mới nhất của device.
+func (r *DeviceSessionRepository) Recent(deviceID string, offset, limit int) ([]models.DeviceSession, error) {
+	var out []models.DeviceSession
+	err := r.db.Where("device_id = ?", deviceID).
+		Order("connected_at DESC").Order("id DESC").
+		Offset(offset).Limit(limit).
+		Find(&out).Error
+	return out, err
+}
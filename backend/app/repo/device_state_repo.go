@@ -0,0 +1,42 @@
+package repo
+
+import (
+	"errors"
+
+	"sagiri-guard/backend/app/models"
+
+	"gorm.io/gorm"
+)
+
+type DeviceStateRepository struct {
+	db *gorm.DB
+}
+
+func NewDeviceStateRepository(db *gorm.DB) *DeviceStateRepository {
+	return &DeviceStateRepository{db: db}
+}
+
+// Get trả về state của device; nil nếu chưa có.
+func (r *DeviceStateRepository) Get(deviceID string) (*models.DeviceState, error) {
+	var st models.DeviceState
+	err := r.db.Where("device_id = ?", deviceID).First(&st).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// Save tạo mới hoặc cập nhật state (theo ID).
+func (r *DeviceStateRepository) Save(st *models.DeviceState) error {
+	return r.db.Save(st).Error
+}
+
+// ListAll trả về state của mọi device (dùng cho admin_list_devices).
+func (r *DeviceStateRepository) ListAll() ([]models.DeviceState, error) {
+	var out []models.DeviceState
+	err := r.db.Find(&out).Error
+	return out, err
+}
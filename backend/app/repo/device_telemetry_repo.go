@@ -0,0 +1,41 @@
+package repo
+
+import (
+	"time"
+
+	"sagiri-guard/backend/app/models"
+
+	"gorm.io/gorm"
+)
+
+type DeviceTelemetryRepository struct {
+	db *gorm.DB
+}
+
+func NewDeviceTelemetryRepository(db *gorm.DB) *DeviceTelemetryRepository {
+	return &DeviceTelemetryRepository{db: db}
+}
+
+func (r *DeviceTelemetryRepository) Create(t *models.DeviceTelemetry) error {
+	return r.db.Create(t).Error
+}
+
+// PruneBefore xóa các mẫu của device cũ hơn before.
+func (r *DeviceTelemetryRepository) PruneBefore(deviceID string, before time.Time) error {
+	return r.db.Where("device_id = ? AND reported_at < ?", deviceID, before).Delete(&models.DeviceTelemetry{}).Error
+}
+
+// Recent trả về các mẫu mới nhất của device, mới nhất trước.
+func (r *DeviceTelemetryRepository) Recent(deviceID string, limit int) ([]models.DeviceTelemetry, error) {
+	var out []models.DeviceTelemetry
+	err := r.db.Where("device_id = ?", deviceID).Order("reported_at DESC").Order("id DESC").Limit(limit).Find(&out).Error
+	return out, err
+}
+
+// LatestAll trả về mẫu mới nhất của mỗi device.
+func (r *DeviceTelemetryRepository) LatestAll() ([]models.DeviceTelemetry, error) {
+	var out []models.DeviceTelemetry
+	latest := r.db.Model(&models.DeviceTelemetry{}).Select("MAX(id)").Group("device_id")
+	err := r.db.Where("id IN (?)", latest).Find(&out).Error
+	return out, err
+}
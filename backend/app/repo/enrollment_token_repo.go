@@ -0,0 +1,98 @@
+package repo
+
+import (
+	"time"
+
+	"sagiri-guard/backend/app/models"
+
+	"gorm.io/gorm"
+)
+
+type EnrollmentTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewEnrollmentTokenRepository(db *gorm.DB) *EnrollmentTokenRepository {
+	return &EnrollmentTokenRepository{db: db}
+}
+
+func (r *EnrollmentTokenRepository) Create(t *models.EnrollmentToken) error {
+	return r.db.Create(t).Error
+}
+
+func (r *EnrollmentTokenRepository) FindByHash(hash string) (*models.EnrollmentToken, error) {
+	var out models.EnrollmentToken
+	if err := r.db.Where("token_hash = ?", hash).First(&out).Error; err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (r *EnrollmentTokenRepository) FindByID(id uint) (*models.EnrollmentToken, error) {
+	var out models.EnrollmentToken
+	if err := r.db.First(&out, id).Error; err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Consume tăng số lần dùng nếu token còn hiệu lực tại thời điểm now; trả về
+// false khi token đã thu hồi, hết hạn hoặc hết lượt (kiểm tra trong cùng câu
+// UPDATE để hai agent enroll đồng thời không vượt MaxUses).
+func (r *EnrollmentTokenRepository) Consume(id uint, now time.Time) (bool, error) {
+	res := r.db.Model(&models.EnrollmentToken{}).
+		Where("id = ? AND revoked = ? AND expires_at > ?", id, false, now).
+		Where("max_uses = 0 OR uses < max_uses").
+		Updates(map[string]any{"uses": gorm.Expr("uses + 1"), "last_used_at": now})
+	return res.RowsAffected == 1, res.Error
+}
+
+// Unconsume trả lại một lượt dùng đã tiêu bằng Consume.
+func (r *EnrollmentTokenRepository) Unconsume(id uint) error {
+	return r.db.Model(&models.EnrollmentToken{}).
+		Where("id = ? AND uses > 0", id).
+		Update("uses", gorm.Expr("uses - 1")).Error
+}
+
+func (r *EnrollmentTokenRepository) Revoke(id uint) (int64, error) {
+	res := r.db.Model(&models.EnrollmentToken{}).Where("id = ?", id).Update("revoked", true)
+	return res.RowsAffected, res.Error
+}
+
+// List trả về token mới nhất trước; activeOnly bỏ token đã thu hồi/hết hạn.
+func (r *EnrollmentTokenRepository) List(activeOnly bool, now time.Time, offset, limit int) ([]models.EnrollmentToken, error) {
+	q := r.db.Model(&models.EnrollmentToken{})
+	if activeOnly {
+		q = q.Where("revoked = ? AND expires_at > ?", false, now).
+			Where("max_uses = 0 OR uses < max_uses")
+	}
+	var out []models.EnrollmentToken
+	err := q.Order("id DESC").Offset(offset).Limit(limit).Find(&out).Error
+	return out, err
+}
+
+func (r *EnrollmentTokenRepository) FindEnrollment(tokenID uint, deviceID string) (*models.DeviceEnrollment, error) {
+	var out models.DeviceEnrollment
+	if err := r.db.Where("token_id = ? AND device_id = ?", tokenID, deviceID).First(&out).Error; err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (r *EnrollmentTokenRepository) AddEnrollment(e *models.DeviceEnrollment) error {
+	return r.db.Create(e).Error
+}
+
+func (r *EnrollmentTokenRepository) DeleteEnrollment(tokenID uint, deviceID string) error {
+	return r.db.Where("token_id = ? AND device_id = ?", tokenID, deviceID).Delete(&models.DeviceEnrollment{}).Error
+}
+
+// Enrollments trả về các device đã enroll bằng token, mới nhất trước.
+func (r *EnrollmentTokenRepository) Enrollments(tokenID uint, offset, limit int) ([]models.DeviceEnrollment, error) {
+	var out []models.DeviceEnrollment
+	err := r.db.Where("token_id = ?", tokenID).
+		Order("enrolled_at DESC").Order("id DESC").
+		Offset(offset).Limit(limit).
+		Find(&out).Error
+	return out, err
+}
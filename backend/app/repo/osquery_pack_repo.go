@@ -0,0 +1,148 @@
+package repo
+
+import (
+	"errors"
+	"time"
+
+	"sagiri-guard/backend/app/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OsqueryPackRepository struct {
+	db *gorm.DB
+}
+
+func NewOsqueryPackRepository(db *gorm.DB) *OsqueryPackRepository {
+	return &OsqueryPackRepository{db: db}
+}
+
+// GetByName trả về pack theo tên; nil nếu không tồn tại.
+func (r *OsqueryPackRepository) GetByName(name string) (*models.OsqueryPack, error) {
+	var p models.OsqueryPack
+	err := r.db.Where("name = ?", name).First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Save lưu pack và thay toàn bộ query của pack trong một transaction.
+func (r *OsqueryPackRepository) Save(p *models.OsqueryPack, queries []models.OsqueryPackQuery) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(p).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("pack_id = ?", p.ID).Delete(&models.OsqueryPackQuery{}).Error; err != nil {
+			return err
+		}
+		if len(queries) == 0 {
+			return nil
+		}
+		for i := range queries {
+			queries[i].ID = 0
+			queries[i].PackID = p.ID
+		}
+		return tx.Create(&queries).Error
+	})
+}
+
+// Delete xóa pack cùng query và target; lịch sử diff được giữ lại.
+func (r *OsqueryPackRepository) Delete(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("pack_id = ?", id).Delete(&models.OsqueryPackQuery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("pack_id = ?", id).Delete(&models.OsqueryPackTarget{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.OsqueryPack{}, id).Error
+	})
+}
+
+func (r *OsqueryPackRepository) List() ([]models.OsqueryPack, error) {
+	var out []models.OsqueryPack
+	err := r.db.Order("name ASC").Find(&out).Error
+	return out, err
+}
+
+// Queries trả về query của các pack, sắp theo pack rồi tên.
+func (r *OsqueryPackRepository) Queries(packIDs []uint) ([]models.OsqueryPackQuery, error) {
+	var out []models.OsqueryPackQuery
+	if len(packIDs) == 0 {
+		return out, nil
+	}
+	err := r.db.Where("pack_id IN ?", packIDs).Order("pack_id ASC, name ASC").Find(&out).Error
+	return out, err
+}
+
+// AddTargets giao pack cho device/group; target đã có được bỏ qua.
+func (r *OsqueryPackRepository) AddTargets(targets []models.OsqueryPackTarget) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&targets).Error
+}
+
+func (r *OsqueryPackRepository) RemoveTarget(t models.OsqueryPackTarget) error {
+	return r.db.Where("pack_id = ? AND device_id = ? AND group_name = ?", t.PackID, t.DeviceID, t.GroupName).
+		Delete(&models.OsqueryPackTarget{}).Error
+}
+
+// Targets trả về mọi target; packID = 0 lấy của tất cả pack.
+func (r *OsqueryPackRepository) Targets(packID uint) ([]models.OsqueryPackTarget, error) {
+	var out []models.OsqueryPackTarget
+	q := r.db.Order("id ASC")
+	if packID != 0 {
+		q = q.Where("pack_id = ?", packID)
+	}
+	err := q.Find(&out).Error
+	return out, err
+}
+
+// InsertDiffRows ghi một lô dòng diff vào bảng lịch sử.
+func (r *OsqueryPackRepository) InsertDiffRows(rows []models.OsqueryDiffRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	return r.db.CreateInBatches(&rows, 200).Error
+}
+
+// DiffHistoryFilter lọc lịch sử diff; trường rỗng/0 = không lọc.
+type DiffHistoryFilter struct {
+	DeviceID  string
+	Pack      string
+	QueryName string
+	Action    string
+	Since     time.Time
+	Until     time.Time
+	Offset    int
+	Limit     int
+}
+
+// DiffHistory trả về các dòng diff mới nhất trước, theo bộ lọc.
+func (r *OsqueryPackRepository) DiffHistory(f DiffHistoryFilter) ([]models.OsqueryDiffRow, error) {
+	q := r.db.Where("device_id = ?", f.DeviceID)
+	if f.Pack != "" {
+		q = q.Where("pack = ?", f.Pack)
+	}
+	if f.QueryName != "" {
+		q = q.Where("query_name = ?", f.QueryName)
+	}
+	if f.Action != "" {
+		q = q.Where("action = ?", f.Action)
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("collected_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("collected_at < ?", f.Until)
+	}
+	var out []models.OsqueryDiffRow
+	err := q.Order("collected_at DESC, id DESC").Offset(f.Offset).Limit(f.Limit).Find(&out).Error
+	return out, err
+}
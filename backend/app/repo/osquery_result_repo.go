@@ -0,0 +1,62 @@
+package repo
+
+import (
+	"errors"
+
+	"sagiri-guard/backend/app/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OsqueryResultRepository struct {
+	db *gorm.DB
+}
+
+func NewOsqueryResultRepository(db *gorm.DB) *OsqueryResultRepository {
+	return &OsqueryResultRepository{db: db}
+}
+
+// Create lưu kết quả; kết quả của cùng command gửi lại lần hai bị bỏ qua.
+func (r *OsqueryResultRepository) Create(res *models.OsqueryResult) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(res).Error
+}
+
+// Get trả về kết quả theo ID; nil nếu không tồn tại.
+func (r *OsqueryResultRepository) Get(id uint) (*models.OsqueryResult, error) {
+	var res models.OsqueryResult
+	err := r.db.First(&res, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ListByDevice trả về các kết quả mới nhất của device, không kèm cột rows_json.
+func (r *OsqueryResultRepository) ListByDevice(deviceID string, limit int) ([]models.OsqueryResult, error) {
+	var out []models.OsqueryResult
+	err := r.db.Omit("rows_json").
+		Where("device_id = ?", deviceID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&out).Error
+	return out, err
+}
+
+// Latest trả về kết quả mới nhất của device cho một query; nil nếu chưa chạy.
+func (r *OsqueryResultRepository) Latest(deviceID, queryHash string) (*models.OsqueryResult, error) {
+	var res models.OsqueryResult
+	err := r.db.Where("device_id = ? AND query_hash = ?", deviceID, queryHash).
+		Order("id DESC").
+		First(&res).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
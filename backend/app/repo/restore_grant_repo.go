@@ -0,0 +1,44 @@
+package repo
+
+import (
+	"errors"
+	"time"
+
+	"sagiri-guard/backend/app/models"
+
+	"gorm.io/gorm"
+)
+
+type RestoreGrantRepository struct {
+	db *gorm.DB
+}
+
+func NewRestoreGrantRepository(db *gorm.DB) *RestoreGrantRepository {
+	return &RestoreGrantRepository{db: db}
+}
+
+func (r *RestoreGrantRepository) Create(g *models.RestoreGrant) error {
+	return r.db.Create(g).Error
+}
+
+// GetByID trả về grant theo ID; nil nếu không tồn tại.
+func (r *RestoreGrantRepository) GetByID(id uint) (*models.RestoreGrant, error) {
+	var g models.RestoreGrant
+	err := r.db.Where("id = ?", id).First(&g).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// MarkUsed đánh dấu grant đã dùng; trả về false nếu grant đã được dùng trước
+// đó (hai lần tải đồng thời chỉ một lần thành công).
+func (r *RestoreGrantRepository) MarkUsed(id uint, at time.Time) (bool, error) {
+	res := r.db.Model(&models.RestoreGrant{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", at)
+	return res.RowsAffected > 0, res.Error
+}
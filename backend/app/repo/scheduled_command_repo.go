@@ -0,0 +1,87 @@
+package repo
+
+import (
+	"errors"
+	"time"
+
+	"sagiri-guard/backend/app/models"
+
+	"gorm.io/gorm"
+)
+
+type ScheduledCommandRepository struct {
+	db *gorm.DB
+}
+
+func NewScheduledCommandRepository(db *gorm.DB) *ScheduledCommandRepository {
+	return &ScheduledCommandRepository{db: db}
+}
+
+func (r *ScheduledCommandRepository) Create(s *models.ScheduledCommand) error {
+	return r.db.Create(s).Error
+}
+
+// Get trả về schedule theo ID; nil nếu không tồn tại.
+func (r *ScheduledCommandRepository) Get(id uint) (*models.ScheduledCommand, error) {
+	var s models.ScheduledCommand
+	err := r.db.First(&s, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetByName trả về schedule theo tên; nil nếu không tồn tại.
+func (r *ScheduledCommandRepository) GetByName(name string) (*models.ScheduledCommand, error) {
+	var s models.ScheduledCommand
+	err := r.db.Where("name = ?", name).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *ScheduledCommandRepository) List() ([]models.ScheduledCommand, error) {
+	var out []models.ScheduledCommand
+	err := r.db.Order("id ASC").Find(&out).Error
+	return out, err
+}
+
+// SetPaused tạm dừng/tiếp tục schedule; next là lần chạy kế tiếp khi tiếp tục.
+func (r *ScheduledCommandRepository) SetPaused(id uint, paused bool, next *time.Time) error {
+	return r.db.Model(&models.ScheduledCommand{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"paused": paused, "next_run_at": next}).Error
+}
+
+// Due trả về các schedule đang chạy đã tới giờ.
+func (r *ScheduledCommandRepository) Due(now time.Time) ([]models.ScheduledCommand, error) {
+	var out []models.ScheduledCommand
+	err := r.db.Where("paused = ? AND next_run_at IS NOT NULL AND next_run_at <= ?", false, now).
+		Order("next_run_at ASC").
+		Find(&out).Error
+	return out, err
+}
+
+// Claim chuyển schedule sang lần chạy kế tiếp, chỉ khi next_run_at vẫn là slot
+// đã đọc. Trả về false nếu runner khác (hoặc thao tác pause) đã xử lý trước.
+func (r *ScheduledCommandRepository) Claim(id uint, slot time.Time, next *time.Time, batchID string) (bool, error) {
+	res := r.db.Model(&models.ScheduledCommand{}).
+		Where("id = ? AND paused = ? AND next_run_at = ?", id, false, slot).
+		Updates(map[string]any{
+			"next_run_at":   next,
+			"last_run_at":   slot,
+			"last_batch_id": batchID,
+			"run_count":     gorm.Expr("run_count + 1"),
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
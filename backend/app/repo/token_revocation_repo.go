@@ -0,0 +1,52 @@
+package repo
+
+import (
+	"time"
+
+	"sagiri-guard/backend/app/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TokenRevocationRepository struct {
+	db *gorm.DB
+}
+
+func NewTokenRevocationRepository(db *gorm.DB) *TokenRevocationRepository {
+	return &TokenRevocationRepository{db: db}
+}
+
+// RevokeToken ghi jti vào danh sách thu hồi; jti đã có thì giữ bản ghi cũ và
+// trả về false (dùng để phát hiện refresh token bị dùng hai lần).
+func (r *TokenRevocationRepository) RevokeToken(t *models.RevokedToken) (bool, error) {
+	res := r.db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "jti"}}, DoNothing: true}).Create(t)
+	return res.RowsAffected > 0, res.Error
+}
+
+// ActiveTokens trả về các jti bị thu hồi mà token gốc chưa hết hạn.
+func (r *TokenRevocationRepository) ActiveTokens(now time.Time) ([]models.RevokedToken, error) {
+	var out []models.RevokedToken
+	err := r.db.Where("expires_at > ?", now).Find(&out).Error
+	return out, err
+}
+
+// PruneTokens xóa bản ghi của token đã hết hạn.
+func (r *TokenRevocationRepository) PruneTokens(now time.Time) (int64, error) {
+	res := r.db.Where("expires_at <= ?", now).Delete(&models.RevokedToken{})
+	return res.RowsAffected, res.Error
+}
+
+// SetDeviceCutoff đặt (hoặc dời) mốc thu hồi token của device.
+func (r *TokenRevocationRepository) SetDeviceCutoff(d *models.DeviceRevocation) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"revoked_before", "reason", "revoked_by", "updated_at"}),
+	}).Create(d).Error
+}
+
+func (r *TokenRevocationRepository) DeviceCutoffs() ([]models.DeviceRevocation, error) {
+	var out []models.DeviceRevocation
+	err := r.db.Find(&out).Error
+	return out, err
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+	"sagiri-guard/backend/global"
+)
+
+type AuditService struct{ repo *repo.AuditLogRepository }
+
+func NewAuditService(r *repo.AuditLogRepository) *AuditService {
+	return &AuditService{repo: r}
+}
+
+// Record ghi một entry audit; lỗi ghi chỉ được log để không chặn thao tác chính.
+func (s *AuditService) Record(actor, action, deviceID, target, detail string) {
+	if s == nil || s.repo == nil {
+		return
+	}
+	l := models.AuditLog{Actor: actor, Action: action, DeviceID: deviceID, Target: target, Detail: detail}
+	if err := s.repo.Create(&l); err != nil {
+		global.Logger.Error().Err(err).Str("action", action).Str("device", deviceID).Msg("write audit log failed")
+	}
+}
+
+func (s *AuditService) Latest(deviceID string, limit int) ([]models.AuditLog, error) {
+	return s.repo.LatestByDevice(deviceID, limit)
+}
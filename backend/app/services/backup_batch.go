@@ -0,0 +1,295 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/global"
+)
+
+// maxBatchFiles giới hạn số file mỗi batch để manifest và ACK finalize vừa một frame.
+const maxBatchFiles = 500
+
+// BackupBatch gom nhiều file upload: một init, một kết nối transfer, một finalize.
+type BackupBatch struct {
+	ID        string
+	Token     string
+	DeviceID  string
+	Files     []*BackupSession
+	CreatedAt time.Time
+}
+
+// BatchFileSessionID trả về session ID của file thứ idx trong batch.
+func BatchFileSessionID(batchID string, idx int) string {
+	return fmt.Sprintf("%s.%d", batchID, idx)
+}
+
+// PrepareBatchUpload tạo session cho từng file trong manifest. Chưa tạo
+// BackupFileVersion nào cho tới khi FinalizeBatch.
+func (s *BackupService) PrepareBatchUpload(deviceID string, req dto.BackupBatchInitRequest) (*dto.BackupBatchSessionResponse, error) {
+	if deviceID == "" {
+		return nil, errors.New("missing device id")
+	}
+	if len(req.Files) == 0 {
+		return nil, errors.New("empty batch")
+	}
+	if len(req.Files) > maxBatchFiles {
+		return nil, fmt.Errorf("batch too large: %d files (max %d)", len(req.Files), maxBatchFiles)
+	}
+	deviceDir := filepath.Join(s.storageDir, deviceID)
+	if err := os.MkdirAll(deviceDir, 0o755); err != nil {
+		return nil, fmt.Errorf("mkdir device dir: %w", err)
+	}
+
+	now := time.Now()
+	batch := &BackupBatch{
+		ID:        newID("batch"),
+		Token:     newToken(),
+		DeviceID:  deviceID,
+		CreatedAt: now,
+	}
+	cleanup := func() {
+		for _, f := range batch.Files {
+			_ = os.Remove(f.TempPath)
+		}
+	}
+	for i, f := range req.Files {
+		if f.FileName == "" || f.FileSize < 0 {
+			cleanup()
+			return nil, fmt.Errorf("invalid file metadata at index %d", i)
+		}
+		safeName := filepath.Base(f.FileName)
+		logicalPath := f.LogicalPath
+		if logicalPath == "" {
+			logicalPath = safeName
+		}
+		finalPath, err := createBatchTemp(deviceDir, now.Unix(), safeName)
+		if err != nil {
+			cleanup()
+			return nil, fmt.Errorf("create temp file: %w", err)
+		}
+		tempPath := finalPath + ".part"
+		batch.Files = append(batch.Files, &BackupSession{
+			ID:          BatchFileSessionID(batch.ID, i),
+			Token:       batch.Token,
+			DeviceID:    deviceID,
+			FileID:      f.FileID,
+			LogicalPath: logicalPath,
+			FileName:    safeName,
+			FileSize:    f.FileSize,
+			Checksum:    f.Checksum,
+			BatchID:     batch.ID,
+			Direction:   dto.DirectionUpload,
+			Status:      dto.SessionActive,
+			TempPath:    tempPath,
+			FinalPath:   finalPath,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		})
+	}
+
+	s.mu.Lock()
+	s.batches[batch.ID] = batch
+	for _, f := range batch.Files {
+		s.sessions[f.ID] = f
+	}
+	s.mu.Unlock()
+	return &dto.BackupBatchSessionResponse{
+		BatchID:   batch.ID,
+		Token:     batch.Token,
+		Count:     len(batch.Files),
+		ChunkSize: s.chunkSize,
+		TCPHost:   s.tcpHost,
+		TCPPort:   s.tcpPort,
+	}, nil
+}
+
+// maxStoredNameAttempts giới hạn số lần thử tên blob khác khi tên đã có người dùng.
+const maxStoredNameAttempts = 1000
+
+// createBatchTemp chọn tên blob chưa dùng trong deviceDir và tạo file .part của nó
+// bằng O_EXCL, để batch đồng thời (hay file trùng tên trong cùng batch) không
+// truncate file tạm của nhau. Trả về đường dẫn blob cuối cùng.
+func createBatchTemp(deviceDir string, unix int64, safeName string) (string, error) {
+	for n := 0; n < maxStoredNameAttempts; n++ {
+		storedName := fmt.Sprintf("%d_%s", unix, safeName)
+		if n > 0 {
+			storedName = fmt.Sprintf("%d_%d_%s", unix, n, safeName)
+		}
+		finalPath := filepath.Join(deviceDir, storedName)
+		if _, err := os.Stat(finalPath); err == nil {
+			continue
+		}
+		tf, err := os.OpenFile(finalPath+".part", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_ = tf.Close()
+		return finalPath, nil
+	}
+	return "", fmt.Errorf("no free stored name for %s", safeName)
+}
+
+// FinalizeBatch đưa các file đã nhận đủ vào storage và tạo toàn bộ
+// BackupFileVersion trong một transaction. Nếu transaction lỗi, không file nào được giữ lại.
+func (s *BackupService) FinalizeBatch(deviceID string, req dto.BackupBatchFinalizeRequest) (*dto.BackupBatchFinalizeResponse, error) {
+	if s.versions == nil {
+		return nil, errors.New("backup versions not available")
+	}
+	s.mu.Lock()
+	batch, ok := s.batches[req.BatchID]
+	if !ok {
+		s.mu.Unlock()
+		return nil, ErrSessionNotFound
+	}
+	if batch.Token != req.Token || batch.DeviceID != deviceID {
+		s.mu.Unlock()
+		return nil, ErrInvalidSession
+	}
+	delete(s.batches, batch.ID)
+	for _, f := range batch.Files {
+		delete(s.sessions, f.ID)
+	}
+	s.mu.Unlock()
+
+	resp := &dto.BackupBatchFinalizeResponse{BatchID: batch.ID}
+	hold, err := s.deviceHold(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("load backup hold: %w", err)
+	}
+
+	type staged struct {
+		sess     *BackupSession
+		version  *models.BackupFileVersion
+		manifest backupManifest
+	}
+	var ready []staged
+	for i, f := range batch.Files {
+		info, err := os.Stat(f.TempPath)
+		if f.Status != dto.SessionCompleted || err != nil || info.Size() != f.FileSize {
+			resp.Incomplete = append(resp.Incomplete, i)
+			_ = os.Remove(f.TempPath)
+			continue
+		}
+		sum, err := hashFile(f.TempPath)
+		if err != nil {
+			global.Logger.Error().Err(err).Str("file", f.TempPath).Msg("batch finalize: hash failed")
+			resp.Failed = append(resp.Failed, i)
+			_ = os.Remove(f.TempPath)
+			continue
+		}
+		// Checksum agent khai báo trong manifest phải khớp dữ liệu đã nhận
+		if f.Checksum != "" && !strings.EqualFold(f.Checksum, sum) {
+			global.Logger.Warn().Str("file", f.TempPath).Str("want", f.Checksum).Str("got", sum).Msg("batch finalize: checksum mismatch")
+			resp.Failed = append(resp.Failed, i)
+			_ = os.Remove(f.TempPath)
+			continue
+		}
+		if err := os.Rename(f.TempPath, f.FinalPath); err != nil {
+			global.Logger.Error().Err(err).Str("file", f.FinalPath).Msg("batch finalize: rename failed")
+			resp.Failed = append(resp.Failed, i)
+			_ = os.Remove(f.TempPath)
+			continue
+		}
+		v := &models.BackupFileVersion{
+			DeviceID:    deviceID,
+			FileID:      f.FileID,
+			LogicalPath: f.LogicalPath,
+			FileName:    f.FileName,
+			StoredName:  filepath.Base(f.FinalPath),
+			Size:        f.FileSize,
+			SHA256:      sum,
+		}
+		applyRetention(v, hold)
+		ready = append(ready, staged{sess: f, version: v})
+	}
+	if len(ready) == 0 {
+		return resp, nil
+	}
+
+	vs := make([]*models.BackupFileVersion, len(ready))
+	for i := range ready {
+		vs[i] = ready[i].version
+	}
+	if err := s.versions.CreateBatch(vs); err != nil {
+		for _, r := range ready {
+			_ = os.Remove(r.sess.FinalPath)
+		}
+		return nil, fmt.Errorf("store backup versions: %w", err)
+	}
+
+	for _, r := range ready {
+		v := r.version
+		if err := s.syncBlobMode(v, hold); err != nil {
+			global.Logger.Error().Err(err).Str("file", r.sess.FinalPath).Msg("batch finalize: protect file failed")
+		}
+		m := backupManifest{
+			DeviceID:    v.DeviceID,
+			FileID:      v.FileID,
+			LogicalPath: v.LogicalPath,
+			FileName:    v.FileName,
+			StoredName:  v.StoredName,
+			Version:     v.Version,
+			Size:        v.Size,
+			SHA256:      v.SHA256,
+			RetainUntil: v.RetainUntil,
+			CreatedAt:   v.CreatedAt,
+		}
+		// Manifest chỉ phục vụ rebuild catalog; lỗi ghi không làm hỏng version đã lưu
+		if err := writeManifest(r.sess.FinalPath, m); err != nil {
+			global.Logger.Error().Err(err).Str("file", r.sess.FinalPath).Msg("batch finalize: write manifest failed")
+		}
+	}
+	resp.Stored = len(ready)
+	return resp, nil
+}
+
+// ExpireBatches hủy các batch chưa finalize không có hoạt động nào trong batchTTL:
+// gỡ batch và session khỏi bộ nhớ rồi xóa file .part. Trả về session ID đã gỡ.
+func (s *BackupService) ExpireBatches(now time.Time) []string {
+	cutoff := now.Add(-s.batchTTL)
+	var expired []*BackupBatch
+	s.mu.Lock()
+	for id, b := range s.batches {
+		if batchLastActivity(b).After(cutoff) {
+			continue
+		}
+		delete(s.batches, id)
+		for _, f := range b.Files {
+			delete(s.sessions, f.ID)
+		}
+		expired = append(expired, b)
+	}
+	s.mu.Unlock()
+
+	var ids []string
+	for _, b := range expired {
+		for _, f := range b.Files {
+			if err := os.Remove(f.TempPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				global.Logger.Warn().Err(err).Str("file", f.TempPath).Msg("expire batch: remove temp failed")
+			}
+			ids = append(ids, f.ID)
+		}
+	}
+	return ids
+}
+
+// batchLastActivity là lần cuối batch nhận dữ liệu (gọi khi đang giữ s.mu).
+func batchLastActivity(b *BackupBatch) time.Time {
+	last := b.CreatedAt
+	for _, f := range b.Files {
+		if f.UpdatedAt.After(last) {
+			last = f.UpdatedAt
+		}
+	}
+	return last
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+)
+
+// manifestSuffix là đuôi file sidecar ghi cạnh mỗi blob trong thư mục backups.
+const manifestSuffix = ".manifest.json"
+
+// backupManifest chứa đủ metadata để dựng lại BackupFileVersion khi mất DB.
+type backupManifest struct {
+	DeviceID    string     `json:"device_id"`
+	FileID      string     `json:"file_id,omitempty"`
+	LogicalPath string     `json:"logical_path"`
+	FileName    string     `json:"file_name"`
+	StoredName  string     `json:"stored_name"`
+	Version     int        `json:"version"`
+	Size        int64      `json:"size"`
+	SHA256      string     `json:"sha256"`
+	RetainUntil *time.Time `json:"retain_until,omitempty"`
+	LegalHold   bool       `json:"legal_hold,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// deviceManifestName là sidecar cấp device (trong <storage>/<device>/) lưu hold
+// của device; đuôi manifestSuffix nên không bị quét như blob.
+const deviceManifestName = "device" + manifestSuffix
+
+// deviceHoldManifest chứa BackupHold của device để rebuild catalog dựng lại được.
+type deviceHoldManifest struct {
+	DeviceID   string    `json:"device_id"`
+	LegalHold  bool      `json:"legal_hold"`
+	RetainDays int       `json:"retain_days"`
+	UpdatedBy  string    `json:"updated_by,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func manifestPath(blobPath string) string { return blobPath + manifestSuffix }
+
+func writeManifest(blobPath string, m backupManifest) error {
+	return writeJSONFile(manifestPath(blobPath), m)
+}
+
+// writeJSONFile ghi qua file .tmp rồi rename để không để lại JSON dở dang.
+func writeJSONFile(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func writeDeviceHoldManifest(deviceDir string, h *models.BackupHold) error {
+	if err := os.MkdirAll(deviceDir, 0o755); err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(deviceDir, deviceManifestName), deviceHoldManifest{
+		DeviceID:   h.DeviceID,
+		LegalHold:  h.LegalHold,
+		RetainDays: h.RetainDays,
+		UpdatedBy:  h.UpdatedBy,
+		UpdatedAt:  time.Now(),
+	})
+}
+
+func readDeviceHoldManifest(deviceDir string) (*deviceHoldManifest, error) {
+	b, err := os.ReadFile(filepath.Join(deviceDir, deviceManifestName))
+	if err != nil {
+		return nil, err
+	}
+	var m deviceHoldManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func readManifest(blobPath string) (*backupManifest, error) {
+	b, err := os.ReadFile(manifestPath(blobPath))
+	if err != nil {
+		return nil, err
+	}
+	var m backupManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// isBlobName loại bỏ file tạm upload và sidecar khi quét thư mục backups.
+func isBlobName(name string) bool {
+	return !strings.HasSuffix(name, ".part") &&
+		!strings.HasSuffix(name, ".path") &&
+		!strings.HasSuffix(name, manifestSuffix) &&
+		!strings.HasSuffix(name, manifestSuffix+".tmp")
+}
+
+// CatalogRebuildReport tổng kết một lần rebuild catalog.
+type CatalogRebuildReport struct {
+	Scanned         int      `json:"scanned"`
+	AlreadyIndexed  int      `json:"already_indexed"`
+	Restored        int      `json:"restored"`
+	HoldsRestored   int      `json:"holds_restored"`
+	WithoutManifest []string `json:"without_manifest,omitempty"` // blob được dựng lại từ tên file
+	Corrupt         []string `json:"corrupt,omitempty"`          // nội dung không khớp SHA256 trong manifest
+	Errors          []string `json:"errors,omitempty"`
+}
+
+// ScrubReport tổng kết một lần scrub storage.
+type ScrubReport struct {
+	Checked  int      `json:"checked"`
+	Healthy  int      `json:"healthy"`
+	Corrupt  []string `json:"corrupt,omitempty"`  // checksum không khớp (bit rot)
+	Missing  []string `json:"missing,omitempty"`  // DB có nhưng file không còn
+	Orphaned []string `json:"orphaned,omitempty"` // file có nhưng DB không có
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// BackupCatalog đối chiếu thư mục backups với bảng backup_file_versions.
+type BackupCatalog struct {
+	storageDir string
+	versions   *repo.BackupVersionRepository
+	holds      *repo.BackupHoldRepository
+}
+
+func NewBackupCatalog(storageDir string, versions *repo.BackupVersionRepository, holds *repo.BackupHoldRepository) *BackupCatalog {
+	if storageDir == "" {
+		storageDir = "backups"
+	}
+	return &BackupCatalog{storageDir: storageDir, versions: versions, holds: holds}
+}
+
+// Rebuild quét <storage>/<device>/<blob> và tạo lại các BackupFileVersion còn thiếu,
+// ưu tiên metadata trong sidecar manifest. Hold cấp device được dựng lại từ
+// device.manifest.json nếu DB chưa có.
+func (c *BackupCatalog) Rebuild() (*CatalogRebuildReport, error) {
+	report := &CatalogRebuildReport{}
+	if err := c.rebuildHolds(report); err != nil {
+		return report, err
+	}
+	err := c.walkBlobs(func(deviceID, blobPath string) {
+		report.Scanned++
+		storedName := filepath.Base(blobPath)
+		existing, err := c.versions.FindByStoredName(deviceID, storedName)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", blobPath, err))
+			return
+		}
+		if existing != nil {
+			report.AlreadyIndexed++
+			return
+		}
+		v, fromManifest, corrupt, err := c.versionFromDisk(deviceID, blobPath)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", blobPath, err))
+			return
+		}
+		// Blob hỏng vẫn được index với checksum của manifest để scrub tiếp tục báo
+		if err := c.versions.Create(v); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", blobPath, err))
+			return
+		}
+		if corrupt {
+			report.Corrupt = append(report.Corrupt, blobPath)
+		}
+		if !fromManifest {
+			report.WithoutManifest = append(report.WithoutManifest, blobPath)
+		}
+		report.Restored++
+	})
+	return report, err
+}
+
+// Scrub hash lại từng blob được DB tham chiếu, báo blob hỏng/thiếu và blob mồ côi.
+func (c *BackupCatalog) Scrub() (*ScrubReport, error) {
+	report := &ScrubReport{}
+	indexed := make(map[string]struct{})
+	err := c.versions.EachBatch(200, func(batch []models.BackupFileVersion) error {
+		for _, v := range batch {
+			report.Checked++
+			blobPath := filepath.Join(c.storageDir, v.DeviceID, v.StoredName)
+			indexed[blobPath] = struct{}{}
+			sum, err := hashFile(blobPath)
+			if errors.Is(err, os.ErrNotExist) {
+				report.Missing = append(report.Missing, blobPath)
+				continue
+			}
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", blobPath, err))
+				continue
+			}
+			expected := v.SHA256
+			if expected == "" {
+				// Row cũ chưa có checksum: dùng manifest nếu có, nếu không thì ghi nhận checksum hiện tại
+				if m, err := readManifest(blobPath); err == nil && m.SHA256 != "" {
+					expected = m.SHA256
+				} else {
+					if err := c.versions.UpdateChecksum(v.ID, sum); err != nil {
+						report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", blobPath, err))
+					}
+					report.Healthy++
+					continue
+				}
+			}
+			if sum != expected {
+				report.Corrupt = append(report.Corrupt, blobPath)
+				continue
+			}
+			report.Healthy++
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	err = c.walkBlobs(func(deviceID, blobPath string) {
+		if _, ok := indexed[blobPath]; !ok {
+			report.Orphaned = append(report.Orphaned, blobPath)
+		}
+	})
+	return report, err
+}
+
+// rebuildHolds tạo lại BackupHold cho các device có manifest hold nhưng chưa có row.
+func (c *BackupCatalog) rebuildHolds(report *CatalogRebuildReport) error {
+	if c.holds == nil {
+		return nil
+	}
+	devices, err := os.ReadDir(c.storageDir)
+	if err != nil {
+		return fmt.Errorf("read storage dir: %w", err)
+	}
+	for _, d := range devices {
+		if !d.IsDir() {
+			continue
+		}
+		deviceDir := filepath.Join(c.storageDir, d.Name())
+		m, err := readDeviceHoldManifest(deviceDir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", deviceDir, err))
+			continue
+		}
+		existing, err := c.holds.Get(d.Name())
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", deviceDir, err))
+			continue
+		}
+		if existing != nil {
+			continue
+		}
+		h := &models.BackupHold{DeviceID: d.Name(), LegalHold: m.LegalHold, RetainDays: m.RetainDays, UpdatedBy: m.UpdatedBy}
+		if err := c.holds.Save(h); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", deviceDir, err))
+			continue
+		}
+		report.HoldsRestored++
+	}
+	return nil
+}
+
+func (c *BackupCatalog) walkBlobs(fn func(deviceID, blobPath string)) error {
+	devices, err := os.ReadDir(c.storageDir)
+	if err != nil {
+		return fmt.Errorf("read storage dir: %w", err)
+	}
+	for _, d := range devices {
+		if !d.IsDir() {
+			continue
+		}
+		deviceDir := filepath.Join(c.storageDir, d.Name())
+		entries, err := os.ReadDir(deviceDir)
+		if err != nil {
+			return fmt.Errorf("read device dir %s: %w", deviceDir, err)
+		}
+		for _, e := range entries {
+			if e.IsDir() || !isBlobName(e.Name()) {
+				continue
+			}
+			fn(d.Name(), filepath.Join(deviceDir, e.Name()))
+		}
+	}
+	return nil
+}
+
+// versionFromDisk dựng BackupFileVersion từ manifest; nếu không có manifest thì
+// suy ra từ tên blob dạng <unix>_<name>. SHA256 lấy từ manifest khi có, và
+// corrupt = true nếu nội dung blob không còn khớp với nó.
+func (c *BackupCatalog) versionFromDisk(deviceID, blobPath string) (v *models.BackupFileVersion, fromManifest, corrupt bool, err error) {
+	info, err := os.Stat(blobPath)
+	if err != nil {
+		return nil, false, false, err
+	}
+	sum, err := hashFile(blobPath)
+	if err != nil {
+		return nil, false, false, err
+	}
+	storedName := filepath.Base(blobPath)
+	v = &models.BackupFileVersion{
+		DeviceID:   deviceID,
+		StoredName: storedName,
+		Size:       info.Size(),
+		SHA256:     sum,
+	}
+	if m, err := readManifest(blobPath); err == nil {
+		fromManifest = true
+		if m.SHA256 != "" {
+			v.SHA256 = m.SHA256
+			corrupt = m.SHA256 != sum
+		}
+		v.FileID = m.FileID
+		v.LogicalPath = m.LogicalPath
+		v.FileName = m.FileName
+		v.Version = m.Version
+		v.RetainUntil = m.RetainUntil
+		v.LegalHold = m.LegalHold
+		v.CreatedAt = m.CreatedAt
+	} else {
+		v.FileName = storedName
+		v.CreatedAt = info.ModTime()
+		if ts, name, ok := strings.Cut(storedName, "_"); ok {
+			if unix, err := strconv.ParseInt(ts, 10, 64); err == nil {
+				v.FileName = name
+				v.CreatedAt = time.Unix(unix, 0)
+			}
+		}
+		v.LogicalPath = v.FileName
+	}
+	taken := v.Version <= 0
+	if !taken {
+		if taken, err = c.versions.VersionExists(deviceID, v.LogicalPath, v.Version); err != nil {
+			return nil, false, false, err
+		}
+	}
+	if taken {
+		next, err := c.versions.NextVersion(deviceID, v.LogicalPath)
+		if err != nil {
+			return nil, false, false, err
+		}
+		v.Version = next
+	}
+	return v, fromManifest, corrupt, nil
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"sagiri-guard/backend/app/models"
+)
+
+var (
+	ErrBackupProtected = errors.New("backup version is under retention or legal hold")
+	ErrRetentionShrink = errors.New("retain_until can only be extended")
+)
+
+// BackupDeleteReport tổng kết một thao tác xóa nhiều version (purge/retention).
+type BackupDeleteReport struct {
+	Deleted   []uint `json:"deleted"`
+	Protected []uint `json:"protected,omitempty"` // bị bỏ qua do WORM/legal hold
+}
+
+// isProtected: version bị khóa xóa khi có legal hold (của version hoặc device)
+// hoặc chưa hết hạn retain_until.
+func isProtected(v *models.BackupFileVersion, hold *models.BackupHold, now time.Time) bool {
+	if v.LegalHold || (hold != nil && hold.LegalHold) {
+		return true
+	}
+	return v.RetainUntil != nil && now.Before(*v.RetainUntil)
+}
+
+func (s *BackupService) blobPath(v *models.BackupFileVersion) string {
+	return filepath.Join(s.storageDir, v.DeviceID, v.StoredName)
+}
+
+func (s *BackupService) deviceHold(deviceID string) (*models.BackupHold, error) {
+	if s.holds == nil {
+		return nil, nil
+	}
+	return s.holds.Get(deviceID)
+}
+
+// syncBlobMode đặt blob read-only khi version đang được bảo vệ và trả lại quyền ghi khi hết.
+func (s *BackupService) syncBlobMode(v *models.BackupFileVersion, hold *models.BackupHold) error {
+	mode := os.FileMode(0o644)
+	if isProtected(v, hold, time.Now()) {
+		mode = 0o444
+	}
+	if err := os.Chmod(s.blobPath(v), mode); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// syncManifestHold ghi trạng thái hold vào manifest để rebuild catalog không làm mất hold.
+func (s *BackupService) syncManifestHold(v *models.BackupFileVersion) error {
+	m, err := readManifest(s.blobPath(v))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.RetainUntil = v.RetainUntil
+	m.LegalHold = v.LegalHold
+	return writeManifest(s.blobPath(v), *m)
+}
+
+// SetVersionHold đặt/gỡ legal hold và gia hạn retain_until cho một version.
+// retain_until không được rút ngắn (WORM).
+func (s *BackupService) SetVersionHold(versionID uint, legalHold *bool, retainUntil *time.Time) (*models.BackupFileVersion, error) {
+	if s.versions == nil {
+		return nil, errors.New("backup versions not available")
+	}
+	v, err := s.versions.GetByID(versionID)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, ErrVersionNotFound
+	}
+	if retainUntil != nil {
+		if v.RetainUntil != nil && retainUntil.Before(*v.RetainUntil) {
+			return nil, ErrRetentionShrink
+		}
+		v.RetainUntil = retainUntil
+	}
+	if legalHold != nil {
+		v.LegalHold = *legalHold
+	}
+	if err := s.versions.SetHold(v.ID, v.LegalHold, v.RetainUntil); err != nil {
+		return nil, err
+	}
+	hold, err := s.deviceHold(v.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.syncBlobMode(v, hold); err != nil {
+		return nil, fmt.Errorf("set blob mode: %w", err)
+	}
+	if err := s.syncManifestHold(v); err != nil {
+		return nil, fmt.Errorf("update manifest: %w", err)
+	}
+	return v, nil
+}
+
+// SetDeviceHold cập nhật legal hold / số ngày WORM của device rồi đồng bộ quyền
+// file cho các blob hiện có. RetainDays chỉ áp dụng cho version upload sau đó.
+// Hold cũng được ghi vào device.manifest.json để rebuild catalog giữ lại.
+func (s *BackupService) SetDeviceHold(deviceID string, legalHold *bool, retainDays *int, actor string) (*models.BackupHold, error) {
+	if s.holds == nil || s.versions == nil {
+		return nil, errors.New("backup holds not available")
+	}
+	if deviceID == "" || deviceID != filepath.Base(deviceID) || deviceID == ".." {
+		return nil, errors.New("invalid device_id")
+	}
+	hold, err := s.holds.Get(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if hold == nil {
+		hold = &models.BackupHold{DeviceID: deviceID}
+	}
+	if legalHold != nil {
+		hold.LegalHold = *legalHold
+	}
+	if retainDays != nil {
+		if *retainDays < 0 {
+			return nil, errors.New("retain_days must be >= 0")
+		}
+		hold.RetainDays = *retainDays
+	}
+	hold.UpdatedBy = actor
+	if err := s.holds.Save(hold); err != nil {
+		return nil, err
+	}
+	if err := writeDeviceHoldManifest(filepath.Join(s.storageDir, deviceID), hold); err != nil {
+		return hold, fmt.Errorf("update device manifest: %w", err)
+	}
+	versions, err := s.versions.ListByDevice(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		if err := s.syncBlobMode(&versions[i], hold); err != nil {
+			return hold, fmt.Errorf("set blob mode %s: %w", versions[i].StoredName, err)
+		}
+	}
+	return hold, nil
+}
+
+// applyDeviceRetention gán retain_until cho version mới theo WORM của device.
+func (s *BackupService) applyDeviceRetention(v *models.BackupFileVersion) (*models.BackupHold, error) {
+	hold, err := s.deviceHold(v.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	applyRetention(v, hold)
+	return hold, nil
+}
+
+func applyRetention(v *models.BackupFileVersion, hold *models.BackupHold) {
+	if hold != nil && hold.RetainDays > 0 {
+		until := time.Now().AddDate(0, 0, hold.RetainDays)
+		v.RetainUntil = &until
+	}
+}
+
+// deleteVersion là đường xóa duy nhất: kiểm tra hold, xóa row rồi xóa blob + manifest.
+// Nếu xóa file lỗi, blob còn lại sẽ được scrub báo là orphaned.
+func (s *BackupService) deleteVersion(v *models.BackupFileVersion, hold *models.BackupHold) error {
+	if isProtected(v, hold, time.Now()) {
+		return ErrBackupProtected
+	}
+	if err := s.versions.Delete(v.ID); err != nil {
+		return err
+	}
+	blob := s.blobPath(v)
+	if err := os.Remove(blob); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove blob: %w", err)
+	}
+	if err := os.Remove(manifestPath(blob)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove manifest: %w", err)
+	}
+	return nil
+}
+
+// DeleteVersion xóa một version (admin delete); trả ErrBackupProtected nếu đang bị khóa.
+func (s *BackupService) DeleteVersion(versionID uint) (*models.BackupFileVersion, error) {
+	if s.versions == nil {
+		return nil, errors.New("backup versions not available")
+	}
+	v, err := s.versions.GetByID(versionID)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, ErrVersionNotFound
+	}
+	hold, err := s.deviceHold(v.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.deleteVersion(v, hold); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// PurgeDevice xóa toàn bộ backup của device, bỏ qua các version được bảo vệ.
+func (s *BackupService) PurgeDevice(deviceID string) (*BackupDeleteReport, error) {
+	if s.versions == nil {
+		return nil, errors.New("backup versions not available")
+	}
+	versions, err := s.versions.ListByDevice(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return s.deleteMany(deviceID, versions)
+}
+
+// PruneVersions áp dụng retention giữ keepLast version mới nhất của logicalPath.
+func (s *BackupService) PruneVersions(deviceID, logicalPath string, keepLast int) (*BackupDeleteReport, error) {
+	if s.versions == nil {
+		return nil, errors.New("backup versions not available")
+	}
+	if keepLast < 1 {
+		return nil, errors.New("keep_last must be >= 1")
+	}
+	versions, err := s.versions.List(deviceID, logicalPath) // version ASC
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) <= keepLast {
+		return &BackupDeleteReport{}, nil
+	}
+	return s.deleteMany(deviceID, versions[:len(versions)-keepLast])
+}
+
+func (s *BackupService) deleteMany(deviceID string, versions []models.BackupFileVersion) (*BackupDeleteReport, error) {
+	hold, err := s.deviceHold(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	report := &BackupDeleteReport{Deleted: []uint{}}
+	for i := range versions {
+		v := &versions[i]
+		err := s.deleteVersion(v, hold)
+		if errors.Is(err, ErrBackupProtected) {
+			report.Protected = append(report.Protected, v.ID)
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("delete version %d: %w", v.ID, err)
+		}
+		report.Deleted = append(report.Deleted, v.ID)
+	}
+	return report, nil
+}
@@ -20,6 +20,8 @@ var (
 	ErrSessionNotFound   = errors.New("backup session not found")
 	ErrInvalidSession    = errors.New("invalid backup session")
 	ErrDirectionMismatch = errors.New("direction mismatch")
+	ErrVersionNotFound   = errors.New("backup version not found")
+	ErrGrantInvalid      = errors.New("restore grant invalid, expired or already used")
 )
 
 type BackupSession struct {
@@ -31,6 +33,9 @@ type BackupSession struct {
 	FileName    string
 	FileSize    int64
 	Checksum    string
+	BatchID     string // khác rỗng nếu file thuộc một batch upload
+	GrantID     uint   // khác 0 nếu là download theo grant restore chéo máy
+	DestPath    string // đường dẫn đích đã remap của grant
 	Direction   dto.TransferDirection
 	Status      dto.SessionStatus
 	TempPath    string
@@ -46,11 +51,16 @@ type BackupService struct {
 	tcpHost    string
 	tcpPort    int
 	sessions   map[string]*BackupSession
+	batches    map[string]*BackupBatch
 	mu         sync.RWMutex
 	versions   *repo.BackupVersionRepository
+	grants     *repo.RestoreGrantRepository
+	holds      *repo.BackupHoldRepository
+	grantTTL   time.Duration
+	batchTTL   time.Duration
 }
 
-func NewBackupService(cfg *config.Config, versions *repo.BackupVersionRepository) (*BackupService, error) {
+func NewBackupService(cfg *config.Config, versions *repo.BackupVersionRepository, grants *repo.RestoreGrantRepository, holds *repo.BackupHoldRepository) (*BackupService, error) {
 	storage := cfg.Backup.StoragePath
 	if storage == "" {
 		storage = "backups"
@@ -70,13 +80,26 @@ func NewBackupService(cfg *config.Config, versions *repo.BackupVersionRepository
 	if port <= 0 {
 		port = cfg.TCP.Port + 1
 	}
+	grantTTL := time.Duration(cfg.Backup.RestoreGrantTTLMin) * time.Minute
+	if grantTTL <= 0 {
+		grantTTL = 24 * time.Hour
+	}
+	batchTTL := time.Duration(cfg.Backup.BatchTTLMin) * time.Minute
+	if batchTTL <= 0 {
+		batchTTL = time.Hour
+	}
 	return &BackupService{
 		storageDir: storage,
 		chunkSize:  chunkSize,
 		tcpHost:    host,
 		tcpPort:    port,
 		sessions:   make(map[string]*BackupSession),
+		batches:    make(map[string]*BackupBatch),
 		versions:   versions,
+		grants:     grants,
+		holds:      holds,
+		grantTTL:   grantTTL,
+		batchTTL:   batchTTL,
 	}, nil
 }
 
@@ -141,11 +164,25 @@ func (s *BackupService) PrepareUpload(deviceID string, req dto.BackupUploadInitR
 }
 
 func (s *BackupService) PrepareDownload(deviceID string, req dto.BackupDownloadInitRequest) (*dto.BackupSessionResponse, error) {
-	if deviceID == "" || req.FileName == "" {
+	if deviceID == "" || (req.FileName == "" && req.GrantID == 0) {
 		return nil, errors.New("missing download parameters")
 	}
+	ownerID := deviceID
 	safeName := filepath.Base(req.FileName)
-	finalPath := filepath.Join(s.storageDir, deviceID, safeName)
+	var grantID uint
+	var destPath string
+	if req.GrantID != 0 {
+		g, err := s.validGrant(req.GrantID, deviceID)
+		if err != nil {
+			return nil, err
+		}
+		// grant chỉ bị đánh dấu đã dùng khi tải xong (CompleteDownload),
+		// nên lỗi trước đó vẫn cho phép thử lại tới khi hết hạn
+		ownerID = g.SourceDeviceID
+		safeName = filepath.Base(g.StoredName)
+		grantID, destPath = g.ID, g.DestPath
+	}
+	finalPath := filepath.Join(s.storageDir, ownerID, safeName)
 	info, err := os.Stat(finalPath)
 	if err != nil {
 		return nil, fmt.Errorf("stat file: %w", err)
@@ -155,6 +192,8 @@ func (s *BackupService) PrepareDownload(deviceID string, req dto.BackupDownloadI
 		Token:     newToken(),
 		DeviceID:  deviceID,
 		FileName:  safeName,
+		GrantID:   grantID,
+		DestPath:  destPath,
 		FileSize:  info.Size(),
 		Direction: dto.DirectionDownload,
 		Status:    dto.SessionActive,
@@ -206,6 +245,19 @@ func (s *BackupService) Advance(id string, delta int64) (int64, error) {
 	return sess.BytesDone, nil
 }
 
+// ChunkOffset dựng lại offset 64-bit của chunk từ offset 32-bit trên wire (bị
+// quấn vòng với file >= 4 GiB), chọn giá trị gần số byte đã nhận nhất.
+func ChunkOffset(done int64, wire uint32) int64 {
+	off := done&^0xFFFFFFFF | int64(wire)
+	switch {
+	case off > done+1<<31 && off >= 1<<32:
+		off -= 1 << 32
+	case off+1<<31 < done:
+		off += 1 << 32
+	}
+	return off
+}
+
 func (s *BackupService) CurrentOffset(id string) (int64, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -229,7 +281,54 @@ func (s *BackupService) MarkCompleted(id string) error {
 	return nil
 }
 
+// CheckDownloadGrant kiểm tra lại grant của session download trước khi gửi dữ liệu,
+// tránh hai session cùng một grant đều tải được sau khi grant đã dùng.
+func (s *BackupService) CheckDownloadGrant(sess *BackupSession) error {
+	if sess == nil || sess.GrantID == 0 {
+		return nil
+	}
+	_, err := s.validGrant(sess.GrantID, sess.DeviceID)
+	return err
+}
+
+// CompleteDownload đóng session download đã gửi hết dữ liệu; grant (nếu có)
+// được đánh dấu đã dùng tại đây.
+func (s *BackupService) CompleteDownload(id string) error {
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	if ok {
+		delete(s.sessions, id)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return ErrSessionNotFound
+	}
+	if sess.GrantID == 0 || s.grants == nil {
+		return nil
+	}
+	used, err := s.grants.MarkUsed(sess.GrantID, time.Now())
+	if err != nil {
+		return fmt.Errorf("mark grant used: %w", err)
+	}
+	if !used {
+		return ErrGrantInvalid
+	}
+	return nil
+}
+
 func (s *BackupService) FinalizeUpload(id string) error {
+	s.mu.RLock()
+	pending, ok := s.sessions[id]
+	s.mu.RUnlock()
+	if !ok {
+		return ErrSessionNotFound
+	}
+	// Hash trước khi giữ s.mu để file lớn không chặn các session khác
+	sum, err := hashUploadTemp(pending)
+	if err != nil {
+		return fmt.Errorf("hash backup file: %w", err)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	sess, ok := s.sessions[id]
@@ -265,6 +364,17 @@ func (s *BackupService) FinalizeUpload(id string) error {
 	sess.BytesDone = sess.FileSize
 	sess.UpdatedAt = time.Now()
 
+	manifest := backupManifest{
+		DeviceID:    sess.DeviceID,
+		FileID:      sess.FileID,
+		LogicalPath: sess.LogicalPath,
+		FileName:    sess.FileName,
+		StoredName:  filepath.Base(sess.FinalPath),
+		Size:        sess.FileSize,
+		SHA256:      sum,
+		CreatedAt:   time.Now(),
+	}
+
 	// Ghi lại version mới cho file này
 	if s.versions != nil && sess.LogicalPath != "" {
 		nextVer, err := s.versions.NextVersion(sess.DeviceID, sess.LogicalPath)
@@ -276,18 +386,158 @@ func (s *BackupService) FinalizeUpload(id string) error {
 			FileID:      sess.FileID, // Lưu file_id từ agent
 			LogicalPath: sess.LogicalPath,
 			FileName:    sess.FileName,
-			StoredName:  filepath.Base(sess.FinalPath),
+			StoredName:  manifest.StoredName,
 			Version:     nextVer,
 			Size:        sess.FileSize,
+			SHA256:      sum,
+		}
+		hold, err := s.applyDeviceRetention(v)
+		if err != nil {
+			return fmt.Errorf("load backup hold: %w", err)
 		}
 		if err := s.versions.Create(v); err != nil {
 			return fmt.Errorf("store backup version: %w", err)
 		}
+		if err := s.syncBlobMode(v, hold); err != nil {
+			return fmt.Errorf("protect backup file: %w", err)
+		}
+		manifest.Version = v.Version
+		manifest.RetainUntil = v.RetainUntil
+		manifest.CreatedAt = v.CreatedAt
+	}
+
+	// Sidecar manifest cho phép dựng lại catalog khi mất DB
+	if err := writeManifest(sess.FinalPath, manifest); err != nil {
+		return fmt.Errorf("write backup manifest: %w", err)
 	}
 
 	return nil
 }
 
+// hashUploadTemp hash file tạm của session upload (.part, hoặc .path của agent cũ).
+func hashUploadTemp(sess *BackupSession) (string, error) {
+	sum, err := hashFile(sess.TempPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return hashFile(sess.FinalPath + ".path")
+	}
+	return sum, err
+}
+
+// ResolveVersion tìm bản backup của device theo versionID, hoặc theo
+// (logicalPath, version) khi versionID = 0 (version <= 0 = latest).
+func (s *BackupService) ResolveVersion(deviceID string, versionID uint, logicalPath string, version int) (*models.BackupFileVersion, error) {
+	if s.versions == nil {
+		return nil, errors.New("backup versions not available")
+	}
+	var (
+		v   *models.BackupFileVersion
+		err error
+	)
+	if versionID != 0 {
+		v, err = s.versions.GetByID(versionID)
+	} else {
+		if logicalPath == "" {
+			return nil, errors.New("missing version_id or logical_path")
+		}
+		v, err = s.versions.Get(deviceID, logicalPath, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v == nil || v.DeviceID != deviceID {
+		return nil, ErrVersionNotFound
+	}
+	return v, nil
+}
+
+// GrantCrossDeviceRestore cho phép targetDeviceID tải bản backup v (thuộc device khác)
+// một lần, trong khoảng thời gian grantTTL.
+func (s *BackupService) GrantCrossDeviceRestore(v *models.BackupFileVersion, targetDeviceID, destPath, grantedBy string) (*models.RestoreGrant, error) {
+	if s.grants == nil {
+		return nil, errors.New("restore grants not available")
+	}
+	if v == nil || targetDeviceID == "" {
+		return nil, errors.New("missing grant parameters")
+	}
+	if _, err := os.Stat(filepath.Join(s.storageDir, v.DeviceID, v.StoredName)); err != nil {
+		return nil, fmt.Errorf("stat backup file: %w", err)
+	}
+	g := &models.RestoreGrant{
+		SourceDeviceID: v.DeviceID,
+		TargetDeviceID: targetDeviceID,
+		VersionID:      v.ID,
+		StoredName:     v.StoredName,
+		DestPath:       destPath,
+		GrantedBy:      grantedBy,
+		ExpiresAt:      time.Now().Add(s.grantTTL),
+	}
+	if err := s.grants.Create(g); err != nil {
+		return nil, fmt.Errorf("store restore grant: %w", err)
+	}
+	return g, nil
+}
+
+func (s *BackupService) validGrant(id uint, targetDeviceID string) (*models.RestoreGrant, error) {
+	if s.grants == nil {
+		return nil, ErrGrantInvalid
+	}
+	g, err := s.grants.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	// grant chỉ dùng được một lần: sau khi đã tải xong, restore lại cần admin cấp grant mới
+	if g == nil || g.TargetDeviceID != targetDeviceID || g.UsedAt != nil || time.Now().After(g.ExpiresAt) {
+		return nil, ErrGrantInvalid
+	}
+	return g, nil
+}
+
+// RemapPath thay prefix khớp dài nhất trong rules (so khớp theo ranh giới thư mục).
+// Path của agent Windows (`C:\Users\...`) được chuẩn hóa sang "/" bất kể HĐH
+// của backend và so khớp không phân biệt hoa thường khi có ký tự ổ đĩa.
+// Trả về path gốc nếu không có rule nào khớp.
+func RemapPath(p string, rules []dto.PathRemap) string {
+	norm := remapSlash(p)
+	best, bestLen := -1, 0
+	for i, r := range rules {
+		from := strings.TrimRight(remapSlash(r.From), "/")
+		if from == "" {
+			continue
+		}
+		head := norm
+		if len(head) > len(from) {
+			head = norm[:len(from)]
+		}
+		if !remapEqual(head, from) || (len(norm) > len(from) && norm[len(from)] != '/') {
+			continue
+		}
+		if best < 0 || len(from) > bestLen {
+			best, bestLen = i, len(from)
+		}
+	}
+	if best < 0 {
+		return p
+	}
+	to := strings.TrimRight(remapSlash(rules[best].To), "/")
+	return to + norm[bestLen:]
+}
+
+func remapSlash(p string) string {
+	return strings.ReplaceAll(p, "\\", "/")
+}
+
+// remapEqual so sánh path; path có ký tự ổ đĩa (Windows) không phân biệt hoa thường.
+func remapEqual(a, b string) bool {
+	if hasDriveLetter(a) || hasDriveLetter(b) {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+func hasDriveLetter(p string) bool {
+	return len(p) >= 2 && p[1] == ':' && ((p[0] >= 'a' && p[0] <= 'z') || (p[0] >= 'A' && p[0] <= 'Z'))
+}
+
 func (s *BackupService) toResponse(session *BackupSession) *dto.BackupSessionResponse {
 	return &dto.BackupSessionResponse{
 		SessionID: session.ID,
@@ -300,6 +550,7 @@ func (s *BackupService) toResponse(session *BackupSession) *dto.BackupSessionRes
 		TCPPort:   s.tcpPort,
 		Direction: session.Direction,
 		Status:    session.Status,
+		DestPath:  session.DestPath,
 	}
 }
 
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+	"sagiri-guard/backend/config"
+	"sagiri-guard/backend/global"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newBackupTestService(t *testing.T) *BackupService {
+	t.Helper()
+	global.Logger = zerolog.Nop()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.BackupFileVersion{}, &models.BackupHold{}, &models.RestoreGrant{}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	cfg.Backup.StoragePath = t.TempDir()
+	s, err := NewBackupService(cfg, repo.NewBackupVersionRepository(db), repo.NewRestoreGrantRepository(db), repo.NewBackupHoldRepository(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRemapPath(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		rules []dto.PathRemap
+		want  string
+	}{
+		{
+			name:  "unix prefix",
+			path:  "/home/alice/docs/a.txt",
+			rules: []dto.PathRemap{{From: "/home/alice", To: "/home/bob"}},
+			want:  "/home/bob/docs/a.txt",
+		},
+		{
+			name:  "windows backslashes",
+			path:  `C:\Users\alice\docs\a.txt`,
+			rules: []dto.PathRemap{{From: `C:\Users\alice`, To: `D:\Users\bob`}},
+			want:  "D:/Users/bob/docs/a.txt",
+		},
+		{
+			name:  "drive letter case insensitive",
+			path:  `c:\users\Alice\a.txt`,
+			rules: []dto.PathRemap{{From: "C:/Users/alice", To: "/srv/alice"}},
+			want:  "/srv/alice/a.txt",
+		},
+		{
+			name:  "unix paths stay case sensitive",
+			path:  "/Home/alice/a.txt",
+			rules: []dto.PathRemap{{From: "/home/alice", To: "/home/bob"}},
+			want:  "/Home/alice/a.txt",
+		},
+		{
+			name: "longest prefix wins",
+			path: "/data/projects/x/y.go",
+			rules: []dto.PathRemap{
+				{From: "/data", To: "/mnt"},
+				{From: "/data/projects", To: "/work"},
+			},
+			want: "/work/x/y.go",
+		},
+		{
+			name:  "directory boundary",
+			path:  "/home/alice2/a.txt",
+			rules: []dto.PathRemap{{From: "/home/alice", To: "/home/bob"}},
+			want:  "/home/alice2/a.txt",
+		},
+		{
+			name:  "exact match",
+			path:  "/home/alice",
+			rules: []dto.PathRemap{{From: "/home/alice/", To: "/home/bob/"}},
+			want:  "/home/bob",
+		},
+		{
+			name:  "no match keeps original",
+			path:  `C:\tmp\a.txt`,
+			rules: []dto.PathRemap{{From: "/home", To: "/srv"}},
+			want:  `C:\tmp\a.txt`,
+		},
+		{
+			name:  "empty from ignored",
+			path:  "/a/b",
+			rules: []dto.PathRemap{{From: "/", To: "/x"}},
+			want:  "/a/b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RemapPath(tt.path, tt.rules); got != tt.want {
+				t.Errorf("RemapPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkOffset(t *testing.T) {
+	const gib4 = int64(1) << 32
+	tests := []struct {
+		name string
+		done int64
+		wire uint32
+		want int64
+	}{
+		{"start", 0, 0, 0},
+		{"small file", 1024, 1024, 1024},
+		{"retry of previous chunk", 2048, 1024, 1024},
+		{"just below 4GiB", gib4 - 10, uint32(gib4 - 10), gib4 - 10},
+		{"wrapped past 4GiB", gib4 + 5, 5, gib4 + 5},
+		{"wrap while done still below 4GiB", gib4 - 10, 5, gib4 + 5},
+		{"retry across wrap", gib4 + 100, uint32(gib4 - 20), gib4 - 20},
+		{"second wrap", 2*gib4 + 7, 7, 2*gib4 + 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ChunkOffset(tt.done, tt.wire); got != tt.want {
+				t.Errorf("ChunkOffset(%d, %d) = %d, want %d", tt.done, tt.wire, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreGrantConsumedOnlyOnCompletedDownload(t *testing.T) {
+	s := newBackupTestService(t)
+	v := &models.BackupFileVersion{ID: 7, DeviceID: "src", StoredName: "blob.bin", LogicalPath: "/data/a.txt"}
+	if err := os.MkdirAll(filepath.Join(s.storageDir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(s.storageDir, "src", "blob.bin"), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	g, err := s.GrantCrossDeviceRestore(v, "dst", "/restore/a.txt", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// một lần tải bị bỏ dở không làm mất grant
+	abandoned, err := s.PrepareDownload("dst", dto.BackupDownloadInitRequest{GrantID: g.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if abandoned.DestPath != "/restore/a.txt" {
+		t.Errorf("dest_path = %q, want the grant's remapped path", abandoned.DestPath)
+	}
+	if _, err := s.PrepareDownload("other", dto.BackupDownloadInitRequest{GrantID: g.ID}); !errors.Is(err, ErrGrantInvalid) {
+		t.Errorf("download by another device: err = %v, want ErrGrantInvalid", err)
+	}
+	retry, err := s.PrepareDownload("dst", dto.BackupDownloadInitRequest{GrantID: g.ID})
+	if err != nil {
+		t.Fatalf("retry after an unfinished download: %v", err)
+	}
+	if err := s.CompleteDownload(retry.SessionID); err != nil {
+		t.Fatal(err)
+	}
+
+	sess, err := s.ValidateSession(abandoned.SessionID, abandoned.Token, dto.DirectionDownload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CheckDownloadGrant(sess); !errors.Is(err, ErrGrantInvalid) {
+		t.Errorf("stale session after completion: err = %v, want ErrGrantInvalid", err)
+	}
+	if _, err := s.PrepareDownload("dst", dto.BackupDownloadInitRequest{GrantID: g.ID}); !errors.Is(err, ErrGrantInvalid) {
+		t.Errorf("download after completion: err = %v, want ErrGrantInvalid", err)
+	}
+}
+
+func TestPrepareBatchUploadKeepsConcurrentTempFiles(t *testing.T) {
+	s := newBackupTestService(t)
+	req := dto.BackupBatchInitRequest{Files: []dto.BackupUploadInitRequest{
+		{FileName: "a.txt", FileSize: 3},
+		{FileName: "a.txt", FileSize: 3},
+	}}
+	first, err := s.PrepareBatchUpload("dev", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstFiles := s.batches[first.BatchID].Files
+	if firstFiles[0].TempPath == firstFiles[1].TempPath {
+		t.Fatalf("files in one batch share temp path %s", firstFiles[0].TempPath)
+	}
+	if err := os.WriteFile(firstFiles[0].TempPath, []byte("abc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := s.PrepareBatchUpload("dev", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range s.batches[second.BatchID].Files {
+		for _, g := range firstFiles {
+			if f.TempPath == g.TempPath {
+				t.Errorf("concurrent batches share temp path %s", f.TempPath)
+			}
+		}
+	}
+	if got, err := os.ReadFile(firstFiles[0].TempPath); err != nil || string(got) != "abc" {
+		t.Errorf("in-flight temp file = %q, %v; want untouched", got, err)
+	}
+}
+
+func TestFinalizeBatchVerifiesChecksum(t *testing.T) {
+	s := newBackupTestService(t)
+	sum := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" // sha256("abc")
+	resp, err := s.PrepareBatchUpload("dev", dto.BackupBatchInitRequest{Files: []dto.BackupUploadInitRequest{
+		{FileName: "good.txt", FileSize: 3, Checksum: sum},
+		{FileName: "bad.txt", FileSize: 3, Checksum: sum},
+		{FileName: "unchecked.txt", FileSize: 3},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range []string{"abc", "xyz", "xyz"} {
+		f := s.batches[resp.BatchID].Files[i]
+		if err := os.WriteFile(f.TempPath, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.MarkCompleted(f.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	badPath := s.batches[resp.BatchID].Files[1].FinalPath
+
+	fin, err := s.FinalizeBatch("dev", dto.BackupBatchFinalizeRequest{BatchID: resp.BatchID, Token: resp.Token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fin.Stored != 2 || len(fin.Failed) != 1 || fin.Failed[0] != 1 {
+		t.Fatalf("finalize = %+v, want good and unchecked stored, bad failed", fin)
+	}
+	if _, err := os.Stat(badPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("mismatched blob kept on disk: %v", err)
+	}
+}
+
+func TestCatalogRebuildReportsManifestChecksumMismatch(t *testing.T) {
+	global.Logger = zerolog.Nop()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.BackupFileVersion{}, &models.BackupHold{}); err != nil {
+		t.Fatal(err)
+	}
+	storage := t.TempDir()
+	deviceDir := filepath.Join(storage, "dev")
+	if err := os.MkdirAll(deviceDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	const abcSum = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" // sha256("abc")
+	for name, data := range map[string]string{"1_good.txt": "abc", "2_rotten.txt": "abd"} {
+		blob := filepath.Join(deviceDir, name)
+		if err := os.WriteFile(blob, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		m := backupManifest{DeviceID: "dev", LogicalPath: "/data/" + name, FileName: name, StoredName: name, Version: 1, Size: 3, SHA256: abcSum}
+		if err := writeManifest(blob, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions := repo.NewBackupVersionRepository(db)
+	report, err := NewBackupCatalog(storage, versions, repo.NewBackupHoldRepository(db)).Rebuild()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotten := filepath.Join(deviceDir, "2_rotten.txt")
+	if report.Restored != 2 || len(report.Corrupt) != 1 || report.Corrupt[0] != rotten {
+		t.Fatalf("rebuild report = %+v, want both indexed and %s corrupt", report, rotten)
+	}
+	v, err := versions.FindByStoredName("dev", "2_rotten.txt")
+	if err != nil || v == nil {
+		t.Fatalf("rotten blob not indexed: %v", err)
+	}
+	if v.SHA256 != abcSum {
+		t.Errorf("indexed checksum = %s, want the manifest's %s", v.SHA256, abcSum)
+	}
+}
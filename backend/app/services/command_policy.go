@@ -0,0 +1,53 @@
+package services
+
+import (
+	"time"
+
+	"sagiri-guard/backend/app/models"
+)
+
+const (
+	defaultCommandTTL    = 72 * time.Hour
+	defaultMaxAttempts   = 5
+	commandRetryBase     = 30 * time.Second
+	commandRetryMaxDelay = time.Hour
+)
+
+// commandTTL: command có tác động lên file (restore) hết hạn sớm hơn để bản
+// restore xếp hàng từ lâu không bất ngờ chạy khi device online trở lại.
+var commandTTL = map[string]time.Duration{
+	"restore": 24 * time.Hour,
+}
+
+// ApplyCommandDefaults điền ExpiresAt/MaxAttempts còn trống theo mặc định.
+func ApplyCommandDefaults(cmd *models.AgentCommand, now time.Time) {
+	if cmd.ExpiresAt == nil {
+		ttl, ok := commandTTL[cmd.Command]
+		if !ok {
+			ttl = defaultCommandTTL
+		}
+		exp := now.Add(ttl)
+		cmd.ExpiresAt = &exp
+	}
+	if cmd.MaxAttempts <= 0 {
+		cmd.MaxAttempts = defaultMaxAttempts
+	}
+}
+
+// CommandBackoff trả về thời gian chờ trước lần gửi kế tiếp sau attempts lần thất bại
+// (30s, 1m, 2m, ... tối đa 1h).
+func CommandBackoff(attempts int) time.Duration {
+	d := commandRetryBase
+	for i := 1; i < attempts && d < commandRetryMaxDelay; i++ {
+		d *= 2
+	}
+	if d > commandRetryMaxDelay {
+		d = commandRetryMaxDelay
+	}
+	return d
+}
+
+// CommandExpired cho biết command đã quá hạn tại now.
+func CommandExpired(cmd *models.AgentCommand, now time.Time) bool {
+	return cmd.ExpiresAt != nil && !now.Before(*cmd.ExpiresAt)
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+)
+
+var ErrGroupNotFound = errors.New("device group not found")
+
+type DeviceGroupService struct {
+	groups  *repo.DeviceGroupRepository
+	devices *repo.DeviceRepository
+}
+
+func NewDeviceGroupService(groups *repo.DeviceGroupRepository, devices *repo.DeviceRepository) *DeviceGroupService {
+	return &DeviceGroupService{groups: groups, devices: devices}
+}
+
+// Save tạo mới hoặc cập nhật group theo tên và thêm các thành viên tĩnh trong request.
+func (s *DeviceGroupService) Save(req dto.AdminGroupSaveRequest, actor string) (*models.DeviceGroup, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("missing group name")
+	}
+	rules := normalizeGroupRules(req.Rules)
+	for _, p := range []string{rules.OSName, rules.Hostname, rules.Arch} {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid rule pattern %q: %w", p, err)
+		}
+	}
+	g, err := s.groups.GetByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		g = &models.DeviceGroup{Name: name, CreatedBy: actor}
+	}
+	g.Description = req.Description
+	g.RuleOSName = rules.OSName
+	g.RuleHostname = rules.Hostname
+	g.RuleArch = rules.Arch
+	if err := s.groups.Save(g); err != nil {
+		return nil, err
+	}
+	if err := s.groups.AddMembers(g.ID, cleanIDs(req.Devices)); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (s *DeviceGroupService) Delete(name string) error {
+	g, err := s.get(name)
+	if err != nil {
+		return err
+	}
+	return s.groups.Delete(g.ID)
+}
+
+// UpdateMembers thêm/bớt thành viên tĩnh. Device khớp rule động vẫn thuộc group.
+func (s *DeviceGroupService) UpdateMembers(name string, add, remove []string) (*models.DeviceGroup, error) {
+	g, err := s.get(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.groups.AddMembers(g.ID, cleanIDs(add)); err != nil {
+		return nil, err
+	}
+	if err := s.groups.RemoveMembers(g.ID, cleanIDs(remove)); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Resolve trả về danh sách device ID của group (tĩnh ∪ khớp rule), đã sắp xếp.
+func (s *DeviceGroupService) Resolve(name string) ([]string, error) {
+	g, err := s.get(name)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.devices.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	members, _, err := s.resolve(g, devices)
+	return members, err
+}
+
+// Detail trả về thông tin group kèm danh sách thành viên đã resolve.
+func (s *DeviceGroupService) Detail(name string) (*dto.DeviceGroupDetail, error) {
+	g, err := s.get(name)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.devices.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	members, static, err := s.resolve(g, devices)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.DeviceGroupDetail{DeviceGroupSummary: groupSummary(g, static, members), Members: members}, nil
+}
+
+func (s *DeviceGroupService) List() ([]dto.DeviceGroupSummary, error) {
+	groups, err := s.groups.List()
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.devices.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]dto.DeviceGroupSummary, 0, len(groups))
+	for i := range groups {
+		members, static, err := s.resolve(&groups[i], devices)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, groupSummary(&groups[i], static, members))
+	}
+	return out, nil
+}
+
+func (s *DeviceGroupService) get(name string) (*models.DeviceGroup, error) {
+	g, err := s.groups.GetByName(strings.TrimSpace(name))
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, ErrGroupNotFound
+	}
+	return g, nil
+}
+
+// resolve trả về (tất cả thành viên, thành viên tĩnh).
+func (s *DeviceGroupService) resolve(g *models.DeviceGroup, devices []models.Device) ([]string, []string, error) {
+	static, err := s.groups.ListMembers(g.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	set := make(map[string]struct{}, len(static))
+	for _, id := range static {
+		set[id] = struct{}{}
+	}
+	if g.HasRules() {
+		for i := range devices {
+			if MatchGroupRules(g, &devices[i]) {
+				set[devices[i].UUID] = struct{}{}
+			}
+		}
+	}
+	members := make([]string, 0, len(set))
+	for id := range set {
+		members = append(members, id)
+	}
+	sort.Strings(members)
+	return members, static, nil
+}
+
+// MatchGroupRules: device khớp khi mọi rule khác rỗng đều khớp.
+func MatchGroupRules(g *models.DeviceGroup, d *models.Device) bool {
+	if !g.HasRules() {
+		return false
+	}
+	return globMatch(g.RuleOSName, d.OSName) &&
+		globMatch(g.RuleHostname, d.Hostname) &&
+		globMatch(g.RuleArch, d.Arch)
+}
+
+func globMatch(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(value))
+	return ok
+}
+
+func normalizeGroupRules(r dto.DeviceGroupRules) dto.DeviceGroupRules {
+	return dto.DeviceGroupRules{
+		OSName:   strings.TrimSpace(r.OSName),
+		Hostname: strings.TrimSpace(r.Hostname),
+		Arch:     strings.TrimSpace(r.Arch),
+	}
+}
+
+func groupSummary(g *models.DeviceGroup, static, members []string) dto.DeviceGroupSummary {
+	return dto.DeviceGroupSummary{
+		Name:        g.Name,
+		Description: g.Description,
+		Rules:       dto.DeviceGroupRules{OSName: g.RuleOSName, Hostname: g.RuleHostname, Arch: g.RuleArch},
+		StaticCount: len(static),
+		MemberCount: len(members),
+	}
+}
+
+func cleanIDs(ids []string) []string {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// SummarizeBatch tổng hợp tiến độ của các command cùng batch.
+func SummarizeBatch(batchID string, cmds []models.AgentCommand) dto.BatchProgress {
+	p := dto.BatchProgress{BatchID: batchID, Total: len(cmds)}
+	for _, c := range cmds {
+		if p.Command == "" {
+			p.Command = c.Command
+		}
+		switch c.Status {
+		case "sent":
+			p.Sent++
+		case "running":
+			p.Running++
+		case "done":
+			p.Done++
+		case "failed":
+			p.Failed++
+		case "expired":
+			p.Expired++
+		case "cancelled":
+			p.Cancelled++
+		default:
+			p.Pending++
+		}
+	}
+	p.Complete = p.Pending == 0
+	return p
+}
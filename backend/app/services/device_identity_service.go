@@ -0,0 +1,209 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+	"sagiri-guard/backend/global"
+	"sagiri-guard/cmdsign"
+	"sagiri-guard/devicekey"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIdentityNotBound    = errors.New("device identity not enrolled")
+	ErrIdentityKeyRequired = errors.New("device identity is enrolled; login must present the device key")
+	ErrIdentityRebind      = errors.New("device identity is bound to another key; an admin must reset it")
+	ErrIdentityProof       = errors.New("device identity proof invalid")
+	ErrFingerprintMismatch = errors.New("hardware fingerprint does not match the enrolled device")
+	ErrIdentityUnenrolled  = errors.New("device is already registered without a device key; an admin must reset its identity before login can bind one")
+)
+
+// verifiedTouchInterval giới hạn số lần ghi LastVerifiedAt khi device mở nhiều kết nối ngắn.
+const verifiedTouchInterval = time.Minute
+
+// DeviceIdentityService quản lý credential device (public key + fingerprint)
+// và cảnh báo nghi clone. Identity được cache theo device vì mọi frame của
+// kết nối chưa chứng minh đều phải hỏi device đã gắn key hay chưa.
+type DeviceIdentityService struct {
+	repo  *repo.DeviceIdentityRepository
+	mu    sync.Mutex
+	cache map[string]*models.DeviceIdentity // nil = device chưa gắn identity
+}
+
+func NewDeviceIdentityService(r *repo.DeviceIdentityRepository) *DeviceIdentityService {
+	return &DeviceIdentityService{repo: r, cache: make(map[string]*models.DeviceIdentity)}
+}
+
+// Get trả về identity đã gắn của device, nil nếu chưa có.
+func (s *DeviceIdentityService) Get(deviceID string) (*models.DeviceIdentity, error) {
+	s.mu.Lock()
+	cur, ok := s.cache[deviceID]
+	s.mu.Unlock()
+	if ok {
+		return cur, nil
+	}
+	cur, err := s.repo.FindByDevice(deviceID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		cur = nil
+	}
+	s.mu.Lock()
+	s.cache[deviceID] = cur
+	s.mu.Unlock()
+	return cur, nil
+}
+
+// Bound cho biết kết nối của device có phải chứng minh danh tính không;
+// lỗi DB được coi là đã gắn để không mở cửa khi không kiểm tra được. Identity
+// admin vừa reset (chưa có key) chưa tính là đã gắn.
+func (s *DeviceIdentityService) Bound(deviceID string) bool {
+	cur, err := s.Get(deviceID)
+	return err != nil || (cur != nil && cur.PublicKey != "")
+}
+
+// Login kiểm tra key khi login bằng username/password. Key chỉ được gắn ở lần
+// đăng ký đầu tiên của device (known=false) hoặc sau khi admin reset identity;
+// device đã tồn tại mà chưa gắn key thì bị từ chối, có hay không có key, để
+// credential user không chiếm được device của máy khác.
+func (s *DeviceIdentityService) Login(deviceID, publicKey, fingerprint, actor string, known bool) error {
+	cur, err := s.Get(deviceID)
+	if err != nil {
+		return err
+	}
+	if cur == nil && known {
+		return ErrIdentityUnenrolled
+	}
+	return s.Enroll(deviceID, publicKey, fingerprint, actor)
+}
+
+// Enroll gắn public key và fingerprint cho device chưa có key (lần đăng ký đầu
+// tiên, enroll bằng token, hoặc sau khi admin reset). Device đã gắn thì lần
+// enroll sau phải đúng key và đúng máy; sai lệch được ghi cảnh báo clone và từ
+// chối. Device mới không gửi key (console admin) không được gắn gì.
+func (s *DeviceIdentityService) Enroll(deviceID, publicKey, fingerprint, actor string) error {
+	cur, err := s.Get(deviceID)
+	if err != nil {
+		return err
+	}
+	if cur == nil || cur.PublicKey == "" {
+		if publicKey == "" {
+			if cur != nil {
+				return ErrIdentityKeyRequired
+			}
+			return nil
+		}
+		if _, err := cmdsign.ParsePublicKey(publicKey); err != nil {
+			return err
+		}
+		if fingerprint == "" || len(fingerprint) > 64 {
+			return errors.New("invalid hardware fingerprint")
+		}
+		now := time.Now()
+		if cur != nil {
+			err = s.repo.Bind(deviceID, publicKey, fingerprint, actor, now)
+		} else {
+			err = s.repo.Create(&models.DeviceIdentity{
+				DeviceID:    deviceID,
+				PublicKey:   publicKey,
+				Fingerprint: fingerprint,
+				EnrolledBy:  actor,
+				EnrolledAt:  now,
+			})
+		}
+		if err != nil {
+			return err
+		}
+		s.forget(deviceID)
+		return nil
+	}
+	switch {
+	case publicKey == "":
+		s.Alert(deviceID, "enroll without device key by "+actor)
+		return ErrIdentityKeyRequired
+	case publicKey != cur.PublicKey:
+		s.Alert(deviceID, "enroll with a different device key by "+actor)
+		return ErrIdentityRebind
+	case fingerprint != cur.Fingerprint:
+		s.Alert(deviceID, "enroll from different hardware by "+actor)
+		return ErrFingerprintMismatch
+	}
+	return nil
+}
+
+// Verify kiểm tra chữ ký challenge của một kết nối. Chữ ký đúng nhưng
+// fingerprint khác nghĩa là key đã bị chép sang máy khác.
+func (s *DeviceIdentityService) Verify(deviceID, nonce, fingerprint, signature string) error {
+	cur, err := s.Get(deviceID)
+	if err != nil {
+		return err
+	}
+	if cur == nil || cur.PublicKey == "" {
+		return ErrIdentityNotBound
+	}
+	pub, err := cmdsign.ParsePublicKey(cur.PublicKey)
+	if err != nil {
+		return err
+	}
+	if err := devicekey.Verify(pub, deviceID, nonce, fingerprint, signature); err != nil {
+		s.Alert(deviceID, "invalid device key proof")
+		return ErrIdentityProof
+	}
+	if fingerprint != cur.Fingerprint {
+		s.Alert(deviceID, "valid device key presented from different hardware")
+		return ErrFingerprintMismatch
+	}
+	now := time.Now()
+	if cur.LastVerifiedAt == nil || now.Sub(*cur.LastVerifiedAt) >= verifiedTouchInterval {
+		if err := s.repo.TouchVerified(deviceID, now); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		if c := s.cache[deviceID]; c != nil {
+			c.LastVerifiedAt = &now
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Alert ghi nhận một dấu hiệu device bị clone/giả mạo.
+func (s *DeviceIdentityService) Alert(deviceID, reason string) {
+	global.Logger.Warn().Str("device", deviceID).Str("reason", reason).Msg("device identity alert: suspected clone or spoofing")
+	if err := s.repo.AddAlert(deviceID, reason, time.Now()); err != nil {
+		global.Logger.Error().Err(err).Str("device", deviceID).Msg("record device identity alert failed")
+	}
+}
+
+// Reset gỡ key đang gắn để device enroll lại với key mới (cài lại agent, thay
+// phần cứng, device có từ trước khi bật identity). Bản ghi được giữ lại không có
+// key, đánh dấu admin cho phép lần login/enroll kế tiếp gắn key.
+func (s *DeviceIdentityService) Reset(deviceID string) (bool, error) {
+	n, err := s.repo.ClearKey(deviceID)
+	if err == nil && n == 0 {
+		err = s.repo.Create(&models.DeviceIdentity{DeviceID: deviceID})
+	}
+	s.forget(deviceID)
+	return n > 0, err
+}
+
+// Find đọc identity trực tiếp từ DB (kèm số cảnh báo mới nhất).
+func (s *DeviceIdentityService) Find(deviceID string) (*models.DeviceIdentity, error) {
+	return s.repo.FindByDevice(deviceID)
+}
+
+func (s *DeviceIdentityService) List(alertsOnly bool, offset, limit int) ([]models.DeviceIdentity, error) {
+	return s.repo.List(alertsOnly, offset, limit)
+}
+
+func (s *DeviceIdentityService) forget(deviceID string) {
+	s.mu.Lock()
+	delete(s.cache, deviceID)
+	s.mu.Unlock()
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+	"sagiri-guard/backend/global"
+	"sagiri-guard/cmdsign"
+
+	"github.com/rs/zerolog"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newIdentityTestService(t *testing.T) *DeviceIdentityService {
+	t.Helper()
+	global.Logger = zerolog.Nop()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.DeviceIdentity{}); err != nil {
+		t.Fatal(err)
+	}
+	return NewDeviceIdentityService(repo.NewDeviceIdentityRepository(db))
+}
+
+func testPublicKey(t *testing.T) string {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cmdsign.EncodePublicKey(pub)
+}
+
+func TestDeviceIdentityLogin(t *testing.T) {
+	s := newIdentityTestService(t)
+	key, other := testPublicKey(t), testPublicKey(t)
+
+	// first registration binds the key
+	if err := s.Login("new", key, "fp", "alice", false); err != nil {
+		t.Fatalf("first login error = %v", err)
+	}
+	if !s.Bound("new") {
+		t.Fatal("first login did not bind the key")
+	}
+	if err := s.Login("new", key, "fp", "alice", true); err != nil {
+		t.Errorf("login with the bound key error = %v", err)
+	}
+	if err := s.Login("new", "", "", "alice", true); !errors.Is(err, ErrIdentityKeyRequired) {
+		t.Errorf("key-less login on bound device error = %v, want ErrIdentityKeyRequired", err)
+	}
+	if err := s.Login("new", other, "fp", "mallory", true); !errors.Is(err, ErrIdentityRebind) {
+		t.Errorf("login with another key error = %v, want ErrIdentityRebind", err)
+	}
+
+	// an existing device without a key cannot be claimed by a password login
+	if err := s.Login("legacy", other, "fp", "mallory", true); !errors.Is(err, ErrIdentityUnenrolled) {
+		t.Errorf("binding an existing device error = %v, want ErrIdentityUnenrolled", err)
+	}
+	if err := s.Login("legacy", "", "", "mallory", true); !errors.Is(err, ErrIdentityUnenrolled) {
+		t.Errorf("key-less login on existing device error = %v, want ErrIdentityUnenrolled", err)
+	}
+	if s.Bound("legacy") {
+		t.Fatal("refused login bound a key")
+	}
+
+	// after an admin reset the next login binds, but only with a key
+	if _, err := s.Reset("legacy"); err != nil {
+		t.Fatal(err)
+	}
+	if s.Bound("legacy") {
+		t.Error("reset identity counts as bound")
+	}
+	if err := s.Login("legacy", "", "", "alice", true); !errors.Is(err, ErrIdentityKeyRequired) {
+		t.Errorf("key-less login after reset error = %v, want ErrIdentityKeyRequired", err)
+	}
+	if err := s.Login("legacy", key, "fp", "alice", true); err != nil {
+		t.Fatalf("login after reset error = %v", err)
+	}
+	if err := s.Login("legacy", other, "fp", "mallory", true); !errors.Is(err, ErrIdentityRebind) {
+		t.Errorf("second bind after reset error = %v, want ErrIdentityRebind", err)
+	}
+
+	// a new device without a key (admin console) gets nothing bound
+	if err := s.Login("console", "", "", "admin", false); err != nil || s.Bound("console") {
+		t.Errorf("key-less first login = %v, bound %v", err, s.Bound("console"))
+	}
+}
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+)
+
+// Tên các field trong desired-state, dùng làm giá trị drift.
+const (
+	StateBackupEnabled  = "backup_enabled"
+	StateBlockEnabled   = "block_enabled"
+	StateBlockedDomains = "blocked_domains"
+	StateMonitorPaths   = "monitor_paths"
+	StateRateLimit      = "rate_limit_kbps"
+	StateBackupWindows  = "backup_windows"
+)
+
+// correctionCooldown: khoảng tối thiểu giữa hai lần gửi command sửa lệch cho cùng
+// device, tránh spam khi agent áp dụng thất bại liên tục.
+const correctionCooldown = 5 * time.Minute
+
+// Correction là một command cần queue để đưa agent về desired state.
+type Correction struct {
+	Command string
+	Kind    string
+	Payload json.RawMessage
+}
+
+type DeviceStateService struct {
+	repo *repo.DeviceStateRepository
+}
+
+func NewDeviceStateService(r *repo.DeviceStateRepository) *DeviceStateService {
+	return &DeviceStateService{repo: r}
+}
+
+// Get trả về state đã lưu của device; nil nếu chưa có.
+func (s *DeviceStateService) Get(deviceID string) (*models.DeviceState, error) {
+	return s.repo.Get(deviceID)
+}
+
+// DriftByDevice trả về map deviceID -> các field lệch (chỉ device đang lệch).
+func (s *DeviceStateService) DriftByDevice() (map[string][]string, error) {
+	states, err := s.repo.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]string)
+	for _, st := range states {
+		if d := splitDrift(st.Drift); len(d) > 0 {
+			out[st.DeviceID] = d
+		}
+	}
+	return out, nil
+}
+
+// SetDesired lưu desired state mới cho device và tính lại drift theo actual gần nhất.
+func (s *DeviceStateService) SetDesired(deviceID string, doc dto.DeviceStateDoc, actor string) (*models.DeviceState, error) {
+	if deviceID == "" {
+		return nil, errors.New("missing device_id")
+	}
+	if err := normalizeStateDoc(&doc); err != nil {
+		return nil, err
+	}
+	st, err := s.load(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	st.Desired = string(b)
+	st.DesiredBy = actor
+	st.DesiredAt = &now
+	if actual, err := DecodeStateDoc(st.Actual); err == nil && actual != nil {
+		st.Drift = strings.Join(ComputeDrift(doc, *actual), ",")
+	}
+	if err := s.repo.Save(st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// ReportActual lưu trạng thái thực tế agent báo cáo, tính drift và trả về các
+// command sửa lệch cần gửi. Không trả correction khi còn trong cooldown, trừ khi
+// desired state vừa được đổi sau lần sửa trước.
+func (s *DeviceStateService) ReportActual(deviceID string, actual dto.DeviceStateDoc) (*models.DeviceState, []Correction, error) {
+	if deviceID == "" {
+		return nil, nil, errors.New("missing device_id")
+	}
+	st, err := s.load(deviceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := json.Marshal(actual)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	st.Actual = string(b)
+	st.ReportedAt = &now
+
+	var corrections []Correction
+	desired, err := DecodeStateDoc(st.Desired)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode desired state: %w", err)
+	}
+	if desired == nil {
+		st.Drift = ""
+	} else {
+		drift := ComputeDrift(*desired, actual)
+		st.Drift = strings.Join(drift, ",")
+		if len(drift) > 0 && s.correctionDue(st, now) {
+			corrections = BuildCorrections(*desired, drift)
+		}
+	}
+	if err := s.repo.Save(st); err != nil {
+		return nil, nil, err
+	}
+	return st, corrections, nil
+}
+
+// MarkCorrected ghi nhận thời điểm vừa queue command sửa lệch.
+func (s *DeviceStateService) MarkCorrected(st *models.DeviceState) error {
+	now := time.Now()
+	st.CorrectedAt = &now
+	return s.repo.Save(st)
+}
+
+func (s *DeviceStateService) correctionDue(st *models.DeviceState, now time.Time) bool {
+	if st.CorrectedAt == nil {
+		return true
+	}
+	if st.DesiredAt != nil && st.DesiredAt.After(*st.CorrectedAt) {
+		return true
+	}
+	return now.Sub(*st.CorrectedAt) >= correctionCooldown
+}
+
+func (s *DeviceStateService) load(deviceID string) (*models.DeviceState, error) {
+	st, err := s.repo.Get(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if st == nil {
+		st = &models.DeviceState{DeviceID: deviceID}
+	}
+	return st, nil
+}
+
+// ToResponse chuyển state đã lưu sang DTO cho admin.
+func (s *DeviceStateService) ToResponse(st *models.DeviceState) (dto.DeviceStateResponse, error) {
+	resp := dto.DeviceStateResponse{DeviceID: st.DeviceID, Drift: splitDrift(st.Drift)}
+	var err error
+	if resp.Desired, err = DecodeStateDoc(st.Desired); err != nil {
+		return resp, err
+	}
+	if resp.Actual, err = DecodeStateDoc(st.Actual); err != nil {
+		return resp, err
+	}
+	if st.ReportedAt != nil {
+		resp.ReportedAt = st.ReportedAt.Unix()
+	}
+	if st.CorrectedAt != nil {
+		resp.CorrectedAt = st.CorrectedAt.Unix()
+	}
+	return resp, nil
+}
+
+// DecodeStateDoc parse JSON đã lưu; chuỗi rỗng trả về nil.
+func DecodeStateDoc(raw string) (*dto.DeviceStateDoc, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var doc dto.DeviceStateDoc
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// ComputeDrift so sánh desired với actual, chỉ xét các field desired có quản lý.
+// Danh sách domain/path được so như tập hợp (không phân biệt thứ tự, trùng lặp).
+func ComputeDrift(desired, actual dto.DeviceStateDoc) []string {
+	var drift []string
+	if desired.BackupEnabled != nil && !boolEqual(desired.BackupEnabled, actual.BackupEnabled) {
+		drift = append(drift, StateBackupEnabled)
+	}
+	if desired.BlockEnabled != nil && !boolEqual(desired.BlockEnabled, actual.BlockEnabled) {
+		drift = append(drift, StateBlockEnabled)
+	}
+	// Domain chỉ có ý nghĩa khi blocking đang bật
+	if desired.BlockedDomains != nil && (desired.BlockEnabled == nil || *desired.BlockEnabled) &&
+		!setEqual(*desired.BlockedDomains, listOrNil(actual.BlockedDomains), strings.ToLower) {
+		drift = append(drift, StateBlockedDomains)
+	}
+	if desired.MonitorPaths != nil && !setEqual(*desired.MonitorPaths, listOrNil(actual.MonitorPaths), cleanPath) {
+		drift = append(drift, StateMonitorPaths)
+	}
+	if desired.RateLimitKBps != nil && (actual.RateLimitKBps == nil || *desired.RateLimitKBps != *actual.RateLimitKBps) {
+		drift = append(drift, StateRateLimit)
+	}
+	if desired.BackupWindows != nil && !setEqual(*desired.BackupWindows, listOrNil(actual.BackupWindows), strings.TrimSpace) {
+		drift = append(drift, StateBackupWindows)
+	}
+	return drift
+}
+
+// BuildCorrections sinh command agent tương ứng với các field đang lệch.
+func BuildCorrections(desired dto.DeviceStateDoc, drift []string) []Correction {
+	has := make(map[string]bool, len(drift))
+	for _, d := range drift {
+		has[d] = true
+	}
+	var out []Correction
+	add := func(command, kind string, payload any) {
+		b, _ := json.Marshal(payload)
+		out = append(out, Correction{Command: command, Kind: kind, Payload: b})
+	}
+
+	if has[StateBackupEnabled] {
+		add("backup_auto", "once", map[string]any{"enabled": *desired.BackupEnabled})
+	}
+	if has[StateBlockEnabled] || has[StateBlockedDomains] {
+		if desired.BlockEnabled != nil && !*desired.BlockEnabled {
+			add("block_website", "once", map[string]any{"action": "remove"})
+		} else {
+			rules := make([]map[string]any, 0)
+			for _, d := range listOrNil(desired.BlockedDomains) {
+				rules = append(rules, map[string]any{"type": "domain", "domain": d, "enabled": true})
+			}
+			add("block_website", "once", map[string]any{
+				"action": "apply",
+				"rules":  rules,
+				"status": map[string]any{"enabled": true},
+			})
+		}
+	}
+	if has[StateMonitorPaths] {
+		add("monitor_paths", "once", map[string]any{"paths": *desired.MonitorPaths})
+	}
+	if has[StateRateLimit] || has[StateBackupWindows] {
+		p := map[string]any{}
+		if desired.RateLimitKBps != nil {
+			p["rate_limit_kbps"] = *desired.RateLimitKBps
+		}
+		if desired.BackupWindows != nil {
+			if len(*desired.BackupWindows) == 0 {
+				p["clear_windows"] = true
+			} else {
+				p["windows"] = *desired.BackupWindows
+			}
+		}
+		add("backup_throttle", "once", p)
+	}
+	return out
+}
+
+// normalizeStateDoc kiểm tra và chuẩn hóa desired state trước khi lưu.
+func normalizeStateDoc(doc *dto.DeviceStateDoc) error {
+	if doc.RateLimitKBps != nil && *doc.RateLimitKBps < 0 {
+		return errors.New("rate_limit_kbps must be >= 0")
+	}
+	if doc.BlockedDomains != nil {
+		list := make([]string, 0, len(*doc.BlockedDomains))
+		for _, d := range *doc.BlockedDomains {
+			if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+				list = append(list, d)
+			}
+		}
+		doc.BlockedDomains = &list
+	}
+	if doc.MonitorPaths != nil {
+		list := make([]string, 0, len(*doc.MonitorPaths))
+		for _, p := range *doc.MonitorPaths {
+			if p = strings.TrimSpace(p); p != "" {
+				list = append(list, p)
+			}
+		}
+		doc.MonitorPaths = &list
+	}
+	if doc.BackupWindows != nil {
+		list := make([]string, 0, len(*doc.BackupWindows))
+		for _, w := range *doc.BackupWindows {
+			norm, err := normalizeWindow(w)
+			if err != nil {
+				return err
+			}
+			list = append(list, norm)
+		}
+		doc.BackupWindows = &list
+	}
+	return nil
+}
+
+// normalizeWindow đưa "H:MM-H:MM" về dạng "HH:MM-HH:MM" như agent báo cáo.
+func normalizeWindow(s string) (string, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid backup window %q (want HH:MM-HH:MM)", s)
+	}
+	var out [2]string
+	for i, p := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(p))
+		if err != nil {
+			return "", fmt.Errorf("invalid backup window %q: %w", s, err)
+		}
+		out[i] = t.Format("15:04")
+	}
+	return out[0] + "-" + out[1], nil
+}
+
+func boolEqual(a, b *bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func listOrNil(p *[]string) []string {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+func cleanPath(p string) string {
+	p = strings.TrimRight(strings.ReplaceAll(strings.TrimSpace(p), "\\", "/"), "/")
+	if p == "" {
+		return "/"
+	}
+	return p
+}
+
+func setEqual(a, b []string, norm func(string) string) bool {
+	set := func(list []string) []string {
+		m := make(map[string]struct{}, len(list))
+		for _, v := range list {
+			if v = norm(v); v != "" {
+				m[v] = struct{}{}
+			}
+		}
+		out := make([]string, 0, len(m))
+		for v := range m {
+			out = append(out, v)
+		}
+		sort.Strings(out)
+		return out
+	}
+	sa, sb := set(a), set(b)
+	if len(sa) != len(sb) {
+		return false
+	}
+	for i := range sa {
+		if sa[i] != sb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func splitDrift(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"reflect"
+	"sagiri-guard/backend/app/dto"
+	"testing"
+)
+
+func TestComputeDrift(t *testing.T) {
+	on, off := true, false
+	rate, otherRate := 512, 256
+	list := func(v ...string) *[]string { return &v }
+
+	tests := []struct {
+		name    string
+		desired dto.DeviceStateDoc
+		actual  dto.DeviceStateDoc
+		want    []string
+	}{
+		{
+			name:    "unmanaged fields ignored",
+			desired: dto.DeviceStateDoc{},
+			actual:  dto.DeviceStateDoc{BackupEnabled: &off, MonitorPaths: list("/x")},
+		},
+		{
+			name:    "bool drift",
+			desired: dto.DeviceStateDoc{BackupEnabled: &on, BlockEnabled: &off},
+			actual:  dto.DeviceStateDoc{BackupEnabled: &off, BlockEnabled: &off},
+			want:    []string{StateBackupEnabled},
+		},
+		{
+			name:    "missing actual value drifts",
+			desired: dto.DeviceStateDoc{BackupEnabled: &on, RateLimitKBps: &rate},
+			actual:  dto.DeviceStateDoc{},
+			want:    []string{StateBackupEnabled, StateRateLimit},
+		},
+		{
+			name:    "domains compared as case-insensitive set",
+			desired: dto.DeviceStateDoc{BlockEnabled: &on, BlockedDomains: list("a.com", "B.com")},
+			actual:  dto.DeviceStateDoc{BlockEnabled: &on, BlockedDomains: list("b.com", "a.com", "a.com")},
+		},
+		{
+			name:    "domains ignored while blocking is off",
+			desired: dto.DeviceStateDoc{BlockEnabled: &off, BlockedDomains: list("a.com")},
+			actual:  dto.DeviceStateDoc{BlockEnabled: &off, BlockedDomains: list()},
+		},
+		{
+			name:    "domain drift",
+			desired: dto.DeviceStateDoc{BlockedDomains: list("a.com")},
+			actual:  dto.DeviceStateDoc{BlockedDomains: list("a.com", "c.com")},
+			want:    []string{StateBlockedDomains},
+		},
+		{
+			name:    "monitor paths normalized",
+			desired: dto.DeviceStateDoc{MonitorPaths: list(`C:\Data\`, "/home/a/")},
+			actual:  dto.DeviceStateDoc{MonitorPaths: list("/home/a", "C:/Data")},
+		},
+		{
+			name:    "monitor path drift",
+			desired: dto.DeviceStateDoc{MonitorPaths: list("/home/a")},
+			actual:  dto.DeviceStateDoc{MonitorPaths: list("/home/a", "/srv/policy-root")},
+			want:    []string{StateMonitorPaths},
+		},
+		{
+			name:    "empty desired list matches nil actual",
+			desired: dto.DeviceStateDoc{MonitorPaths: list(), BackupWindows: list()},
+			actual:  dto.DeviceStateDoc{},
+		},
+		{
+			name:    "rate and window drift",
+			desired: dto.DeviceStateDoc{RateLimitKBps: &rate, BackupWindows: list("19:00-07:00")},
+			actual:  dto.DeviceStateDoc{RateLimitKBps: &otherRate, BackupWindows: list(" 19:00-07:00 ", "12:00-13:00")},
+			want:    []string{StateRateLimit, StateBackupWindows},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ComputeDrift(tt.desired, tt.actual)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ComputeDrift = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+
+	"gorm.io/gorm"
+)
+
+const (
+	enrollTokenPrefix     = "sge_"
+	defaultEnrollTTLHours = 24
+	maxEnrollTTLHours     = 720
+)
+
+var (
+	ErrEnrollTokenInvalid  = errors.New("enrollment token is invalid, expired, revoked or used up")
+	ErrEnrollTokenNotFound = errors.New("enrollment token not found")
+	ErrEnrollDeviceExists  = errors.New("device id is already registered; enroll with a new id")
+)
+
+type EnrollmentService struct {
+	repo    *repo.EnrollmentTokenRepository
+	devices *repo.DeviceRepository
+	groups  *DeviceGroupService
+}
+
+func NewEnrollmentService(r *repo.EnrollmentTokenRepository, devices *repo.DeviceRepository, groups *DeviceGroupService) *EnrollmentService {
+	return &EnrollmentService{repo: r, devices: devices, groups: groups}
+}
+
+// Mint tạo mã enrollment mới; mã đầy đủ chỉ được trả về ở đây, DB chỉ giữ hash.
+func (s *EnrollmentService) Mint(req dto.AdminEnrollTokenCreateRequest, actor string) (string, *models.EnrollmentToken, error) {
+	group := strings.TrimSpace(req.Group)
+	if group != "" && s.groups != nil {
+		if _, err := s.groups.get(group); err != nil {
+			return "", nil, err
+		}
+	}
+	maxUses := req.MaxUses
+	switch {
+	case req.Unlimited:
+		maxUses = 0
+	case maxUses <= 0:
+		maxUses = 1
+	}
+	ttl := req.TTLHours
+	if ttl <= 0 {
+		ttl = defaultEnrollTTLHours
+	}
+	if ttl > maxEnrollTTLHours {
+		return "", nil, errors.New("ttl_hours exceeds 720")
+	}
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	plain := enrollTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	t := &models.EnrollmentToken{
+		Name:      strings.TrimSpace(req.Name),
+		TokenHash: hashEnrollToken(plain),
+		Prefix:    plain[:len(enrollTokenPrefix)+6],
+		GroupName: group,
+		MaxUses:   maxUses,
+		ExpiresAt: time.Now().Add(time.Duration(ttl) * time.Hour),
+		CreatedBy: actor,
+	}
+	if err := s.repo.Create(t); err != nil {
+		return "", nil, err
+	}
+	return plain, t, nil
+}
+
+// Check tìm token theo mã và kiểm tra còn hiệu lực (chưa tiêu lượt dùng).
+// Token đã hết lượt vẫn hợp lệ với device đã enroll bằng chính nó. Device ID do
+// agent tự chọn nên ID đã có trong bảng device chỉ được enroll lại bằng đúng
+// token đã enroll nó, tránh chiếm danh tính của device khác.
+func (s *EnrollmentService) Check(plain, deviceID string, now time.Time) (*models.EnrollmentToken, error) {
+	plain = strings.TrimSpace(plain)
+	if !strings.HasPrefix(plain, enrollTokenPrefix) {
+		return nil, ErrEnrollTokenInvalid
+	}
+	t, err := s.repo.FindByHash(hashEnrollToken(plain))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrEnrollTokenInvalid
+		}
+		return nil, err
+	}
+	enrolled := true
+	if _, err := s.repo.FindEnrollment(t.ID, deviceID); err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		enrolled = false
+	}
+	if !enrolled && s.devices != nil {
+		if _, err := s.devices.FindByUUID(deviceID); err == nil {
+			return nil, ErrEnrollDeviceExists
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	if enrollTokenActive(t, now) {
+		return t, nil
+	}
+	if enrolled && !t.Revoked && now.Before(t.ExpiresAt) {
+		return t, nil
+	}
+	return nil, ErrEnrollTokenInvalid
+}
+
+// Redeem tiêu một lượt dùng và ghi device đã enroll. Device enroll lại bằng
+// cùng token (agent khởi động lại trước khi lưu được credential) không tốn thêm lượt.
+// Trả về true khi lần gọi này thật sự tiêu lượt, để caller Release nếu bước sau lỗi.
+func (s *EnrollmentService) Redeem(t *models.EnrollmentToken, deviceID, hostname, remoteAddr string, now time.Time) (bool, error) {
+	if _, err := s.repo.FindEnrollment(t.ID, deviceID); err == nil {
+		return false, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	ok, err := s.repo.Consume(t.ID, now)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, ErrEnrollTokenInvalid
+	}
+	if err := s.repo.AddEnrollment(&models.DeviceEnrollment{
+		TokenID:    t.ID,
+		DeviceID:   deviceID,
+		Hostname:   hostname,
+		RemoteAddr: remoteAddr,
+		EnrolledAt: now,
+	}); err != nil {
+		// hai kết nối cùng enroll một device: bản kia đã ghi, trả lại lượt vừa tiêu
+		_ = s.repo.Unconsume(t.ID)
+		return false, err
+	}
+	return true, nil
+}
+
+// Release hoàn tác một lần Redeem đã tiêu lượt khi enroll không hoàn tất.
+func (s *EnrollmentService) Release(t *models.EnrollmentToken, deviceID string) error {
+	if err := s.repo.DeleteEnrollment(t.ID, deviceID); err != nil {
+		return err
+	}
+	return s.repo.Unconsume(t.ID)
+}
+
+// AssignGroup thêm device vào group gắn với token (nếu có).
+func (s *EnrollmentService) AssignGroup(t *models.EnrollmentToken, deviceID string) error {
+	if t.GroupName == "" || s.groups == nil {
+		return nil
+	}
+	_, err := s.groups.UpdateMembers(t.GroupName, []string{deviceID}, nil)
+	return err
+}
+
+func (s *EnrollmentService) Revoke(id uint) (*models.EnrollmentToken, error) {
+	n, err := s.repo.Revoke(id)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrEnrollTokenNotFound
+	}
+	return s.repo.FindByID(id)
+}
+
+func (s *EnrollmentService) Get(id uint) (*models.EnrollmentToken, error) {
+	t, err := s.repo.FindByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEnrollTokenNotFound
+	}
+	return t, err
+}
+
+func (s *EnrollmentService) List(activeOnly bool, offset, limit int) ([]models.EnrollmentToken, error) {
+	return s.repo.List(activeOnly, time.Now(), offset, limit)
+}
+
+func (s *EnrollmentService) Enrollments(tokenID uint, offset, limit int) ([]models.DeviceEnrollment, error) {
+	return s.repo.Enrollments(tokenID, offset, limit)
+}
+
+// EnrollTokenToSummary chuyển token sang dạng trả cho admin (không có hash).
+func EnrollTokenToSummary(t models.EnrollmentToken, now time.Time) dto.EnrollTokenSummary {
+	out := dto.EnrollTokenSummary{
+		ID:        t.ID,
+		Name:      t.Name,
+		Prefix:    t.Prefix,
+		Group:     t.GroupName,
+		MaxUses:   t.MaxUses,
+		Uses:      t.Uses,
+		ExpiresAt: t.ExpiresAt.Unix(),
+		Revoked:   t.Revoked,
+		Active:    enrollTokenActive(&t, now),
+		CreatedBy: t.CreatedBy,
+		CreatedAt: t.CreatedAt.Unix(),
+	}
+	if t.LastUsedAt != nil {
+		out.LastUsedAt = t.LastUsedAt.Unix()
+	}
+	return out
+}
+
+func enrollTokenActive(t *models.EnrollmentToken, now time.Time) bool {
+	return !t.Revoked && now.Before(t.ExpiresAt) && (t.MaxUses == 0 || t.Uses < t.MaxUses)
+}
+
+func hashEnrollToken(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
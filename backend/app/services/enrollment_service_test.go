@@ -0,0 +1,84 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newEnrollmentTestService(t *testing.T) (*EnrollmentService, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.EnrollmentToken{}, &models.DeviceEnrollment{}, &models.Device{}); err != nil {
+		t.Fatal(err)
+	}
+	return NewEnrollmentService(repo.NewEnrollmentTokenRepository(db), repo.NewDeviceRepository(db), nil), db
+}
+
+func TestEnrollmentCheckRedeem(t *testing.T) {
+	s, db := newEnrollmentTestService(t)
+	now := time.Now()
+	plain, tok, err := s.Mint(dto.AdminEnrollTokenCreateRequest{MaxUses: 1}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.Device{UUID: "existing"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Check(plain, "existing", now); !errors.Is(err, ErrEnrollDeviceExists) {
+		t.Fatalf("Check(existing device) error = %v, want ErrEnrollDeviceExists", err)
+	}
+	if _, err := s.Check("sge_wrong", "new-1", now); !errors.Is(err, ErrEnrollTokenInvalid) {
+		t.Fatalf("Check(wrong token) error = %v, want ErrEnrollTokenInvalid", err)
+	}
+
+	got, err := s.Check(plain, "new-1", now)
+	if err != nil {
+		t.Fatalf("Check(new device) error = %v", err)
+	}
+	fresh, err := s.Redeem(got, "new-1", "pc-1", "10.0.0.1", now)
+	if err != nil || !fresh {
+		t.Fatalf("Redeem = %v, %v; want true, nil", fresh, err)
+	}
+	// the device row now exists, but it was enrolled by this token: retry is allowed and free
+	if err := db.Create(&models.Device{UUID: "new-1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Check(plain, "new-1", now); err != nil {
+		t.Fatalf("Check(re-enroll) error = %v", err)
+	}
+	if fresh, err := s.Redeem(got, "new-1", "pc-1", "10.0.0.1", now); err != nil || fresh {
+		t.Fatalf("Redeem(re-enroll) = %v, %v; want false, nil", fresh, err)
+	}
+	if _, err := s.Check(plain, "new-2", now); !errors.Is(err, ErrEnrollTokenInvalid) {
+		t.Fatalf("Check(used up) error = %v, want ErrEnrollTokenInvalid", err)
+	}
+
+	// Release hands the use back for another device
+	if err := s.Release(got, "new-1"); err != nil {
+		t.Fatal(err)
+	}
+	cur, err := s.Get(tok.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur.Uses != 0 {
+		t.Errorf("Uses after Release = %d, want 0", cur.Uses)
+	}
+	if _, err := s.Check(plain, "new-2", now); err != nil {
+		t.Errorf("Check(after release) error = %v", err)
+	}
+}
@@ -0,0 +1,358 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+)
+
+var ErrInventoryNotFound = errors.New("inventory not found")
+
+// Category của InventoryChange.
+const (
+	InventorySystem    = "system"
+	InventoryDisk      = "disk"
+	InventoryInterface = "interface"
+	InventoryPackage   = "package"
+	InventoryUser      = "user"
+)
+
+type InventoryService struct {
+	repo *repo.DeviceInventoryRepository
+}
+
+func NewInventoryService(r *repo.DeviceInventoryRepository) *InventoryService {
+	return &InventoryService{repo: r}
+}
+
+// Record lưu report của agent: nội dung không đổi thì chỉ cập nhật LastSeenAt,
+// ngược lại tạo snapshot mới kèm các thay đổi so với snapshot trước.
+func (s *InventoryService) Record(deviceID string, rep dto.InventoryReport) (dto.InventoryReportResponse, error) {
+	var resp dto.InventoryReportResponse
+	if deviceID == "" {
+		return resp, errors.New("missing device id")
+	}
+	now := time.Now()
+	at := now
+	if rep.UnixTime > 0 && rep.UnixTime <= now.Unix() {
+		at = time.Unix(rep.UnixTime, 0)
+	}
+	canonicalReport(&rep)
+	data, hash, err := inventoryData(rep)
+	if err != nil {
+		return resp, err
+	}
+
+	prev, err := s.repo.Latest(deviceID)
+	if err != nil {
+		return resp, err
+	}
+	if prev != nil && prev.Hash == hash {
+		resp.SnapshotID = prev.ID
+		return resp, s.repo.Touch(prev.ID, at)
+	}
+
+	sys := rep.System
+	inv := &models.DeviceInventory{
+		DeviceID:       deviceID,
+		Hash:           hash,
+		Source:         sys.Source,
+		Hostname:       sys.Hostname,
+		Vendor:         sys.Vendor,
+		Hardware:       sys.Hardware,
+		Serial:         sys.Serial,
+		CPUBrand:       sys.CPUBrand,
+		CPUCores:       sys.CPUCores,
+		MemoryMB:       sys.MemoryMB,
+		OSName:         sys.OSName,
+		OSVersion:      sys.OSVersion,
+		Kernel:         sys.Kernel,
+		DiskCount:      len(rep.Disks),
+		InterfaceCount: len(rep.Interfaces),
+		PackageCount:   len(rep.Packages),
+		UserCount:      len(rep.Users),
+		Truncated:      rep.Truncated,
+		DataJSON:       data,
+		CollectedAt:    at,
+		LastSeenAt:     at,
+	}
+	var changes []models.InventoryChange
+	if prev != nil {
+		var old dto.InventoryReport
+		if err := json.Unmarshal([]byte(prev.DataJSON), &old); err != nil {
+			return resp, fmt.Errorf("decode previous inventory: %w", err)
+		}
+		changes = DiffInventory(deviceID, old, rep, at)
+	}
+	if err := s.repo.CreateSnapshot(inv, changes); err != nil {
+		return resp, err
+	}
+	resp.SnapshotID, resp.Changed, resp.Changes = inv.ID, true, len(changes)
+	return resp, nil
+}
+
+// Snapshot trả về snapshot theo ID (0 = mới nhất) cùng report đầy đủ.
+func (s *InventoryService) Snapshot(deviceID string, id uint) (*models.DeviceInventory, dto.InventoryReport, error) {
+	var rep dto.InventoryReport
+	var inv *models.DeviceInventory
+	var err error
+	if id == 0 {
+		inv, err = s.repo.Latest(deviceID)
+	} else {
+		inv, err = s.repo.Get(deviceID, id)
+	}
+	if err != nil {
+		return nil, rep, err
+	}
+	if inv == nil {
+		return nil, rep, ErrInventoryNotFound
+	}
+	if err := json.Unmarshal([]byte(inv.DataJSON), &rep); err != nil {
+		return nil, rep, err
+	}
+	return inv, rep, nil
+}
+
+// Snapshots trả về danh sách snapshot (không kèm dữ liệu chi tiết), mới nhất trước.
+func (s *InventoryService) Snapshots(deviceID string, offset, limit int) ([]dto.InventorySummary, bool, error) {
+	rows, err := s.repo.ListSnapshots(deviceID, offset, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	more := len(rows) > limit
+	if more {
+		rows = rows[:limit]
+	}
+	out := make([]dto.InventorySummary, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, InventoryToSummary(r))
+	}
+	return out, more, nil
+}
+
+// Changes trả về lịch sử thay đổi, mới nhất trước; more cho biết còn trang sau.
+func (s *InventoryService) Changes(req dto.AdminInventoryHistoryRequest, limit int) ([]dto.InventoryChangeEntry, bool, error) {
+	f := repo.InventoryChangeFilter{DeviceID: req.DeviceID, Category: req.Category, Offset: req.Offset, Limit: limit + 1}
+	if req.Since > 0 {
+		f.Since = time.Unix(req.Since, 0)
+	}
+	rows, err := s.repo.Changes(f)
+	if err != nil {
+		return nil, false, err
+	}
+	more := len(rows) > limit
+	if more {
+		rows = rows[:limit]
+	}
+	out := make([]dto.InventoryChangeEntry, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, dto.InventoryChangeEntry{
+			SnapshotID: r.SnapshotID,
+			DetectedAt: r.DetectedAt.Unix(),
+			Category:   r.Category,
+			Action:     r.Action,
+			Item:       r.Item,
+			Old:        r.Old,
+			New:        r.New,
+		})
+	}
+	return out, more, nil
+}
+
+func InventoryToSummary(inv models.DeviceInventory) dto.InventorySummary {
+	return dto.InventorySummary{
+		SnapshotID:     inv.ID,
+		CollectedAt:    inv.CollectedAt.Unix(),
+		LastSeenAt:     inv.LastSeenAt.Unix(),
+		Source:         inv.Source,
+		Hostname:       inv.Hostname,
+		Vendor:         inv.Vendor,
+		Hardware:       inv.Hardware,
+		Serial:         inv.Serial,
+		CPUBrand:       inv.CPUBrand,
+		CPUCores:       inv.CPUCores,
+		MemoryMB:       inv.MemoryMB,
+		OSName:         inv.OSName,
+		OSVersion:      inv.OSVersion,
+		Kernel:         inv.Kernel,
+		DiskCount:      inv.DiskCount,
+		InterfaceCount: inv.InterfaceCount,
+		PackageCount:   inv.PackageCount,
+		UserCount:      inv.UserCount,
+		Truncated:      inv.Truncated,
+	}
+}
+
+// InventorySection trả về danh sách của một phần report dưới dạng JSON từng phần tử.
+func InventorySection(rep dto.InventoryReport, section string) ([]json.RawMessage, error) {
+	var items any
+	switch section {
+	case "disks":
+		items = rep.Disks
+	case "interfaces":
+		items = rep.Interfaces
+	case "packages":
+		items = rep.Packages
+	case "users":
+		items = rep.Users
+	default:
+		return nil, fmt.Errorf("unknown inventory section %q", section)
+	}
+	b, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var out []json.RawMessage
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DiffInventory so hai report và trả về các thay đổi (chưa gán SnapshotID).
+func DiffInventory(deviceID string, old, cur dto.InventoryReport, at time.Time) []models.InventoryChange {
+	var out []models.InventoryChange
+	add := func(category, action, item, o, n string) {
+		out = append(out, models.InventoryChange{
+			DeviceID:   deviceID,
+			DetectedAt: at,
+			Category:   category,
+			Action:     action,
+			Item:       clip(item, 255),
+			Old:        clip(o, 512),
+			New:        clip(n, 512),
+		})
+	}
+	diffKeyed := func(category string, o, n map[string]string) {
+		keys := make([]string, 0, len(o)+len(n))
+		for k := range o {
+			keys = append(keys, k)
+		}
+		for k := range n {
+			if _, ok := o[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ov, inOld := o[k]
+			nv, inNew := n[k]
+			switch {
+			case !inOld:
+				add(category, "added", k, "", nv)
+			case !inNew:
+				add(category, "removed", k, ov, "")
+			case ov != nv:
+				add(category, "changed", k, ov, nv)
+			}
+		}
+	}
+
+	diffKeyed(InventorySystem, systemFields(old.System), systemFields(cur.System))
+	diffKeyed(InventoryDisk, diskMap(old.Disks), diskMap(cur.Disks))
+	diffKeyed(InventoryInterface, interfaceMap(old.Interfaces), interfaceMap(cur.Interfaces))
+	diffKeyed(InventoryUser, userMap(old.Users), userMap(cur.Users))
+	// danh sách bị cắt thì không suy ra package bị gỡ
+	if !old.Truncated && !cur.Truncated {
+		diffKeyed(InventoryPackage, packageMap(old.Packages), packageMap(cur.Packages))
+	}
+	return out
+}
+
+func systemFields(s dto.InventorySystem) map[string]string {
+	m := map[string]string{
+		"hostname":       s.Hostname,
+		"vendor":         s.Vendor,
+		"hardware_model": s.Hardware,
+		"serial":         s.Serial,
+		"cpu_brand":      s.CPUBrand,
+		"cpu_cores":      strconv.Itoa(s.CPUCores),
+		"memory_mb":      strconv.FormatInt(s.MemoryMB, 10),
+		"os_name":        s.OSName,
+		"os_version":     s.OSVersion,
+		"kernel":         s.Kernel,
+	}
+	for k, v := range m {
+		if v == "" || v == "0" {
+			delete(m, k)
+		}
+	}
+	return m
+}
+
+func diskMap(disks []dto.InventoryDisk) map[string]string {
+	m := make(map[string]string, len(disks))
+	for _, d := range disks {
+		m[d.Mount] = fmt.Sprintf("%s %s %dMB", d.Device, d.FSType, d.SizeMB)
+	}
+	return m
+}
+
+func interfaceMap(ifaces []dto.InventoryInterface) map[string]string {
+	m := make(map[string]string, len(ifaces))
+	for _, it := range ifaces {
+		m[it.Name] = strings.TrimSpace(it.MAC + " " + strings.Join(it.Addrs, ","))
+	}
+	return m
+}
+
+func packageMap(pkgs []dto.InventoryPackage) map[string]string {
+	m := make(map[string]string, len(pkgs))
+	for _, p := range pkgs {
+		m[p.Manager+"/"+p.Name] = p.Version
+	}
+	return m
+}
+
+func userMap(users []dto.InventoryUser) map[string]string {
+	m := make(map[string]string, len(users))
+	for _, u := range users {
+		m[u.Name] = fmt.Sprintf("uid=%d home=%s shell=%s", u.UID, u.Home, u.Shell)
+	}
+	return m
+}
+
+// canonicalReport sắp xếp các danh sách để hash không phụ thuộc thứ tự agent gửi.
+func canonicalReport(rep *dto.InventoryReport) {
+	sort.Slice(rep.Disks, func(i, j int) bool { return rep.Disks[i].Mount < rep.Disks[j].Mount })
+	sort.Slice(rep.Interfaces, func(i, j int) bool { return rep.Interfaces[i].Name < rep.Interfaces[j].Name })
+	for i := range rep.Interfaces {
+		sort.Strings(rep.Interfaces[i].Addrs)
+	}
+	sort.Slice(rep.Packages, func(i, j int) bool {
+		a, b := rep.Packages[i], rep.Packages[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Manager < b.Manager
+	})
+	sort.Slice(rep.Users, func(i, j int) bool { return rep.Users[i].Name < rep.Users[j].Name })
+}
+
+// inventoryData trả về JSON lưu trong snapshot và hash nội dung (bỏ UnixTime).
+func inventoryData(rep dto.InventoryReport) (string, string, error) {
+	rep.UnixTime = 0
+	b, err := json.Marshal(rep)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256(b)
+	return string(b), hex.EncodeToString(sum[:]), nil
+}
+
+func clip(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max]
+}
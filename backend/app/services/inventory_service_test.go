@@ -0,0 +1,106 @@
+package services
+
+import (
+	"reflect"
+	"sagiri-guard/backend/app/dto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffInventory(t *testing.T) {
+	base := dto.InventoryReport{
+		System:     dto.InventorySystem{Hostname: "pc-1", OSName: "Ubuntu", OSVersion: "22.04", MemoryMB: 8192},
+		Disks:      []dto.InventoryDisk{{Device: "/dev/sda1", Mount: "/", FSType: "ext4", SizeMB: 1000}},
+		Interfaces: []dto.InventoryInterface{{Name: "eth0", MAC: "aa:bb", Addrs: []string{"10.0.0.2"}}},
+		Packages:   []dto.InventoryPackage{{Manager: "deb", Name: "curl", Version: "7.0"}},
+		Users:      []dto.InventoryUser{{Name: "alice", UID: 1000, Home: "/home/alice", Shell: "/bin/bash"}},
+	}
+	with := func(edit func(r *dto.InventoryReport)) dto.InventoryReport {
+		r := base
+		r.Disks = append([]dto.InventoryDisk(nil), base.Disks...)
+		r.Interfaces = append([]dto.InventoryInterface(nil), base.Interfaces...)
+		r.Packages = append([]dto.InventoryPackage(nil), base.Packages...)
+		r.Users = append([]dto.InventoryUser(nil), base.Users...)
+		edit(&r)
+		return r
+	}
+
+	tests := []struct {
+		name string
+		old  dto.InventoryReport
+		cur  dto.InventoryReport
+		want []string // category/action/item
+	}{
+		{name: "identical", old: base, cur: base},
+		{
+			name: "system field changed and cleared",
+			old:  base,
+			cur: with(func(r *dto.InventoryReport) {
+				r.System.OSVersion = "24.04"
+				r.System.MemoryMB = 0
+			}),
+			want: []string{"system/removed/memory_mb", "system/changed/os_version"},
+		},
+		{
+			name: "disk resized and added",
+			old:  base,
+			cur: with(func(r *dto.InventoryReport) {
+				r.Disks[0].SizeMB = 2000
+				r.Disks = append(r.Disks, dto.InventoryDisk{Device: "/dev/sdb1", Mount: "/data", FSType: "xfs", SizeMB: 500})
+			}),
+			want: []string{"disk/changed//", "disk/added//data"},
+		},
+		{
+			name: "interface removed, user added",
+			old:  base,
+			cur: with(func(r *dto.InventoryReport) {
+				r.Interfaces = nil
+				r.Users = append(r.Users, dto.InventoryUser{Name: "bob", UID: 1001})
+			}),
+			want: []string{"interface/removed/eth0", "user/added/bob"},
+		},
+		{
+			name: "package upgraded and installed",
+			old:  base,
+			cur: with(func(r *dto.InventoryReport) {
+				r.Packages[0].Version = "8.0"
+				r.Packages = append(r.Packages, dto.InventoryPackage{Manager: "deb", Name: "vim", Version: "9"})
+			}),
+			want: []string{"package/changed/deb/curl", "package/added/deb/vim"},
+		},
+		{
+			name: "truncated package list not diffed",
+			old:  base,
+			cur: with(func(r *dto.InventoryReport) {
+				r.Packages = nil
+				r.Truncated = true
+			}),
+		},
+	}
+	at := time.Unix(1700000000, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := DiffInventory("dev-1", tt.old, tt.cur, at)
+			var got []string
+			for _, c := range changes {
+				if c.DeviceID != "dev-1" || !c.DetectedAt.Equal(at) {
+					t.Errorf("change %+v missing device or time", c)
+				}
+				got = append(got, strings.Join([]string{c.Category, c.Action, c.Item}, "/"))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffInventory = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffInventoryValues(t *testing.T) {
+	old := dto.InventoryReport{Packages: []dto.InventoryPackage{{Manager: "deb", Name: "curl", Version: "7.0"}}}
+	cur := dto.InventoryReport{Packages: []dto.InventoryPackage{{Manager: "deb", Name: "curl", Version: "8.0"}}}
+	changes := DiffInventory("dev-1", old, cur, time.Now())
+	if len(changes) != 1 || changes[0].Old != "7.0" || changes[0].New != "8.0" {
+		t.Fatalf("changes = %+v, want one 7.0 -> 8.0 change", changes)
+	}
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+)
+
+var ErrPackNotFound = errors.New("osquery pack not found")
+
+const (
+	minPackInterval = 10
+	maxPackInterval = 7 * 24 * 3600
+)
+
+type OsqueryPackService struct {
+	repo   *repo.OsqueryPackRepository
+	groups *DeviceGroupService
+}
+
+func NewOsqueryPackService(r *repo.OsqueryPackRepository, groups *DeviceGroupService) *OsqueryPackService {
+	return &OsqueryPackService{repo: r, groups: groups}
+}
+
+// Save tạo hoặc cập nhật pack; danh sách query cũ được thay toàn bộ.
+func (s *OsqueryPackService) Save(req dto.AdminPackSaveRequest, actor string) (*models.OsqueryPack, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || strings.Contains(name, "/") {
+		return nil, errors.New("invalid pack name")
+	}
+	if len(req.Queries) == 0 {
+		return nil, errors.New("pack has no queries")
+	}
+	seen := map[string]bool{}
+	queries := make([]models.OsqueryPackQuery, 0, len(req.Queries))
+	for _, q := range req.Queries {
+		qn := strings.TrimSpace(q.Name)
+		if qn == "" || strings.Contains(qn, "/") {
+			return nil, fmt.Errorf("invalid query name %q", q.Name)
+		}
+		if seen[qn] {
+			return nil, fmt.Errorf("duplicate query name %q", qn)
+		}
+		seen[qn] = true
+		sql := NormalizeQuery(q.Query)
+		if sql == "" {
+			return nil, fmt.Errorf("query %q is empty", qn)
+		}
+		if q.IntervalSec < minPackInterval || q.IntervalSec > maxPackInterval {
+			return nil, fmt.Errorf("query %q: interval_sec must be between %d and %d", qn, minPackInterval, maxPackInterval)
+		}
+		queries = append(queries, models.OsqueryPackQuery{Name: qn, Query: sql, IntervalSec: q.IntervalSec})
+	}
+
+	p, err := s.repo.GetByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		p = &models.OsqueryPack{Name: name, CreatedBy: actor}
+	}
+	p.Description = strings.TrimSpace(req.Description)
+	if err := s.repo.Save(p, queries); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Delete xóa pack và trả về các device đang nhận pack (cần gửi lại cấu hình).
+func (s *OsqueryPackService) Delete(name string) ([]string, error) {
+	p, err := s.get(name)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.Devices(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Delete(p.ID); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// Assign giao hoặc gỡ pack khỏi device/group; trả về các device bị ảnh hưởng.
+func (s *OsqueryPackService) Assign(req dto.AdminPackAssignRequest) ([]string, error) {
+	p, err := s.get(req.Pack)
+	if err != nil {
+		return nil, err
+	}
+	deviceIDs := cleanIDs(req.DeviceIDs)
+	groups := cleanIDs(req.Groups)
+	if len(deviceIDs) == 0 && len(groups) == 0 {
+		return nil, errors.New("missing device_ids or groups")
+	}
+	affected := append([]string{}, deviceIDs...)
+	targets := make([]models.OsqueryPackTarget, 0, len(deviceIDs)+len(groups))
+	for _, id := range deviceIDs {
+		targets = append(targets, models.OsqueryPackTarget{PackID: p.ID, DeviceID: id})
+	}
+	for _, g := range groups {
+		members, err := s.groups.Resolve(g)
+		if err != nil && !(req.Remove && errors.Is(err, ErrGroupNotFound)) {
+			return nil, err
+		}
+		affected = append(affected, members...)
+		targets = append(targets, models.OsqueryPackTarget{PackID: p.ID, GroupName: g})
+	}
+	if req.Remove {
+		for _, t := range targets {
+			if err := s.repo.RemoveTarget(t); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := s.repo.AddTargets(targets); err != nil {
+		return nil, err
+	}
+	return uniqueSortedIDs(affected), nil
+}
+
+// Devices trả về mọi device nhận pack (giao trực tiếp hoặc qua group).
+func (s *OsqueryPackService) Devices(p *models.OsqueryPack) ([]string, error) {
+	targets, err := s.repo.Targets(p.ID)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, t := range targets {
+		if t.DeviceID != "" {
+			out = append(out, t.DeviceID)
+			continue
+		}
+		members, err := s.groupMembers(t.GroupName)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, members...)
+	}
+	return uniqueSortedIDs(out), nil
+}
+
+// ConfigFor dựng toàn bộ query pack của device kèm hash để agent báo lại.
+func (s *OsqueryPackService) ConfigFor(deviceID string) (dto.OsqueryPacksArg, error) {
+	arg := dto.OsqueryPacksArg{Queries: []dto.OsqueryPackQueryArg{}}
+	targets, err := s.repo.Targets(0)
+	if err != nil {
+		return arg, err
+	}
+	members := map[string]map[string]bool{}
+	packIDs := map[uint]bool{}
+	for _, t := range targets {
+		if t.DeviceID == deviceID {
+			packIDs[t.PackID] = true
+			continue
+		}
+		if t.GroupName == "" {
+			continue
+		}
+		set, ok := members[t.GroupName]
+		if !ok {
+			ids, err := s.groupMembers(t.GroupName)
+			if err != nil {
+				return arg, err
+			}
+			set = make(map[string]bool, len(ids))
+			for _, id := range ids {
+				set[id] = true
+			}
+			members[t.GroupName] = set
+		}
+		if set[deviceID] {
+			packIDs[t.PackID] = true
+		}
+	}
+	if len(packIDs) > 0 {
+		packs, err := s.repo.List()
+		if err != nil {
+			return arg, err
+		}
+		names := map[uint]string{}
+		ids := make([]uint, 0, len(packIDs))
+		for _, p := range packs {
+			if packIDs[p.ID] {
+				names[p.ID] = p.Name
+				ids = append(ids, p.ID)
+			}
+		}
+		queries, err := s.repo.Queries(ids)
+		if err != nil {
+			return arg, err
+		}
+		for _, q := range queries {
+			arg.Queries = append(arg.Queries, dto.OsqueryPackQueryArg{Pack: names[q.PackID], Name: q.Name, Query: q.Query, IntervalSec: q.IntervalSec})
+		}
+		sort.Slice(arg.Queries, func(i, j int) bool {
+			if arg.Queries[i].Pack != arg.Queries[j].Pack {
+				return arg.Queries[i].Pack < arg.Queries[j].Pack
+			}
+			return arg.Queries[i].Name < arg.Queries[j].Name
+		})
+	}
+	if len(arg.Queries) == 0 {
+		// agent chưa từng nhận pack cũng báo hash rỗng
+		return arg, nil
+	}
+	b, err := json.Marshal(arg.Queries)
+	if err != nil {
+		return arg, err
+	}
+	sum := sha256.Sum256(b)
+	arg.Hash = hex.EncodeToString(sum[:])
+	return arg, nil
+}
+
+// RecordDiff lưu các dòng thêm/bớt agent gửi về vào bảng lịch sử.
+func (s *OsqueryPackService) RecordDiff(deviceID string, d dto.OsqueryDiff) (int, error) {
+	if d.Pack == "" || d.Name == "" {
+		return 0, errors.New("missing pack or query name")
+	}
+	at := time.Unix(d.UnixTime, 0)
+	if d.UnixTime <= 0 {
+		at = time.Now()
+	}
+	rows := make([]models.OsqueryDiffRow, 0, len(d.Added)+len(d.Removed))
+	add := func(action string, list []json.RawMessage) {
+		for _, r := range list {
+			rows = append(rows, models.OsqueryDiffRow{
+				DeviceID:    deviceID,
+				Pack:        d.Pack,
+				QueryName:   d.Name,
+				CollectedAt: at,
+				Action:      action,
+				Counter:     d.Counter,
+				Row:         string(r),
+			})
+		}
+	}
+	add("added", d.Added)
+	add("removed", d.Removed)
+	return len(rows), s.repo.InsertDiffRows(rows)
+}
+
+// History trả về lịch sử diff của device, mới nhất trước; more cho biết còn trang sau.
+func (s *OsqueryPackService) History(req dto.AdminPackHistoryRequest) (entries []dto.OsqueryDiffEntry, more bool, err error) {
+	if req.DeviceID == "" {
+		return nil, false, errors.New("missing device_id")
+	}
+	if req.Action != "" && req.Action != "added" && req.Action != "removed" {
+		return nil, false, fmt.Errorf("unknown action %q", req.Action)
+	}
+	limit := req.Limit
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	f := repo.DiffHistoryFilter{
+		DeviceID:  req.DeviceID,
+		Pack:      req.Pack,
+		QueryName: req.Query,
+		Action:    req.Action,
+		Offset:    req.Offset,
+		Limit:     limit + 1,
+	}
+	if req.Since > 0 {
+		f.Since = time.Unix(req.Since, 0)
+	}
+	if req.Until > 0 {
+		f.Until = time.Unix(req.Until, 0)
+	}
+	rows, err := s.repo.DiffHistory(f)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(rows) > limit {
+		rows, more = rows[:limit], true
+	}
+	out := make([]dto.OsqueryDiffEntry, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, dto.OsqueryDiffEntry{
+			ID:          r.ID,
+			Pack:        r.Pack,
+			Query:       r.QueryName,
+			Action:      r.Action,
+			Row:         json.RawMessage(r.Row),
+			CollectedAt: r.CollectedAt.Unix(),
+		})
+	}
+	return out, more, nil
+}
+
+func (s *OsqueryPackService) List() ([]dto.OsqueryPackSummary, error) {
+	packs, err := s.repo.List()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(packs))
+	for _, p := range packs {
+		ids = append(ids, p.ID)
+	}
+	queries, err := s.repo.Queries(ids)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := s.repo.Targets(0)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*dto.OsqueryPackSummary, len(packs))
+	out := make([]dto.OsqueryPackSummary, len(packs))
+	for i, p := range packs {
+		out[i] = dto.OsqueryPackSummary{Name: p.Name, Description: p.Description, Queries: []string{}}
+		byID[p.ID] = &out[i]
+	}
+	for _, q := range queries {
+		if sum := byID[q.PackID]; sum != nil {
+			sum.Queries = append(sum.Queries, q.Name)
+		}
+	}
+	for _, t := range targets {
+		sum := byID[t.PackID]
+		if sum == nil {
+			continue
+		}
+		if t.DeviceID != "" {
+			sum.Devices = append(sum.Devices, t.DeviceID)
+		} else {
+			sum.Groups = append(sum.Groups, t.GroupName)
+		}
+	}
+	return out, nil
+}
+
+// Summary trả về tóm tắt của một pack (sau khi lưu).
+func (s *OsqueryPackService) Summary(name string) (dto.OsqueryPackSummary, error) {
+	list, err := s.List()
+	if err != nil {
+		return dto.OsqueryPackSummary{}, err
+	}
+	for _, p := range list {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return dto.OsqueryPackSummary{}, ErrPackNotFound
+}
+
+func (s *OsqueryPackService) get(name string) (*models.OsqueryPack, error) {
+	p, err := s.repo.GetByName(strings.TrimSpace(name))
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ErrPackNotFound
+	}
+	return p, nil
+}
+
+// groupMembers resolve group; group đã bị xóa được coi như không có thành viên.
+func (s *OsqueryPackService) groupMembers(name string) ([]string, error) {
+	if s.groups == nil {
+		return nil, nil
+	}
+	ids, err := s.groups.Resolve(name)
+	if errors.Is(err, ErrGroupNotFound) {
+		return nil, nil
+	}
+	return ids, err
+}
+
+func uniqueSortedIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	out := make([]string, 0, len(ids))
+	for _, id := range cleanIDs(ids) {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+)
+
+var ErrOsqueryResultNotFound = errors.New("osquery result not found")
+
+const maxStoredError = 1024
+
+type OsqueryService struct {
+	repo *repo.OsqueryResultRepository
+}
+
+func NewOsqueryService(r *repo.OsqueryResultRepository) *OsqueryService {
+	return &OsqueryService{repo: r}
+}
+
+// NormalizeQuery gom khoảng trắng và bỏ dấu ";" cuối để cùng một query viết
+// khác nhau vẫn được so sánh với nhau.
+func NormalizeQuery(q string) string {
+	q = strings.Join(strings.Fields(q), " ")
+	return strings.TrimSpace(strings.TrimRight(q, "; "))
+}
+
+// QueryHash là khóa tra cứu kết quả theo query đã chuẩn hóa.
+func QueryHash(q string) string {
+	sum := sha256.Sum256([]byte(NormalizeQuery(q)))
+	return hex.EncodeToString(sum[:])
+}
+
+// StoreResult lưu kết quả command osquery_run. Query lấy từ payload của command
+// (do backend gửi đi) chứ không tin dữ liệu agent báo về.
+func (s *OsqueryService) StoreResult(cmd *models.AgentCommand, errMsg string, output json.RawMessage) error {
+	var arg dto.OsqueryRunArg
+	if err := json.Unmarshal([]byte(cmd.Payload), &arg); err != nil {
+		return fmt.Errorf("decode osquery_run payload: %w", err)
+	}
+	res := models.OsqueryResult{
+		CommandID: cmd.ID,
+		DeviceID:  cmd.DeviceID,
+		QueryHash: QueryHash(arg.Query),
+		Query:     NormalizeQuery(arg.Query),
+		RowsJSON:  "[]",
+		Error:     errMsg,
+	}
+	if len(res.Error) > maxStoredError {
+		res.Error = res.Error[:maxStoredError]
+	}
+	if len(output) > 0 {
+		var out dto.OsqueryRunOutput
+		if err := json.Unmarshal(output, &out); err != nil {
+			return fmt.Errorf("decode osquery_run output: %w", err)
+		}
+		rows, err := canonicalRows(out.Rows)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(rows)
+		if err != nil {
+			return err
+		}
+		res.RowsJSON = string(b)
+		res.RowCount = out.RowCount
+		res.StoredRows = len(rows)
+		res.Truncated = out.Truncated || len(rows) < out.RowCount
+		res.RowsHash = rowsHash(rows)
+		res.DurationMs = out.DurationMs
+	}
+	return s.repo.Create(&res)
+}
+
+func (s *OsqueryService) Get(id uint) (*models.OsqueryResult, error) {
+	res, err := s.repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, ErrOsqueryResultNotFound
+	}
+	return res, nil
+}
+
+func (s *OsqueryService) ListByDevice(deviceID string, limit int) ([]models.OsqueryResult, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return s.repo.ListByDevice(deviceID, limit)
+}
+
+// Rows giải mã các dòng đã lưu của một kết quả.
+func (s *OsqueryService) Rows(res *models.OsqueryResult) ([]json.RawMessage, error) {
+	var rows []json.RawMessage
+	if res.RowsJSON == "" {
+		return rows, nil
+	}
+	err := json.Unmarshal([]byte(res.RowsJSON), &rows)
+	return rows, err
+}
+
+// Compare lấy kết quả mới nhất của query trên từng device và gom các device có
+// cùng tập dòng vào cùng variant (đánh số theo thứ tự xuất hiện).
+func (s *OsqueryService) Compare(query string, deviceIDs []string) (dto.OsqueryCompareResponse, error) {
+	resp := dto.OsqueryCompareResponse{Devices: []dto.OsqueryCompareEntry{}}
+	if NormalizeQuery(query) == "" {
+		return resp, errors.New("missing query")
+	}
+	hash := QueryHash(query)
+	variants := map[string]int{}
+	for _, deviceID := range deviceIDs {
+		res, err := s.repo.Latest(deviceID, hash)
+		if err != nil {
+			return resp, err
+		}
+		if res == nil {
+			resp.Missing = append(resp.Missing, deviceID)
+			continue
+		}
+		// lỗi thực thi là một variant riêng theo nội dung lỗi
+		key := "rows:" + res.RowsHash
+		if res.Error != "" {
+			key = "error:" + res.Error
+		}
+		v, ok := variants[key]
+		if !ok {
+			v = len(variants) + 1
+			variants[key] = v
+		}
+		resp.Devices = append(resp.Devices, dto.OsqueryCompareEntry{
+			DeviceID:  deviceID,
+			ResultID:  res.ID,
+			RowCount:  res.RowCount,
+			Truncated: res.Truncated,
+			Error:     res.Error,
+			CreatedAt: res.CreatedAt.Unix(),
+			Variant:   v,
+		})
+	}
+	resp.Variants = len(variants)
+	return resp, nil
+}
+
+// Diff trả về các dòng chỉ có ở left hoặc chỉ có ở right (so theo multiset).
+func (s *OsqueryService) Diff(leftID, rightID uint) (dto.OsqueryDiffResponse, error) {
+	resp := dto.OsqueryDiffResponse{LeftID: leftID, RightID: rightID}
+	left, err := s.Get(leftID)
+	if err != nil {
+		return resp, err
+	}
+	right, err := s.Get(rightID)
+	if err != nil {
+		return resp, err
+	}
+	lrows, err := s.Rows(left)
+	if err != nil {
+		return resp, err
+	}
+	rrows, err := s.Rows(right)
+	if err != nil {
+		return resp, err
+	}
+	remaining := map[string]int{}
+	for _, r := range rrows {
+		remaining[string(r)]++
+	}
+	resp.OnlyLeft = []json.RawMessage{}
+	for _, r := range lrows {
+		if remaining[string(r)] > 0 {
+			remaining[string(r)]--
+			resp.Common++
+			continue
+		}
+		resp.OnlyLeft = append(resp.OnlyLeft, r)
+	}
+	resp.OnlyRight = []json.RawMessage{}
+	for _, r := range rrows {
+		if remaining[string(r)] > 0 {
+			remaining[string(r)]--
+			resp.OnlyRight = append(resp.OnlyRight, r)
+		}
+	}
+	resp.OnlyLeftCount = len(resp.OnlyLeft)
+	resp.OnlyRightCount = len(resp.OnlyRight)
+	return resp, nil
+}
+
+// OsqueryResultToDTO chuyển kết quả sang dạng tóm tắt (không kèm dòng).
+func OsqueryResultToDTO(res models.OsqueryResult) dto.OsqueryResultSummary {
+	return dto.OsqueryResultSummary{
+		ID:         res.ID,
+		CommandID:  res.CommandID,
+		DeviceID:   res.DeviceID,
+		Query:      res.Query,
+		RowCount:   res.RowCount,
+		StoredRows: res.StoredRows,
+		Truncated:  res.Truncated,
+		RowsHash:   res.RowsHash,
+		Error:      res.Error,
+		DurationMs: res.DurationMs,
+		CreatedAt:  res.CreatedAt.Unix(),
+	}
+}
+
+// canonicalRows encode lại từng dòng với key đã sắp xếp để so sánh byte-by-byte.
+func canonicalRows(rows []json.RawMessage) ([]json.RawMessage, error) {
+	out := make([]json.RawMessage, 0, len(rows))
+	for _, r := range rows {
+		var m map[string]any
+		if err := json.Unmarshal(r, &m); err != nil {
+			return nil, fmt.Errorf("decode osquery row: %w", err)
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// rowsHash băm tập dòng không phụ thuộc thứ tự.
+func rowsHash(rows []json.RawMessage) string {
+	keys := make([]string, len(rows))
+	for i, r := range rows {
+		keys[i] = string(r)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sort"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPresenceDays = 7
+	maxPresenceDays     = 90
+)
+
+type PresenceService struct {
+	sessions *repo.DeviceSessionRepository
+	devices  *repo.DeviceRepository
+}
+
+func NewPresenceService(sessions *repo.DeviceSessionRepository, devices *repo.DeviceRepository) *PresenceService {
+	return &PresenceService{sessions: sessions, devices: devices}
+}
+
+// Connect mở session cho device đã đăng ký; trả về 0 nếu device chưa có
+// (vd: phiên admin) để không lẫn vào thống kê.
+func (s *PresenceService) Connect(deviceID, remoteAddr string, at time.Time) (uint, error) {
+	if _, err := s.devices.FindByUUID(deviceID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	sess := &models.DeviceSession{DeviceID: deviceID, ConnectedAt: at, RemoteAddr: remoteAddr}
+	if err := s.sessions.Create(sess); err != nil {
+		return 0, err
+	}
+	return sess.ID, s.devices.TouchSeen(deviceID, at, hostOf(remoteAddr))
+}
+
+// Disconnect đóng session và ghi nhận thời điểm thấy device lần cuối.
+func (s *PresenceService) Disconnect(sessionID uint, deviceID, reason string, at time.Time) error {
+	if err := s.sessions.Close(sessionID, at, reason); err != nil {
+		return err
+	}
+	return s.devices.TouchSeen(deviceID, at, "")
+}
+
+// Seen cập nhật LastSeenAt/LastIP khi nhận frame từ device.
+func (s *PresenceService) Seen(deviceID, remoteAddr string, at time.Time) error {
+	return s.devices.TouchSeen(deviceID, at, hostOf(remoteAddr))
+}
+
+// CloseDangling đóng các session còn mở từ lần chạy trước (backend dừng đột ngột);
+// thời điểm đóng là LastSeenAt của device nên uptime không bị tính dư.
+func (s *PresenceService) CloseDangling() (int, error) {
+	open, err := s.sessions.Open()
+	if err != nil {
+		return 0, err
+	}
+	for _, sess := range open {
+		end := sess.ConnectedAt
+		if d, err := s.devices.FindByUUID(sess.DeviceID); err == nil && d.LastSeenAt != nil && d.LastSeenAt.After(end) {
+			end = *d.LastSeenAt
+		}
+		if err := s.sessions.Close(sess.ID, end, "server_restart"); err != nil {
+			return 0, err
+		}
+	}
+	return len(open), nil
+}
+
+// PresenceWindow trả về cửa sổ [since, until) theo số ngày yêu cầu.
+func PresenceWindow(days int, now time.Time) (time.Time, time.Time) {
+	if days <= 0 {
+		days = defaultPresenceDays
+	}
+	if days > maxPresenceDays {
+		days = maxPresenceDays
+	}
+	return now.Add(-time.Duration(days) * 24 * time.Hour), now
+}
+
+// Summaries tính presence của mọi device trong cửa sổ; online cho biết device
+// nào đang kết nối. Kết quả sắp theo LastSeenAt tăng dần (lâu chưa thấy lên đầu).
+func (s *PresenceService) Summaries(since, until time.Time, notSeenDays int, online func(string) bool) ([]dto.DevicePresence, error) {
+	devices, err := s.devices.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.sessions.Overlapping("", since, until)
+	if err != nil {
+		return nil, err
+	}
+	byDevice := make(map[string][]models.DeviceSession)
+	for _, sess := range sessions {
+		byDevice[sess.DeviceID] = append(byDevice[sess.DeviceID], sess)
+	}
+	cutoff := until.Add(-time.Duration(notSeenDays) * 24 * time.Hour)
+	out := make([]dto.DevicePresence, 0, len(devices))
+	for _, d := range devices {
+		isOnline := online != nil && online(d.UUID)
+		if notSeenDays > 0 && (isOnline || d.LastSeenAt != nil && d.LastSeenAt.After(cutoff)) {
+			continue
+		}
+		p := DevicePresenceOf(d, byDevice[d.UUID], since, until)
+		p.Online = isOnline
+		out = append(out, p)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].LastSeenAt < out[j].LastSeenAt })
+	return out, nil
+}
+
+// Detail tính presence của một device và trả về các session gần đây.
+func (s *PresenceService) Detail(deviceID string, since, until time.Time, offset, limit int) (dto.DevicePresence, []dto.DeviceSessionEntry, bool, error) {
+	d, err := s.devices.FindByUUID(deviceID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return dto.DevicePresence{}, nil, false, errors.New("device not found")
+		}
+		return dto.DevicePresence{}, nil, false, err
+	}
+	sessions, err := s.sessions.Overlapping(deviceID, since, until)
+	if err != nil {
+		return dto.DevicePresence{}, nil, false, err
+	}
+	p := DevicePresenceOf(*d, sessions, since, until)
+
+	recent, err := s.sessions.Recent(deviceID, offset, limit+1)
+	if err != nil {
+		return p, nil, false, err
+	}
+	more := len(recent) > limit
+	if more {
+		recent = recent[:limit]
+	}
+	entries := make([]dto.DeviceSessionEntry, 0, len(recent))
+	for _, sess := range recent {
+		e := dto.DeviceSessionEntry{ConnectedAt: sess.ConnectedAt.Unix(), RemoteAddr: sess.RemoteAddr, CloseReason: sess.CloseReason}
+		end := until
+		if sess.DisconnectedAt != nil {
+			end = *sess.DisconnectedAt
+			e.DisconnectedAt = end.Unix()
+		}
+		e.DurationSec = int64(end.Sub(sess.ConnectedAt).Seconds())
+		entries = append(entries, e)
+	}
+	return p, entries, more, nil
+}
+
+// DevicePresenceOf tính uptime của device trong [since, until) từ các session
+// (hợp các khoảng để kết nối song song không bị tính hai lần).
+func DevicePresenceOf(d models.Device, sessions []models.DeviceSession, since, until time.Time) dto.DevicePresence {
+	start := since
+	if d.CreatedAt.After(start) {
+		start = d.CreatedAt
+	}
+	p := dto.DevicePresence{UUID: d.UUID, Name: d.Name, LastIP: d.LastIP, Sessions: len(sessions), WindowStart: start.Unix()}
+	if d.LastSeenAt != nil {
+		p.LastSeenAt = d.LastSeenAt.Unix()
+	}
+	window := until.Sub(start)
+	if window <= 0 {
+		return p
+	}
+	type span struct{ from, to time.Time }
+	spans := make([]span, 0, len(sessions))
+	for _, sess := range sessions {
+		from, to := sess.ConnectedAt, until
+		if sess.DisconnectedAt != nil {
+			to = *sess.DisconnectedAt
+		}
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(until) {
+			to = until
+		}
+		if to.After(from) {
+			spans = append(spans, span{from, to})
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].from.Before(spans[j].from) })
+	var covered time.Duration
+	var cur span
+	for i, sp := range spans {
+		if i == 0 || sp.from.After(cur.to) {
+			if i > 0 {
+				covered += cur.to.Sub(cur.from)
+			}
+			cur = sp
+			continue
+		}
+		if sp.to.After(cur.to) {
+			cur.to = sp.to
+		}
+	}
+	if len(spans) > 0 {
+		covered += cur.to.Sub(cur.from)
+	}
+	p.UptimePercent = math.Round(float64(covered)/float64(window)*10000) / 100
+	return p
+}
+
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"sagiri-guard/backend/app/models"
+	"testing"
+	"time"
+)
+
+func TestDevicePresenceOf(t *testing.T) {
+	since := time.Unix(1700000000, 0)
+	until := since.Add(10 * time.Hour)
+	at := func(h float64) time.Time { return since.Add(time.Duration(h * float64(time.Hour))) }
+	sess := func(from, to float64) models.DeviceSession {
+		s := models.DeviceSession{ConnectedAt: at(from)}
+		if to >= 0 {
+			end := at(to)
+			s.DisconnectedAt = &end
+		}
+		return s
+	}
+	dev := models.Device{UUID: "dev-1", CreatedAt: since.Add(-24 * time.Hour)}
+
+	tests := []struct {
+		name            string
+		device          models.Device
+		sessions        []models.DeviceSession
+		wantUptime      float64
+		wantWindowStart time.Time
+	}{
+		{name: "no sessions", device: dev, wantUptime: 0, wantWindowStart: since},
+		{name: "single closed session", device: dev, sessions: []models.DeviceSession{sess(1, 6)}, wantUptime: 50, wantWindowStart: since},
+		{name: "still connected", device: dev, sessions: []models.DeviceSession{sess(8, -1)}, wantUptime: 20, wantWindowStart: since},
+		{name: "overlapping sessions counted once", device: dev, sessions: []models.DeviceSession{sess(0, 4), sess(2, 5), sess(3, 3.5)}, wantUptime: 50, wantWindowStart: since},
+		{name: "disjoint sessions", device: dev, sessions: []models.DeviceSession{sess(6, 7), sess(0, 1)}, wantUptime: 20, wantWindowStart: since},
+		{name: "session before window clipped", device: dev, sessions: []models.DeviceSession{sess(-5, 2)}, wantUptime: 20, wantWindowStart: since},
+		{
+			name:            "device created inside window",
+			device:          models.Device{UUID: "dev-2", CreatedAt: at(5)},
+			sessions:        []models.DeviceSession{sess(5, 7.5)},
+			wantUptime:      50,
+			wantWindowStart: at(5),
+		},
+		{
+			name:            "device created after window",
+			device:          models.Device{UUID: "dev-3", CreatedAt: at(11)},
+			wantUptime:      0,
+			wantWindowStart: at(11),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := DevicePresenceOf(tt.device, tt.sessions, since, until)
+			if p.UptimePercent != tt.wantUptime {
+				t.Errorf("UptimePercent = %v, want %v", p.UptimePercent, tt.wantUptime)
+			}
+			if p.WindowStart != tt.wantWindowStart.Unix() {
+				t.Errorf("WindowStart = %d, want %d", p.WindowStart, tt.wantWindowStart.Unix())
+			}
+			if p.Sessions != len(tt.sessions) || p.UUID != tt.device.UUID {
+				t.Errorf("presence = %+v, want %d sessions for %s", p, len(tt.sessions), tt.device.UUID)
+			}
+		})
+	}
+}
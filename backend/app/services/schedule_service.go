@@ -0,0 +1,216 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"sagiri-guard/backend/app/cron"
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+)
+
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// ScheduledRun là một lần chạy đã được claim, sẵn sàng sinh AgentCommand.
+type ScheduledRun struct {
+	Schedule models.ScheduledCommand
+	Slot     time.Time
+	BatchID  string
+}
+
+type ScheduleService struct {
+	repo   *repo.ScheduledCommandRepository
+	groups *DeviceGroupService
+}
+
+func NewScheduleService(r *repo.ScheduledCommandRepository, groups *DeviceGroupService) *ScheduleService {
+	return &ScheduleService{repo: r, groups: groups}
+}
+
+// Create kiểm tra cron/timezone/target rồi lưu schedule với lần chạy đầu tiên.
+func (s *ScheduleService) Create(req dto.AdminScheduleCreateRequest, actor string) (*models.ScheduledCommand, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || req.Command == "" {
+		return nil, errors.New("missing name or command")
+	}
+	if (req.DeviceID == "") == (req.Group == "") {
+		return nil, errors.New("exactly one of device_id or group is required")
+	}
+	if req.Group != "" && s.groups != nil {
+		if _, err := s.groups.Resolve(req.Group); err != nil {
+			return nil, err
+		}
+	}
+	if existing, err := s.repo.GetByName(name); err != nil {
+		return nil, err
+	} else if existing != nil {
+		return nil, fmt.Errorf("schedule %q already exists", name)
+	}
+	sched := models.ScheduledCommand{
+		Name:        name,
+		CronExpr:    strings.TrimSpace(req.Cron),
+		Timezone:    strings.TrimSpace(req.Timezone),
+		DeviceID:    req.DeviceID,
+		GroupName:   req.Group,
+		Command:     req.Command,
+		Kind:        req.Kind,
+		Payload:     string(req.Payload),
+		Paused:      req.Paused,
+		CreatedBy:   actor,
+		TTLSec:      req.TTLSec,
+		MaxAttempts: req.MaxAttempts,
+	}
+	next, err := nextRun(&sched, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !req.Paused {
+		sched.NextRunAt = next
+	}
+	if err := s.repo.Create(&sched); err != nil {
+		return nil, err
+	}
+	return &sched, nil
+}
+
+// SetPaused tạm dừng hoặc tiếp tục schedule. Khi tiếp tục, lần chạy kế tiếp được
+// tính từ hiện tại: các slot bị lỡ trong lúc pause không được chạy bù.
+func (s *ScheduleService) SetPaused(id uint, name string, paused bool) (*models.ScheduledCommand, error) {
+	sched, err := s.find(id, name)
+	if err != nil {
+		return nil, err
+	}
+	var next *time.Time
+	if !paused {
+		if next, err = nextRun(sched, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.repo.SetPaused(sched.ID, paused, next); err != nil {
+		return nil, err
+	}
+	sched.Paused = paused
+	sched.NextRunAt = next
+	return sched, nil
+}
+
+func (s *ScheduleService) List() ([]dto.ScheduleSummary, error) {
+	list, err := s.repo.List()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]dto.ScheduleSummary, 0, len(list))
+	for i := range list {
+		out = append(out, ScheduleToDTO(&list[i]))
+	}
+	return out, nil
+}
+
+// ClaimDue claim các schedule đã tới giờ. Mỗi schedule chạy tối đa một lần cho
+// mỗi lượt, kể cả khi backend tắt qua nhiều slot: các slot lỡ được gộp thành một
+// lần chạy và next_run_at nhảy tới slot tương lai. Claim có điều kiện trên
+// next_run_at nên hai runner (hoặc hai tick chồng nhau) không chạy trùng.
+func (s *ScheduleService) ClaimDue(now time.Time) ([]ScheduledRun, error) {
+	due, err := s.repo.Due(now)
+	if err != nil {
+		return nil, err
+	}
+	var runs []ScheduledRun
+	for _, sched := range due {
+		slot := *sched.NextRunAt
+		next, err := nextRun(&sched, now)
+		if err != nil {
+			// biểu thức không còn hợp lệ (vd. timezone bị gỡ): dừng schedule
+			next = nil
+		}
+		batchID := fmt.Sprintf("sched-%d-%d", sched.ID, slot.Unix())
+		ok, err := s.repo.Claim(sched.ID, slot, next, batchID)
+		if err != nil {
+			return runs, err
+		}
+		if !ok {
+			continue
+		}
+		runs = append(runs, ScheduledRun{Schedule: sched, Slot: slot, BatchID: batchID})
+	}
+	return runs, nil
+}
+
+// Targets trả về danh sách device của một lần chạy (group được resolve tại thời điểm chạy).
+func (s *ScheduleService) Targets(sched *models.ScheduledCommand) ([]string, error) {
+	if sched.GroupName == "" {
+		return []string{sched.DeviceID}, nil
+	}
+	if s.groups == nil {
+		return nil, errors.New("device group service not available")
+	}
+	return s.groups.Resolve(sched.GroupName)
+}
+
+func (s *ScheduleService) find(id uint, name string) (*models.ScheduledCommand, error) {
+	var (
+		sched *models.ScheduledCommand
+		err   error
+	)
+	if id != 0 {
+		sched, err = s.repo.Get(id)
+	} else {
+		sched, err = s.repo.GetByName(strings.TrimSpace(name))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sched == nil {
+		return nil, ErrScheduleNotFound
+	}
+	return sched, nil
+}
+
+// nextRun tính slot cron kế tiếp sau after theo timezone của schedule.
+func nextRun(sched *models.ScheduledCommand, after time.Time) (*time.Time, error) {
+	expr, err := cron.Parse(sched.CronExpr)
+	if err != nil {
+		return nil, err
+	}
+	loc := time.Local
+	if sched.Timezone != "" {
+		if loc, err = time.LoadLocation(sched.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", sched.Timezone, err)
+		}
+	}
+	next := expr.Next(after.In(loc))
+	if next.IsZero() {
+		return nil, fmt.Errorf("cron %q never fires", sched.CronExpr)
+	}
+	next = next.UTC()
+	return &next, nil
+}
+
+func ScheduleToDTO(s *models.ScheduledCommand) dto.ScheduleSummary {
+	out := dto.ScheduleSummary{
+		ID:          s.ID,
+		Name:        s.Name,
+		Cron:        s.CronExpr,
+		Timezone:    s.Timezone,
+		DeviceID:    s.DeviceID,
+		Group:       s.GroupName,
+		Command:     s.Command,
+		Paused:      s.Paused,
+		LastBatchID: s.LastBatchID,
+		RunCount:    s.RunCount,
+	}
+	if s.Payload != "" {
+		out.Payload = json.RawMessage(s.Payload)
+	}
+	if s.NextRunAt != nil {
+		out.NextRunAt = s.NextRunAt.Unix()
+	}
+	if s.LastRunAt != nil {
+		out.LastRunAt = s.LastRunAt.Unix()
+	}
+	return out
+}
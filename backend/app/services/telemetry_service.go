@@ -0,0 +1,143 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+)
+
+// Trạng thái sức khỏe agent trong danh sách device.
+const (
+	HealthOK        = "healthy"
+	HealthUnhealthy = "unhealthy"
+	HealthStale     = "stale"
+)
+
+// Ngưỡng đánh giá sức khỏe agent.
+const (
+	telemetryRetention     = 24 * time.Hour
+	staleAfterIntervals    = 3
+	minStaleAfter          = 3 * time.Minute
+	maxAgentCPUPercent     = 80
+	maxAgentMemoryMB       = 1024
+	minDiskFreeMB          = 1024
+	maxBackupQueue         = 1000
+	maxTreeSyncAge         = 10 * time.Minute
+	defaultTelemetryWindow = 60
+)
+
+type TelemetryService struct {
+	repo *repo.DeviceTelemetryRepository
+}
+
+func NewTelemetryService(r *repo.DeviceTelemetryRepository) *TelemetryService {
+	return &TelemetryService{repo: r}
+}
+
+// Record lưu mẫu telemetry và xóa các mẫu quá thời gian lưu giữ của device.
+func (s *TelemetryService) Record(deviceID string, t dto.Telemetry) error {
+	if deviceID == "" {
+		return errors.New("missing device id")
+	}
+	now := time.Now()
+	syncAge := int64(-1)
+	if t.LastTreeSync > 0 && t.UnixTime >= t.LastTreeSync {
+		syncAge = t.UnixTime - t.LastTreeSync
+	}
+	row := &models.DeviceTelemetry{
+		DeviceID:     deviceID,
+		AgentVersion: clip(t.AgentVersion, 64),
+		UptimeSec:    t.UptimeSec,
+		CPUPercent:   math.Round(t.CPUPercent*10) / 10,
+		MemoryMB:     math.Round(t.MemoryMB*10) / 10,
+		Goroutines:   t.Goroutines,
+		DiskFreeMB:   t.DiskFreeMB,
+		BackupQueue:  t.BackupQueue,
+		MonitorPaths: t.MonitorPaths,
+		WatchCount:   t.WatchCount,
+		SyncAgeSec:   syncAge,
+		IntervalSec:  t.IntervalSec,
+		ReportedAt:   now,
+	}
+	if err := s.repo.Create(row); err != nil {
+		return err
+	}
+	return s.repo.PruneBefore(deviceID, now.Add(-telemetryRetention))
+}
+
+// Recent trả về các mẫu gần nhất của device (mới nhất trước).
+func (s *TelemetryService) Recent(deviceID string, limit int) ([]models.DeviceTelemetry, error) {
+	if limit <= 0 || limit > 1440 {
+		limit = defaultTelemetryWindow
+	}
+	return s.repo.Recent(deviceID, limit)
+}
+
+// HealthByDevice đánh giá sức khỏe theo mẫu mới nhất của mỗi device.
+func (s *TelemetryService) HealthByDevice(now time.Time) (map[string]string, map[string][]string, error) {
+	rows, err := s.repo.LatestAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	status := make(map[string]string, len(rows))
+	issues := make(map[string][]string, len(rows))
+	for _, r := range rows {
+		status[r.DeviceID], issues[r.DeviceID] = EvaluateHealth(r, now)
+	}
+	return status, issues, nil
+}
+
+// EvaluateHealth trả về trạng thái và lý do của một mẫu telemetry.
+func EvaluateHealth(t models.DeviceTelemetry, now time.Time) (string, []string) {
+	staleAfter := time.Duration(t.IntervalSec) * time.Second * staleAfterIntervals
+	if staleAfter < minStaleAfter {
+		staleAfter = minStaleAfter
+	}
+	if age := now.Sub(t.ReportedAt); age > staleAfter {
+		return HealthStale, []string{fmt.Sprintf("no telemetry for %s", age.Truncate(time.Second))}
+	}
+	var issues []string
+	if t.CPUPercent > maxAgentCPUPercent {
+		issues = append(issues, fmt.Sprintf("agent cpu %.0f%%", t.CPUPercent))
+	}
+	if t.MemoryMB > maxAgentMemoryMB {
+		issues = append(issues, fmt.Sprintf("agent memory %.0fMB", t.MemoryMB))
+	}
+	if t.DiskFreeMB >= 0 && t.DiskFreeMB < minDiskFreeMB {
+		issues = append(issues, fmt.Sprintf("disk free %dMB", t.DiskFreeMB))
+	}
+	if t.BackupQueue > maxBackupQueue {
+		issues = append(issues, fmt.Sprintf("backup queue %d", t.BackupQueue))
+	}
+	if t.MonitorPaths > 0 && t.WatchCount == 0 {
+		issues = append(issues, "file monitor not watching")
+	}
+	syncStalled := t.SyncAgeSec > int64(maxTreeSyncAge/time.Second) ||
+		t.SyncAgeSec < 0 && t.UptimeSec > int64(maxTreeSyncAge/time.Second)
+	if syncStalled {
+		issues = append(issues, "file tree sync stalled")
+	}
+	if len(issues) > 0 {
+		return HealthUnhealthy, issues
+	}
+	return HealthOK, nil
+}
+
+func TelemetryToDTO(t models.DeviceTelemetry) dto.TelemetrySample {
+	return dto.TelemetrySample{
+		ReportedAt:   t.ReportedAt.Unix(),
+		AgentVersion: t.AgentVersion,
+		UptimeSec:    t.UptimeSec,
+		CPUPercent:   t.CPUPercent,
+		MemoryMB:     t.MemoryMB,
+		DiskFreeMB:   t.DiskFreeMB,
+		BackupQueue:  t.BackupQueue,
+		WatchCount:   t.WatchCount,
+		SyncAgeSec:   t.SyncAgeSec,
+	}
+}
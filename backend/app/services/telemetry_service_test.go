@@ -0,0 +1,100 @@
+package services
+
+import (
+	"reflect"
+	"sagiri-guard/backend/app/models"
+	"testing"
+	"time"
+)
+
+func TestEvaluateHealth(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	healthy := models.DeviceTelemetry{
+		UptimeSec:    3600,
+		CPUPercent:   5,
+		MemoryMB:     80,
+		DiskFreeMB:   50000,
+		MonitorPaths: 1,
+		WatchCount:   10,
+		SyncAgeSec:   30,
+		IntervalSec:  60,
+		ReportedAt:   now.Add(-30 * time.Second),
+	}
+	with := func(edit func(*models.DeviceTelemetry)) models.DeviceTelemetry {
+		t := healthy
+		edit(&t)
+		return t
+	}
+
+	tests := []struct {
+		name       string
+		in         models.DeviceTelemetry
+		wantStatus string
+		wantIssues []string
+	}{
+		{name: "healthy", in: healthy, wantStatus: HealthOK},
+		{
+			name:       "stale after three intervals",
+			in:         with(func(t *models.DeviceTelemetry) { t.IntervalSec = 120; t.ReportedAt = now.Add(-7 * time.Minute) }),
+			wantStatus: HealthStale,
+			wantIssues: []string{"no telemetry for 7m0s"},
+		},
+		{
+			name:       "short interval uses minimum stale window",
+			in:         with(func(t *models.DeviceTelemetry) { t.IntervalSec = 10; t.ReportedAt = now.Add(-2 * time.Minute) }),
+			wantStatus: HealthOK,
+		},
+		{
+			name: "resource issues",
+			in: with(func(t *models.DeviceTelemetry) {
+				t.CPUPercent = 95
+				t.MemoryMB = 2048
+				t.DiskFreeMB = 100
+				t.BackupQueue = 5000
+			}),
+			wantStatus: HealthUnhealthy,
+			wantIssues: []string{"agent cpu 95%", "agent memory 2048MB", "disk free 100MB", "backup queue 5000"},
+		},
+		{
+			name:       "unknown disk free ignored",
+			in:         with(func(t *models.DeviceTelemetry) { t.DiskFreeMB = -1 }),
+			wantStatus: HealthOK,
+		},
+		{
+			name:       "monitor not watching",
+			in:         with(func(t *models.DeviceTelemetry) { t.WatchCount = 0 }),
+			wantStatus: HealthUnhealthy,
+			wantIssues: []string{"file monitor not watching"},
+		},
+		{
+			name:       "no monitor paths configured",
+			in:         with(func(t *models.DeviceTelemetry) { t.MonitorPaths = 0; t.WatchCount = 0 }),
+			wantStatus: HealthOK,
+		},
+		{
+			name:       "sync stalled",
+			in:         with(func(t *models.DeviceTelemetry) { t.SyncAgeSec = 3600 }),
+			wantStatus: HealthUnhealthy,
+			wantIssues: []string{"file tree sync stalled"},
+		},
+		{
+			name:       "never synced on fresh agent",
+			in:         with(func(t *models.DeviceTelemetry) { t.SyncAgeSec = -1; t.UptimeSec = 60 }),
+			wantStatus: HealthOK,
+		},
+		{
+			name:       "never synced after long uptime",
+			in:         with(func(t *models.DeviceTelemetry) { t.SyncAgeSec = -1; t.UptimeSec = 3600 }),
+			wantStatus: HealthUnhealthy,
+			wantIssues: []string{"file tree sync stalled"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, issues := EvaluateHealth(tt.in, now)
+			if status != tt.wantStatus || !reflect.DeepEqual(issues, tt.wantIssues) {
+				t.Errorf("EvaluateHealth = %s %v, want %s %v", status, issues, tt.wantStatus, tt.wantIssues)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"sagiri-guard/backend/app/dto"
+	jwtutil "sagiri-guard/backend/app/jwt"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+	"sagiri-guard/backend/global"
+)
+
+var (
+	ErrTokenRevoked        = errors.New("token has been revoked")
+	ErrRefreshReused       = errors.New("refresh token was already used; all tokens of the device have been revoked")
+	ErrTokenDeviceMismatch = errors.New("token was issued to another device")
+)
+
+const (
+	RevokeReasonLogout     = "logout"
+	RevokeReasonRotated    = "rotated"
+	RevokeReasonAdmin      = "admin"
+	RevokeReasonSuperseded = "superseded"
+)
+
+// refreshRetryGrace là khoảng agent được gửi lại refresh token vừa xoay khi
+// không nhận được cặp token mới (mất kết nối giữa chừng) mà không bị coi là reuse.
+const refreshRetryGrace = 2 * time.Minute
+
+type revokedJTI struct {
+	expiresAt time.Time
+	reason    string
+	revokedAt time.Time
+	next      string    // jti refresh token cấp khi xoay token này (chỉ giữ trong bộ nhớ)
+	nextExp   time.Time // hạn của refresh token next
+}
+
+// TokenService cấp cặp access/refresh token và giữ danh sách thu hồi (theo jti
+// và theo device). Danh sách được cache trong bộ nhớ vì mọi frame của device
+// đều kiểm tra token đang dùng.
+type TokenService struct {
+	signer  *jwtutil.Signer
+	repo    *repo.TokenRevocationRepository
+	mu      sync.RWMutex
+	revoked map[string]revokedJTI // jti -> token gốc hết hạn lúc nào
+	cutoffs map[string]time.Time  // deviceID -> token cấp từ mốc này trở về trước bị thu hồi
+}
+
+func NewTokenService(signer *jwtutil.Signer, r *repo.TokenRevocationRepository) *TokenService {
+	return &TokenService{
+		signer:  signer,
+		repo:    r,
+		revoked: make(map[string]revokedJTI),
+		cutoffs: make(map[string]time.Time),
+	}
+}
+
+// Load nạp danh sách thu hồi từ DB (xóa trước các jti đã hết hạn).
+func (s *TokenService) Load() error {
+	now := time.Now()
+	if n, err := s.repo.PruneTokens(now); err != nil {
+		return err
+	} else if n > 0 {
+		global.Logger.Info().Int64("count", n).Msg("pruned expired token revocations")
+	}
+	tokens, err := s.repo.ActiveTokens(now)
+	if err != nil {
+		return err
+	}
+	cutoffs, err := s.repo.DeviceCutoffs()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range tokens {
+		s.revoked[t.JTI] = revokedJTI{expiresAt: t.ExpiresAt, reason: t.Reason, revokedAt: t.RevokedAt}
+	}
+	for _, d := range cutoffs {
+		s.cutoffs[d.DeviceID] = d.RevokedBefore
+	}
+	return nil
+}
+
+// Issue cấp access token ngắn hạn kèm refresh token.
+func (s *TokenService) Issue(userID uint, username, role, deviceID string) (dto.TokenPair, error) {
+	access, accessClaims, err := s.signer.SignAccess(userID, username, role, deviceID)
+	if err != nil {
+		return dto.TokenPair{}, err
+	}
+	refresh, refreshClaims, err := s.signer.SignRefresh(userID, username, role, deviceID)
+	if err != nil {
+		return dto.TokenPair{}, err
+	}
+	return dto.TokenPair{
+		Token:            access,
+		RefreshToken:     refresh,
+		ExpiresAt:        accessClaims.ExpiresAt.Unix(),
+		RefreshExpiresAt: refreshClaims.ExpiresAt.Unix(),
+		DeviceID:         deviceID,
+	}, nil
+}
+
+// Validate kiểm tra access token: chữ ký, hạn dùng và danh sách thu hồi.
+func (s *TokenService) Validate(token string) (*jwtutil.Claims, error) {
+	claims, err := s.signer.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	if s.isRevoked(claims) {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// Refresh đổi refresh token lấy cặp token mới. Refresh token cũ bị thu hồi
+// ngay; nếu nó được dùng lại (bị đánh cắp hoặc sao chép) thì mọi token của
+// device bị thu hồi. Ngoại lệ: gửi lại trong refreshRetryGrace khi token cấp
+// lúc xoay chưa được dùng thì cấp cặp mới thay cho cặp agent không nhận được.
+func (s *TokenService) Refresh(refreshToken, deviceID string) (dto.TokenPair, error) {
+	claims, err := s.signer.ParseRefresh(refreshToken)
+	if err != nil {
+		return dto.TokenPair{}, err
+	}
+	if deviceID != "" && claims.DeviceID != deviceID {
+		return dto.TokenPair{}, ErrTokenDeviceMismatch
+	}
+	s.mu.RLock()
+	prev, seen := s.revoked[claims.ID]
+	s.mu.RUnlock()
+	if seen && prev.reason == RevokeReasonRotated {
+		return s.refreshRetry(claims, prev)
+	}
+	if s.isRevoked(claims) {
+		return dto.TokenPair{}, ErrTokenRevoked
+	}
+	fresh, err := s.revoke(claims, RevokeReasonRotated, claims.DeviceID)
+	if err != nil {
+		return dto.TokenPair{}, err
+	}
+	if !fresh {
+		// hai lần refresh đồng thời bằng cùng một token
+		return dto.TokenPair{}, s.refreshReused(claims)
+	}
+	return s.issueRotated(claims)
+}
+
+// refreshRetry xử lý refresh token đã xoay được gửi lại. Trong grace và khi
+// token kế tiếp chưa được dùng, token kế tiếp bị thay thế (superseded) để chỉ
+// còn một chuỗi refresh; ngoài ra là reuse.
+func (s *TokenService) refreshRetry(claims *jwtutil.Claims, prev revokedJTI) (dto.TokenPair, error) {
+	if prev.next == "" || time.Since(prev.revokedAt) > refreshRetryGrace || s.cutoffRevoked(claims) {
+		return dto.TokenPair{}, s.refreshReused(claims)
+	}
+	fresh, err := s.store(&models.RevokedToken{
+		JTI:       prev.next,
+		DeviceID:  claims.DeviceID,
+		Type:      jwtutil.TypeRefresh,
+		Reason:    RevokeReasonSuperseded,
+		RevokedBy: "system",
+		ExpiresAt: prev.nextExp,
+	})
+	if err != nil {
+		return dto.TokenPair{}, err
+	}
+	if !fresh {
+		// token kế tiếp đã được dùng hoặc bị thu hồi: chuỗi đã đi tiếp
+		return dto.TokenPair{}, s.refreshReused(claims)
+	}
+	global.Logger.Info().Str("device", claims.DeviceID).Str("jti", claims.ID).Msg("rotated refresh token retried within grace")
+	return s.issueRotated(claims)
+}
+
+// issueRotated cấp cặp token mới cho refresh token vừa xoay và nhớ jti kế tiếp.
+func (s *TokenService) issueRotated(claims *jwtutil.Claims) (dto.TokenPair, error) {
+	pair, err := s.Issue(claims.UserID, claims.Username, claims.Role, claims.DeviceID)
+	if err != nil {
+		return dto.TokenPair{}, err
+	}
+	next, err := s.signer.ParseRefresh(pair.RefreshToken)
+	if err != nil {
+		return dto.TokenPair{}, err
+	}
+	s.mu.Lock()
+	if e, ok := s.revoked[claims.ID]; ok {
+		e.next = next.ID
+		e.nextExp = next.ExpiresAt.Time
+		s.revoked[claims.ID] = e
+	}
+	s.mu.Unlock()
+	return pair, nil
+}
+
+func (s *TokenService) refreshReused(claims *jwtutil.Claims) error {
+	global.Logger.Warn().Str("device", claims.DeviceID).Str("jti", claims.ID).Msg("refresh token reuse detected, revoking device tokens")
+	if _, err := s.RevokeDevice(claims.DeviceID, "refresh token reuse", "system"); err != nil {
+		global.Logger.Error().Err(err).Str("device", claims.DeviceID).Msg("revoke device after refresh reuse failed")
+	}
+	return ErrRefreshReused
+}
+
+// RevokeClaims thu hồi token đã parse (logout).
+func (s *TokenService) RevokeClaims(claims *jwtutil.Claims, reason, actor string) error {
+	_, err := s.revoke(claims, reason, actor)
+	return err
+}
+
+// RevokeRefresh thu hồi refresh token mà device gửi lên (logout).
+func (s *TokenService) RevokeRefresh(refreshToken, deviceID, reason, actor string) error {
+	claims, err := s.signer.ParseRefresh(refreshToken)
+	if err != nil {
+		return err
+	}
+	if claims.DeviceID != deviceID {
+		return ErrTokenDeviceMismatch
+	}
+	return s.RevokeClaims(claims, reason, actor)
+}
+
+// RevokeJTI thu hồi token theo jti khi không có token gốc (admin). expiresAt
+// zero thì giữ bản ghi theo thời hạn refresh token.
+func (s *TokenService) RevokeJTI(jti, deviceID string, expiresAt time.Time, reason, actor string) error {
+	if jti == "" {
+		return errors.New("missing jti")
+	}
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(time.Duration(s.signer.RefreshExpMin) * time.Minute)
+	}
+	_, err := s.store(&models.RevokedToken{JTI: jti, DeviceID: deviceID, Reason: reason, RevokedBy: actor, ExpiresAt: expiresAt})
+	return err
+}
+
+func (s *TokenService) revoke(claims *jwtutil.Claims, reason, actor string) (bool, error) {
+	if claims.ID == "" {
+		// token cấp trước khi có jti chỉ thu hồi được theo device
+		return false, errors.New("token has no jti; revoke the device instead")
+	}
+	typ := claims.Type
+	if typ == "" {
+		typ = jwtutil.TypeAccess
+	}
+	return s.store(&models.RevokedToken{
+		JTI:       claims.ID,
+		DeviceID:  claims.DeviceID,
+		Type:      typ,
+		Reason:    reason,
+		RevokedBy: actor,
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
+}
+
+func (s *TokenService) store(t *models.RevokedToken) (bool, error) {
+	now := time.Now()
+	t.RevokedAt = now
+	fresh, err := s.repo.RevokeToken(t)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	for jti, e := range s.revoked {
+		if !e.expiresAt.After(now) {
+			delete(s.revoked, jti)
+		}
+	}
+	if _, ok := s.revoked[t.JTI]; !ok || fresh {
+		s.revoked[t.JTI] = revokedJTI{expiresAt: t.ExpiresAt, reason: t.Reason, revokedAt: now}
+	}
+	s.mu.Unlock()
+	return fresh, nil
+}
+
+// RevokeDevice thu hồi mọi token đã cấp cho device tới thời điểm hiện tại. JWT
+// chỉ lưu iat theo giây nên token cấp trong cùng giây cũng bị thu hồi.
+func (s *TokenService) RevokeDevice(deviceID, reason, actor string) (time.Time, error) {
+	if deviceID == "" {
+		return time.Time{}, errors.New("missing device id")
+	}
+	cutoff := time.Now().Truncate(time.Second)
+	if err := s.repo.SetDeviceCutoff(&models.DeviceRevocation{
+		DeviceID:      deviceID,
+		RevokedBefore: cutoff,
+		Reason:        reason,
+		RevokedBy:     actor,
+	}); err != nil {
+		return time.Time{}, err
+	}
+	s.mu.Lock()
+	s.cutoffs[deviceID] = cutoff
+	s.mu.Unlock()
+	return cutoff, nil
+}
+
+func (s *TokenService) isRevoked(claims *jwtutil.Claims) bool {
+	s.mu.RLock()
+	_, ok := s.revoked[claims.ID]
+	s.mu.RUnlock()
+	if claims.ID != "" && ok {
+		return true
+	}
+	return s.cutoffRevoked(claims)
+}
+
+// cutoffRevoked cho biết token cấp trước mốc thu hồi của device.
+func (s *TokenService) cutoffRevoked(claims *jwtutil.Claims) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if cutoff, ok := s.cutoffs[claims.DeviceID]; ok {
+		if claims.IssuedAt == nil || !claims.IssuedAt.Time.After(cutoff) {
+			return true
+		}
+	}
+	return false
+}
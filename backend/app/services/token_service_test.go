@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwtutil "sagiri-guard/backend/app/jwt"
+	"sagiri-guard/backend/app/models"
+	"sagiri-guard/backend/app/repo"
+	"sagiri-guard/backend/global"
+
+	"github.com/rs/zerolog"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTokenTestService(t *testing.T) *TokenService {
+	t.Helper()
+	global.Logger = zerolog.Nop()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.RevokedToken{}, &models.DeviceRevocation{}); err != nil {
+		t.Fatal(err)
+	}
+	signer := &jwtutil.Signer{Secret: []byte("test-secret"), Issuer: "test", ExpMin: 15, RefreshExpMin: 60}
+	s := NewTokenService(signer, repo.NewTokenRevocationRepository(db))
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestTokenRefreshRotation(t *testing.T) {
+	s := newTokenTestService(t)
+	first, err := s.Issue(1, "agent", "device", "dev-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Refresh(first.RefreshToken, "dev-2"); !errors.Is(err, ErrTokenDeviceMismatch) {
+		t.Fatalf("Refresh(other device) error = %v, want ErrTokenDeviceMismatch", err)
+	}
+	second, err := s.Refresh(first.RefreshToken, "dev-1")
+	if err != nil {
+		t.Fatalf("Refresh error = %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("Refresh returned the same refresh token")
+	}
+	if _, err := s.Refresh(second.RefreshToken, "dev-1"); err != nil {
+		t.Fatalf("Refresh(rotated token) error = %v", err)
+	}
+	if _, err := s.Validate(second.Token); err != nil {
+		t.Errorf("access token of a rotated pair should stay valid: %v", err)
+	}
+}
+
+func TestTokenRefreshRetryWithinGrace(t *testing.T) {
+	s := newTokenTestService(t)
+	first, err := s.Issue(1, "agent", "device", "dev-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost, err := s.Refresh(first.RefreshToken, "dev-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the agent never got "lost" and retries with the token it still has
+	retry, err := s.Refresh(first.RefreshToken, "dev-1")
+	if err != nil {
+		t.Fatalf("retry within grace error = %v", err)
+	}
+	if _, err := s.Refresh(lost.RefreshToken, "dev-1"); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("superseded refresh token error = %v, want ErrTokenRevoked", err)
+	}
+	// a second retry is still a retry while the latest pair is unused
+	again, err := s.Refresh(first.RefreshToken, "dev-1")
+	if err != nil {
+		t.Fatalf("second retry error = %v", err)
+	}
+	if _, err := s.Refresh(retry.RefreshToken, "dev-1"); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("superseded retry token error = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := s.Refresh(again.RefreshToken, "dev-1"); err != nil {
+		t.Fatalf("Refresh(latest) error = %v", err)
+	}
+	// the chain moved on: the first token is now reuse and revokes the device
+	if _, err := s.Refresh(first.RefreshToken, "dev-1"); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("replay after chain moved error = %v, want ErrRefreshReused", err)
+	}
+}
+
+func TestTokenRefreshReuse(t *testing.T) {
+	s := newTokenTestService(t)
+	first, err := s.Issue(1, "agent", "device", "dev-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Refresh(first.RefreshToken, "dev-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// pretend the rotation happened before the grace window
+	claims, err := s.signer.ParseRefresh(first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	e := s.revoked[claims.ID]
+	e.revokedAt = time.Now().Add(-refreshRetryGrace - time.Second)
+	s.revoked[claims.ID] = e
+	s.mu.Unlock()
+
+	if _, err := s.Refresh(first.RefreshToken, "dev-1"); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("reuse after grace error = %v, want ErrRefreshReused", err)
+	}
+	if _, err := s.Validate(second.Token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("access token after reuse error = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := s.Refresh(second.RefreshToken, "dev-1"); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("refresh token after reuse error = %v, want ErrTokenRevoked", err)
+	}
+}
+
+func TestTokenDeviceCutoff(t *testing.T) {
+	s := newTokenTestService(t)
+	pair, err := s.Issue(1, "agent", "device", "dev-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.Issue(2, "agent", "device", "dev-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RevokeDevice("dev-1", "test", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Validate(pair.Token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Validate after cutoff error = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := s.Refresh(pair.RefreshToken, "dev-1"); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Refresh after cutoff error = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := s.Validate(other.Token); err != nil {
+		t.Errorf("other device token error = %v", err)
+	}
+
+	// tokens issued after the cutoff are valid again
+	s.mu.Lock()
+	s.cutoffs["dev-1"] = time.Now().Add(-time.Hour)
+	s.mu.Unlock()
+	fresh, err := s.Issue(1, "agent", "device", "dev-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Validate(fresh.Token); err != nil {
+		t.Errorf("token issued after cutoff error = %v", err)
+	}
+}
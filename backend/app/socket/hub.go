@@ -1,61 +1,322 @@
 package socket
 
 import (
+	"errors"
 	"sagiri-guard/backend/global"
 	"sagiri-guard/network"
+	"sort"
 	"sync"
+	"time"
 )
 
+// ConnRole phân biệt kết nối điều khiển (nhận command push) với kết nối truyền
+// file / gửi một lần (protocolclient.SendAction, backup upload/download).
+type ConnRole string
+
+const (
+	RoleTransfer ConnRole = "transfer"
+	RoleControl  ConnRole = "control"
+)
+
+// DuplicatePolicy quyết định xử lý khi một device mở kết nối control thứ hai.
+type DuplicatePolicy string
+
+const (
+	// KickOld ngắt kết nối control cũ, kết nối mới thay thế.
+	KickOld DuplicatePolicy = "kick_old"
+	// RejectNew giữ kết nối cũ, từ chối kết nối mới.
+	RejectNew DuplicatePolicy = "reject_new"
+)
+
+var (
+	ErrDuplicateLogin = errors.New("device already has an active control connection")
+	ErrNotLoggedIn    = errors.New("connection has not logged in")
+	ErrDeviceOffline  = errors.New("device has no control connection")
+)
+
+// ParseDuplicatePolicy trả về policy tương ứng; giá trị rỗng/không hợp lệ dùng KickOld.
+func ParseDuplicatePolicy(s string) DuplicatePolicy {
+	if DuplicatePolicy(s) == RejectNew {
+		return RejectNew
+	}
+	return KickOld
+}
+
+// ConnInfo là metadata của một kết nối đã login.
+type ConnInfo struct {
+	ConnID       int64
+	DeviceID     string
+	Role         ConnRole
+	RemoteAddr   string
+	AgentVersion string
+	ConnectedAt  time.Time
+	PromotedAt   time.Time // zero khi chưa lên control
+	LastFrameAt  time.Time
+	Frames       int64
+	Authorized   bool   // login frame mang token hợp lệ của chính device
+	Verified     bool   // đã ký challenge bằng key của device
+	Fingerprint  string // fingerprint phần cứng gửi kèm lúc chứng minh
+}
+
 type clientConn struct {
-	c  *network.TCPClient
-	mu sync.Mutex
+	c         *network.TCPClient
+	mu        sync.Mutex // tuần tự hóa các lần ghi từ Send
+	info      ConnInfo
+	challenge string // nonce identity_challenge chưa dùng
 }
 
+// Hub là registry duy nhất cho các kết nối protocol: mọi kết nối đã login nằm
+// trong conns (key = ConnID), chỉ kết nối control mới được map theo device ID
+// và nhận command push.
 type Hub struct {
-	mu   sync.RWMutex
-	byID map[string]*clientConn // keep for listing online devices; send uses C registry
+	mu      sync.RWMutex
+	policy  DuplicatePolicy
+	conns   map[int64]*clientConn
+	control map[string]*clientConn
+}
+
+func NewHub(policy DuplicatePolicy) *Hub {
+	return &Hub{
+		policy:  ParseDuplicatePolicy(string(policy)),
+		conns:   make(map[int64]*clientConn),
+		control: make(map[string]*clientConn),
+	}
+}
+
+// Policy trả về duplicate-login policy đang áp dụng.
+func (h *Hub) Policy() DuplicatePolicy { return h.policy }
+
+// Register ghi nhận một kết nối vừa login với vai trò transfer. Login lặp lại
+// trên cùng kết nối cập nhật token; nếu đổi device thì kết nối mất quyền control
+// và phải chứng minh danh tính lại.
+func (h *Hub) Register(deviceID string, c *network.TCPClient, authorized bool) {
+	id := c.ConnID()
+	if id < 0 {
+		return
+	}
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if cur, ok := h.conns[id]; ok {
+		if cur.info.DeviceID != deviceID {
+			if h.control[cur.info.DeviceID] == cur {
+				delete(h.control, cur.info.DeviceID)
+			}
+			cur.info.DeviceID = deviceID
+			cur.info.Role = RoleTransfer
+			cur.info.PromotedAt = time.Time{}
+			cur.info.Verified = false
+			cur.info.Fingerprint = ""
+			cur.challenge = ""
+		}
+		cur.info.Authorized = authorized
+		cur.info.LastFrameAt = now
+		return
+	}
+	h.conns[id] = &clientConn{c: c, info: ConnInfo{
+		ConnID:      id,
+		DeviceID:    deviceID,
+		Role:        RoleTransfer,
+		RemoteAddr:  c.RemoteAddr(),
+		ConnectedAt: now,
+		LastFrameAt: now,
+		Authorized:  authorized,
+	}}
+}
+
+// DeviceOf trả về device ID mà kết nối đã login; false nếu kết nối chưa login.
+func (h *Hub) DeviceOf(c *network.TCPClient) (string, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	cur, ok := h.conns[c.ConnID()]
+	if !ok {
+		return "", false
+	}
+	return cur.info.DeviceID, true
+}
+
+// Authorized cho biết login frame của kết nối mang token hợp lệ.
+func (h *Hub) Authorized(c *network.TCPClient) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	cur, ok := h.conns[c.ConnID()]
+	return ok && cur.info.Authorized
+}
+
+// Verified cho biết kết nối đã chứng minh danh tính device.
+func (h *Hub) Verified(c *network.TCPClient) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	cur, ok := h.conns[c.ConnID()]
+	return ok && cur.info.Verified
+}
+
+// SetChallenge lưu nonce vừa cấp cho kết nối (thay nonce cũ nếu có).
+func (h *Hub) SetChallenge(c *network.TCPClient, nonce string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cur, ok := h.conns[c.ConnID()]
+	if !ok {
+		return ErrNotLoggedIn
+	}
+	cur.challenge = nonce
+	return nil
 }
 
-func NewHub() *Hub { return &Hub{byID: make(map[string]*clientConn)} }
+// TakeChallenge trả về và xóa nonce của kết nối; mỗi nonce chỉ dùng một lần.
+func (h *Hub) TakeChallenge(c *network.TCPClient) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cur, ok := h.conns[c.ConnID()]
+	if !ok {
+		return ""
+	}
+	nonce := cur.challenge
+	cur.challenge = ""
+	return nonce
+}
+
+// MarkVerified đánh dấu kết nối đã chứng minh danh tính với fingerprint fp.
+func (h *Hub) MarkVerified(c *network.TCPClient, fp string) {
+	h.mu.Lock()
+	if cur, ok := h.conns[c.ConnID()]; ok {
+		cur.info.Verified = true
+		cur.info.Fingerprint = fp
+	}
+	h.mu.Unlock()
+}
 
-func (h *Hub) Register(deviceID string, c *network.TCPClient) {
+// Promote nâng kết nối lên control cho device của nó, áp dụng duplicate-login
+// policy. Với KickOld, kết nối control cũ (nếu có) bị shutdown và metadata của
+// nó được trả về để caller đóng session/ghi audit.
+func (h *Hub) Promote(deviceID string, c *network.TCPClient, agentVersion string) (ConnInfo, *ConnInfo, error) {
+	id := c.ConnID()
 	h.mu.Lock()
-	h.byID[deviceID] = &clientConn{c: c}
+	cur, ok := h.conns[id]
+	if !ok || cur.info.DeviceID != deviceID {
+		h.mu.Unlock()
+		return ConnInfo{}, nil, ErrNotLoggedIn
+	}
+	var kicked *clientConn
+	if old, exists := h.control[deviceID]; exists && old != cur {
+		if h.policy == RejectNew {
+			h.mu.Unlock()
+			return cur.info, nil, ErrDuplicateLogin
+		}
+		old.info.Role = RoleTransfer
+		kicked = old
+	}
+	if cur.info.Role != RoleControl {
+		cur.info.Role = RoleControl
+		cur.info.PromotedAt = time.Now()
+	}
+	if agentVersion != "" {
+		cur.info.AgentVersion = agentVersion
+	}
+	h.control[deviceID] = cur
+	info := cur.info
+	var kickedInfo *ConnInfo
+	if kicked != nil {
+		ki := kicked.info
+		kickedInfo = &ki
+	}
 	h.mu.Unlock()
+
+	if kicked != nil {
+		global.Logger.Warn().Str("device", deviceID).Int64("old_conn", kickedInfo.ConnID).Int64("new_conn", id).
+			Msg("duplicate control login, closing previous connection")
+		if err := kicked.c.Shutdown(); err != nil {
+			global.Logger.Warn().Err(err).Str("device", deviceID).Msg("shutdown previous connection failed")
+		}
+	}
+	return info, kickedInfo, nil
 }
 
-func (h *Hub) Unregister(deviceID string, c *network.TCPClient) {
+// Touch cập nhật thời điểm/số frame của một kết nối đã login.
+func (h *Hub) Touch(c *network.TCPClient) {
 	h.mu.Lock()
-	if cur, ok := h.byID[deviceID]; ok && cur.c.Equal(c) {
-		delete(h.byID, deviceID)
+	if cur, ok := h.conns[c.ConnID()]; ok {
+		cur.info.LastFrameAt = time.Now()
+		cur.info.Frames++
 	}
 	h.mu.Unlock()
 }
 
-func (h *Hub) IsOnline(deviceID string) bool {
-	if network.DeviceIsOnline(deviceID) {
-		return true
+// Unregister xóa kết nối khỏi registry; trả về metadata và true nếu kết nối
+// đang là control của device.
+func (h *Hub) Unregister(deviceID string, c *network.TCPClient) (ConnInfo, bool) {
+	id := c.ConnID()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cur, ok := h.conns[id]
+	if !ok {
+		return ConnInfo{}, false
+	}
+	delete(h.conns, id)
+	wasControl := false
+	if h.control[cur.info.DeviceID] == cur {
+		delete(h.control, cur.info.DeviceID)
+		wasControl = true
+	}
+	return cur.info, wasControl
+}
+
+// Disconnect shutdown mọi kết nối (control và transfer) của device trừ keep
+// (nil = không giữ kết nối nào); registry được dọn khi server báo disconnect.
+// Trả về số kết nối bị ngắt.
+func (h *Hub) Disconnect(deviceID string, keep *network.TCPClient) int {
+	keepID := int64(-1)
+	if keep != nil {
+		keepID = keep.ConnID()
+	}
+	h.mu.RLock()
+	var targets []*clientConn
+	for id, cc := range h.conns {
+		if cc.info.DeviceID == deviceID && id != keepID {
+			targets = append(targets, cc)
+		}
+	}
+	h.mu.RUnlock()
+	for _, cc := range targets {
+		if err := cc.c.Shutdown(); err != nil {
+			global.Logger.Warn().Err(err).Str("device", deviceID).Int64("conn", cc.info.ConnID).Msg("shutdown connection failed")
+		}
 	}
+	return len(targets)
+}
+
+// Info trả về metadata kết nối control của device.
+func (h *Hub) Info(deviceID string) (ConnInfo, bool) {
 	h.mu.RLock()
-	_, ok := h.byID[deviceID]
+	defer h.mu.RUnlock()
+	cc, ok := h.control[deviceID]
+	if !ok {
+		return ConnInfo{}, false
+	}
+	return cc.info, true
+}
+
+func (h *Hub) IsOnline(deviceID string) bool {
+	h.mu.RLock()
+	_, ok := h.control[deviceID]
 	h.mu.RUnlock()
 	return ok
 }
 
-// OnlineDevices trả về danh sách tất cả device đang online.
+// OnlineDevices trả về danh sách tất cả device đang có kết nối control.
 func (h *Hub) OnlineDevices() []string {
 	h.mu.RLock()
-	out := make([]string, 0, len(h.byID))
-	for id := range h.byID {
-		if network.DeviceIsOnline(id) {
-			out = append(out, id)
-		}
+	out := make([]string, 0, len(h.control))
+	for id := range h.control {
+		out = append(out, id)
 	}
+	total := len(h.conns)
 	h.mu.RUnlock()
+	sort.Strings(out)
 
 	// Debug log summary
 	global.Logger.Debug().
-		Int("cached", len(h.byID)).
+		Int("connections", total).
 		Int("online", len(out)).
 		Strs("online_ids", out).
 		Msg("hub online devices")
@@ -63,22 +324,34 @@ func (h *Hub) OnlineDevices() []string {
 	return out
 }
 
-func (h *Hub) Send(deviceID string, data []byte) error {
-	global.Logger.Info().Str("device", deviceID).Str("data", string(data)).Msg("Sending data to device")
-	if err := network.SendToDevice(deviceID, data); err != nil {
-		// fallback: if we still have a TCPClient cached, try once
-		h.mu.RLock()
-		cc, ok := h.byID[deviceID]
-		h.mu.RUnlock()
-		if ok && cc != nil && cc.c != nil && cc.c.IsOpen() {
-			cc.mu.Lock()
-			err2 := cc.c.SendCommand(data)
-			cc.mu.Unlock()
-			if err2 == nil {
-				global.Logger.Info().Str("device", deviceID).Str("data", string(data)).Msg("Sent data via cached client")
-				return nil
-			}
+// Connections trả về metadata của mọi kết nối đã login, sắp theo device rồi ConnID.
+func (h *Hub) Connections() []ConnInfo {
+	h.mu.RLock()
+	out := make([]ConnInfo, 0, len(h.conns))
+	for _, cc := range h.conns {
+		out = append(out, cc.info)
+	}
+	h.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].DeviceID != out[j].DeviceID {
+			return out[i].DeviceID < out[j].DeviceID
 		}
+		return out[i].ConnID < out[j].ConnID
+	})
+	return out
+}
+
+func (h *Hub) Send(deviceID string, data []byte) error {
+	h.mu.RLock()
+	cc, ok := h.control[deviceID]
+	h.mu.RUnlock()
+	if !ok {
+		return ErrDeviceOffline
+	}
+	cc.mu.Lock()
+	err := cc.c.SendCommand(data)
+	cc.mu.Unlock()
+	if err != nil {
 		return err
 	}
 	global.Logger.Info().Str("device", deviceID).Str("data", string(data)).Msg("Sent data to device")
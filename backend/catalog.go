@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"sagiri-guard/backend/global"
+	"sagiri-guard/backend/initialize"
+
+	"github.com/rs/zerolog"
+)
+
+const catalogUsage = "usage: backend [-config path] catalog [-report file] <rebuild|scrub>"
+
+// runCatalog handles `backend catalog rebuild` (re-create backup_file_versions rows
+// from the storage directory) and `backend catalog scrub` (verify blob checksums).
+// The JSON report goes to stdout (or -report file) and logs go to stderr, so the
+// report can be piped. Corrupt or missing blobs make the command fail.
+func runCatalog(cfgPath string, args []string) error {
+	fs := flag.NewFlagSet("catalog", flag.ContinueOnError)
+	reportPath := fs.String("report", "", "Write the JSON report to this file instead of stdout")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errors.New(catalogUsage)
+	}
+	global.Logger = global.Logger.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	catalog, err := initialize.BuildBackupCatalog(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	var (
+		report   any
+		findings error
+	)
+	switch fs.Arg(0) {
+	case "rebuild":
+		r, err := catalog.Rebuild()
+		if err != nil {
+			return err
+		}
+		global.Logger.Info().
+			Int("scanned", r.Scanned).
+			Int("already_indexed", r.AlreadyIndexed).
+			Int("restored", r.Restored).
+			Int("holds_restored", r.HoldsRestored).
+			Int("without_manifest", len(r.WithoutManifest)).
+			Int("corrupt", len(r.Corrupt)).
+			Int("errors", len(r.Errors)).
+			Msg("backup catalog rebuilt")
+		report = r
+		if len(r.Corrupt) > 0 || len(r.Errors) > 0 {
+			findings = fmt.Errorf("rebuild found %d corrupt blobs and %d errors", len(r.Corrupt), len(r.Errors))
+		}
+	case "scrub":
+		r, err := catalog.Scrub()
+		if err != nil {
+			return err
+		}
+		global.Logger.Info().
+			Int("checked", r.Checked).
+			Int("healthy", r.Healthy).
+			Int("corrupt", len(r.Corrupt)).
+			Int("missing", len(r.Missing)).
+			Int("orphaned", len(r.Orphaned)).
+			Int("errors", len(r.Errors)).
+			Msg("backup storage scrubbed")
+		report = r
+		if len(r.Corrupt) > 0 || len(r.Missing) > 0 || len(r.Errors) > 0 {
+			findings = fmt.Errorf("scrub found %d corrupt, %d missing blobs and %d errors", len(r.Corrupt), len(r.Missing), len(r.Errors))
+		}
+	default:
+		return errors.New(catalogUsage)
+	}
+
+	if err := writeCatalogReport(*reportPath, report); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	return findings
+}
+
+func writeCatalogReport(path string, report any) error {
+	if path == "" {
+		return encodeReport(os.Stdout, report)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := encodeReport(f, report); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func encodeReport(w io.Writer, report any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -20,19 +20,38 @@ type TCP struct {
 }
 
 type Backup struct {
-	StoragePath string
-	ChunkSize   int64
-	TCP         TCP
+	StoragePath        string
+	ChunkSize          int64
+	TCP                TCP
+	RestoreGrantTTLMin int
+	BatchTTLMin        int // batch upload không finalize sau ngần này phút bị hủy
 }
+
+// CommandSigning cấu hình khóa Ed25519 dùng để ký command gửi xuống agent.
+type CommandSigning struct {
+	KeyPath string
+}
+
+// Registry cấu hình registry kết nối protocol.
+type Registry struct {
+	// DuplicateLogin: "kick_old" (mặc định) ngắt kết nối control cũ khi device
+	// login lại, "reject_new" giữ kết nối cũ và từ chối kết nối mới.
+	DuplicateLogin string
+}
+
 type Config struct {
 	TCP TCP
 	DB  DB
 	JWT struct {
 		Secret string
 		Issuer string
-		ExpMin int
+		ExpMin int // access token
+		// RefreshExpMin: refresh token dùng để lấy access token mới
+		RefreshExpMin int
 	}
-	Backup Backup
+	Backup         Backup
+	CommandSigning CommandSigning
+	Registry       Registry
 }
 
 func Load(path string) (*Config, error) {
@@ -53,8 +72,11 @@ func Load(path string) (*Config, error) {
 	v.SetDefault("backend.db.name", "sagiri_guard")
 	v.SetDefault("backend.backup.storage_path", "backups")
 	v.SetDefault("backend.backup.chunk_size", 524288) // 512KB
+	v.SetDefault("backend.backup.restore_grant_ttl_min", 1440)
 	v.SetDefault("backend.backup.tcp.host", v.GetString("backend.host"))
 	v.SetDefault("backend.backup.tcp.port", v.GetInt("backend.port"))
+	v.SetDefault("backend.command_signing.key_path", "command_signing.key")
+	v.SetDefault("backend.registry.duplicate_login", "kick_old")
 	if err := v.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("read config: %w", err)
 	}
@@ -87,7 +109,11 @@ func Load(path string) (*Config, error) {
 				Host: backupHost,
 				Port: backupPort,
 			},
+			RestoreGrantTTLMin: v.GetInt("backend.backup.restore_grant_ttl_min"),
+			BatchTTLMin:        v.GetInt("backend.backup.batch_ttl_min"),
 		},
+		CommandSigning: CommandSigning{KeyPath: v.GetString("backend.command_signing.key_path")},
+		Registry:       Registry{DuplicateLogin: v.GetString("backend.registry.duplicate_login")},
 	}
 	cfg.JWT.Secret = v.GetString("backend.jwt.secret")
 	if cfg.JWT.Secret == "" {
@@ -99,7 +125,11 @@ func Load(path string) (*Config, error) {
 	}
 	cfg.JWT.ExpMin = v.GetInt("backend.jwt.exp_min")
 	if cfg.JWT.ExpMin <= 0 {
-		cfg.JWT.ExpMin = 60
+		cfg.JWT.ExpMin = 15
+	}
+	cfg.JWT.RefreshExpMin = v.GetInt("backend.jwt.refresh_exp_min")
+	if cfg.JWT.RefreshExpMin <= 0 {
+		cfg.JWT.RefreshExpMin = 30 * 24 * 60
 	}
 	return cfg, nil
 }
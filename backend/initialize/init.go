@@ -1,6 +1,7 @@
 package initialize
 
 import (
+	"crypto/ed25519"
 	"fmt"
 	"sagiri-guard/backend/app/controllers"
 	"sagiri-guard/backend/app/db"
@@ -11,6 +12,7 @@ import (
 	"sagiri-guard/backend/app/socket"
 	"sagiri-guard/backend/config"
 	"sagiri-guard/backend/global"
+	"sagiri-guard/cmdsign"
 
 	"gorm.io/gorm"
 )
@@ -28,37 +30,10 @@ type App struct {
 }
 
 func Build(configPath string) (*App, error) {
-	// Load config
-	cfg, err := config.Load(configPath)
+	cfg, gdb, err := setupDatabase(configPath)
 	if err != nil {
 		return nil, err
 	}
-	global.Config = cfg
-
-	// Connect DB
-	gdb, err := db.Connect(db.Config{Host: cfg.DB.Host, Port: cfg.DB.Port, User: cfg.DB.User, Password: cfg.DB.Pass, DBName: cfg.DB.Name})
-	if err != nil {
-		return nil, fmt.Errorf("connect db: %w", err)
-	}
-	global.Mdb = gdb
-
-	// Migrate
-	if err := gdb.AutoMigrate(
-		&models.User{},
-		&models.Device{},
-		&models.AgentLog{},
-		&models.ContentType{},
-		&models.FileNode{},
-		&models.FolderNode{},
-		&models.Item{},
-		&models.ItemContentTypeLink{},
-		&models.AgentCommand{},
-		&models.BackupFileVersion{},
-		&models.WebsiteBlockRule{},
-		&models.WebsiteBlockStatus{},
-	); err != nil {
-		return nil, fmt.Errorf("migrate: %w", err)
-	}
 
 	// Services / repos needed for protocol
 	userRepo := repo.NewUserRepository(gdb)
@@ -67,12 +42,32 @@ func Build(configPath string) (*App, error) {
 	fileTreeRepo := repo.NewFileTreeRepository(gdb)
 	backupVersionRepo := repo.NewBackupVersionRepository(gdb)
 	agentCmdRepo := repo.NewAgentCommandRepository(gdb)
+	restoreGrantRepo := repo.NewRestoreGrantRepository(gdb)
+	backupHoldRepo := repo.NewBackupHoldRepository(gdb)
+	deviceStateRepo := repo.NewDeviceStateRepository(gdb)
 
 	userSvc := services.NewUserService(userRepo)
 	deviceSvc := services.NewDeviceService(deviceRepo)
 	agentLogSvc := services.NewAgentLogService(agentLogRepo)
+	auditSvc := services.NewAuditService(repo.NewAuditLogRepository(gdb))
+	deviceStateSvc := services.NewDeviceStateService(deviceStateRepo)
+	deviceGroupSvc := services.NewDeviceGroupService(repo.NewDeviceGroupRepository(gdb), deviceRepo)
+	websiteBlockSvc := services.NewWebsiteBlockService(repo.NewWebsiteBlockRepository(gdb))
+	scheduleSvc := services.NewScheduleService(repo.NewScheduledCommandRepository(gdb), deviceGroupSvc)
+	osquerySvc := services.NewOsqueryService(repo.NewOsqueryResultRepository(gdb))
+	packSvc := services.NewOsqueryPackService(repo.NewOsqueryPackRepository(gdb), deviceGroupSvc)
+	inventorySvc := services.NewInventoryService(repo.NewDeviceInventoryRepository(gdb))
+	telemetrySvc := services.NewTelemetryService(repo.NewDeviceTelemetryRepository(gdb))
+	presenceSvc := services.NewPresenceService(repo.NewDeviceSessionRepository(gdb), deviceRepo)
+	if n, err := presenceSvc.CloseDangling(); err != nil {
+		global.Logger.Warn().Err(err).Msg("close dangling device sessions failed")
+	} else if n > 0 {
+		global.Logger.Info().Int("sessions", n).Msg("closed device sessions left open by previous run")
+	}
+	identitySvc := services.NewDeviceIdentityService(repo.NewDeviceIdentityRepository(gdb))
+	enrollmentSvc := services.NewEnrollmentService(repo.NewEnrollmentTokenRepository(gdb), deviceRepo, deviceGroupSvc)
 	fileTreeSvc := services.NewFileTreeService(fileTreeRepo, repo.NewContentTypeRepository(gdb))
-	backupSvc, err := services.NewBackupService(cfg, backupVersionRepo)
+	backupSvc, err := services.NewBackupService(cfg, backupVersionRepo, restoreGrantRepo, backupHoldRepo)
 	if err != nil {
 		return nil, fmt.Errorf("init backup service: %w", err)
 	}
@@ -82,13 +77,24 @@ func Build(configPath string) (*App, error) {
 	_ = userSvc.EnsureUser("user", "user123", "user")
 
 	signer := &jwtutil.Signer{
-		Secret: []byte(cfg.JWT.Secret),
-		Issuer: cfg.JWT.Issuer,
-		ExpMin: cfg.JWT.ExpMin,
+		Secret:        []byte(cfg.JWT.Secret),
+		Issuer:        cfg.JWT.Issuer,
+		ExpMin:        cfg.JWT.ExpMin,
+		RefreshExpMin: cfg.JWT.RefreshExpMin,
+	}
+	tokenSvc := services.NewTokenService(signer, repo.NewTokenRevocationRepository(gdb))
+	if err := tokenSvc.Load(); err != nil {
+		return nil, fmt.Errorf("load token revocations: %w", err)
+	}
+
+	cmdKey, err := cmdsign.LoadOrCreateKey(cfg.CommandSigning.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load command signing key: %w", err)
 	}
+	global.Logger.Info().Str("public_key", cmdsign.EncodePublicKey(cmdKey.Public().(ed25519.PublicKey))).Msg("Command signing key loaded")
 
-	hub := socket.NewHub()
-	protocolCtrl := controllers.NewProtocolController(hub, agentCmdRepo, deviceSvc, fileTreeSvc, agentLogSvc, backupSvc, userSvc, signer)
+	hub := socket.NewHub(socket.ParseDuplicatePolicy(cfg.Registry.DuplicateLogin))
+	protocolCtrl := controllers.NewProtocolController(hub, agentCmdRepo, deviceSvc, fileTreeSvc, agentLogSvc, backupSvc, userSvc, auditSvc, deviceStateSvc, deviceGroupSvc, websiteBlockSvc, scheduleSvc, osquerySvc, packSvc, inventorySvc, telemetrySvc, presenceSvc, identitySvc, enrollmentSvc, tokenSvc, signer, cmdKey)
 
 	return &App{
 		Cfg:       *cfg,
@@ -102,3 +108,69 @@ func Build(configPath string) (*App, error) {
 		Protocol:  protocolCtrl,
 	}, nil
 }
+
+// setupDatabase loads config, connects MySQL and runs migrations.
+func setupDatabase(configPath string) (*config.Config, *gorm.DB, error) {
+	// Load config
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	global.Config = cfg
+
+	// Connect DB
+	gdb, err := db.Connect(db.Config{Host: cfg.DB.Host, Port: cfg.DB.Port, User: cfg.DB.User, Password: cfg.DB.Pass, DBName: cfg.DB.Name})
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect db: %w", err)
+	}
+	global.Mdb = gdb
+
+	// Migrate
+	if err := gdb.AutoMigrate(
+		&models.User{},
+		&models.Device{},
+		&models.AgentLog{},
+		&models.ContentType{},
+		&models.FileNode{},
+		&models.FolderNode{},
+		&models.Item{},
+		&models.ItemContentTypeLink{},
+		&models.AgentCommand{},
+		&models.BackupFileVersion{},
+		&models.WebsiteBlockRule{},
+		&models.WebsiteBlockStatus{},
+		&models.RestoreGrant{},
+		&models.BackupHold{},
+		&models.AuditLog{},
+		&models.DeviceState{},
+		&models.DeviceGroup{},
+		&models.DeviceGroupMember{},
+		&models.ScheduledCommand{},
+		&models.OsqueryResult{},
+		&models.OsqueryPack{},
+		&models.OsqueryPackQuery{},
+		&models.OsqueryPackTarget{},
+		&models.OsqueryDiffRow{},
+		&models.DeviceInventory{},
+		&models.InventoryChange{},
+		&models.DeviceTelemetry{},
+		&models.DeviceSession{},
+		&models.DeviceIdentity{},
+		&models.EnrollmentToken{},
+		&models.DeviceEnrollment{},
+		&models.RevokedToken{},
+		&models.DeviceRevocation{},
+	); err != nil {
+		return nil, nil, fmt.Errorf("migrate: %w", err)
+	}
+	return cfg, gdb, nil
+}
+
+// BuildBackupCatalog prepares the offline catalog/scrub tool (no protocol server).
+func BuildBackupCatalog(configPath string) (*services.BackupCatalog, error) {
+	cfg, gdb, err := setupDatabase(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return services.NewBackupCatalog(cfg.Backup.StoragePath, repo.NewBackupVersionRepository(gdb), repo.NewBackupHoldRepository(gdb)), nil
+}
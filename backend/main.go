@@ -2,10 +2,12 @@ package main
 
 import (
 	"flag"
+	"os"
 	"sagiri-guard/backend/global"
 	"sagiri-guard/backend/initialize"
 	"sagiri-guard/backend/server"
 	"sagiri-guard/network"
+	"time"
 )
 
 func main() {
@@ -14,6 +16,15 @@ func main() {
 	)
 	flag.Parse()
 
+	// Offline maintenance subcommands do not start the protocol server
+	if flag.Arg(0) == "catalog" {
+		if err := runCatalog(*cfgPath, flag.Args()[1:]); err != nil {
+			global.Logger.Error().Msgf("Catalog command failed: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := network.Init(); err != nil {
 		global.Logger.Error().Msgf("Cannot initialize network library: %v", err)
 		return
@@ -31,6 +42,14 @@ func main() {
 		global.Logger.Error().Msgf("Cannot start protocol server: %v", err)
 		return
 	}
+
+	// Materialize scheduled/recurring commands
+	app.Protocol.StartScheduler(30 * time.Second)
+	// Expire stale commands and retry failed deliveries after backoff
+	app.Protocol.StartCommandSweeper(time.Minute)
+	// Drop batch uploads that were never finalized
+	app.Protocol.StartBackupSweeper(5 * time.Minute)
+
 	// global.Logger.Info().Msgf("Protocol server is listening on %s:%d...", app.Cfg.TCP.Host, app.Cfg.TCP.Port)
 
 	select {}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/ed25519"
 	"sagiri-guard/backend/app/controllers"
 	jwtutil "sagiri-guard/backend/app/jwt"
 	"sagiri-guard/backend/app/repo"
@@ -35,6 +36,6 @@ func StartProtocolServer(host string, port int, ctrl *controllers.ProtocolContro
 }
 
 // BuildProtocolController constructs controller and hub.
-func BuildProtocolController(h *socket.Hub, cmdRepo *repo.AgentCommandRepository, deviceSvc *services.DeviceService, treeSvc *services.FileTreeService, logSvc *services.AgentLogService, backupSvc *services.BackupService, userSvc *services.UserService, signer *jwtutil.Signer) *controllers.ProtocolController {
-	return controllers.NewProtocolController(h, cmdRepo, deviceSvc, treeSvc, logSvc, backupSvc, userSvc, signer)
+func BuildProtocolController(h *socket.Hub, cmdRepo *repo.AgentCommandRepository, deviceSvc *services.DeviceService, treeSvc *services.FileTreeService, logSvc *services.AgentLogService, backupSvc *services.BackupService, userSvc *services.UserService, auditSvc *services.AuditService, stateSvc *services.DeviceStateService, groupSvc *services.DeviceGroupService, blockSvc *services.WebsiteBlockService, scheduleSvc *services.ScheduleService, osquerySvc *services.OsqueryService, packSvc *services.OsqueryPackService, inventorySvc *services.InventoryService, telemetrySvc *services.TelemetryService, presenceSvc *services.PresenceService, identitySvc *services.DeviceIdentityService, enrollmentSvc *services.EnrollmentService, tokenSvc *services.TokenService, signer *jwtutil.Signer, cmdKey ed25519.PrivateKey) *controllers.ProtocolController {
+	return controllers.NewProtocolController(h, cmdRepo, deviceSvc, treeSvc, logSvc, backupSvc, userSvc, auditSvc, stateSvc, groupSvc, blockSvc, scheduleSvc, osquerySvc, packSvc, inventorySvc, telemetrySvc, presenceSvc, identitySvc, enrollmentSvc, tokenSvc, signer, cmdKey)
 }
@@ -1,13 +1,24 @@
 package ui
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
 
 	"sagiri-guard/network"
 
 	tea "github.com/charmbracelet/bubbletea"
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// refreshBefore is how long before expiry the console refreshes its access token
+	refreshBefore = 2 * time.Minute
+	// refreshRetry is the delay after a refresh attempt failed on the network
+	refreshRetry = 30 * time.Second
 )
 
 // Session manages the persistent connection to the backend
@@ -21,13 +32,21 @@ type Session struct {
 	StopChan    chan struct{}
 	mu          sync.Mutex
 	loopRunning bool
+	// ConsoleID is the protocol device ID of this console; unique per process so
+	// several consoles do not replace each other's control connection
+	ConsoleID string
+	// RefreshToken renews Token before it expires (see StartTokenRefresh)
+	RefreshToken string
 }
 
 // NewSession creates a new session manager
 func NewSession() *Session {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
 	return &Session{
-		MsgChan:  make(chan tea.Msg),
-		StopChan: make(chan struct{}),
+		MsgChan:   make(chan tea.Msg),
+		StopChan:  make(chan struct{}),
+		ConsoleID: "admin-console-" + hex.EncodeToString(suffix),
 	}
 }
 
@@ -64,11 +83,21 @@ func (s *Session) Login(deviceID, token string) error {
 	return nil
 }
 
-// Close closes the connection
+// Hello claims the control role for the logged-in connection so the backend
+// routes pushed frames (command output) to this session
+func (s *Session) Hello() error {
+	return s.SendCommand("hello", map[string]string{"role": "control"})
+}
+
+// Close logs the console out and closes the connection
 func (s *Session) Close() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.Client != nil {
+		if s.Token != "" {
+			// best effort: revoke this console's tokens before leaving
+			_ = s.SendCommand("logout", map[string]string{"refresh_token": s.RefreshToken})
+		}
 		s.Client.Close()
 	}
 	if s.loopRunning {
@@ -77,6 +106,106 @@ func (s *Session) Close() {
 	}
 }
 
+// StartTokenRefresh keeps the console's access token fresh. Refreshing runs on
+// a separate short connection so its ACK does not reach the UI; the backend
+// updates the token of the console's main connection as well.
+func (s *Session) StartTokenRefresh(refreshToken string) {
+	if refreshToken == "" {
+		return
+	}
+	s.mu.Lock()
+	s.RefreshToken = refreshToken
+	s.mu.Unlock()
+	go s.refreshLoop()
+}
+
+func (s *Session) refreshLoop() {
+	for {
+		s.mu.Lock()
+		token := s.Token
+		s.mu.Unlock()
+		var claims jwt.RegisteredClaims
+		if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil || claims.ExpiresAt == nil {
+			return
+		}
+		wait := time.Until(claims.ExpiresAt.Time) - refreshBefore
+		if wait < 0 {
+			wait = 0
+		}
+		select {
+		case <-s.StopChan:
+			return
+		case <-time.After(wait):
+		}
+		rejected, err := s.refresh()
+		if err == nil {
+			continue
+		}
+		if rejected {
+			select {
+			case s.MsgChan <- MsgFromServer{Err: fmt.Errorf("session expired, log in again: %v", err)}:
+			case <-s.StopChan:
+			}
+			return
+		}
+		select {
+		case <-s.StopChan:
+			return
+		case <-time.After(refreshRetry):
+		}
+	}
+}
+
+// refresh exchanges the refresh token for a new pair; rejected reports that
+// the backend refused the refresh token itself.
+func (s *Session) refresh() (rejected bool, err error) {
+	s.mu.Lock()
+	refreshToken := s.RefreshToken
+	s.mu.Unlock()
+	c, err := network.DialTCP(s.Host, s.Port)
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+	if err := c.SendLogin(s.ConsoleID, ""); err != nil {
+		return false, err
+	}
+	b, err := json.Marshal(map[string]any{
+		"action": "refresh",
+		"data":   map[string]string{"refresh_token": refreshToken, "device_id": s.ConsoleID},
+	})
+	if err != nil {
+		return false, err
+	}
+	if err := c.SendCommand(b); err != nil {
+		return false, err
+	}
+	for {
+		msg, err := c.RecvProtocolMessage()
+		if err != nil {
+			return false, err
+		}
+		if msg.Type != network.MsgAck {
+			continue
+		}
+		if msg.StatusCode != 200 {
+			return msg.StatusCode == 401, fmt.Errorf("refresh failed: %d %s", msg.StatusCode, msg.StatusMsg)
+		}
+		var pair struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := json.Unmarshal([]byte(msg.StatusMsg), &pair); err != nil || pair.Token == "" {
+			return false, fmt.Errorf("invalid refresh response")
+		}
+		s.mu.Lock()
+		s.Token = pair.Token
+		s.RefreshToken = pair.RefreshToken
+		s.mu.Unlock()
+		return false, nil
+	}
+}
+
 // SendCommand sends generic command
 func (s *Session) SendCommand(action string, data any) error {
 	if s.Client == nil {
@@ -48,7 +48,7 @@ type CommandDef struct {
 	Name        string
 	Description string
 	Fields      []FieldDef
-	Kind        string // "agent" or "shell"
+	Kind        string // "agent", "once", "stream", "cancel" or "shell"
 }
 
 type FieldDef struct {
@@ -75,6 +75,16 @@ var availableCommands = []CommandDef{
 			{Name: "enabled", Placeholder: "true or false", Required: true, Default: "true"},
 		},
 	},
+	{
+		Name:        "backup_throttle",
+		Description: "Set backup bandwidth limit and backup windows",
+		Kind:        "agent",
+		Fields: []FieldDef{
+			{Name: "rate_limit_kbps", Placeholder: "KB/s outside windows (0 = unlimited, empty = unchanged)", Required: false},
+			{Name: "windows", Placeholder: "Full-speed windows, comma separated (e.g. 19:00-07:00)", Required: false},
+			{Name: "defer_outside_window", Placeholder: "true/false (empty = unchanged)", Required: false},
+		},
+	},
 	{
 		Name:        "restore",
 		Description: "Restore a file from backup",
@@ -84,6 +94,7 @@ var availableCommands = []CommandDef{
 			{Name: "version_id", Placeholder: "Version ID", Required: true},
 			{Name: "file_name", Placeholder: "File name", Required: true},
 			{Name: "dest_path", Placeholder: "Destination path", Required: true},
+			{Name: "mode", Placeholder: "overwrite, keep_both, skip_if_same_hash, restore_to_staging_dir", Required: false, Default: "overwrite"},
 		},
 	},
 	{
@@ -96,6 +107,40 @@ var availableCommands = []CommandDef{
 			{Name: "domains", Placeholder: "Comma-separated domains for action", Required: false},
 		},
 	},
+	{
+		Name:        "monitor_paths",
+		Description: "Replace the directories watched for backup",
+		Kind:        "agent",
+		Fields: []FieldDef{
+			{Name: "paths", Placeholder: "Comma-separated directories", Required: true},
+		},
+	},
+	{
+		Name:        "osquery_run",
+		Description: "Run an osquery SQL query (results stored on the backend)",
+		Kind:        "once",
+		Fields: []FieldDef{
+			{Name: "query", Placeholder: "e.g. SELECT name, version FROM os_version", Required: true},
+			{Name: "timeout_sec", Placeholder: "Timeout in seconds (default: 30)", Required: false},
+			{Name: "max_rows", Placeholder: "Max rows (default: 1000)", Required: false},
+		},
+	},
+	{
+		Name:        "tail_log",
+		Description: "Stream new agent log lines live",
+		Kind:        "stream",
+		Fields: []FieldDef{
+			{Name: "lines", Placeholder: "Initial lines (default: 20)", Required: false, Default: "20"},
+		},
+	},
+	{
+		Name:        "stop_stream",
+		Description: "Stop a running stream command",
+		Kind:        "cancel",
+		Fields: []FieldDef{
+			{Name: "command", Placeholder: "Stream command name (e.g. tail_log)", Required: true, Default: "tail_log"},
+		},
+	},
 	{
 		Name:        "Custom Shell",
 		Description: "Execute a raw shell command",
@@ -299,13 +344,20 @@ func (m CommandFormModel) submitCommand() tea.Cmd {
 				"kind":      "shell",
 				"payload":   map[string]string{},
 			}
+		} else if cmd.Kind == "cancel" {
+			// Stop a running stream command by name
+			req = map[string]interface{}{
+				"device_id": m.DeviceID,
+				"command":   m.Inputs[0].Value(),
+				"kind":      "cancel",
+			}
 		} else {
 			// Agent command
 			payload := buildPayload(cmd.Name, m.Inputs)
 			req = map[string]interface{}{
 				"device_id": m.DeviceID,
 				"command":   cmd.Name,
-				"kind":      "agent",
+				"kind":      cmd.Kind,
 				"payload":   payload,
 			}
 		}
@@ -330,6 +382,20 @@ func buildPayload(name string, inputs []textinput.Model) map[string]interface{}
 	case "backup_auto":
 		enabled := inputs[0].Value() == "true"
 		return map[string]interface{}{"enabled": enabled}
+	case "backup_throttle":
+		p := map[string]interface{}{}
+		if v := inputs[0].Value(); v != "" {
+			rate := 0
+			fmt.Sscanf(v, "%d", &rate)
+			p["rate_limit_kbps"] = rate
+		}
+		if v := inputs[1].Value(); v != "" {
+			p["windows"] = splitComma(v)
+		}
+		if v := inputs[2].Value(); v != "" {
+			p["defer_outside_window"] = v == "true"
+		}
+		return p
 	case "restore":
 		versionID := 0
 		fmt.Sscanf(inputs[1].Value(), "%d", &versionID)
@@ -338,6 +404,7 @@ func buildPayload(name string, inputs []textinput.Model) map[string]interface{}
 			"version_id": versionID,
 			"file_name":  inputs[2].Value(),
 			"dest_path":  inputs[3].Value(),
+			"mode":       inputs[4].Value(),
 		}
 	case "block_website":
 		enabled := inputs[1].Value() == "true"
@@ -355,6 +422,27 @@ func buildPayload(name string, inputs []textinput.Model) map[string]interface{}
 			p["rules"] = rules
 		}
 		return p
+	case "monitor_paths":
+		return map[string]interface{}{"paths": splitComma(inputs[0].Value())}
+	case "osquery_run":
+		p := map[string]interface{}{"query": inputs[0].Value()}
+		if v := inputs[1].Value(); v != "" {
+			timeout := 0
+			fmt.Sscanf(v, "%d", &timeout)
+			p["timeout_sec"] = timeout
+		}
+		if v := inputs[2].Value(); v != "" {
+			rows := 0
+			fmt.Sscanf(v, "%d", &rows)
+			p["max_rows"] = rows
+		}
+		return p
+	case "tail_log":
+		lines := 20
+		if inputs[0].Value() != "" {
+			fmt.Sscanf(inputs[0].Value(), "%d", &lines)
+		}
+		return map[string]interface{}{"lines": lines}
 	}
 	return nil
 }
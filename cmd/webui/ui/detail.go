@@ -66,6 +66,23 @@ type fileLoadedMsg struct {
 	Error error
 }
 
+// outputEvent is a frame pushed by the backend for a subscribed stream command
+type outputEvent struct {
+	Event string        `json:"event"`
+	Data  commandOutput `json:"data"`
+}
+
+type commandOutput struct {
+	ID       uint   `json:"id"`
+	DeviceID string `json:"device_id"`
+	Command  string `json:"command"`
+	Data     string `json:"data"`
+	Done     int64  `json:"done"`
+	Total    int64  `json:"total"`
+	EOF      bool   `json:"eof"`
+	Error    string `json:"error"`
+}
+
 type commandResultMsg struct {
 	Result string
 	Error  error
@@ -138,6 +155,7 @@ func (m DeviceDetailModel) Init() tea.Cmd {
 	return tea.Batch(
 		textinput.Blink,
 		m.fetchDir(nil),
+		m.subscribeOutput("admin_subscribe_output"),
 	)
 }
 
@@ -149,7 +167,10 @@ func (m DeviceDetailModel) Update(msg tea.Msg) (DeviceDetailModel, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "esc":
-			return m, func() tea.Msg { return BackToDashboardMsg{} } // Signal to root
+			return m, tea.Batch(
+				m.subscribeOutput("admin_unsubscribe_output"),
+				func() tea.Msg { return BackToDashboardMsg{} }, // Signal to root
+			)
 		case "tab":
 			// Switch focus between Tree and Form
 			if m.Files.Focused() {
@@ -201,7 +222,16 @@ func (m DeviceDetailModel) Update(msg tea.Msg) (DeviceDetailModel, tea.Cmd) {
 			m.LogContent += fmt.Sprintf("\nError: %v", msg.Err)
 			m.CommandLog.SetContent(m.LogContent)
 		} else if msg.Msg != nil {
-			if msg.Msg.Type == network.MsgAck {
+			if msg.Msg.Type == network.MsgCommand {
+				// Live output pushed for a stream command
+				var ev outputEvent
+				if err := json.Unmarshal(msg.Msg.CommandJSON, &ev); err == nil && ev.Event == "command_output" && ev.Data.DeviceID == m.DeviceID {
+					m.LogContent += formatOutput(ev.Data)
+					m.CommandLog.SetContent(m.LogContent)
+					m.CommandLog.GotoBottom()
+					cmds = append(cmds, func() tea.Msg { return tea.WindowSizeMsg{Width: m.Width, Height: m.Height} })
+				}
+			} else if msg.Msg.Type == network.MsgAck {
 				// Check status code for error
 				if msg.Msg.StatusCode != 200 {
 					m.LogContent += fmt.Sprintf("\nError (Server): %s", msg.Msg.StatusMsg)
@@ -221,6 +251,8 @@ func (m DeviceDetailModel) Update(msg tea.Msg) (DeviceDetailModel, tea.Cmd) {
 						m.LogContent += fmt.Sprintf("\nError parsing tree: %v", err)
 						m.CommandLog.SetContent(m.LogContent)
 						m.CommandLog.GotoBottom()
+					} else if strings.Contains(msg.Msg.StatusMsg, "\"devices\":") {
+						// Output subscription ack, nothing to show
 					} else {
 						// Assume command response
 						m.LogContent += fmt.Sprintf("\nResponse: %s", msg.Msg.StatusMsg)
@@ -431,3 +463,26 @@ func (m DeviceDetailModel) sendCommand(cmd string) tea.Cmd {
 		return nil
 	}
 }
+
+// subscribeOutput (un)subscribes this console from live output of the device
+func (m DeviceDetailModel) subscribeOutput(action string) tea.Cmd {
+	return func() tea.Msg {
+		m.Session.SendCommand(action, map[string]interface{}{"device_id": m.DeviceID})
+		return nil
+	}
+}
+
+func formatOutput(o commandOutput) string {
+	prefix := fmt.Sprintf("\n[%s#%d] ", o.Command, o.ID)
+	switch {
+	case o.EOF && o.Error != "":
+		return prefix + "stopped: " + o.Error
+	case o.EOF:
+		return prefix + "stopped"
+	case o.Total > 0:
+		return fmt.Sprintf("%sprogress %d/%d (%d%%)", prefix, o.Done, o.Total, o.Done*100/o.Total)
+	case o.Done > 0:
+		return fmt.Sprintf("%sprogress %d", prefix, o.Done)
+	}
+	return prefix + strings.TrimRight(o.Data, "\n")
+}
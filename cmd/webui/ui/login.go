@@ -132,9 +132,10 @@ func (m LoginModel) LoginCmd() tea.Msg {
 	// Protocol router: if msg.Token != "", it validates. If empty, it accepts?
 	// "login missing device id" if empty.
 
-	tempDeviceID := "admin-console"
-	// Send initial opaque login to get onto the Hub
-	if err := m.Session.Login(tempDeviceID, "initial-handshake"); err != nil {
+	tempDeviceID := m.Session.ConsoleID
+	// Send an unauthenticated login frame to get onto the Hub; only the
+	// "login" action is allowed until the JWT login below
+	if err := m.Session.Login(tempDeviceID, ""); err != nil {
 		return errMsg(fmt.Errorf("initial handshake failed: %v", err))
 	}
 
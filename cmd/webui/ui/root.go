@@ -83,14 +83,18 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if sMsg, ok := msg.(MsgFromServer); ok && sMsg.Msg != nil && sMsg.Msg.Type == network.MsgAck {
 			if sMsg.Msg.StatusCode == 200 {
 				var authResp struct {
-					Token string `json:"token"`
+					Token        string `json:"token"`
+					RefreshToken string `json:"refresh_token"`
 				}
 				if err := json.Unmarshal([]byte(sMsg.Msg.StatusMsg), &authResp); err == nil {
 					// Perform protocol login
-					deviceID := "admin-console"
+					deviceID := m.Session.ConsoleID
 					if err := m.Session.Login(deviceID, authResp.Token); err != nil {
 						m.Login.Err = fmt.Errorf("protocol login failed: %v", err)
+					} else if err := m.Session.Hello(); err != nil {
+						m.Login.Err = fmt.Errorf("protocol hello failed: %v", err)
 					} else {
+						m.Session.StartTokenRefresh(authResp.RefreshToken)
 						// Success! Transition to dashboard
 						m.State = stateDashboard
 						m.Dashboard = NewDashboardModel(m.Session, m.width, m.height)
@@ -0,0 +1,140 @@
+// Package cmdsign định nghĩa định dạng ký Ed25519 cho command backend gửi xuống
+// agent. Backend ký, agent xác thực bằng public key được pin trong config; cả
+// hai phía dùng chung Message để chuỗi được ký luôn khớp nhau.
+package cmdsign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const version = "sagiri-cmd-v1"
+
+// Fields là các trường của command được bao phủ bởi chữ ký.
+type Fields struct {
+	ID        uint
+	DeviceID  string
+	Command   string
+	Kind      string
+	Argument  []byte // JSON đã compact
+	ExpiresAt int64  // hạn của command (0 = không hạn)
+	Nonce     string
+	NotAfter  int64 // hạn của chữ ký (unix)
+}
+
+// Message dựng chuỗi canonical để ký/xác thực. Argument được compact và escape
+// HTML giống encoding/json khi marshal json.RawMessage, nên việc encode lại JSON
+// trên đường truyền không làm hỏng chữ ký.
+func Message(f Fields) ([]byte, error) {
+	var compact, arg bytes.Buffer
+	if len(f.Argument) > 0 {
+		if err := json.Compact(&compact, f.Argument); err != nil {
+			return nil, fmt.Errorf("cmdsign: invalid argument json: %w", err)
+		}
+		json.HTMLEscape(&arg, compact.Bytes())
+	}
+	sum := sha256.Sum256(arg.Bytes())
+	parts := []string{
+		version,
+		strconv.FormatUint(uint64(f.ID), 10),
+		f.DeviceID,
+		f.Command,
+		f.Kind,
+		hex.EncodeToString(sum[:]),
+		strconv.FormatInt(f.ExpiresAt, 10),
+		f.Nonce,
+		strconv.FormatInt(f.NotAfter, 10),
+	}
+	return []byte(strings.Join(parts, "\n")), nil
+}
+
+// Sign trả về chữ ký base64 cho các trường của command.
+func Sign(key ed25519.PrivateKey, f Fields) (string, error) {
+	msg, err := Message(f)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, msg)), nil
+}
+
+// Verify kiểm tra chữ ký base64; chỉ kiểm tra mật mã, không kiểm tra hạn/nonce.
+func Verify(pub ed25519.PublicKey, f Fields, sig string) error {
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil || len(raw) != ed25519.SignatureSize {
+		return errors.New("cmdsign: malformed signature")
+	}
+	msg, err := Message(f)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, msg, raw) {
+		return errors.New("cmdsign: signature mismatch")
+	}
+	return nil
+}
+
+// NewNonce sinh nonce ngẫu nhiên 128 bit.
+func NewNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ParsePublicKey đọc public key dạng base64 (như trong file .pub).
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, errors.New("cmdsign: invalid public key")
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// EncodePublicKey trả về public key dạng base64 để pin vào config agent.
+func EncodePublicKey(pub ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(pub)
+}
+
+// LoadOrCreateKey đọc private key (seed base64) từ path; nếu chưa có thì sinh mới,
+// ghi với quyền 0600 và ghi kèm public key ra path + ".pub".
+func LoadOrCreateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("cmdsign: invalid key file %s", path)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(priv.Seed())+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path+".pub", []byte(EncodePublicKey(pub)+"\n"), 0o644); err != nil {
+		return nil, err
+	}
+	return priv, nil
+}
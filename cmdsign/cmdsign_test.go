@@ -0,0 +1,174 @@
+package cmdsign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testFields() Fields {
+	return Fields{
+		ID:        42,
+		DeviceID:  "dev-1",
+		Command:   "backup_auto",
+		Kind:      "once",
+		Argument:  []byte(`{"enabled":true,"path":"<a&b>"}`),
+		ExpiresAt: 1700000000,
+		Nonce:     "00112233",
+		NotAfter:  1700000300,
+	}
+}
+
+func TestMessageCanonicalArgument(t *testing.T) {
+	base, err := Message(testFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		arg  string
+	}{
+		{"indented", "{\n  \"enabled\": true,\n  \"path\": \"<a&b>\"\n}"},
+		{"html escaped", `{"enabled":true,"path":"\u003ca\u0026b\u003e"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := testFields()
+			f.Argument = []byte(tt.arg)
+			got, err := Message(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, base) {
+				t.Errorf("Message differs for equivalent argument:\n%s\nvs\n%s", got, base)
+			}
+		})
+	}
+
+	f := testFields()
+	f.Argument = []byte(`{"enabled":`)
+	if _, err := Message(f); err == nil {
+		t.Error("Message accepted invalid argument json")
+	}
+	f.Argument = nil
+	if _, err := Message(f); err != nil {
+		t.Errorf("Message without argument: %v", err)
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := Sign(priv, testFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		pub     ed25519.PublicKey
+		mutate  func(*Fields)
+		sig     string
+		wantErr bool
+	}{
+		{name: "valid", pub: pub, sig: sig},
+		{name: "wrong key", pub: otherPub, sig: sig, wantErr: true},
+		{name: "malformed signature", pub: pub, sig: "not-base64!", wantErr: true},
+		{name: "short signature", pub: pub, sig: "AAAA", wantErr: true},
+		{name: "id changed", pub: pub, sig: sig, mutate: func(f *Fields) { f.ID++ }, wantErr: true},
+		{name: "device changed", pub: pub, sig: sig, mutate: func(f *Fields) { f.DeviceID = "dev-2" }, wantErr: true},
+		{name: "command changed", pub: pub, sig: sig, mutate: func(f *Fields) { f.Command = "restore" }, wantErr: true},
+		{name: "kind changed", pub: pub, sig: sig, mutate: func(f *Fields) { f.Kind = "stream" }, wantErr: true},
+		{name: "argument changed", pub: pub, sig: sig, mutate: func(f *Fields) { f.Argument = []byte(`{"enabled":false}`) }, wantErr: true},
+		{name: "argument reformatted", pub: pub, sig: sig, mutate: func(f *Fields) { f.Argument = []byte(`{ "enabled": true, "path": "<a&b>" }`) }},
+		{name: "expiry changed", pub: pub, sig: sig, mutate: func(f *Fields) { f.ExpiresAt = 0 }, wantErr: true},
+		{name: "nonce changed", pub: pub, sig: sig, mutate: func(f *Fields) { f.Nonce = "ff" }, wantErr: true},
+		{name: "not_after changed", pub: pub, sig: sig, mutate: func(f *Fields) { f.NotAfter += 3600 }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := testFields()
+			if tt.mutate != nil {
+				tt.mutate(&f)
+			}
+			err := Verify(tt.pub, f, tt.sig)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadOrCreateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "command_signing.key")
+	priv, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !priv.Equal(again) {
+		t.Error("reloaded key differs from generated key")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode = %v, err = %v; want 0600", info.Mode().Perm(), err)
+	}
+	pubText, err := os.ReadFile(path + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ParsePublicKey(string(pubText))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pub.Equal(priv.Public()) {
+		t.Error(".pub file does not match private key")
+	}
+
+	if err := os.WriteFile(path, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadOrCreateKey(path); err == nil {
+		t.Error("LoadOrCreateKey accepted an invalid key file")
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{"valid", EncodePublicKey(pub), false},
+		{"surrounding whitespace", "  " + EncodePublicKey(pub) + "\n", false},
+		{"empty", "", true},
+		{"not base64", "%%%", true},
+		{"wrong length", "AAAA", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePublicKey(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePublicKey error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(pub) {
+				t.Error("parsed key differs")
+			}
+		})
+	}
+}
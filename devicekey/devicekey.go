@@ -0,0 +1,36 @@
+// Package devicekey định nghĩa challenge-response chứng minh danh tính device.
+// Agent sinh cặp key Ed25519 lúc enroll và gửi public key cùng fingerprint phần
+// cứng cho backend; mỗi kết nối sau đó ký nonce do backend cấp. Hai phía dùng
+// chung Message để chuỗi được ký luôn khớp nhau. Lưu/đọc key dùng lại cmdsign.
+package devicekey
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+const version = "sagiri-device-v1"
+
+// Message dựng chuỗi canonical để ký/xác thực một challenge.
+func Message(deviceID, nonce, fingerprint string) []byte {
+	return []byte(strings.Join([]string{version, deviceID, nonce, fingerprint}, "\n"))
+}
+
+// Sign trả về chữ ký base64 của device cho challenge.
+func Sign(key ed25519.PrivateKey, deviceID, nonce, fingerprint string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, Message(deviceID, nonce, fingerprint)))
+}
+
+// Verify kiểm tra chữ ký base64; nonce có còn hiệu lực do caller kiểm tra.
+func Verify(pub ed25519.PublicKey, deviceID, nonce, fingerprint, sig string) error {
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil || len(raw) != ed25519.SignatureSize {
+		return errors.New("devicekey: malformed signature")
+	}
+	if !ed25519.Verify(pub, Message(deviceID, nonce, fingerprint), raw) {
+		return errors.New("devicekey: signature mismatch")
+	}
+	return nil
+}
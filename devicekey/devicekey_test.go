@@ -0,0 +1,56 @@
+package devicekey
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := Sign(key, "dev-1", "nonce-1", "fp-1")
+
+	tests := []struct {
+		name        string
+		pub         ed25519.PublicKey
+		deviceID    string
+		nonce       string
+		fingerprint string
+		sig         string
+		wantErr     bool
+	}{
+		{name: "valid", pub: pub, deviceID: "dev-1", nonce: "nonce-1", fingerprint: "fp-1", sig: sig},
+		{name: "other key", pub: otherPub, deviceID: "dev-1", nonce: "nonce-1", fingerprint: "fp-1", sig: sig, wantErr: true},
+		{name: "other device", pub: pub, deviceID: "dev-2", nonce: "nonce-1", fingerprint: "fp-1", sig: sig, wantErr: true},
+		{name: "replayed for another nonce", pub: pub, deviceID: "dev-1", nonce: "nonce-2", fingerprint: "fp-1", sig: sig, wantErr: true},
+		{name: "fingerprint changed", pub: pub, deviceID: "dev-1", nonce: "nonce-1", fingerprint: "fp-2", sig: sig, wantErr: true},
+		{name: "not base64", pub: pub, deviceID: "dev-1", nonce: "nonce-1", fingerprint: "fp-1", sig: "!!", wantErr: true},
+		{name: "truncated", pub: pub, deviceID: "dev-1", nonce: "nonce-1", fingerprint: "fp-1", sig: base64.StdEncoding.EncodeToString([]byte("short")), wantErr: true},
+		{name: "empty", pub: pub, deviceID: "dev-1", nonce: "nonce-1", fingerprint: "fp-1", sig: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.pub, tt.deviceID, tt.nonce, tt.fingerprint, tt.sig)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMessageFieldsSeparated(t *testing.T) {
+	// Ghép field bằng newline nên dịch ranh giới giữa các field phải ra message khác
+	a := string(Message("dev", "1nonce", "fp"))
+	b := string(Message("dev1", "nonce", "fp"))
+	if a == b {
+		t.Fatalf("Message collides across field boundary: %q", a)
+	}
+}
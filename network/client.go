@@ -8,6 +8,9 @@ import "C"
 
 import (
 	"errors"
+	"net"
+	"strconv"
+	"syscall"
 	"unsafe"
 )
 
@@ -56,6 +59,42 @@ func (c *TCPClient) Equal(other *TCPClient) bool {
 	return c.fd == other.fd
 }
 
+// RemoteAddr returns the peer address ("ip:port") of the socket, or "" when unknown.
+func (c *TCPClient) RemoteAddr() string {
+	if c == nil || c.fd == C.INVALID_SOCKET {
+		return ""
+	}
+	sa, err := syscall.Getpeername(int(c.fd))
+	if err != nil {
+		return ""
+	}
+	switch a := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return net.JoinHostPort(net.IP(a.Addr[:]).String(), strconv.Itoa(a.Port))
+	case *syscall.SockaddrInet6:
+		return net.JoinHostPort(net.IP(a.Addr[:]).String(), strconv.Itoa(a.Port))
+	}
+	return ""
+}
+
+// ConnID returns an identifier that is unique among currently open connections
+// (the socket descriptor), or -1 when the client is closed.
+func (c *TCPClient) ConnID() int64 {
+	if c == nil || c.fd == C.INVALID_SOCKET {
+		return -1
+	}
+	return int64(c.fd)
+}
+
+// Shutdown stops both directions of the socket without releasing the descriptor,
+// so the goroutine or C thread blocked in a read on it returns and cleans up normally.
+func (c *TCPClient) Shutdown() error {
+	if c == nil || c.fd == C.INVALID_SOCKET {
+		return errors.New("client not open")
+	}
+	return syscall.Shutdown(int(c.fd), syscall.SHUT_RDWR)
+}
+
 // Write sends data over the TCP connection
 func (c *TCPClient) Write(data []byte) (int, error) {
 	if c == nil || c.fd == C.INVALID_SOCKET {
@@ -62,7 +62,8 @@ int protocol_send_login(SOCKET fd, const char* device_id, const char* token) {
     if (device_len == 0 || device_len > PROTOCOL_MAX_DEVICE_ID) {
         return -1;
     }
-    if (token_len == 0 || token_len > PROTOCOL_MAX_TOKEN) {
+    // Empty token is allowed: the backend registers an unauthenticated connection
+    if (token_len > PROTOCOL_MAX_TOKEN) {
         return -1;
     }
 
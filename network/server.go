@@ -168,30 +168,3 @@ func (s *ProtocolServer) Close() error {
 	protocolDisconnectHandler = nil
 	return nil
 }
-
-// DeviceIsOnline queries C-side registry to check if a device has an active protocol connection.
-func DeviceIsOnline(deviceID string) bool {
-	if deviceID == "" {
-		return false
-	}
-	cDev := C.CString(deviceID)
-	defer C.free(unsafe.Pointer(cDev))
-	return C.protocol_device_is_online(cDev) != 0
-}
-
-// SendToDevice uses server-side registry (managed in C) to push a command JSON to a device.
-// This works only for connections handled by the protocol server (not for ad-hoc DialTCP).
-func SendToDevice(deviceID string, jsonPayload []byte) error {
-	if deviceID == "" {
-		return errors.New("device id required")
-	}
-	if len(jsonPayload) == 0 {
-		return errors.New("empty payload")
-	}
-	cDev := C.CString(deviceID)
-	defer C.free(unsafe.Pointer(cDev))
-	if C.protocol_send_to_device(cDev, (*C.char)(unsafe.Pointer(&jsonPayload[0])), C.size_t(len(jsonPayload))) != 0 {
-		return errors.New("send to device failed")
-	}
-	return nil
-}